@@ -42,9 +42,18 @@ var ErrNotIndexed = errors.New("pebble: batch not indexed")
 // ErrInvalidBatch indicates that a batch is invalid or otherwise corrupted.
 var ErrInvalidBatch = errors.New("pebble: invalid batch")
 
-// ErrBatchTooLarge indicates that a batch is invalid or otherwise corrupted.
+// ErrBatchTooLarge indicates that a batch exceeds the maximum batch size of
+// 4GB, or Options.Experimental.MaxBatchSize.
 var ErrBatchTooLarge = errors.Newf("pebble: batch too large: >= %s", humanize.Uint64(maxBatchSize))
 
+// ErrKeyTooLarge indicates that the commit of a batch failed because one of
+// its keys exceeds Options.Experimental.MaxKeySize.
+var ErrKeyTooLarge = errors.New("pebble: key too large")
+
+// ErrValueTooLarge indicates that the commit of a batch failed because one of
+// its values exceeds Options.Experimental.MaxValueSize.
+var ErrValueTooLarge = errors.New("pebble: value too large")
+
 // DeferredBatchOp represents a batch operation (eg. set, merge, delete) that is
 // being inserted into the batch. Indexing is not performed on the specified key
 // until Finish is called, hence the name deferred. This struct lets the caller
@@ -164,12 +173,18 @@ func (d DeferredBatchOp) Finish() error {
 //	InternalKeyKindDelete         varstring
 //	InternalKeyKindLogData        varstring
 //	InternalKeyKindIngestSST      varstring
+//	InternalKeyKindCommitTxn      varstring
+//	InternalKeyKindRollbackTxn    varstring
+//	InternalKeyKindBatchChunk     varstring
+//	InternalKeyKindCommitChunks   varstring
+//	InternalKeyKindIdempotencyToken varstring
 //	InternalKeyKindSet            varstring varstring
 //	InternalKeyKindMerge          varstring varstring
 //	InternalKeyKindRangeDelete    varstring varstring
 //	InternalKeyKindRangeKeySet    varstring varstring
 //	InternalKeyKindRangeKeyUnset  varstring varstring
 //	InternalKeyKindRangeKeyDelete varstring varstring
+//	InternalKeyKindPrepareTxn     varstring varstring
 //
 // The intuitive understanding here are that the arguments to Delete, Set,
 // Merge, DeleteRange and RangeKeyDelete are encoded into the batch. The
@@ -264,6 +279,15 @@ type Batch struct {
 	// then it will only contain key kinds of IngestSST.
 	ingestedSSTBatch bool
 
+	// txnMarker indicates that the batch begins with a two-phase commit marker
+	// of kind InternalKeyKindPrepareTxn, InternalKeyKindCommitTxn or
+	// InternalKeyKindRollbackTxn.
+	txnMarker bool
+
+	// idempotencyTokens indicates that the batch contains records of kind
+	// InternalKeyKindIdempotencyToken.
+	idempotencyTokens bool
+
 	// Synchronous Apply uses the commit WaitGroup for both publishing the
 	// seqnum and waiting for the WAL fsync (if needed). Asynchronous
 	// ApplyNoSyncWait, which implies WriteOptions.Sync is true, uses the commit
@@ -377,8 +401,12 @@ func (b *Batch) refreshMemTableSize() {
 			b.countRangeDels++
 		case InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete:
 			b.countRangeKeys++
-		case InternalKeyKindIngestSST:
-			// This key kind doesn't contribute to the memtable size.
+		case InternalKeyKindIdempotencyToken:
+			b.idempotencyTokens = true
+			continue
+		case InternalKeyKindIngestSST, InternalKeyKindPrepareTxn, InternalKeyKindCommitTxn,
+			InternalKeyKindRollbackTxn, InternalKeyKindBatchChunk, InternalKeyKindCommitChunks:
+			// These key kinds don't contribute to the memtable size.
 			continue
 		}
 		b.memTableSize += memTableEntrySize(len(key), len(value))
@@ -407,6 +435,9 @@ func (b *Batch) Apply(batch *Batch, _ *WriteOptions) error {
 	b.data = append(b.data, batch.data[batchHeaderLen:]...)
 
 	b.setCount(b.Count() + batch.Count())
+	if batch.idempotencyTokens {
+		b.idempotencyTokens = true
+	}
 
 	if b.db != nil || b.index != nil {
 		// Only iterate over the new entries if we need to track memTableSize or in
@@ -424,6 +455,10 @@ func (b *Batch) Apply(batch *Batch, _ *WriteOptions) error {
 				b.countRangeKeys++
 			case InternalKeyKindIngestSST:
 				panic("pebble: invalid key kind for batch")
+			case InternalKeyKindIdempotencyToken:
+				// Idempotency tokens aren't indexed, nor added to the memtable.
+				b.idempotencyTokens = true
+				continue
 			}
 			if b.index != nil {
 				var err error
@@ -829,6 +864,109 @@ func (b *Batch) LogData(data []byte, _ *WriteOptions) error {
 	return nil
 }
 
+// AddIdempotencyToken adds the idempotency token to the batch. The token will
+// be written to the WAL along with the batch, but not added to memtables or
+// sstables. Once the batch is committed, the token is reported by
+// DB.IdempotencyTokenCommitted, including after reopening the DB, which
+// allows producers that may retry a write to check whether it was already
+// applied. A batch may carry several tokens.
+//
+// The DB only retains the Options.Experimental.MaxIdempotencyTokens most
+// recently committed tokens, up to a total size of MaxIdempotencyTokensSize
+// bytes. Idempotency tokens are only supported if the WAL is enabled, require
+// a format major version of at least FormatIdempotencyTokens, and aren't
+// supported by Batch.CommitChunked.
+//
+// It is safe to modify the contents of the argument after AddIdempotencyToken
+// returns.
+func (b *Batch) AddIdempotencyToken(token []byte) error {
+	if b.ingestedSSTBatch || b.txnMarker {
+		panic("pebble: invalid call to AddIdempotencyToken")
+	}
+	if b.db != nil {
+		if err := b.db.checkIdempotencyTokens(); err != nil {
+			return err
+		}
+	}
+	if len(token) == 0 {
+		return errors.New("pebble: idempotency token must not be empty")
+	}
+	if b.db != nil && len(token) > b.db.opts.Experimental.MaxIdempotencyTokensSize {
+		return errors.Newf("pebble: idempotency token size %d exceeds the maximum of %d",
+			errors.Safe(len(token)), errors.Safe(b.db.opts.Experimental.MaxIdempotencyTokensSize))
+	}
+	origCount, origMemTableSize := b.count, b.memTableSize
+	b.prepareDeferredKeyRecord(len(token), InternalKeyKindIdempotencyToken)
+	copy(b.deferredOp.Key, token)
+	// Like LogData, the token isn't added to the memtable, so we restore
+	// b.count and b.memTableSize.
+	b.count, b.memTableSize = origCount, origMemTableSize
+	b.idempotencyTokens = true
+	return nil
+}
+
+// prepareTxn adds the prepare record of the transaction txnID to the empty
+// batch, which contains the repr of the prepared batch. The data will only be
+// written to the WAL (not added to memtables or sstables).
+func (b *Batch) prepareTxn(txnID []byte, repr []byte) {
+	b.txnMarkerRecord(InternalKeyKindPrepareTxn, txnID, repr)
+}
+
+// commitTxn adds the commit record of the transaction txnID to the empty
+// batch. The data will only be written to the WAL (not added to memtables or
+// sstables).
+func (b *Batch) commitTxn(txnID []byte) {
+	b.txnMarkerRecord(InternalKeyKindCommitTxn, txnID, nil)
+}
+
+// rollbackTxn adds the rollback record of the transaction txnID to the empty
+// batch. The data will only be written to the WAL (not added to memtables or
+// sstables).
+func (b *Batch) rollbackTxn(txnID []byte) {
+	b.txnMarkerRecord(InternalKeyKindRollbackTxn, txnID, nil)
+}
+
+func (b *Batch) txnMarkerRecord(kind InternalKeyKind, txnID []byte, value []byte) {
+	if !b.Empty() {
+		// A two-phase commit marker must be the first record of a batch.
+		panic("pebble: invalid two-phase commit marker")
+	}
+	b.txnMarker = true
+	if kind == InternalKeyKindPrepareTxn {
+		b.prepareDeferredKeyValueRecord(len(txnID), len(value), kind)
+		copy(b.deferredOp.Value, value)
+	} else {
+		b.prepareDeferredKeyRecord(len(txnID), kind)
+	}
+	copy(b.deferredOp.Key, txnID)
+	// Like LogData, the markers aren't added to the memtable, so we restore
+	// b.count and b.memTableSize.
+	b.count, b.memTableSize = 0, 0
+}
+
+// batchChunk adds the marker beginning a chunk of a batch committed by
+// Batch.CommitChunked to the empty batch. The data will only be written to the
+// WAL (not added to memtables or sstables).
+func (b *Batch) batchChunk() {
+	b.chunkMarkerRecord(InternalKeyKindBatchChunk)
+}
+
+// commitChunks adds the marker committing the chunks of a batch committed by
+// Batch.CommitChunked to the empty batch. The data will only be written to the
+// WAL (not added to memtables or sstables).
+func (b *Batch) commitChunks() {
+	b.chunkMarkerRecord(InternalKeyKindCommitChunks)
+}
+
+func (b *Batch) chunkMarkerRecord(kind InternalKeyKind) {
+	if !b.Empty() {
+		// A chunked commit marker must be the first record of a batch.
+		panic("pebble: invalid chunked commit marker")
+	}
+	b.prepareDeferredKeyRecord(0, kind)
+	b.count, b.memTableSize = 0, 0
+}
+
 // IngestSST adds the FileNum for an sstable to the batch. The data will only be
 // written to the WAL (not added to memtables or sstables).
 func (b *Batch) ingestSST(fileNum base.FileNum) {
@@ -1148,6 +1286,8 @@ func (b *Batch) Reset() {
 	b.rangeKeys = nil
 	b.rangeKeysSeqNum = 0
 	b.flushable = nil
+	b.txnMarker = false
+	b.idempotencyTokens = false
 	b.commit = sync.WaitGroup{}
 	b.fsyncWait = sync.WaitGroup{}
 	b.commitErr = nil
@@ -1282,7 +1422,9 @@ type BatchReader []byte
 
 // ReadBatch constructs a BatchReader from a batch representation.  The
 // header is not validated. ReadBatch returns a new batch reader and the
-// count of entries contained within the batch.
+// count of entries contained within the batch. Consumers of batch
+// representations from outside the DB, such as the WAL or the network, should
+// use the batchrepr package instead, which validates its input.
 func ReadBatch(repr []byte) (r BatchReader, count uint32) {
 	if len(repr) <= batchHeaderLen {
 		return nil, count
@@ -1307,7 +1449,8 @@ func (r *BatchReader) Next() (kind InternalKeyKind, ukey []byte, value []byte, o
 	}
 	switch kind {
 	case InternalKeyKindSet, InternalKeyKindMerge, InternalKeyKindRangeDelete,
-		InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete:
+		InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete,
+		InternalKeyKindPrepareTxn:
 		*r, value, ok = batchDecodeStr(*r)
 		if !ok {
 			return 0, nil, nil, false
@@ -1558,6 +1701,12 @@ func newFlushableBatch(batch *Batch, comparer *Comparer) *flushableBatch {
 				rangeDelOffsets = append(rangeDelOffsets, entry)
 			case InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete:
 				rangeKeyOffsets = append(rangeKeyOffsets, entry)
+			case InternalKeyKindPrepareTxn, InternalKeyKindCommitTxn, InternalKeyKindRollbackTxn,
+				InternalKeyKindBatchChunk, InternalKeyKindCommitChunks, InternalKeyKindIdempotencyToken:
+				// Two-phase commit and chunked commit markers and idempotency
+				// tokens are only written to the WAL, and don't consume a
+				// sequence number.
+				index--
 			default:
 				b.offsets = append(b.offsets, entry)
 			}
@@ -0,0 +1,318 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package batchrepr provides functionality for decoding the representation of
+// a batch, as returned by Batch.Repr, written to the WAL and accepted by
+// Batch.SetRepr. It allows consumers of the WAL or of batches sent over the
+// network, e.g. replication layers, to decode batches without depending on the
+// internals of the pebble package.
+//
+// The representation is a 12-byte header, holding the sequence number of the
+// batch's first record (8 bytes, little-endian; zero if the batch hasn't been
+// committed) and the record count (4 bytes, little-endian). The header is
+// followed by a series of records, each a 1-byte kind tag followed by one or
+// two varstrings (a uvarint length followed by that many bytes). The kind tags
+// are exactly those specified by InternalKeyKind. The representation is the
+// on-disk format of a batch in the WAL, and thus it is stable: new record
+// kinds may be added, but the existing ones will not be modified.
+//
+// A WAL written with Options.WALCipher holds sealed batch representations,
+// which must be opened before they're decoded.
+package batchrepr
+
+import (
+	"encoding/binary"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/keyspan"
+	"github.com/cockroachdb/pebble/internal/rangekey"
+)
+
+// HeaderLen is the length of the header of a batch representation.
+const HeaderLen = 12
+
+// InternalKeyKind exports the base.InternalKeyKind type.
+type InternalKeyKind = base.InternalKeyKind
+
+// Header is the header of a batch representation.
+type Header struct {
+	// SeqNum is the sequence number assigned to the first record of the batch,
+	// or zero if the batch hasn't been committed. The records that are
+	// applied to the memtable are assigned successive sequence numbers.
+	SeqNum uint64
+	// Count is the number of records of the batch that are applied to the
+	// memtable. Records such as LogData don't contribute to the count.
+	Count uint32
+}
+
+// ReadHeader reads the header of a batch representation. It returns false if
+// the representation is too short to hold a header.
+func ReadHeader(repr []byte) (h Header, ok bool) {
+	if len(repr) < HeaderLen {
+		return Header{}, false
+	}
+	h.SeqNum = binary.LittleEndian.Uint64(repr[:8])
+	h.Count = binary.LittleEndian.Uint32(repr[8:HeaderLen])
+	return h, true
+}
+
+// Reader iterates over the records of a batch representation, without their
+// header.
+type Reader []byte
+
+// Read returns a Reader over the records of the batch representation, along
+// with its header. It returns false if the representation is too short to
+// hold a header.
+func Read(repr []byte) (r Reader, h Header, ok bool) {
+	if h, ok = ReadHeader(repr); !ok {
+		return nil, Header{}, false
+	}
+	return Reader(repr[HeaderLen:]), h, true
+}
+
+// Next returns the next record of the batch. The key and value alias the
+// batch representation. The value is nil for the record kinds encoded with a
+// single varstring. The final return value is false if the batch is corrupt.
+// The end of the batch is reached when len(r) == 0.
+func (r *Reader) Next() (kind InternalKeyKind, key []byte, value []byte, ok bool) {
+	if len(*r) == 0 {
+		return 0, nil, nil, false
+	}
+	kind = InternalKeyKind((*r)[0])
+	if kind > base.InternalKeyKindMax {
+		return 0, nil, nil, false
+	}
+	data := (*r)[1:]
+	if key, data, ok = decodeVarstring(data); !ok {
+		return 0, nil, nil, false
+	}
+	if hasValue(kind) {
+		if value, data, ok = decodeVarstring(data); !ok {
+			return 0, nil, nil, false
+		}
+	}
+	*r = data
+	return kind, key, value, true
+}
+
+// hasValue returns true if the records of the kind are encoded with a second
+// varstring.
+func hasValue(kind InternalKeyKind) bool {
+	switch kind {
+	case base.InternalKeyKindSet, base.InternalKeyKindMerge, base.InternalKeyKindRangeDelete,
+		base.InternalKeyKindRangeKeySet, base.InternalKeyKindRangeKeyUnset,
+		base.InternalKeyKindRangeKeyDelete, base.InternalKeyKindPrepareTxn:
+		return true
+	}
+	return false
+}
+
+func decodeVarstring(data []byte) (s, rest []byte, ok bool) {
+	v, n := binary.Uvarint(data)
+	if n <= 0 || v > uint64(len(data)-n) {
+		return nil, nil, false
+	}
+	data = data[n:]
+	return data[:v], data[v:], true
+}
+
+// Visitor receives the records of a batch representation decoded by Decode.
+// The byte slices passed to its methods alias the batch representation, and
+// must be copied to be retained. If a method returns an error, Decode stops
+// and returns that error.
+//
+// New methods may be added to Visitor as record kinds are added to the
+// representation. Embed NopVisitor to ignore the records of the kinds a
+// visitor isn't interested in.
+type Visitor interface {
+	// Set is called for a record written by Batch.Set.
+	Set(key, value []byte) error
+	// Merge is called for a record written by Batch.Merge.
+	Merge(key, value []byte) error
+	// Delete is called for a record written by Batch.Delete.
+	Delete(key []byte) error
+	// SingleDelete is called for a record written by Batch.SingleDelete.
+	SingleDelete(key []byte) error
+	// DeleteRange is called for a record written by Batch.DeleteRange.
+	DeleteRange(start, end []byte) error
+	// RangeKeySet is called for every suffix of a record written by
+	// Batch.RangeKeySet. Records coalescing several suffixes result in a call
+	// per suffix.
+	RangeKeySet(start, end, suffix, value []byte) error
+	// RangeKeyUnset is called for every suffix of a record written by
+	// Batch.RangeKeyUnset.
+	RangeKeyUnset(start, end, suffix []byte) error
+	// RangeKeyDelete is called for a record written by Batch.RangeKeyDelete.
+	RangeKeyDelete(start, end []byte) error
+	// LogData is called for a record written by Batch.LogData.
+	LogData(data []byte) error
+	// IngestSST is called for the records of the batch written to the WAL
+	// when sstables are ingested as flushables, one per sstable.
+	IngestSST(fileNum uint64) error
+	// PrepareTxn is called for the record written by Batch.Prepare, holding
+	// the representation of the prepared batch. The prepared batch isn't
+	// applied unless the transaction is committed.
+	PrepareTxn(txnID, repr []byte) error
+	// CommitTxn is called for the marker written by DB.CommitPrepared. The
+	// records of the committed batch follow the marker.
+	CommitTxn(txnID []byte) error
+	// RollbackTxn is called for the record written by DB.RollbackPrepared.
+	RollbackTxn(txnID []byte) error
+	// BatchChunk is called for the marker beginning each chunk of a batch
+	// committed by Batch.CommitChunked. The records of the chunk follow the
+	// marker.
+	BatchChunk() error
+	// CommitChunks is called for the marker committing the preceding chunks
+	// of a batch committed by Batch.CommitChunked. Chunks that aren't
+	// followed by the marker aren't committed.
+	CommitChunks() error
+	// IdempotencyToken is called for a record written by
+	// Batch.AddIdempotencyToken. The batches beginning new WALs also hold the
+	// tokens retained by the DB.
+	IdempotencyToken(token []byte) error
+}
+
+// Decode decodes the batch representation, calling the visitor's methods for
+// its records in order. It returns an error marked as a corruption error if
+// the representation is malformed.
+func Decode(repr []byte, v Visitor) error {
+	r, _, ok := Read(repr)
+	if !ok {
+		if len(repr) == 0 {
+			return nil
+		}
+		return base.CorruptionErrorf("pebble: invalid batch")
+	}
+	var keys []keyspan.Key
+	for len(r) > 0 {
+		offset := len(repr) - len(r)
+		kind, key, value, ok := r.Next()
+		if !ok {
+			return base.CorruptionErrorf("pebble: invalid batch record at offset %d", errors.Safe(offset))
+		}
+		var err error
+		switch kind {
+		case base.InternalKeyKindSet:
+			err = v.Set(key, value)
+		case base.InternalKeyKindMerge:
+			err = v.Merge(key, value)
+		case base.InternalKeyKindDelete:
+			err = v.Delete(key)
+		case base.InternalKeyKindSingleDelete:
+			err = v.SingleDelete(key)
+		case base.InternalKeyKindRangeDelete:
+			err = v.DeleteRange(key, value)
+		case base.InternalKeyKindRangeKeySet, base.InternalKeyKindRangeKeyUnset,
+			base.InternalKeyKindRangeKeyDelete:
+			var s keyspan.Span
+			s, err = rangekey.Decode(base.MakeInternalKey(key, 0, kind), value, keys[:0])
+			if err != nil {
+				return err
+			}
+			keys = s.Keys
+			err = visitRangeKeys(v, kind, s)
+		case base.InternalKeyKindLogData:
+			err = v.LogData(key)
+		case base.InternalKeyIngestSST:
+			fileNum, n := binary.Uvarint(key)
+			if n <= 0 || n != len(key) {
+				return base.CorruptionErrorf("pebble: invalid ingested sstable record at offset %d",
+					errors.Safe(offset))
+			}
+			err = v.IngestSST(fileNum)
+		case base.InternalKeyKindPrepareTxn:
+			err = v.PrepareTxn(key, value)
+		case base.InternalKeyKindCommitTxn:
+			err = v.CommitTxn(key)
+		case base.InternalKeyKindRollbackTxn:
+			err = v.RollbackTxn(key)
+		case base.InternalKeyKindBatchChunk:
+			err = v.BatchChunk()
+		case base.InternalKeyKindCommitChunks:
+			err = v.CommitChunks()
+		case base.InternalKeyKindIdempotencyToken:
+			err = v.IdempotencyToken(key)
+		default:
+			return base.CorruptionErrorf("pebble: unexpected %s record in batch at offset %d",
+				kind, errors.Safe(offset))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func visitRangeKeys(v Visitor, kind InternalKeyKind, s keyspan.Span) error {
+	for _, k := range s.Keys {
+		var err error
+		switch kind {
+		case base.InternalKeyKindRangeKeySet:
+			err = v.RangeKeySet(s.Start, s.End, k.Suffix, k.Value)
+		case base.InternalKeyKindRangeKeyUnset:
+			err = v.RangeKeyUnset(s.Start, s.End, k.Suffix)
+		case base.InternalKeyKindRangeKeyDelete:
+			err = v.RangeKeyDelete(s.Start, s.End)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NopVisitor is a Visitor ignoring all records. It may be embedded in visitors
+// only interested in some of the record kinds.
+type NopVisitor struct{}
+
+var _ Visitor = NopVisitor{}
+
+// Set implements Visitor.
+func (NopVisitor) Set(key, value []byte) error { return nil }
+
+// Merge implements Visitor.
+func (NopVisitor) Merge(key, value []byte) error { return nil }
+
+// Delete implements Visitor.
+func (NopVisitor) Delete(key []byte) error { return nil }
+
+// SingleDelete implements Visitor.
+func (NopVisitor) SingleDelete(key []byte) error { return nil }
+
+// DeleteRange implements Visitor.
+func (NopVisitor) DeleteRange(start, end []byte) error { return nil }
+
+// RangeKeySet implements Visitor.
+func (NopVisitor) RangeKeySet(start, end, suffix, value []byte) error { return nil }
+
+// RangeKeyUnset implements Visitor.
+func (NopVisitor) RangeKeyUnset(start, end, suffix []byte) error { return nil }
+
+// RangeKeyDelete implements Visitor.
+func (NopVisitor) RangeKeyDelete(start, end []byte) error { return nil }
+
+// LogData implements Visitor.
+func (NopVisitor) LogData(data []byte) error { return nil }
+
+// IngestSST implements Visitor.
+func (NopVisitor) IngestSST(fileNum uint64) error { return nil }
+
+// PrepareTxn implements Visitor.
+func (NopVisitor) PrepareTxn(txnID, repr []byte) error { return nil }
+
+// CommitTxn implements Visitor.
+func (NopVisitor) CommitTxn(txnID []byte) error { return nil }
+
+// RollbackTxn implements Visitor.
+func (NopVisitor) RollbackTxn(txnID []byte) error { return nil }
+
+// BatchChunk implements Visitor.
+func (NopVisitor) BatchChunk() error { return nil }
+
+// CommitChunks implements Visitor.
+func (NopVisitor) CommitChunks() error { return nil }
+
+// IdempotencyToken implements Visitor.
+func (NopVisitor) IdempotencyToken(token []byte) error { return nil }
@@ -0,0 +1,255 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package batchrepr_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/datadriven"
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/batchrepr"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/record"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+// printingVisitor prints the records it visits.
+type printingVisitor struct {
+	buf strings.Builder
+}
+
+var _ batchrepr.Visitor = (*printingVisitor)(nil)
+
+func (v *printingVisitor) printf(format string, args ...interface{}) error {
+	fmt.Fprintf(&v.buf, format+"\n", args...)
+	return nil
+}
+
+func (v *printingVisitor) Set(key, value []byte) error {
+	return v.printf("set %s %s", key, value)
+}
+func (v *printingVisitor) Merge(key, value []byte) error {
+	return v.printf("merge %s %s", key, value)
+}
+func (v *printingVisitor) Delete(key []byte) error {
+	return v.printf("del %s", key)
+}
+func (v *printingVisitor) SingleDelete(key []byte) error {
+	return v.printf("singledel %s", key)
+}
+func (v *printingVisitor) DeleteRange(start, end []byte) error {
+	return v.printf("del-range %s %s", start, end)
+}
+func (v *printingVisitor) RangeKeySet(start, end, suffix, value []byte) error {
+	return v.printf("range-key-set %s %s %s %s", start, end, suffix, value)
+}
+func (v *printingVisitor) RangeKeyUnset(start, end, suffix []byte) error {
+	return v.printf("range-key-unset %s %s %s", start, end, suffix)
+}
+func (v *printingVisitor) RangeKeyDelete(start, end []byte) error {
+	return v.printf("range-key-del %s %s", start, end)
+}
+func (v *printingVisitor) LogData(data []byte) error {
+	return v.printf("log-data %s", data)
+}
+func (v *printingVisitor) IngestSST(fileNum uint64) error {
+	return v.printf("ingest-sst %d", fileNum)
+}
+func (v *printingVisitor) PrepareTxn(txnID, repr []byte) error {
+	v.printf("prepare-txn %s", txnID)
+	return batchrepr.Decode(repr, v)
+}
+func (v *printingVisitor) CommitTxn(txnID []byte) error {
+	return v.printf("commit-txn %s", txnID)
+}
+func (v *printingVisitor) RollbackTxn(txnID []byte) error {
+	return v.printf("rollback-txn %s", txnID)
+}
+func (v *printingVisitor) BatchChunk() error {
+	return v.printf("batch-chunk")
+}
+func (v *printingVisitor) CommitChunks() error {
+	return v.printf("commit-chunks")
+}
+func (v *printingVisitor) IdempotencyToken(token []byte) error {
+	return v.printf("idempotency-token %s", token)
+}
+
+func TestDecode(t *testing.T) {
+	datadriven.RunTest(t, "testdata/decode", func(t *testing.T, td *datadriven.TestData) string {
+		switch td.Cmd {
+		case "decode":
+			b := new(pebble.Batch)
+			for _, line := range strings.Split(td.Input, "\n") {
+				f := strings.Fields(line)
+				arg := func(i int) []byte {
+					if i >= len(f) {
+						return nil
+					}
+					return []byte(f[i])
+				}
+				var err error
+				switch f[0] {
+				case "set":
+					err = b.Set(arg(1), arg(2), nil)
+				case "merge":
+					err = b.Merge(arg(1), arg(2), nil)
+				case "del":
+					err = b.Delete(arg(1), nil)
+				case "singledel":
+					err = b.SingleDelete(arg(1), nil)
+				case "del-range":
+					err = b.DeleteRange(arg(1), arg(2), nil)
+				case "range-key-set":
+					err = b.RangeKeySet(arg(1), arg(2), arg(3), arg(4), nil)
+				case "range-key-unset":
+					err = b.RangeKeyUnset(arg(1), arg(2), arg(3), nil)
+				case "range-key-del":
+					err = b.RangeKeyDelete(arg(1), arg(2), nil)
+				case "log-data":
+					err = b.LogData(arg(1), nil)
+				case "idempotency-token":
+					err = b.AddIdempotencyToken(arg(1))
+				default:
+					return fmt.Sprintf("unknown op: %s", f[0])
+				}
+				if err != nil {
+					return err.Error()
+				}
+			}
+			h, ok := batchrepr.ReadHeader(b.Repr())
+			require.True(t, ok)
+			v := &printingVisitor{}
+			v.printf("count: %d", h.Count)
+			if err := batchrepr.Decode(b.Repr(), v); err != nil {
+				return err.Error()
+			}
+			return v.buf.String()
+
+		default:
+			return fmt.Sprintf("unknown command: %s", td.Cmd)
+		}
+	})
+}
+
+// TestDecodeWAL decodes the batches read from a WAL, including the markers
+// written by two-phase and chunked commits and the idempotency tokens.
+func TestDecodeWAL(t *testing.T) {
+	fs := vfs.NewMem()
+	d, err := pebble.Open("", &pebble.Options{
+		FS:                 fs,
+		FormatMajorVersion: pebble.FormatNewest,
+	})
+	require.NoError(t, err)
+
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, b.Prepare([]byte("txn1"), pebble.Sync))
+	require.NoError(t, d.CommitPrepared([]byte("txn1"), pebble.Sync))
+	b = d.NewBatch()
+	require.NoError(t, b.Delete([]byte("b"), nil))
+	require.NoError(t, b.Prepare([]byte("txn2"), pebble.Sync))
+	require.NoError(t, d.RollbackPrepared([]byte("txn2"), pebble.Sync))
+	b = d.NewBatch()
+	require.NoError(t, b.Set([]byte("c"), []byte("3"), nil))
+	require.NoError(t, b.CommitChunked())
+	require.NoError(t, b.Close())
+	b = d.NewBatch()
+	require.NoError(t, b.Set([]byte("d"), []byte("4"), nil))
+	require.NoError(t, b.AddIdempotencyToken([]byte("token1")))
+	require.NoError(t, d.Apply(b, pebble.Sync))
+	require.NoError(t, d.Close())
+
+	var logs []string
+	var logNum base.FileNum
+	ls, err := fs.List("")
+	require.NoError(t, err)
+	for _, name := range ls {
+		if fileType, fileNum, ok := base.ParseFilename(fs, name); ok && fileType == base.FileTypeLog {
+			logs = append(logs, name)
+			logNum = fileNum
+		}
+	}
+	require.Len(t, logs, 1)
+	f, err := fs.Open(logs[0])
+	require.NoError(t, err)
+	defer f.Close()
+
+	v := &printingVisitor{}
+	rr := record.NewReader(f, logNum)
+	for {
+		r, err := rr.Next()
+		if err == io.EOF || record.IsInvalidRecord(err) {
+			break
+		}
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		_, err = io.Copy(&buf, r)
+		require.NoError(t, err)
+		require.NoError(t, batchrepr.Decode(buf.Bytes(), v))
+	}
+	require.Equal(t, `prepare-txn txn1
+set a 1
+commit-txn txn1
+set a 1
+prepare-txn txn2
+del b
+rollback-txn txn2
+batch-chunk
+set c 3
+commit-chunks
+set d 4
+idempotency-token token1
+`, v.buf.String())
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	b := new(pebble.Batch)
+	require.NoError(t, b.Set([]byte("key"), []byte("value"), nil))
+	require.NoError(t, b.RangeKeySet([]byte("a"), []byte("b"), []byte("@1"), []byte("v"), nil))
+	repr := b.Repr()
+
+	// Every truncation of the batch within its header or a record is reported
+	// as corruption.
+	boundaries := map[int]bool{batchrepr.HeaderLen: true}
+	for r, _, _ := batchrepr.Read(repr); len(r) > 0; {
+		_, _, _, ok := r.Next()
+		require.True(t, ok)
+		boundaries[len(repr)-len(r)] = true
+	}
+	for n := 1; n < len(repr); n++ {
+		if boundaries[n] {
+			require.NoError(t, batchrepr.Decode(repr[:n], batchrepr.NopVisitor{}))
+			continue
+		}
+		err := batchrepr.Decode(repr[:n], batchrepr.NopVisitor{})
+		require.Error(t, err, "truncated to %d bytes", n)
+		require.True(t, errors.Is(err, pebble.ErrCorruption))
+	}
+	require.NoError(t, batchrepr.Decode(repr, batchrepr.NopVisitor{}))
+
+	// Errors returned by the visitor stop the decoding.
+	errStop := errors.New("stop")
+	var seen int
+	err := batchrepr.Decode(repr, stoppingVisitor{fn: func() error {
+		seen++
+		return errStop
+	}})
+	require.Equal(t, errStop, err)
+	require.Equal(t, 1, seen)
+}
+
+type stoppingVisitor struct {
+	batchrepr.NopVisitor
+	fn func() error
+}
+
+func (v stoppingVisitor) Set(key, value []byte) error { return v.fn() }
@@ -237,26 +237,10 @@ func (d *DB) Checkpoint(
 		}
 	}
 
-	{
-		// Set the format major version in the destination directory.
-		var versionMarker *atomicfs.Marker
-		versionMarker, _, ckErr = atomicfs.LocateMarker(fs, destDir, formatVersionMarkerName)
-		if ckErr != nil {
-			return ckErr
-		}
-
-		// We use the marker to encode the active format version in the
-		// marker filename. Unlike other uses of the atomic marker,
-		// there is no file with the filename `formatVers.String()` on
-		// the filesystem.
-		ckErr = versionMarker.Move(formatVers.String())
-		if ckErr != nil {
-			return ckErr
-		}
-		ckErr = versionMarker.Close()
-		if ckErr != nil {
-			return ckErr
-		}
+	// Set the format major version in the destination directory.
+	ckErr = writeFormatVersionMarker(fs, destDir, formatVers)
+	if ckErr != nil {
+		return ckErr
 	}
 
 	var excludedFiles map[deletedFileEntry]*fileMetadata
@@ -338,6 +322,23 @@ func (d *DB) Checkpoint(
 	return ckErr
 }
 
+// writeFormatVersionMarker sets the format major version of the store in
+// destDir.
+func writeFormatVersionMarker(fs vfs.FS, destDir string, formatVers FormatMajorVersion) error {
+	versionMarker, _, err := atomicfs.LocateMarker(fs, destDir, formatVersionMarkerName)
+	if err != nil {
+		return err
+	}
+	// We use the marker to encode the active format version in the
+	// marker filename. Unlike other uses of the atomic marker,
+	// there is no file with the filename `formatVers.String()` on
+	// the filesystem.
+	if err := versionMarker.Move(formatVers.String()); err != nil {
+		return err
+	}
+	return versionMarker.Close()
+}
+
 func (d *DB) writeCheckpointManifest(
 	fs vfs.FS,
 	formatVers FormatMajorVersion,
@@ -0,0 +1,224 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"sync/atomic"
+
+	"github.com/cockroachdb/errors"
+)
+
+// batchChunk is a chunk of a batch committed by Batch.CommitChunked, along
+// with the memtable it's applied to.
+type batchChunk struct {
+	batch Batch
+	mem   *memTable
+}
+
+// CommitChunked commits the batch in chunks that are applied to successive
+// memtables. A batch that is larger than the memtable is otherwise committed
+// as a flushable batch, which bypasses the memtable size accounting: it's
+// flushed as a unit, forcing the flush of the memtable preceding it. Instead,
+// CommitChunked fills and rotates the memtables like a stream of smaller
+// batches would, so that bulk writers don't need to split their batches.
+//
+// The commit is atomic. Each chunk is written to the WAL, followed by a commit
+// marker once all the chunks are written, and the chunks are only replayed
+// from the WAL if they're followed by the commit marker. The batch's writes
+// aren't visible to readers until all the chunks are applied, and the
+// memtables the chunks are applied to aren't flushed until the commit marker
+// is durable. The commit marker is always synced.
+//
+// Other writes to the DB are blocked while the chunks are written to the WAL.
+// The memtables are rotated without stalling, so a large batch may exceed
+// Options.MemTableStopWritesThreshold, stalling later writes until the
+// memtables are flushed.
+// A single record of the batch must fit in a memtable of Options.MemTableSize.
+// CommitChunked requires a format major version of at least
+// FormatChunkedBatches, and doesn't support the idempotency tokens of
+// Batch.AddIdempotencyToken. The batch isn't modified, and must be closed by
+// the caller.
+func (b *Batch) CommitChunked() error {
+	if b.ingestedSSTBatch || b.txnMarker {
+		panic("pebble: invalid call to CommitChunked")
+	}
+	d := b.db
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if err := d.diskFullErr(); err != nil {
+		return err
+	}
+	if v := d.FormatMajorVersion(); v < FormatChunkedBatches {
+		return errors.Newf(
+			"pebble: database has format major version %d; chunked commits require at least %d",
+			errors.Safe(v), errors.Safe(FormatChunkedBatches),
+		)
+	}
+	if b.idempotencyTokens {
+		return errors.New("pebble: chunked commits don't support idempotency tokens")
+	}
+	if b.Empty() {
+		return nil
+	}
+	if b.Count() == invalidBatchCount {
+		return ErrInvalidBatch
+	}
+	if err := d.checkWriteSizeLimits(b); err != nil {
+		return err
+	}
+
+	var chunks []*batchChunk
+	var committed bool
+	var err error
+	d.commit.AllocateSeqNum(int(b.Count()), func(seqNum uint64) {
+		chunks, committed, err = d.writeBatchChunks(b, seqNum)
+	}, func(seqNum uint64) {
+		if committed {
+			for _, c := range chunks {
+				if applyErr := c.mem.apply(&c.batch, c.batch.SeqNum()); applyErr != nil {
+					err = firstError(err, applyErr)
+					break
+				}
+			}
+		}
+		// The memtables sharing the WAL of the chunks must be flushed together,
+		// so they're all unreferenced at once.
+		d.mu.Lock()
+		for _, c := range chunks {
+			c.mem.writerUnref()
+		}
+		d.maybeScheduleFlush()
+		d.mu.Unlock()
+	})
+	return err
+}
+
+// writeBatchChunks splits the batch b into chunks fitting the memtables,
+// starting with the mutable memtable and rotating it once it's full. Each
+// chunk reserves space in its memtable, and references it until the chunk is
+// applied. The chunks are written to the WAL, followed by the commit marker.
+// The records of b have the sequence numbers starting at seqNum.
+//
+// The chunks are returned so that they're applied by the caller if they're
+// committed, and unreferenced. The chunks may be committed even if an error is
+// returned.
+//
+// commitPipeline.mu must be held by the caller, with no batch pending
+// publication.
+func (d *DB) writeBatchChunks(
+	b *Batch, seqNum uint64,
+) (chunks []*batchChunk, committed bool, err error) {
+	d.mu.Lock()
+	var size int64
+	for r := b.Reader(); len(r) > 0 && err == nil; {
+		mem := d.mu.mem.mutable
+		avail := uint64(mem.availBytes())
+		c := &batchChunk{mem: mem}
+		c.batch.batchChunk()
+		var records int
+		for len(r) > 0 {
+			rec := r
+			kind, ukey, value, ok := r.Next()
+			if !ok {
+				d.mu.Unlock()
+				return chunks, false, ErrInvalidBatch
+			}
+			var entrySize uint64
+			if kind != InternalKeyKindLogData {
+				entrySize = memTableEntrySize(len(ukey), len(value))
+			}
+			if c.batch.memTableSize+entrySize > avail {
+				// The record doesn't fit in the memtable.
+				r = rec
+				break
+			}
+			c.batch.data = append(c.batch.data, rec[:len(rec)-len(r)]...)
+			c.batch.memTableSize += entrySize
+			if kind != InternalKeyKindLogData {
+				c.batch.count++
+			}
+			records++
+		}
+
+		if records > 0 {
+			c.batch.setSeqNum(seqNum)
+			seqNum += c.batch.count
+			if err := mem.prepare(&c.batch); err != nil {
+				d.mu.Unlock()
+				return chunks, false, err
+			}
+			chunks = append(chunks, c)
+			if !d.opts.DisableWAL {
+				repr := c.batch.Repr()
+				if size, err = d.mu.log.WriteRecord(repr); err != nil {
+					break
+				}
+				d.mu.log.bytesIn += uint64(len(repr))
+			}
+		} else if mem.empty() && mem.totalBytes() >= uint64(d.opts.MemTableSize) {
+			d.mu.Unlock()
+			return chunks, false, errors.New("pebble: batch record does not fit in a memtable")
+		}
+		if len(r) > 0 {
+			// The remainder of the batch is applied to a new memtable, which
+			// shares the WAL of the previous one, so that the chunks and the
+			// commit marker are all written to the same WAL.
+			logNum := d.mu.mem.queue[len(d.mu.mem.queue)-1].logNum
+			d.rotateMemtable(logNum, seqNum, mem)
+		}
+	}
+	d.mu.Unlock()
+	if err == nil && d.opts.DisableWAL {
+		return chunks, true, nil
+	}
+
+	if err == nil {
+		var marker Batch
+		marker.commitChunks()
+		marker.setSeqNum(seqNum)
+		size, err = d.writeAndSyncRecords(&d.mu.log.walWriter, [][]byte{marker.Repr()})
+		committed = err == nil
+	}
+	if err == nil {
+		atomic.StoreUint64(&d.atomic.logSize, uint64(size))
+		if len(chunks) > 1 {
+			// A flush of the memtables sharing the WAL of the chunks must also
+			// flush the mutable memtable, so the WAL is rotated.
+			d.mu.Lock()
+			err = d.rotateWALLocked(seqNum)
+			d.mu.Unlock()
+		}
+	}
+	if err != nil {
+		if err := d.handleDiskFull(err); err != nil {
+			return chunks, committed, err
+		}
+		panic(err)
+	}
+	return chunks, committed, nil
+}
+
+// rotateWALLocked rotates the mutable memtable and the WAL, without stalling
+// like DB.makeRoomForWrite. The new memtable has the creation sequence number
+// logSeqNum.
+//
+// Both DB.mu and commitPipeline.mu must be held by the caller.
+func (d *DB) rotateWALLocked(logSeqNum uint64) error {
+	newLogNum, prevLogSize, err := d.recycleWAL()
+	if err != nil {
+		return err
+	}
+	immMem := d.mu.mem.mutable
+	d.mu.mem.queue[len(d.mu.mem.queue)-1].logSize = prevLogSize
+	if err := d.logCarriedOverRecordsLocked(logSeqNum); err != nil {
+		return err
+	}
+	d.rotateMemtable(newLogNum, logSeqNum, immMem)
+	return nil
+}
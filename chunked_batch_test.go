@@ -0,0 +1,176 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/record"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitChunked(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &Options{
+		FS:                          mem,
+		FormatMajorVersion:          FormatChunkedBatches,
+		MemTableSize:                256 << 10,
+		MemTableStopWritesThreshold: 2,
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+
+	const n = 1000
+	value := bytes.Repeat([]byte("v"), 1<<10)
+	newLargeBatch := func(prefix string) *Batch {
+		b := d.NewBatch()
+		for i := 0; i < n; i++ {
+			require.NoError(t, b.Set([]byte(fmt.Sprintf("%s%04d", prefix, i)), value, nil))
+		}
+		require.NoError(t, b.DeleteRange([]byte(prefix+"0500"), []byte(prefix+"0600"), nil))
+		return b
+	}
+	count := func(prefix string) int {
+		iter := d.NewIter(&IterOptions{
+			LowerBound: []byte(prefix),
+			UpperBound: []byte(prefix + "\xff"),
+		})
+		var c int
+		for valid := iter.First(); valid; valid = iter.Next() {
+			require.Equal(t, value, iter.Value())
+			c++
+		}
+		require.NoError(t, iter.Close())
+		return c
+	}
+
+	require.NoError(t, d.Set([]byte("a"), []byte("before"), nil))
+	// Block flushes, so that the chunks remain in the WAL.
+	d.mu.Lock()
+	d.mu.compact.flushing = true
+	d.mu.Unlock()
+	b := newLargeBatch("b")
+	require.NoError(t, b.CommitChunked())
+	require.NoError(t, b.Close())
+	require.Equal(t, n-100, count("b"))
+
+	// The chunks were applied to memtables, rather than committed as a
+	// flushable batch.
+	d.mu.Lock()
+	var memtables int
+	for _, entry := range d.mu.mem.queue {
+		_, ok := entry.flushable.(*memTable)
+		require.True(t, ok, "%T", entry.flushable)
+		memtables++
+	}
+	require.Greater(t, memtables, 2)
+	d.mu.compact.flushing = false
+	d.mu.Unlock()
+
+	// The committed chunks are replayed from the WAL.
+	require.NoError(t, d.Checkpoint("checkpoint"))
+	require.NoError(t, d.Close())
+	d, err = Open("checkpoint", opts)
+	require.NoError(t, err)
+	require.Equal(t, n-100, count("b"))
+	require.NoError(t, d.Close())
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	require.Equal(t, n-100, count("b"))
+
+	// A batch whose commit marker is missing from the WAL isn't replayed. The
+	// batch fits in the memtable, so that it's still unflushed.
+	require.NoError(t, d.Set([]byte("c"), []byte("before"), nil))
+	b = d.NewBatch()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, b.Set([]byte(fmt.Sprintf("d%04d", i)), value, nil))
+	}
+	require.NoError(t, b.CommitChunked())
+	require.NoError(t, b.Close())
+	require.Equal(t, 10, count("d"))
+	require.NoError(t, d.Close())
+	removeCommitChunksRecords(t, mem)
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	require.Equal(t, n-100, count("b"))
+	require.Equal(t, 0, count("d"))
+	for _, k := range []string{"a", "c"} {
+		v, closer, err := d.Get([]byte(k))
+		require.NoError(t, err)
+		require.Equal(t, "before", string(v))
+		require.NoError(t, closer.Close())
+	}
+
+	// A record must fit in a memtable.
+	b = d.NewBatch()
+	require.NoError(t, b.Set([]byte("e"), bytes.Repeat([]byte("v"), 512<<10), nil))
+	require.Error(t, b.CommitChunked())
+	require.NoError(t, b.Close())
+	require.NoError(t, d.Close())
+}
+
+func TestCommitChunkedFormatMajorVersion(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                 vfs.NewMem(),
+		FormatMajorVersion: FormatTwoPhaseCommit,
+	})
+	require.NoError(t, err)
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("a"), []byte("1"), nil))
+	require.Error(t, b.CommitChunked())
+	require.NoError(t, b.Close())
+	_, _, err = d.Get([]byte("a"))
+	require.True(t, errors.Is(err, ErrNotFound))
+	require.NoError(t, d.Close())
+}
+
+// removeCommitChunksRecords rewrites the WALs in the root of fs without their
+// chunked commit markers.
+func removeCommitChunksRecords(t *testing.T, fs vfs.FS) {
+	ls, err := fs.List("")
+	require.NoError(t, err)
+	for _, name := range ls {
+		fileType, fileNum, ok := base.ParseFilename(fs, name)
+		if !ok || fileType != fileTypeLog {
+			continue
+		}
+		f, err := fs.Open(name)
+		require.NoError(t, err)
+		var records [][]byte
+		rr := record.NewReader(f, fileNum)
+		for {
+			r, err := rr.Next()
+			if err != nil {
+				break
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				break
+			}
+			var b Batch
+			require.NoError(t, b.SetRepr(data))
+			br := b.Reader()
+			if kind, _, _, _ := br.Next(); kind != InternalKeyKindCommitChunks {
+				records = append(records, data)
+			}
+		}
+		require.NoError(t, f.Close())
+
+		f, err = fs.Create(name)
+		require.NoError(t, err)
+		w := record.NewLogWriter(f, fileNum, record.LogWriterConfig{})
+		for _, data := range records {
+			_, err := w.WriteRecord(data)
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Close())
+	}
+}
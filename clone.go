@@ -0,0 +1,302 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"os"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider/sharedobjcat"
+	"github.com/cockroachdb/pebble/record"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/cockroachdb/pebble/vfs/atomicfs"
+)
+
+type cloneOptions struct {
+	// creatorID is the creator ID of the clone, for its shared objects.
+	creatorID objstorage.CreatorID
+}
+
+// CloneOption sets optional parameters used by DB.Clone.
+type CloneOption func(*cloneOptions)
+
+// WithCloneCreatorID sets the creator ID of the clone (see DB.SetCreatorID),
+// which must differ from that of the DB. It's required to clone a DB with
+// sstables on shared storage, as the clone references them under its creator
+// ID.
+func WithCloneCreatorID(creatorID uint64) CloneOption {
+	return func(opt *cloneOptions) {
+		opt.creatorID = objstorage.CreatorID(creatorID)
+	}
+}
+
+// Clone creates an independent copy of the DB in the specified directory,
+// which can be opened as a separate DB. The clone shares the sstables of the
+// DB rather than copying them: local sstables are hard linked when possible,
+// and sstables on shared storage are referenced by the clone's shared object
+// catalog. The WAL and OPTIONS are copied, and a new MANIFEST is written
+// containing only the current version of the LSM, so that the clone's
+// MANIFEST and WAL diverge from the DB's going forward.
+//
+// All writes committed before calling Clone are part of the clone. Unlike
+// Checkpoint, Clone supports sstables on shared storage, which are referenced
+// on behalf of the clone, so that they outlive their deletion by the DB. The
+// creator ID of the clone must then be set with WithCloneCreatorID, and the
+// clone must be opened with the same SharedStorage.
+func (d *DB) Clone(destDir string, opts ...CloneOption) (cloneErr error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	opt := &cloneOptions{}
+	for _, fn := range opts {
+		fn(opt)
+	}
+	if _, err := d.opts.FS.Stat(destDir); !oserror.IsNotExist(err) {
+		if err == nil {
+			return &os.PathError{
+				Op:   "clone",
+				Path: destDir,
+				Err:  oserror.ErrExist,
+			}
+		}
+		return err
+	}
+
+	if !d.opts.DisableWAL && !d.opts.ReadOnly {
+		// Write an empty log-data record to flush and sync the WAL.
+		if err := d.LogData(nil /* data */, Sync); err != nil {
+			return err
+		}
+	}
+
+	// Disable file deletions, so that the sstables and WALs of the current
+	// version remain on disk until they're linked or copied.
+	d.mu.Lock()
+	d.disableFileDeletions()
+	defer func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.enableFileDeletions()
+	}()
+
+	// Lock the manifest so that the current version and the fields of the
+	// snapshot version edit are consistent with one another.
+	d.mu.versions.logLock()
+	memQueue := d.mu.mem.queue
+	current := d.mu.versions.currentVersion()
+	formatVers := d.mu.formatVers.vers
+	manifestFileNum := d.mu.versions.manifestFileNum
+	snapshot := versionEdit{
+		ComparerName:       d.mu.versions.cmpName,
+		MinUnflushedLogNum: d.mu.versions.minUnflushedLogNum,
+		NextFileNum:        d.mu.versions.nextFileNum,
+		LastSeqNum:         d.mu.versions.atomic.logSeqNum - 1,
+	}
+	optionsFileNum := d.optionsFileNum
+	d.mu.versions.logUnlock()
+	d.mu.Unlock()
+
+	// Wrap the normal filesystem with one which wraps newly created files with
+	// vfs.NewSyncingFile.
+	fs := vfs.NewSyncingFS(d.opts.FS, vfs.SyncingFileOptions{
+		NoSyncOnClose: d.opts.NoSyncOnClose,
+		BytesPerSync:  d.opts.BytesPerSync,
+	})
+
+	// Create the dir and its parents (if necessary), and sync them.
+	var dir vfs.File
+	defer func() {
+		if dir != nil {
+			_ = dir.Close()
+		}
+		if cloneErr != nil {
+			// Attempt to cleanup on error.
+			paths, _ := fs.List(destDir)
+			for _, path := range paths {
+				_ = fs.Remove(fs.PathJoin(destDir, path))
+			}
+			_ = fs.Remove(destDir)
+		}
+	}()
+	dir, cloneErr = mkdirAllAndSyncParents(fs, destDir)
+	if cloneErr != nil {
+		return cloneErr
+	}
+
+	if !d.opts.ReadOnly {
+		// Link or copy the OPTIONS.
+		srcPath := base.MakeFilepath(fs, d.dirname, fileTypeOptions, optionsFileNum)
+		destPath := fs.PathJoin(destDir, fs.PathBase(srcPath))
+		cloneErr = vfs.LinkOrCopy(fs, srcPath, destPath)
+		if cloneErr != nil {
+			return cloneErr
+		}
+	}
+
+	cloneErr = writeFormatVersionMarker(fs, destDir, formatVers)
+	if cloneErr != nil {
+		return cloneErr
+	}
+
+	// Link or copy the local sstables, and add the shared sstables to the
+	// clone's shared object catalog.
+	var sharedObjs sharedobjcat.Batch
+	var sharedMetas []objstorage.ObjectMetadata
+	backings := make(map[base.FileNum]struct{})
+	for level, levelMetadata := range current.Levels {
+		iter := levelMetadata.Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			snapshot.NewFiles = append(snapshot.NewFiles, newFileEntry{Level: level, Meta: f})
+			if _, ok := backings[f.FileBacking.FileNum]; ok {
+				continue
+			}
+			backings[f.FileBacking.FileNum] = struct{}{}
+			if f.Virtual {
+				snapshot.CreatedBackingTables = append(snapshot.CreatedBackingTables, f.FileBacking)
+			}
+
+			objMeta, err := d.objProvider.Lookup(fileTypeTable, f.FileBacking.FileNum)
+			if err != nil {
+				return err
+			}
+			if objMeta.IsShared() {
+				if !opt.creatorID.IsSet() {
+					return errors.New("pebble: cloning sstables on shared storage requires the creator ID of the clone")
+				}
+				sharedMetas = append(sharedMetas, objMeta)
+				sharedObjs.AddObject(sharedobjcat.SharedObjectMetadata{
+					FileNum:        objMeta.FileNum,
+					FileType:       objMeta.FileType,
+					CreatorID:      objMeta.Shared.CreatorID,
+					CreatorFileNum: objMeta.Shared.CreatorFileNum,
+				})
+				continue
+			}
+			srcPath := base.MakeFilepath(fs, d.dirname, fileTypeTable, f.FileBacking.FileNum)
+			destPath := fs.PathJoin(destDir, fs.PathBase(srcPath))
+			cloneErr = vfs.LinkOrCopy(fs, srcPath, destPath)
+			if cloneErr != nil {
+				return cloneErr
+			}
+		}
+	}
+	if opt.creatorID.IsSet() && d.opts.Experimental.SharedStorage != nil {
+		cloneErr = writeSharedObjectCatalog(fs, destDir, opt.creatorID, sharedObjs)
+		if cloneErr != nil {
+			return cloneErr
+		}
+	}
+
+	cloneErr = writeCloneManifest(fs, formatVers, destDir, dir, manifestFileNum, &snapshot)
+	if cloneErr != nil {
+		return cloneErr
+	}
+
+	// Copy the unflushed WAL files. We copy rather than link because WAL file
+	// recycling will cause the WAL files to be reused which would invalidate
+	// the clone.
+	for i := range memQueue {
+		logNum := memQueue[i].logNum
+		if logNum == 0 || logNum < snapshot.MinUnflushedLogNum {
+			continue
+		}
+		srcPath := base.MakeFilepath(fs, d.walDirname, fileTypeLog, logNum)
+		destPath := fs.PathJoin(destDir, fs.PathBase(srcPath))
+		cloneErr = vfs.Copy(fs, srcPath, destPath)
+		if cloneErr != nil {
+			return cloneErr
+		}
+	}
+
+	// Reference the shared sstables on behalf of the clone. This is done last,
+	// as the references would outlive a failed clone, but while file deletions
+	// are disabled, so that the sstables are still referenced by the DB.
+	if len(sharedMetas) > 0 {
+		cloneErr = d.objProvider.RefSharedObjects(opt.creatorID, sharedMetas)
+		if cloneErr != nil {
+			return cloneErr
+		}
+	}
+
+	// Sync and close the clone directory.
+	cloneErr = dir.Sync()
+	if cloneErr != nil {
+		return cloneErr
+	}
+	cloneErr = dir.Close()
+	dir = nil
+	return cloneErr
+}
+
+// writeSharedObjectCatalog writes the shared object catalog of the clone in
+// destDir, which has the creator ID creatorID and contains the shared objects
+// in objs.
+func writeSharedObjectCatalog(
+	fs vfs.FS, destDir string, creatorID objstorage.CreatorID, objs sharedobjcat.Batch,
+) error {
+	catalog, _, err := sharedobjcat.Open(fs, destDir)
+	if err != nil {
+		return err
+	}
+	if err := catalog.SetCreatorID(creatorID); err != nil {
+		_ = catalog.Close()
+		return err
+	}
+	if !objs.IsEmpty() {
+		if err := catalog.ApplyBatch(objs); err != nil {
+			_ = catalog.Close()
+			return err
+		}
+	}
+	return catalog.Close()
+}
+
+// writeCloneManifest writes the MANIFEST of the clone in destDir, which
+// contains the single version edit snapshot, and makes it the clone's active
+// MANIFEST.
+func writeCloneManifest(
+	fs vfs.FS,
+	formatVers FormatMajorVersion,
+	destDirPath string,
+	destDir vfs.File,
+	manifestFileNum FileNum,
+	snapshot *versionEdit,
+) error {
+	if err := func() error {
+		path := base.MakeFilepath(fs, destDirPath, fileTypeManifest, manifestFileNum)
+		f, err := fs.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		rw := record.NewWriter(f)
+		w, err := rw.Next()
+		if err != nil {
+			return err
+		}
+		if err := snapshot.Encode(w); err != nil {
+			return err
+		}
+		if err := rw.Close(); err != nil {
+			return err
+		}
+		return f.Sync()
+	}(); err != nil {
+		return err
+	}
+
+	manifestMarker, _, err := atomicfs.LocateMarker(fs, destDirPath, manifestMarkerName)
+	if err != nil {
+		return err
+	}
+	if err := setCurrentFunc(formatVers, manifestMarker, fs, destDirPath, destDir)(manifestFileNum); err != nil {
+		return err
+	}
+	return manifestMarker.Close()
+}
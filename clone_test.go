@@ -0,0 +1,126 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage/shared"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClone(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &Options{FS: mem, FormatMajorVersion: FormatNewest}
+	d, err := Open("db", opts)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("a%d", i)), []byte("flushed"), nil))
+	}
+	require.NoError(t, d.Flush())
+	// Excise a span of the flushed sstable, creating virtual sstables.
+	require.NoError(t, d.Excise([]byte("a3"), []byte("a6")))
+	require.NoError(t, d.Set([]byte("b"), []byte("unflushed"), NoSync))
+
+	require.NoError(t, d.Clone("clone"))
+	require.True(t, oserror.IsExist(d.Clone("clone")), "cloning into an existing directory")
+
+	// Later writes to the DB aren't part of the clone, which remains openable
+	// once the DB's sstables are compacted and the DB is closed.
+	require.NoError(t, d.Set([]byte("c"), []byte("later"), nil))
+	require.NoError(t, d.Compact([]byte("a"), []byte("d"), false))
+	require.NoError(t, d.Close())
+
+	c, err := Open("clone", opts)
+	require.NoError(t, err)
+	require.Equal(t, "a0:flushed a1:flushed a2:flushed a6:flushed a7:flushed a8:flushed "+
+		"a9:flushed b:unflushed", scanAll(t, c))
+
+	// Writes to the clone aren't visible in the DB.
+	require.NoError(t, c.Set([]byte("d"), []byte("clone"), nil))
+	require.NoError(t, c.Compact([]byte("a"), []byte("e"), false))
+	require.NoError(t, c.Close())
+
+	d, err = Open("db", opts)
+	require.NoError(t, err)
+	require.Equal(t, "a0:flushed a1:flushed a2:flushed a6:flushed a7:flushed a8:flushed "+
+		"a9:flushed b:unflushed c:later", scanAll(t, d))
+	require.NoError(t, d.Close())
+
+	c, err = Open("clone", opts)
+	require.NoError(t, err)
+	require.Equal(t, "a0:flushed a1:flushed a2:flushed a6:flushed a7:flushed a8:flushed "+
+		"a9:flushed b:unflushed d:clone", scanAll(t, c))
+	require.NoError(t, c.Close())
+}
+
+func TestCloneSharedStorage(t *testing.T) {
+	mem := vfs.NewMem()
+	sharedStorage := shared.NewInMem()
+	opts := &Options{FS: mem}
+	opts.Experimental.SharedStorage = sharedStorage
+	opts.Experimental.CreateOnShared = true
+	d, err := Open("db", opts)
+	require.NoError(t, err)
+	_, err = d.CollectSharedGarbage(0)
+	require.NoError(t, err, "collecting garbage without a creator ID")
+	require.NoError(t, d.SetCreatorID(1))
+
+	require.NoError(t, d.Set([]byte("a"), []byte("shared"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("b"), []byte("unflushed"), nil))
+	require.Error(t, d.Clone("clone"), "cloning shared sstables without a creator ID")
+	require.Error(t, d.Clone("clone", WithCloneCreatorID(1)), "cloning with the DB's creator ID")
+	require.NoError(t, d.Clone("clone", WithCloneCreatorID(2)))
+
+	// The shared sstable outlives its compaction by the DB, and the collection
+	// of the DB's garbage, as it's referenced by the clone.
+	require.NoError(t, d.Set([]byte("a"), []byte("later"), nil))
+	require.NoError(t, d.Compact([]byte("a"), []byte("c"), false))
+	for i := 0; i < 2; i++ {
+		_, err = d.CollectSharedGarbage(0)
+		require.NoError(t, err)
+	}
+	require.NoError(t, d.Close())
+
+	// The clone references the shared sstable, rather than a local copy.
+	list, err := mem.List("clone")
+	require.NoError(t, err)
+	for _, name := range list {
+		fileType, _, ok := base.ParseFilename(mem, name)
+		require.False(t, ok && fileType == fileTypeTable, "local sstable %s", name)
+	}
+
+	c, err := Open("clone", opts)
+	require.NoError(t, err)
+	require.Equal(t, "a:shared b:unflushed", scanAll(t, c))
+	require.Error(t, c.SetCreatorID(3), "changing the creator ID of the clone")
+	require.NoError(t, c.Set([]byte("c"), []byte("clone"), nil))
+	require.NoError(t, c.Flush())
+	require.NoError(t, c.Close())
+
+	c, err = Open("clone", opts)
+	require.NoError(t, err)
+	require.Equal(t, "a:shared b:unflushed c:clone", scanAll(t, c))
+	require.NoError(t, c.Close())
+}
+
+func scanAll(t *testing.T, d *DB) string {
+	iter := d.NewIter(nil)
+	var s string
+	for valid := iter.First(); valid; valid = iter.Next() {
+		if s != "" {
+			s += " "
+		}
+		s += fmt.Sprintf("%s:%s", iter.Key(), iter.Value())
+	}
+	require.NoError(t, iter.Close())
+	return s
+}
@@ -10,6 +10,7 @@ import (
 	"sync/atomic"
 	"unsafe"
 
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/record"
 )
 
@@ -307,6 +308,10 @@ func (p *commitPipeline) Commit(b *Batch, syncWAL bool, noSyncWait bool) error {
 	mem, err := p.prepare(b, syncWAL, noSyncWait)
 	if err != nil {
 		b.db = nil // prevent batch reuse on error
+		if errors.Is(err, ErrDiskFull) {
+			p.abandon(b, err, syncWAL, noSyncWait)
+			return err
+		}
 		// NB: we are not doing <-p.commitQueueSem since the batch is still
 		// sitting in the pending queue. We should consider fixing this by also
 		// removing the batch from the pending queue.
@@ -460,6 +465,25 @@ func (p *commitPipeline) prepare(b *Batch, syncWAL bool, noSyncWait bool) (*memT
 	return mem, err
 }
 
+// abandon releases a batch that failed to be written to the WAL after the DB
+// ran out of disk space. The batch was neither queued for syncing by the WAL
+// nor applied to the memtable, but it sits in the pending queue; publishing it
+// ensures it doesn't block the publication of subsequent batches. Its sequence
+// numbers are left unused.
+func (p *commitPipeline) abandon(b *Batch, err error, syncWAL bool, noSyncWait bool) {
+	if syncWAL {
+		b.commitErr = err
+		if noSyncWait {
+			b.fsyncWait.Done()
+		} else {
+			b.commit.Done()
+		}
+		<-p.logSyncQSem
+	}
+	p.publish(b)
+	<-p.commitQueueSem
+}
+
 func (p *commitPipeline) publish(b *Batch) {
 	// Mark the batch as applied.
 	atomic.StoreUint32(&b.applied, 1)
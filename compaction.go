@@ -901,6 +901,9 @@ func newFlush(opts *Options, cur *version, baseLevel int, flushing flushableList
 
 	if opts.FlushSplitBytes > 0 {
 		c.maxOutputFileSize = uint64(opts.Level(0).TargetFileSize)
+		if opts.Experimental.FlushTargetFileSize > 0 {
+			c.maxOutputFileSize = uint64(opts.Experimental.FlushTargetFileSize)
+		}
 		c.maxOverlapBytes = maxGrandparentOverlapBytes(opts, 0)
 		c.grandparents = c.version.Overlaps(baseLevel, c.cmp, c.smallest.UserKey,
 			c.largest.UserKey, c.largest.IsExclusiveSentinel())
@@ -1300,6 +1303,12 @@ func (c *compaction) newInputIter(
 			for _, rangeDelIter := range rangeDelIters {
 				rangeDelIter.Close()
 			}
+			// The range deletion and range key iterators of the tables are
+			// wrapped in noCloseIters, and only closed through c.closers.
+			for _, closer := range c.closers {
+				closer.Close()
+			}
+			c.closers = nil
 		}
 	}()
 
@@ -1630,7 +1639,11 @@ func (d *DB) addInProgressCompaction(c *compaction) {
 // state in the case of an unsuccessful compaction.
 //
 // DB.mu must be held when calling this method. All writes to the manifest for
-// this compaction should have completed by this point.
+// this compaction should have completed by this point. On rollback, the
+// manifest must also be locked (see versionSet.logLock): a concurrent
+// logAndApply updates the L0 interval indexes of the files it shares with the
+// current version while DB.mu is released, and InitCompactingFileInfo relies
+// on them.
 func (d *DB) removeInProgressCompaction(c *compaction, rollback bool) {
 	for _, cl := range c.inputs {
 		iter := cl.files.Iter()
@@ -1696,6 +1709,10 @@ func (d *DB) maybeScheduleFlush() {
 	if d.mu.compact.flushing || d.closed.Load() != nil || d.opts.ReadOnly {
 		return
 	}
+	if atomic.LoadUint32(&d.atomic.diskFull) == diskFullReadOnly {
+		// Flushes are paused until disk space is freed (see DB.ResumeWrites).
+		return
+	}
 	if len(d.mu.mem.queue) <= 1 {
 		return
 	}
@@ -1790,29 +1807,32 @@ func (d *DB) maybeScheduleDelayedFlush(tbl *memTable, dur time.Duration) {
 
 func (d *DB) flush() {
 	pprof.Do(context.Background(), flushLabels, func(context.Context) {
-		flushingWorkStart := time.Now()
-		d.mu.Lock()
-		defer d.mu.Unlock()
-		idleDuration := flushingWorkStart.Sub(d.mu.compact.noOngoingFlushStartTime)
-		var bytesFlushed uint64
-		var err error
-		if bytesFlushed, err = d.flush1(); err != nil {
-			// TODO(peter): count consecutive flush errors and backoff.
-			d.opts.EventListener.BackgroundError(err)
-		}
-		d.mu.compact.flushing = false
-		d.mu.compact.noOngoingFlushStartTime = time.Now()
-		workDuration := d.mu.compact.noOngoingFlushStartTime.Sub(flushingWorkStart)
-		d.mu.compact.flushWriteThroughput.Bytes += int64(bytesFlushed)
-		d.mu.compact.flushWriteThroughput.WorkDuration += workDuration
-		d.mu.compact.flushWriteThroughput.IdleDuration += idleDuration
-		// More flush work may have arrived while we were flushing, so schedule
-		// another flush if needed.
-		d.maybeScheduleFlush()
-		// The flush may have produced too many files in a level, so schedule a
-		// compaction if needed.
-		d.maybeScheduleCompaction()
-		d.mu.compact.cond.Broadcast()
+		vfs.WithIOPriority(d.opts.Experimental.BackgroundIOPriority, func() {
+			flushingWorkStart := time.Now()
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			idleDuration := flushingWorkStart.Sub(d.mu.compact.noOngoingFlushStartTime)
+			var bytesFlushed uint64
+			var err error
+			if bytesFlushed, err = d.flush1(); err != nil {
+				// TODO(peter): count consecutive flush errors and backoff.
+				d.opts.EventListener.BackgroundError(err)
+				_ = d.handleDiskFull(err)
+			}
+			d.mu.compact.flushing = false
+			d.mu.compact.noOngoingFlushStartTime = time.Now()
+			workDuration := d.mu.compact.noOngoingFlushStartTime.Sub(flushingWorkStart)
+			d.mu.compact.flushWriteThroughput.Bytes += int64(bytesFlushed)
+			d.mu.compact.flushWriteThroughput.WorkDuration += workDuration
+			d.mu.compact.flushWriteThroughput.IdleDuration += idleDuration
+			// More flush work may have arrived while we were flushing, so schedule
+			// another flush if needed.
+			d.maybeScheduleFlush()
+			// The flush may have produced too many files in a level, so schedule a
+			// compaction if needed.
+			d.maybeScheduleCompaction()
+			d.mu.compact.cond.Broadcast()
+		})
 	})
 }
 
@@ -1944,6 +1964,11 @@ func (d *DB) flush1() (bytesFlushed uint64, err error) {
 				return 0, errFlushInvariant
 			}
 		}
+		// The records carried over from the flushed WALs must be durable before
+		// the flushed WALs are obsoleted.
+		if err := d.waitCarriedOverSyncsLocked(minUnflushedLogNum); err != nil {
+			return 0, err
+		}
 	}
 
 	c := newFlush(d.opts, d.mu.versions.currentVersion(),
@@ -1987,6 +2012,7 @@ func (d *DB) flush1() (bytesFlushed uint64, err error) {
 		Ingest:   ingest,
 		Err:      err,
 	}
+	var unlockManifest bool
 	if err == nil {
 		for i := range ve.NewFiles {
 			e := &ve.NewFiles[i]
@@ -2035,13 +2061,17 @@ func (d *DB) flush1() (bytesFlushed uint64, err error) {
 		}
 	} else {
 		// We won't be performing the logAndApply step because of the error,
-		// so logUnlock.
-		d.mu.versions.logUnlock()
+		// so logUnlock once the compaction is rolled back below (see
+		// removeInProgressCompaction).
+		unlockManifest = true
 	}
 
 	bytesFlushed = c.bytesIterated
 	d.maybeUpdateDeleteCompactionHints(c)
 	d.removeInProgressCompaction(c, err != nil)
+	if unlockManifest {
+		d.mu.versions.logUnlock()
+	}
 	d.mu.versions.incrementCompactions(c.kind, c.extraLevels)
 	d.mu.versions.incrementCompactionBytes(-c.bytesWritten)
 
@@ -2114,9 +2144,27 @@ func pickAuto(picker compactionPicker, env compactionEnv) *pickedCompaction {
 }
 
 func pickElisionOnly(picker compactionPicker, env compactionEnv) *pickedCompaction {
+	if env.deferNonEssentialCompactions {
+		return nil
+	}
 	return picker.pickElisionOnlyCompaction(env)
 }
 
+// ScheduleCompactions checks whether any compactions should be scheduled, and
+// schedules them. Compactions are checked for whenever a flush or compaction
+// completes, so this is only necessary when the criteria for scheduling a
+// compaction change outside of Pebble; e.g. when a window allowing
+// non-essential compactions opens (see
+// Options.Experimental.AllowNonEssentialCompactions).
+func (d *DB) ScheduleCompactions() {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.maybeScheduleCompaction()
+}
+
 // maybeScheduleCompactionPicker schedules a compaction if necessary,
 // calling `pickFunc` to pick automatic compactions.
 //
@@ -2127,6 +2175,11 @@ func (d *DB) maybeScheduleCompactionPicker(
 	if d.closed.Load() != nil || d.opts.ReadOnly {
 		return
 	}
+	if atomic.LoadUint32(&d.atomic.diskFull) == diskFullReadOnly {
+		// Compactions are paused until disk space is freed (see
+		// DB.ResumeWrites).
+		return
+	}
 	maxConcurrentCompactions := d.opts.MaxConcurrentCompactions()
 	if d.mu.compact.compactingCount >= maxConcurrentCompactions {
 		if len(d.mu.compact.manual) > 0 {
@@ -2150,8 +2203,9 @@ func (d *DB) maybeScheduleCompactionPicker(
 	}
 
 	env := compactionEnv{
-		earliestSnapshotSeqNum:  d.mu.snapshots.earliest(),
-		earliestUnflushedSeqNum: d.getEarliestUnflushedSeqNumLocked(),
+		earliestSnapshotSeqNum:       d.mu.snapshots.earliest(),
+		earliestUnflushedSeqNum:      d.getEarliestUnflushedSeqNumLocked(),
+		deferNonEssentialCompactions: !d.opts.Experimental.AllowNonEssentialCompactions(),
 	}
 
 	// Check for delete-only compactions first, because they're expected to be
@@ -2162,7 +2216,8 @@ func (d *DB) maybeScheduleCompactionPicker(
 		!d.opts.DisableAutomaticCompactions {
 		v := d.mu.versions.currentVersion()
 		snapshots := d.mu.snapshots.toSlice()
-		inputs, unresolvedHints := checkDeleteCompactionHints(d.cmp, v, d.mu.compact.deletionHints, snapshots)
+		inputs, unresolvedHints := checkDeleteCompactionHints(
+			d.cmp, v, d.mu.compact.deletionHints, snapshots, d.historyRetentionSeqNum())
 		d.mu.compact.deletionHints = unresolvedHints
 
 		if len(inputs) > 0 {
@@ -2397,7 +2452,11 @@ func (d *DB) maybeUpdateDeleteCompactionHints(c *compaction) {
 }
 
 func checkDeleteCompactionHints(
-	cmp Compare, v *version, hints []deleteCompactionHint, snapshots []uint64,
+	cmp Compare,
+	v *version,
+	hints []deleteCompactionHint,
+	snapshots []uint64,
+	retainHistorySeqNum uint64,
 ) ([]compactionLevel, []deleteCompactionHint) {
 	var files map[*fileMetadata]bool
 	var byLevel [numLevels][]*fileMetadata
@@ -2444,9 +2503,15 @@ func checkDeleteCompactionHints(
 		// ______________________________________________________________
 		//     a b c d e f g h i j k l m n o p q r s t u v w x y z
 
+		//
+		// If history retention is enabled, every sequence number at or above
+		// retainHistorySeqNum behaves as if it were protected by a snapshot.
+		// A hint with a tombstone within the retained window always has a
+		// snapshot stripe boundary between the tombstone and the data it
+		// deletes, and must wait until the tombstone falls out of the window.
 		ti, _ := snapshotIndex(h.tombstoneLargestSeqNum, snapshots)
 		fi, _ := snapshotIndex(h.fileSmallestSeqNum, snapshots)
-		if ti != fi {
+		if ti != fi || (retainHistorySeqNum != 0 && h.tombstoneLargestSeqNum >= retainHistorySeqNum) {
 			// Cannot resolve yet.
 			unresolvedHints = append(unresolvedHints, h)
 			continue
@@ -2488,17 +2553,20 @@ func checkDeleteCompactionHints(
 // compact runs one compaction and maybe schedules another call to compact.
 func (d *DB) compact(c *compaction, errChannel chan error) {
 	pprof.Do(context.Background(), compactLabels, func(context.Context) {
-		d.mu.Lock()
-		defer d.mu.Unlock()
-		if err := d.compact1(c, errChannel); err != nil {
-			// TODO(peter): count consecutive compaction errors and backoff.
-			d.opts.EventListener.BackgroundError(err)
-		}
-		d.mu.compact.compactingCount--
-		// The previous compaction may have produced too many files in a
-		// level, so reschedule another compaction if needed.
-		d.maybeScheduleCompaction()
-		d.mu.compact.cond.Broadcast()
+		vfs.WithIOPriority(d.opts.Experimental.BackgroundIOPriority, func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			if err := d.compact1(c, errChannel); err != nil {
+				// TODO(peter): count consecutive compaction errors and backoff.
+				d.opts.EventListener.BackgroundError(err)
+				_ = d.handleDiskFull(err)
+			}
+			d.mu.compact.compactingCount--
+			// The previous compaction may have produced too many files in a
+			// level, so reschedule another compaction if needed.
+			d.maybeScheduleCompaction()
+			d.mu.compact.cond.Broadcast()
+		})
 	})
 }
 
@@ -2522,8 +2590,12 @@ func (d *DB) compact1(c *compaction, errChannel chan error) (err error) {
 	ve, pendingOutputs, err := d.runCompaction(jobID, c)
 
 	info.Duration = d.timeNow().Sub(startTime)
+	// Acquire logLock. This will be released either through a call to
+	// logAndApply if there is no error, or by way of logUnlock once the
+	// compaction is rolled back (see removeInProgressCompaction).
+	d.mu.versions.logLock()
+	var unlockManifest bool
 	if err == nil {
-		d.mu.versions.logLock()
 		err = d.mu.versions.logAndApply(jobID, ve, c.metrics, false /* forceRotation */, func() []compactionInfo {
 			return d.getInProgressCompactionInfoLocked(c)
 		})
@@ -2537,6 +2609,8 @@ func (d *DB) compact1(c *compaction, errChannel chan error) (err error) {
 			}
 			d.mu.versions.updateObsoleteTableMetricsLocked()
 		}
+	} else {
+		unlockManifest = true
 	}
 
 	info.Done = true
@@ -2550,6 +2624,9 @@ func (d *DB) compact1(c *compaction, errChannel chan error) (err error) {
 
 	d.maybeUpdateDeleteCompactionHints(c)
 	d.removeInProgressCompaction(c, err != nil)
+	if unlockManifest {
+		d.mu.versions.logUnlock()
+	}
 	d.mu.versions.incrementCompactions(c.kind, c.extraLevels)
 	d.mu.versions.incrementCompactionBytes(-c.bytesWritten)
 
@@ -2569,6 +2646,107 @@ func (d *DB) compact1(c *compaction, errChannel chan error) (err error) {
 	return err
 }
 
+// flushBacklogged returns true if immutable memtables beyond the flushing
+// ones being flushed are queued, indicating that flushes are falling behind
+// and that a write stall may be imminent.
+func (d *DB) flushBacklogged(flushing int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// The last memtable in the queue is the mutable memtable.
+	return len(d.mu.mem.queue)-1 > flushing
+}
+
+// historyRetentionSeqNum returns the sequence number at or above which flushes
+// and compactions must retain every version of every key, as configured by
+// Options.Experimental.HistoryRetentionSeqNums and HistoryRetentionDuration,
+// or as pinned by DB.PinSeqNum. It returns zero if history retention is
+// disabled.
+//
+// d.mu must be held when calling this.
+func (d *DB) historyRetentionSeqNum() uint64 {
+	var seqNum uint64
+	visibleSeqNum := atomic.LoadUint64(&d.mu.versions.atomic.visibleSeqNum)
+	if window := d.opts.Experimental.HistoryRetentionSeqNums; window != 0 {
+		if visibleSeqNum <= window {
+			// The entire history of the DB falls within the window.
+			return 1
+		}
+		seqNum = visibleSeqNum - window
+	}
+	if dur := d.opts.Experimental.HistoryRetentionDuration; dur != 0 {
+		now := d.timeNow()
+		d.sampleHistoryLocked(visibleSeqNum)
+		// Every key written within the duration has a sequence number at or
+		// above that of the most recent sample taken at least the duration
+		// ago. The earlier samples are no longer needed.
+		samples := d.mu.historySamples
+		i := sort.Search(len(samples), func(i int) bool {
+			return now.Sub(samples[i].time) < dur
+		})
+		if i == 0 {
+			// The entire history of the DB may fall within the duration.
+			return 1
+		}
+		d.mu.historySamples = samples[i-1:]
+		if s := samples[i-1].seqNum; seqNum == 0 || s < seqNum {
+			seqNum = s
+		}
+	}
+	for p := range d.mu.seqNumPins {
+		if seqNum == 0 || p.seqNum < seqNum {
+			seqNum = p.seqNum
+		}
+	}
+	return seqNum
+}
+
+// seqNumSample records that every key written after the sample was taken has a
+// sequence number at or above seqNum.
+type seqNumSample struct {
+	seqNum uint64
+	time   time.Time
+}
+
+// historySamplesPerDuration bounds the number of samples retained for
+// Options.Experimental.HistoryRetentionDuration, by limiting the rate at which
+// they're taken. History may be retained for up to 1/historySamplesPerDuration
+// longer than the duration, in addition to the delay until the next flush or
+// compaction.
+const historySamplesPerDuration = 64
+
+// sampleHistoryLocked records that every key written from now on has a
+// sequence number at or above seqNum, unless a sample was taken recently. It's
+// a noop if Options.Experimental.HistoryRetentionDuration isn't set.
+//
+// d.mu must be held when calling this.
+func (d *DB) sampleHistoryLocked(seqNum uint64) {
+	dur := d.opts.Experimental.HistoryRetentionDuration
+	if dur == 0 {
+		return
+	}
+	now := d.timeNow()
+	if n := len(d.mu.historySamples); n > 0 &&
+		now.Sub(d.mu.historySamples[n-1].time) < dur/historySamplesPerDuration {
+		return
+	}
+	d.mu.historySamples = append(d.mu.historySamples, seqNumSample{seqNum: seqNum, time: now})
+}
+
+// addSnapshotBoundary returns the ascending snapshots slice with seqNum
+// inserted, if it's not already present. The provided slice may be modified.
+func addSnapshotBoundary(snapshots []uint64, seqNum uint64) []uint64 {
+	i := sort.Search(len(snapshots), func(i int) bool {
+		return snapshots[i] >= seqNum
+	})
+	if i < len(snapshots) && snapshots[i] == seqNum {
+		return snapshots
+	}
+	snapshots = append(snapshots, 0)
+	copy(snapshots[i+1:], snapshots[i:])
+	snapshots[i] = seqNum
+	return snapshots
+}
+
 // runCompactions runs a compaction that produces new on-disk tables from
 // memtables or old on-disk tables.
 //
@@ -2656,6 +2834,10 @@ func (d *DB) runCompaction(
 	}()
 
 	snapshots := d.mu.snapshots.toSlice()
+	retainHistorySeqNum := d.historyRetentionSeqNum()
+	if retainHistorySeqNum != 0 {
+		snapshots = addSnapshotBoundary(snapshots, retainHistorySeqNum)
+	}
 	formatVers := d.mu.formatVers.vers
 
 	// Release the d.mu lock while doing I/O.
@@ -2669,7 +2851,7 @@ func (d *DB) runCompaction(
 	}
 	c.allowedZeroSeqNum = c.allowZeroSeqNum()
 	iter := newCompactionIter(c.cmp, c.equal, c.formatKey, d.merge, iiter, snapshots,
-		&c.rangeDelFrag, &c.rangeKeyFrag, c.allowedZeroSeqNum, c.elideTombstone,
+		retainHistorySeqNum, &c.rangeDelFrag, &c.rangeKeyFrag, c.allowedZeroSeqNum, c.elideTombstone,
 		c.elideRangeTombstone, d.FormatMajorVersion())
 
 	var (
@@ -2760,7 +2942,9 @@ func (d *DB) runCompaction(
 		pendingOutputs = append(pendingOutputs, fileMeta.PhysicalMeta())
 		d.mu.Unlock()
 
-		writable, objMeta, err := d.objProvider.Create(context.TODO(), fileTypeTable, fileNum, objstorage.CreateOptions{} /* TODO */)
+		writable, objMeta, err := d.objProvider.Create(context.TODO(), fileTypeTable, fileNum, objstorage.CreateOptions{
+			PreferSharedStorage: d.opts.Experimental.CreateOnShared,
+		})
 		if err != nil {
 			return err
 		}
@@ -3045,6 +3229,13 @@ func (d *DB) runCompaction(
 	}
 	splitter := &splitterGroup{cmp: c.cmp, splitters: outputSplitters}
 
+	var outputPacer pacer
+	if c.flushing != nil && d.flushLimiter != nil {
+		outputPacer = newFlushPacer(d.flushLimiter, func() bool {
+			return d.flushBacklogged(len(c.flushing))
+		})
+	}
+
 	// Each outer loop iteration produces one output file. An iteration that
 	// produces a file containing point keys (and optionally range tombstones)
 	// guarantees that the input iterator advanced. An iteration that produces
@@ -3174,6 +3365,13 @@ func (d *DB) runCompaction(
 		if err := finishOutput(splitKey); err != nil {
 			return nil, pendingOutputs, err
 		}
+		// Pace the outputs of a flush, unless this was the final output.
+		if outputPacer != nil && len(ve.NewFiles) > 0 &&
+			(key != nil || !c.rangeDelFrag.Empty() || !c.rangeKeyFrag.Empty()) {
+			if err := outputPacer.maybeThrottle(ve.NewFiles[len(ve.NewFiles)-1].Meta.Size); err != nil {
+				return nil, pendingOutputs, err
+			}
+		}
 	}
 
 	for _, cl := range c.inputs {
@@ -202,6 +202,13 @@ type compactionIter struct {
 	// numbers define the snapshot stripes (see the Snapshots description
 	// above). The sequence numbers are in ascending order.
 	snapshots []uint64
+	// retainHistorySeqNum, if non-zero, is the sequence number at or above
+	// which every version of every key must be retained (see
+	// Options.Experimental.HistoryRetentionSeqNums). Each sequence number at or
+	// above retainHistorySeqNum is treated as if it were its own snapshot
+	// stripe. The caller is expected to have also included retainHistorySeqNum
+	// within snapshots so that it forms the boundary of the stripe beneath it.
+	retainHistorySeqNum uint64
 	// frontiers holds a heap of user keys that affect compaction behavior when
 	// they're exceeded. Before a new key is returned, the compaction iterator
 	// advances the frontier, notifying any code that subscribed to be notified
@@ -238,6 +245,7 @@ func newCompactionIter(
 	merge Merge,
 	iter internalIterator,
 	snapshots []uint64,
+	retainHistorySeqNum uint64,
 	rangeDelFrag *keyspan.Fragmenter,
 	rangeKeyFrag *keyspan.Fragmenter,
 	allowZeroSeqNum bool,
@@ -250,6 +258,7 @@ func newCompactionIter(
 		merge:               merge,
 		iter:                iter,
 		snapshots:           snapshots,
+		retainHistorySeqNum: retainHistorySeqNum,
 		frontiers:           frontiers{cmp: cmp},
 		rangeDelFrag:        rangeDelFrag,
 		rangeKeyFrag:        rangeKeyFrag,
@@ -278,7 +287,7 @@ func (i *compactionIter) First() (*InternalKey, []byte) {
 		return nil, nil
 	}
 	if i.iterKey != nil {
-		i.curSnapshotIdx, i.curSnapshotSeqNum = snapshotIndex(i.iterKey.SeqNum(), i.snapshots)
+		i.curSnapshotIdx, i.curSnapshotSeqNum = i.snapshotIndex(i.iterKey.SeqNum())
 	}
 	i.pos = iterPosNext
 	return i.Next()
@@ -468,6 +477,23 @@ func snapshotIndex(seq uint64, snapshots []uint64) (int, uint64) {
 	return index, snapshots[index]
 }
 
+// snapshotIndex returns the index and sequence number of the snapshot stripe
+// containing seq. It's equivalent to the snapshotIndex function over
+// i.snapshots, except that when history retention is enabled, every sequence
+// number at or above i.retainHistorySeqNum is placed in a stripe of its own.
+// This prevents the compaction from collapsing any two versions of a key (or
+// eliding any tombstone) that fall within the retained window.
+func (i *compactionIter) snapshotIndex(seq uint64) (int, uint64) {
+	if i.retainHistorySeqNum == 0 || seq < i.retainHistorySeqNum {
+		return snapshotIndex(seq, i.snapshots)
+	}
+	// The stripe for seq behaves as if there were a snapshot at seq+1. The
+	// stripe indexes are offset beyond len(i.snapshots) so that they're
+	// distinct from (and ordered after) all of the stripes defined by
+	// i.snapshots.
+	return len(i.snapshots) + 1 + int(seq-i.retainHistorySeqNum), seq + 1
+}
+
 // skipInStripe skips over skippable keys in the same stripe and user key.
 func (i *compactionIter) skipInStripe() {
 	i.skip = true
@@ -537,14 +563,14 @@ func (i *compactionIter) nextInStripe() stripeChangeType {
 			prevKey.Trailer = i.keyTrailer
 			panic(fmt.Sprintf("pebble: invariant violation: %s and %s out of order", key, prevKey))
 		}
-		i.curSnapshotIdx, i.curSnapshotSeqNum = snapshotIndex(key.SeqNum(), i.snapshots)
+		i.curSnapshotIdx, i.curSnapshotSeqNum = i.snapshotIndex(key.SeqNum())
 		return newStripe
 	} else if !i.equal(i.key.UserKey, key.UserKey) {
-		i.curSnapshotIdx, i.curSnapshotSeqNum = snapshotIndex(key.SeqNum(), i.snapshots)
+		i.curSnapshotIdx, i.curSnapshotSeqNum = i.snapshotIndex(key.SeqNum())
 		return newStripe
 	}
 	origSnapshotIdx := i.curSnapshotIdx
-	i.curSnapshotIdx, i.curSnapshotSeqNum = snapshotIndex(key.SeqNum(), i.snapshots)
+	i.curSnapshotIdx, i.curSnapshotSeqNum = i.snapshotIndex(key.SeqNum())
 	switch key.Kind() {
 	case InternalKeyKindRangeDelete:
 		// Range tombstones need to be exposed by the compactionIter to the upper level
@@ -860,7 +886,7 @@ func (i *compactionIter) emitRangeDelChunk(fragmented keyspan.Span) {
 	currentIdx := -1
 	keys := fragmented.Keys[:0]
 	for _, k := range fragmented.Keys {
-		idx, _ := snapshotIndex(k.SeqNum(), i.snapshots)
+		idx, _ := i.snapshotIndex(k.SeqNum())
 		if currentIdx == idx {
 			continue
 		}
@@ -80,6 +80,7 @@ func TestCompactionIter(t *testing.T) {
 	var rangeKeys []keyspan.Span
 	var vals [][]byte
 	var snapshots []uint64
+	var retainHistorySeqNum uint64
 	var elideTombstones bool
 	var allowZeroSeqnum bool
 	var interleavingIter *keyspan.InterleavingIter
@@ -122,6 +123,7 @@ func TestCompactionIter(t *testing.T) {
 			merge,
 			iter,
 			snapshots,
+			retainHistorySeqNum,
 			&keyspan.Fragmenter{},
 			&keyspan.Fragmenter{},
 			allowZeroSeqnum,
@@ -163,6 +165,7 @@ func TestCompactionIter(t *testing.T) {
 
 			case "iter":
 				snapshots = snapshots[:0]
+				retainHistorySeqNum = 0
 				elideTombstones = false
 				allowZeroSeqnum = false
 				for _, arg := range d.CmdArgs {
@@ -175,6 +178,12 @@ func TestCompactionIter(t *testing.T) {
 							}
 							snapshots = append(snapshots, uint64(seqNum))
 						}
+					case "retain-history":
+						seqNum, err := strconv.ParseUint(arg.Vals[0], 10, 64)
+						if err != nil {
+							return err.Error()
+						}
+						retainHistorySeqNum = seqNum
 					case "elide-tombstones":
 						var err error
 						elideTombstones, err = strconv.ParseBool(arg.Vals[0])
@@ -194,6 +203,9 @@ func TestCompactionIter(t *testing.T) {
 				sort.Slice(snapshots, func(i, j int) bool {
 					return snapshots[i] < snapshots[j]
 				})
+				if retainHistorySeqNum != 0 {
+					snapshots = addSnapshotBoundary(snapshots, retainHistorySeqNum)
+				}
 
 				iter := newIter(formatVersion)
 				var b bytes.Buffer
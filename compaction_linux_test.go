@@ -0,0 +1,116 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// ioprioIdle is the I/O priority of the idle class, as returned by
+// ioprio_get(2).
+const ioprioIdle = 3 << 13
+
+// getIOPriority returns the I/O priority of the calling thread.
+func getIOPriority() (uintptr, error) {
+	// A who of 0 with IOPRIO_WHO_PROCESS designates the calling thread.
+	prio, _, errno := unix.Syscall(unix.SYS_IOPRIO_GET, 1 /* IOPRIO_WHO_PROCESS */, 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return prio, nil
+}
+
+// ioPriorityFS records the I/O priorities of the threads writing the sstables
+// created through it.
+type ioPriorityFS struct {
+	vfs.FS
+	mu     sync.Mutex
+	prios  map[uintptr]int
+	tables int
+}
+
+func (fs *ioPriorityFS) Create(name string) (vfs.File, error) {
+	f, err := fs.FS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if fileType, _, ok := base.ParseFilename(fs.FS, fs.FS.PathBase(name)); ok && fileType == fileTypeTable {
+		fs.mu.Lock()
+		fs.tables++
+		fs.mu.Unlock()
+		return ioPriorityFile{File: f, fs: fs}, nil
+	}
+	return f, nil
+}
+
+type ioPriorityFile struct {
+	vfs.File
+	fs *ioPriorityFS
+}
+
+func (f ioPriorityFile) Write(p []byte) (int, error) {
+	prio, err := getIOPriority()
+	if err != nil {
+		return 0, err
+	}
+	f.fs.mu.Lock()
+	f.fs.prios[prio]++
+	f.fs.mu.Unlock()
+	return f.File.Write(p)
+}
+
+// TestCompactionBackgroundIOPriority tests that the sstables written by
+// flushes and compactions are written at Options.Experimental.BackgroundIOPriority.
+func TestCompactionBackgroundIOPriority(t *testing.T) {
+	var prio uintptr
+	vfs.WithIOPriority(vfs.IOPriorityIdle, func() {
+		var err error
+		prio, err = getIOPriority()
+		if err != nil {
+			t.Skipf("ioprio_get: %s", err)
+		}
+	})
+	if prio != ioprioIdle {
+		t.Skip("I/O priorities are not supported")
+	}
+
+	fs := &ioPriorityFS{FS: vfs.NewMem(), prios: make(map[uintptr]int)}
+	opts := &Options{
+		FS:                          fs,
+		DisableAutomaticCompactions: true,
+	}
+	opts.Experimental.BackgroundIOPriority = vfs.IOPriorityIdle
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	value := bytes.Repeat([]byte("v"), 100)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 1000; j++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("k%04d", j)), value, nil))
+		}
+		require.NoError(t, d.Flush())
+	}
+	require.NoError(t, d.Compact([]byte("k"), []byte("l"), false /* parallelize */))
+	require.Equal(t, int64(1), d.Metrics().Levels[numLevels-1].NumFiles)
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	// Three flushes and a compaction.
+	require.Equal(t, 4, fs.tables)
+	require.Len(t, fs.prios, 1)
+	require.Greater(t, fs.prios[ioprioIdle], 0)
+}
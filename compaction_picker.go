@@ -25,10 +25,16 @@ type compactionEnv struct {
 	earliestSnapshotSeqNum  uint64
 	inProgressCompactions   []compactionInfo
 	readCompactionEnv       readCompactionEnv
+	// deferNonEssentialCompactions is set outside the windows allowed by
+	// Options.Experimental.AllowNonEssentialCompactions, in which case
+	// automatic compactions that don't help keep up with writes (elision-only,
+	// read-triggered and rewrite compactions) aren't picked.
+	deferNonEssentialCompactions bool
 }
 
 type compactionPicker interface {
 	getScores([]compactionInfo) [numLevels]float64
+	planLevels(env compactionEnv) [numLevels]CompactionPlanLevel
 	getBaseLevel() int
 	getEstimatedMaxWAmp() float64
 	estimatedCompactionDebt(l0ExtraSize uint64) uint64
@@ -774,6 +780,30 @@ func (p *compactionPickerByScore) getScores(inProgress []compactionInfo) [numLev
 	return scores
 }
 
+// planLevels returns the scores of the levels, indexed by level, along with
+// the files that pickAuto would pick to compact from the levels with a score of
+// at least 1.
+func (p *compactionPickerByScore) planLevels(env compactionEnv) [numLevels]CompactionPlanLevel {
+	var levels [numLevels]CompactionPlanLevel
+	for _, info := range p.calculateScores(env.inProgressCompactions) {
+		l := &levels[info.level]
+		l.Score = info.score
+		l.RawScore = info.origScore
+		l.Size = levelCompensatedSize(p.vers.Levels[info.level])
+		if info.level > 0 {
+			l.MaxBytes = p.levelMaxBytes[info.level]
+		}
+		if info.score < 1 || info.level == 0 || info.level == numLevels-1 {
+			continue
+		}
+		if f, ok := p.pickFile(info.level, info.outputLevel, env.earliestSnapshotSeqNum); ok {
+			ti := f.TableInfo()
+			l.Candidate = &ti
+		}
+	}
+	return levels
+}
+
 func (p *compactionPickerByScore) getBaseLevel() int {
 	if p == nil {
 		return 1
@@ -1045,6 +1075,7 @@ func (p *compactionPickerByScore) calculateL0Score(
 	if info.score < fileScore {
 		info.score = fileScore
 	}
+	info.origScore = info.score
 	return info
 }
 
@@ -1261,6 +1292,13 @@ func (p *compactionPickerByScore) pickAuto(env compactionEnv) (pc *pickedCompact
 		}
 	}
 
+	// The remaining compactions are low-priority, as they don't help us keep
+	// up with writes. They are deferred to the windows allowed by
+	// Options.Experimental.AllowNonEssentialCompactions.
+	if env.deferNonEssentialCompactions {
+		return nil
+	}
+
 	// Check for L6 files with tombstones that may be elided. These files may
 	// exist if a snapshot prevented the elision of a tombstone or because of
 	// a move compaction. These are low-priority compactions because they
@@ -1613,10 +1651,15 @@ func pickL0(
 	}
 
 	// Couldn't choose a base compaction. Try choosing an intra-L0
-	// compaction. Note that we pass in L0CompactionThreshold here as opposed to
-	// 1, since choosing a single sublevel intra-L0 compaction is
-	// counterproductive.
-	lcf, err = vers.L0Sublevels.PickIntraL0Compaction(env.earliestUnflushedSeqNum, minIntraL0Count)
+	// compaction. Note that we pass in IntraL0CompactionMinStackDepth here as
+	// opposed to 1, since choosing a single sublevel intra-L0 compaction is
+	// counterproductive. Options that weren't passed through EnsureDefaults
+	// use the default depth.
+	minStackDepth := opts.Experimental.IntraL0CompactionMinStackDepth
+	if minStackDepth <= 0 {
+		minStackDepth = minIntraL0Count
+	}
+	lcf, err = vers.L0Sublevels.PickIntraL0Compaction(env.earliestUnflushedSeqNum, minStackDepth)
 	if err != nil {
 		opts.Logger.Infof("error when picking intra-L0 compaction: %s", err)
 		return
@@ -923,6 +923,7 @@ func TestCompactionPickerPickReadTriggered(t *testing.T) {
 					readCompactions: &rcList,
 					flushing:        false,
 				},
+				deferNonEssentialCompactions: td.HasArg("defer-non-essential"),
 			})
 			var result strings.Builder
 			if pc != nil {
@@ -0,0 +1,168 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cockroachdb/pebble/internal/humanize"
+)
+
+// CompactionPlan describes the automatic compactions that the compaction
+// picker would pick, along with the level scores it bases its decisions on. It
+// is returned by DB.DebugCompactionPlan.
+type CompactionPlan struct {
+	// BaseLevel is the level that L0 is compacted into.
+	BaseLevel int
+	// Levels holds the scores of the levels, indexed by level.
+	Levels [numLevels]CompactionPlanLevel
+	// InProgress is the number of compactions in progress, and
+	// MaxConcurrency the maximum number of concurrent compactions (see
+	// Options.MaxConcurrentCompactions).
+	InProgress     int
+	MaxConcurrency int
+	// Compactions lists the compactions that the picker would pick, in the
+	// order it would pick them. Each compaction is picked assuming that the
+	// previous ones are in progress. No more compactions are picked than
+	// would be allowed to run concurrently with the ones in progress.
+	Compactions []PlannedCompaction
+}
+
+// CompactionPlanLevel holds the compaction score of a level of the LSM.
+type CompactionPlanLevel struct {
+	// Score is the compaction score of the level, adjusted by the score of the
+	// next level so that compactions of the lower levels are prioritized.
+	// The picker considers compacting the levels with a score of at least 1,
+	// in order of decreasing score. RawScore is the unadjusted score, which is
+	// the ratio of Size to MaxBytes, or for L0, based on its sublevel and file
+	// counts.
+	Score    float64
+	RawScore float64
+	// Size is the size of the level, inflated by the estimated size of the
+	// data its tombstones delete. MaxBytes is the target size of the level,
+	// and is zero for L0.
+	Size     uint64
+	MaxBytes int64
+	// Candidate is the table the picker would compact from the level, or nil
+	// if the level's score is lower than 1. The candidates of L0, whose
+	// compactions are picked by sublevel, and of the bottommost level, which
+	// isn't compacted by score, are always nil.
+	Candidate *TableInfo
+}
+
+// PlannedCompaction describes a compaction that the picker would pick.
+type PlannedCompaction struct {
+	// Reason is the kind of the compaction, like CompactionInfo.Reason.
+	Reason string
+	// Score is the score of the level the compaction was picked for, or zero
+	// if the compaction isn't score-based.
+	Score float64
+	// Input contains the input tables of the compaction organized by level.
+	Input []LevelInfo
+	// OutputLevel is the level the compaction would write to.
+	OutputLevel int
+}
+
+// String implements fmt.Stringer.
+func (p *CompactionPlan) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "base level: L%d; compactions in progress: %d/%d\n",
+		p.BaseLevel, p.InProgress, p.MaxConcurrency)
+	fmt.Fprintf(&buf, "      score  raw-score      size  max-size  candidate\n")
+	for level := range p.Levels {
+		l := &p.Levels[level]
+		if level != 0 && level < p.BaseLevel {
+			continue
+		}
+		maxSize := "-"
+		if level > 0 {
+			maxSize = humanize.Int64(l.MaxBytes).String()
+		}
+		candidate := "-"
+		if l.Candidate != nil {
+			candidate = l.Candidate.FileNum.String()
+		}
+		fmt.Fprintf(&buf, "L%d  %7.2f  %9.2f  %8s  %8s  %s\n",
+			level, l.Score, l.RawScore, humanize.Uint64(l.Size), maxSize, candidate)
+	}
+	if len(p.Compactions) == 0 {
+		fmt.Fprintf(&buf, "no compactions\n")
+	}
+	for _, c := range p.Compactions {
+		fmt.Fprintf(&buf, "%s compaction to L%d (score %.2f):", c.Reason, c.OutputLevel, c.Score)
+		for _, in := range c.Input {
+			fmt.Fprintf(&buf, " %s", in)
+		}
+		fmt.Fprintf(&buf, "\n")
+	}
+	return buf.String()
+}
+
+// DebugCompactionPlan returns the automatic compactions that the compaction
+// picker would pick right now, and the level scores it bases its decisions on,
+// without running the compactions. It's meant to help tuning the compaction
+// options. The plan doesn't include manual compactions, delete-only
+// compactions or flushes, and ignores Options.DisableAutomaticCompactions.
+func (d *DB) DebugCompactionPlan() *CompactionPlan {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Like compaction picking, planning needs a coherent view of the current
+	// version (see DB.maybeScheduleCompactionPicker).
+	d.mu.versions.logLock()
+	defer d.mu.versions.logUnlock()
+
+	picker := d.mu.versions.picker
+	plan := &CompactionPlan{
+		BaseLevel:      picker.getBaseLevel(),
+		InProgress:     d.mu.compact.compactingCount,
+		MaxConcurrency: d.opts.MaxConcurrentCompactions(),
+	}
+	// The read compactions are copied, so that the picker doesn't consume the
+	// DB's queue.
+	readCompactions := d.mu.compact.readCompactions
+	env := compactionEnv{
+		earliestSnapshotSeqNum:  d.mu.snapshots.earliest(),
+		earliestUnflushedSeqNum: d.getEarliestUnflushedSeqNumLocked(),
+		inProgressCompactions:   d.getInProgressCompactionInfoLocked(nil),
+		readCompactionEnv: readCompactionEnv{
+			readCompactions: &readCompactions,
+			flushing:        d.mu.compact.flushing || d.passedFlushThreshold(),
+		},
+	}
+	plan.Levels = picker.planLevels(env)
+
+	// The planned compactions are added to the in-progress compactions like
+	// the picked ones, marking their input tables as compacting, so that the
+	// next picks exclude them. They're rolled back once the plan is complete;
+	// since d.mu is held throughout, no compaction picker observes them.
+	var planned []*compaction
+	defer func() {
+		for _, c := range planned {
+			d.removeInProgressCompaction(c, true /* rollback */)
+		}
+	}()
+	for n := plan.InProgress; n < plan.MaxConcurrency; n++ {
+		pc := picker.pickAuto(env)
+		if pc == nil {
+			break
+		}
+		c := newCompaction(pc, d.opts)
+		d.addInProgressCompaction(c)
+		planned = append(planned, c)
+		env.inProgressCompactions = d.getInProgressCompactionInfoLocked(nil)
+		info := c.makeInfo(0 /* jobID */)
+		plan.Compactions = append(plan.Compactions, PlannedCompaction{
+			Reason:      info.Reason,
+			Score:       c.score,
+			Input:       info.Input,
+			OutputLevel: info.Output.Level,
+		})
+	}
+	return plan
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/datadriven"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugCompactionPlan(t *testing.T) {
+	opts := &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		L0CompactionThreshold:       2,
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	plan := d.DebugCompactionPlan()
+	require.Empty(t, plan.Compactions)
+	require.Contains(t, plan.String(), "no compactions")
+
+	// Flush overlapping tables into L0, stacking them into sublevels.
+	for i := 0; i < 3; i++ {
+		for _, k := range []string{"a", "z"} {
+			require.NoError(t, d.Set([]byte(k), []byte(fmt.Sprint(i)), nil))
+		}
+		require.NoError(t, d.Flush())
+	}
+
+	plan = d.DebugCompactionPlan()
+	require.Equal(t, numLevels-1, plan.BaseLevel)
+	require.Equal(t, 0, plan.InProgress)
+	require.Equal(t, 1, plan.MaxConcurrency)
+	require.GreaterOrEqual(t, plan.Levels[0].Score, 1.0)
+	require.Equal(t, int64(0), plan.Levels[0].MaxBytes)
+	require.NotZero(t, plan.Levels[0].Size)
+	require.Equal(t, 3.0, plan.Levels[0].RawScore)
+	require.Len(t, plan.Compactions, 1)
+	c := plan.Compactions[0]
+	require.Equal(t, "default", c.Reason)
+	require.Equal(t, plan.Levels[0].Score, c.Score)
+	require.Equal(t, numLevels-1, c.OutputLevel)
+	require.Equal(t, 0, c.Input[0].Level)
+	require.Len(t, c.Input[0].Tables, 3)
+	require.Contains(t, plan.String(), "default compaction to L6")
+
+	// Planning doesn't run the compactions.
+	m := d.Metrics()
+	require.Equal(t, int64(3), m.Levels[0].NumFiles)
+	require.Equal(t, int64(0), m.Compact.Count)
+}
+
+func TestDebugCompactionPlanConcurrency(t *testing.T) {
+	opts := &Options{
+		DisableAutomaticCompactions: true,
+		MaxConcurrentCompactions:    func() int { return 3 },
+	}
+	// Allow concurrent compactions regardless of the compaction debt.
+	opts.Experimental.CompactionDebtConcurrency = 1
+	d, err := runDBDefineCmd(&datadriven.TestData{
+		Cmd: "define",
+		CmdArgs: []datadriven.CmdArg{
+			{Key: "level-max-bytes", Vals: []string{"L5:1"}},
+		},
+		Input: "L5\na.SET.3:a\nL5\nx.SET.3:x\nL6\na.SET.1:a\nL6\nx.SET.1:x",
+	}, opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Both of the tables of L5 are compacted, once each, as the tables of a
+	// planned compaction are excluded from the later ones.
+	plan := d.DebugCompactionPlan()
+	require.Equal(t, 3, plan.MaxConcurrency)
+	require.Len(t, plan.Compactions, 2, "%s", plan)
+	tables := make(map[FileNum]bool)
+	for _, c := range plan.Compactions {
+		require.Equal(t, 6, c.OutputLevel)
+		for _, in := range c.Input {
+			for _, f := range in.Tables {
+				require.False(t, tables[f.FileNum], "%s planned twice:\n%s", f.FileNum, plan)
+				tables[f.FileNum] = true
+			}
+		}
+	}
+	require.Len(t, tables, 4)
+
+	// Planning leaves the tables available for compaction.
+	require.Equal(t, plan.String(), d.DebugCompactionPlan().String())
+}
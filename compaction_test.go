@@ -60,6 +60,10 @@ func (p *compactionPickerForTesting) getScores([]compactionInfo) [numLevels]floa
 	return [numLevels]float64{}
 }
 
+func (p *compactionPickerForTesting) planLevels(compactionEnv) [numLevels]CompactionPlanLevel {
+	return [numLevels]CompactionPlanLevel{}
+}
+
 func (p *compactionPickerForTesting) getBaseLevel() int {
 	return p.baseLevel
 }
@@ -2890,6 +2894,67 @@ func TestCompactionErrorOnUserKeyOverlap(t *testing.T) {
 		})
 }
 
+func TestCompactionNonEssentialDeferred(t *testing.T) {
+	var allowed atomic.Bool
+	opts := &Options{FS: vfs.NewMem()}
+	opts.Experimental.AllowNonEssentialCompactions = allowed.Load
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Write an L6 table whose deletion tombstones are retained by a snapshot,
+	// making it a candidate for an elision-only compaction once the snapshot
+	// is closed.
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%02d", i)), []byte("v"), nil))
+	}
+	require.NoError(t, d.Flush())
+	s := d.NewSnapshot()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Delete([]byte(fmt.Sprintf("k%02d", i)), nil))
+	}
+	require.NoError(t, d.Compact([]byte("k"), []byte("l"), false /* parallelize */))
+	d.mu.Lock()
+	d.waitTableStats()
+	d.mu.Unlock()
+
+	waitForCompactions := func() {
+		d.mu.Lock()
+		for d.mu.compact.compactingCount > 0 {
+			d.mu.compact.cond.Wait()
+		}
+		d.mu.Unlock()
+	}
+	require.NoError(t, s.Close())
+	waitForCompactions()
+	require.Equal(t, int64(0), d.Metrics().Compact.ElisionOnlyCount)
+
+	allowed.Store(true)
+	d.ScheduleCompactions()
+	waitForCompactions()
+	require.Equal(t, int64(1), d.Metrics().Compact.ElisionOnlyCount)
+}
+
+func TestCompactionWindows(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2023, 6, 1, hour, minute, 0, 0, time.Local)
+	}
+	night := CompactionWindow{Start: 22 * time.Hour, End: 6 * time.Hour}
+	lunch := CompactionWindow{Start: 12 * time.Hour, End: 13*time.Hour + 30*time.Minute}
+	windows := []CompactionWindow{night, lunch}
+
+	require.True(t, inCompactionWindows(at(23, 0), windows))
+	require.True(t, inCompactionWindows(at(0, 0), windows))
+	require.True(t, inCompactionWindows(at(5, 59), windows))
+	require.False(t, inCompactionWindows(at(6, 0), windows))
+	require.False(t, inCompactionWindows(at(11, 59), windows))
+	require.True(t, inCompactionWindows(at(12, 0), windows))
+	require.True(t, inCompactionWindows(at(13, 29), windows))
+	require.False(t, inCompactionWindows(at(13, 30), windows))
+	require.False(t, inCompactionWindows(at(21, 59), windows))
+	require.False(t, inCompactionWindows(at(0, 0), nil))
+}
+
 // TestCompactionErrorCleanup tests an error encountered during a compaction
 // after some output tables have been created. It ensures that the pending
 // output tables are removed from the filesystem.
@@ -3930,3 +3995,49 @@ func TestCompaction_LogAndApplyFails(t *testing.T) {
 		})
 	}
 }
+
+func TestHistoryRetentionDuration(t *testing.T) {
+	opts := &Options{FS: vfs.NewMem(), DisableAutomaticCompactions: true}
+	opts.Experimental.HistoryRetentionDuration = time.Hour
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	var now int64
+	d.mu.Lock()
+	d.timeNow = func() time.Time { return time.Unix(atomic.LoadInt64(&now), 0) }
+	d.mu.Unlock()
+	advance := func(dur time.Duration) {
+		atomic.AddInt64(&now, int64(dur/time.Second))
+	}
+
+	setAndCompact := func(values ...string) {
+		for _, v := range values {
+			require.NoError(t, d.Set([]byte("a"), []byte(v), nil))
+		}
+		require.NoError(t, d.Flush())
+		require.NoError(t, d.Compact([]byte("a"), []byte("b"), false))
+	}
+	versions := func() []string {
+		var vals []string
+		require.NoError(t, d.ScanInternal([]byte("a"), []byte("b"), func(_ *InternalKey, v LazyValue) error {
+			vals = append(vals, string(v.InPlaceValue()))
+			return nil
+		}, nil, nil))
+		return vals
+	}
+
+	setAndCompact("1")
+	require.Equal(t, []string{"1"}, versions())
+
+	// Every version written within the last hour is retained, along with the
+	// version visible at the start of the window.
+	advance(2 * time.Hour)
+	setAndCompact("2", "3")
+	require.Equal(t, []string{"3", "2", "1"}, versions())
+
+	// The versions that fall out of the window are collapsed by the next
+	// compaction rewriting the keys.
+	advance(2 * time.Hour)
+	setAndCompact("4")
+	require.Equal(t, []string{"4", "3"}, versions())
+}
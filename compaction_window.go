@@ -0,0 +1,45 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import "time"
+
+// CompactionWindow is a daily window of time during which non-essential
+// compactions are allowed (see CompactionWindows). Start and End are offsets
+// from midnight in the local time zone; a window whose End precedes its Start
+// spans midnight.
+type CompactionWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// contains returns true if the time of day of t is within the window.
+func (w CompactionWindow) contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// CompactionWindows returns a function for
+// Options.Experimental.AllowNonEssentialCompactions that allows non-essential
+// compactions only within the given daily windows.
+func CompactionWindows(windows ...CompactionWindow) func() bool {
+	return func() bool {
+		return inCompactionWindows(time.Now(), windows)
+	}
+}
+
+func inCompactionWindows(t time.Time, windows []CompactionWindow) bool {
+	for _, w := range windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
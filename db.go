@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -21,6 +22,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/keyspan"
 	"github.com/cockroachdb/pebble/internal/manifest"
 	"github.com/cockroachdb/pebble/internal/manual"
+	"github.com/cockroachdb/pebble/internal/rangekey"
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/record"
 	"github.com/cockroachdb/pebble/sstable"
@@ -48,6 +50,11 @@ var (
 	// ErrReadOnly is returned when a write operation is performed on a read-only
 	// database.
 	ErrReadOnly = errors.New("pebble: read-only")
+	// ErrDiskFull is returned when a write operation is performed on a database
+	// that transitioned into read-only mode after running out of disk space.
+	// See Options.Experimental.ReadOnlyOnDiskFull and DB.ResumeWrites. Use
+	// errors.Is(err, ErrDiskFull) to check for this error.
+	ErrDiskFull = errors.New("pebble: read-only: out of disk space")
 	// errNoSplit indicates that the user is trying to perform a range key
 	// operation but the configured Comparer does not provide a Split
 	// implementation.
@@ -250,6 +257,19 @@ type DB struct {
 
 		// The number of bytes available on disk.
 		diskAvailBytes uint64
+
+		// The disk full state of the DB; one of the diskFull* constants. See
+		// Options.Experimental.ReadOnlyOnDiskFull.
+		diskFull uint32
+
+		// The counts of the batches rejected for exceeding the size limits of
+		// Options.Experimental.MaxKeySize, MaxValueSize and MaxBatchSize.
+		keyTooLargeCount   int64
+		valueTooLargeCount int64
+		batchTooLargeCount int64
+
+		// The number of open Iterators, used to estimate their memory usage.
+		iterCount int64
 	}
 
 	cacheID        uint64
@@ -298,6 +318,9 @@ type DB struct {
 	closedCh chan struct{}
 
 	deletionLimiter limiter
+	// flushLimiter paces the output sstables of flushes. It is nil if
+	// Options.Experimental.FlushOutputPacingRate is zero.
+	flushLimiter limiter
 
 	// Async deletion jobs spawned by cleaners increment this WaitGroup, and
 	// call Done when completed. Once `d.mu.cleaning` is false, the db.Close()
@@ -366,8 +389,13 @@ type DB struct {
 			// The LogWriter is protected by commitPipeline.mu. This allows log
 			// writes to be performed without holding DB.mu, but requires both
 			// commitPipeline.mu and DB.mu to be held when rotating the WAL/memtable
-			// (i.e. makeRoomForWrite).
-			*record.LogWriter
+			// (i.e. makeRoomForWrite). The walWriter wraps the LogWriter of the
+			// current WAL, encrypting its records if
+			// Options.Experimental.WALCipher is set.
+			walWriter
+			// The pending syncs of the records carried over to new WALs by
+			// logCarriedOverRecordsLocked, in the order of the WALs.
+			carriedOverSyncs []*carriedOverSync
 			// Can be nil.
 			metrics struct {
 				fsyncLatency prometheus.Histogram
@@ -445,6 +473,27 @@ type DB struct {
 		// The list of active snapshots.
 		snapshots snapshotList
 
+		// The snapshots pinning the views of the snapshots exported by
+		// Snapshot.Export, keyed by name. The pins are in the list of active
+		// snapshots, but aren't returned to the user.
+		exportedSnapshots map[string]*Snapshot
+
+		// The sequence numbers pinned by DB.PinSeqNum which haven't yet been
+		// released. Like the pins of exported snapshots, they're in the list
+		// of active snapshots.
+		seqNumPins map[*SeqNumPin]struct{}
+
+		// The sequence numbers sampled over time, oldest first, to determine
+		// the history retained by Options.Experimental.HistoryRetentionDuration.
+		historySamples []seqNumSample
+
+		// The transactions prepared by Batch.Prepare which haven't yet been
+		// committed or rolled back, keyed by transaction ID.
+		preparedTxns map[string]*preparedTxn
+
+		// The idempotency tokens of the committed batches which are retained.
+		idempotencyTokens idempotencyTokens
+
 		tableStats struct {
 			// Condition variable used to signal the completion of a
 			// job to collect table stats.
@@ -503,6 +552,202 @@ func (d *DB) Get(key []byte) ([]byte, io.Closer, error) {
 	return d.getInternal(key, nil /* batch */, nil /* snapshot */)
 }
 
+// GetPinned gets the value for the given key, returning a handle to the value
+// rather than the value itself. It returns ErrNotFound if the DB does not
+// contain the key.
+//
+// Unlike Get, GetPinned does not retrieve the value until PinnedValue.Value is
+// called, which allows the caller to inspect the length of the value before
+// deciding whether to read it. The value references the memtable or block
+// cache directly where possible and is not copied. It is safe to modify the
+// contents of the argument after GetPinned returns. On success, the caller
+// MUST call PinnedValue.Close() or a memory leak will occur.
+//
+// The PinnedValue is returned by value to avoid an allocation per lookup, and
+// must not be copied: Close must be called on a single copy.
+func (d *DB) GetPinned(key []byte) (PinnedValue, error) {
+	return d.getPinnedInternal(key, nil /* batch */, nil /* snapshot */)
+}
+
+// Exists returns whether the DB contains the given key. It's equivalent to
+// calling Get and checking for ErrNotFound, but it never retrieves the key's
+// value.
+//
+// Like Get, Exists looks the key up level by level, from the newest data to
+// the oldest, stopping at the most recent entry of the key. The sstables are
+// positioned using the prefix of the key (see Comparer.Split), so that an
+// sstable whose filter excludes the prefix is skipped without loading a data
+// block. The data blocks of the remaining sstables are loaded to find the
+// key's most recent entry, but its value is never read, and values stored out
+// of band (see Options.Experimental.EnableValueBlocks) are never loaded.
+//
+// It is safe to modify the contents of the argument after Exists returns.
+func (d *DB) Exists(key []byte) (bool, error) {
+	return d.existsInternal(key, nil /* snapshot */)
+}
+
+func (d *DB) existsInternal(key []byte, s *Snapshot) (bool, error) {
+	var prefix []byte
+	if split := d.opts.Comparer.Split; split != nil {
+		prefix = key[:split(key)]
+	}
+	i := d.newGetIter(key, nil /* batch */, s, prefix)
+	found := false
+	// The getIter only returns the visible entries of the key, from the most
+	// recent one, which determines whether the key exists. Merge operands are
+	// not merged, as the result of a merge always exists.
+	if ikey, _ := i.getIterAlloc.get.First(); ikey != nil {
+		switch ikey.Kind() {
+		case InternalKeyKindDelete, InternalKeyKindSingleDelete:
+		default:
+			found = true
+		}
+	}
+	if err := i.Close(); err != nil {
+		return false, err
+	}
+	return found, nil
+}
+
+// MultiGet gets the values for the given keys, returning them in the same
+// order as the keys. The value of a key that the DB does not contain is nil;
+// the value of a key that's present with an empty value is a non-nil empty
+// slice.
+//
+// MultiGet reads all of the keys from a single consistent view of the DB.
+// The keys are looked up in sorted order using a single iterator, allowing
+// lookups of nearby keys to share the positioning of the iterator over the
+// memtables, sstables and blocks of the LSM rather than descending through
+// the LSM anew for each key.
+//
+// Unlike Get, MultiGet doesn't return a Closer per key, and the returned
+// values don't reference the memtables or block cache. Instead, the values are
+// copied into a single buffer allocated by MultiGet, which is owned by the
+// caller. The copy costs a memcpy of the total size of the values found, and
+// the buffer remains allocated as long as any of the returned values is
+// referenced, so retaining a small value also retains the values of every
+// other key. Callers reading large values, or retaining few of them, should
+// prefer Get or GetPinned, which avoid the copy. It is safe to modify the
+// contents of the argument after MultiGet returns.
+func (d *DB) MultiGet(keys [][]byte) ([][]byte, error) {
+	iter := d.NewIter(nil)
+	return multiGet(iter, d.cmp, d.equal, d.opts.Comparer.Split, keys)
+}
+
+// multiGet looks up the given keys using the provided iterator, closing the
+// iterator before it returns.
+func multiGet(
+	iter *Iterator, cmp Compare, equal Equal, split Split, keys [][]byte,
+) ([][]byte, error) {
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return cmp(keys[order[i]], keys[order[j]]) < 0
+	})
+
+	// The values are copied into a single buffer in order to avoid an
+	// allocation per key.
+	var buf []byte
+	type span struct{ start, end int }
+	spans := make([]span, len(keys))
+	found := make([]bool, len(keys))
+	for n, idx := range order {
+		key := keys[idx]
+		if n > 0 && equal(key, keys[order[n-1]]) {
+			prev := order[n-1]
+			spans[idx], found[idx] = spans[prev], found[prev]
+			continue
+		}
+		var valid bool
+		if split != nil {
+			valid = iter.SeekPrefixGE(key)
+		} else {
+			valid = iter.SeekGE(key)
+		}
+		if !valid {
+			// The seek resets the iterator's error, so the error of each
+			// seek must be checked before the next one.
+			if err := iter.Error(); err != nil {
+				return nil, firstError(err, iter.Close())
+			}
+			continue
+		}
+		if !equal(iter.Key(), key) {
+			continue
+		}
+		val, err := iter.ValueAndErr()
+		if err != nil {
+			return nil, firstError(err, iter.Close())
+		}
+		spans[idx] = span{start: len(buf), end: len(buf) + len(val)}
+		found[idx] = true
+		buf = append(buf, val...)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	if buf == nil {
+		buf = []byte{}
+	}
+	values := make([][]byte, len(keys))
+	for i := range values {
+		if found[i] {
+			values[i] = buf[spans[i].start:spans[i].end:spans[i].end]
+		}
+	}
+	return values, nil
+}
+
+// PinnedValue is a handle to a value returned by GetPinned. It pins the
+// memtables and sstables that may be referenced by the value, which remain
+// pinned until Close is called. The zero PinnedValue is closed.
+type PinnedValue struct {
+	iter    *Iterator
+	fetched bool
+	value   []byte
+}
+
+// Len returns the length of the value. It does not require the value to be
+// retrieved. It returns zero once the PinnedValue is closed.
+func (v *PinnedValue) Len() int {
+	if v.iter == nil {
+		return 0
+	}
+	return v.iter.value.Len()
+}
+
+// Value returns the value, retrieving it if necessary. The caller should not
+// modify the contents of the returned slice, which remains valid until Close
+// is called. It returns ErrClosed once the PinnedValue is closed.
+func (v *PinnedValue) Value() ([]byte, error) {
+	if v.iter == nil {
+		return nil, ErrClosed
+	}
+	if !v.fetched {
+		val, err := v.iter.ValueAndErr()
+		if err != nil {
+			return nil, err
+		}
+		v.value = val
+		v.fetched = true
+	}
+	return v.value, nil
+}
+
+// Close releases the value. The PinnedValue and any slice returned by Value
+// must not be used after Close is called.
+func (v *PinnedValue) Close() error {
+	i := v.iter
+	if i == nil {
+		return ErrClosed
+	}
+	*v = PinnedValue{}
+	return i.Close()
+}
+
 type getIterAlloc struct {
 	dbi    Iterator
 	keyBuf []byte
@@ -516,6 +761,47 @@ var getIterAllocPool = sync.Pool{
 }
 
 func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer, error) {
+	i, err := d.getIterInternal(key, b, s)
+	if err != nil {
+		return nil, nil, err
+	}
+	val, err := i.ValueAndErr()
+	if err != nil {
+		// The value may be stored in a value block that failed to load.
+		_ = i.Close()
+		return nil, nil, err
+	}
+	return val, i, nil
+}
+
+func (d *DB) getPinnedInternal(key []byte, b *Batch, s *Snapshot) (PinnedValue, error) {
+	i, err := d.getIterInternal(key, b, s)
+	if err != nil {
+		return PinnedValue{}, err
+	}
+	// The PinnedValue isn't part of the pooled getIterAlloc, which is released
+	// when the iterator is closed, as the caller may still hold it.
+	return PinnedValue{iter: i}, nil
+}
+
+// getIterInternal returns an Iterator positioned at the most recent visible
+// value for the given key, or ErrNotFound if there is no such value.
+func (d *DB) getIterInternal(key []byte, b *Batch, s *Snapshot) (*Iterator, error) {
+	i := d.newGetIter(key, b, s, nil /* prefix */)
+	if !i.First() {
+		err := i.Close()
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrNotFound
+	}
+	return i, nil
+}
+
+// newGetIter returns an unpositioned Iterator over the entries of the given
+// key, backed by a getIter. If prefix is non-nil, it's the prefix of the key,
+// which is used to position the sstables using SeekPrefixGE.
+func (d *DB) newGetIter(key []byte, b *Batch, s *Snapshot, prefix []byte) *Iterator {
 	if err := d.closed.Load(); err != nil {
 		panic(err)
 	}
@@ -548,6 +834,10 @@ func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer,
 		mem:      readState.memtables,
 		l0:       readState.current.L0SublevelFiles,
 		version:  readState.current,
+		prefix:   prefix,
+	}
+	if prefix != nil {
+		get.split = d.opts.Comparer.Split
 	}
 
 	// Strip off memtables which cannot possibly contain the seqNum being read
@@ -560,6 +850,7 @@ func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer,
 		get.mem = get.mem[:n-1]
 	}
 
+	atomic.AddInt64(&d.atomic.iterCount, 1)
 	i := &buf.dbi
 	pointIter := get
 	*i = Iterator{
@@ -572,15 +863,7 @@ func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer,
 		readState:    readState,
 		keyBuf:       buf.keyBuf,
 	}
-
-	if !i.First() {
-		err := i.Close()
-		if err != nil {
-			return nil, nil, err
-		}
-		return nil, nil, ErrNotFound
-	}
-	return i.Value(), i, nil
+	return i
 }
 
 // Set sets the value for the given key. It overwrites any previous value
@@ -759,6 +1042,56 @@ func (d *DB) ApplyNoSyncWait(batch *Batch, opts *WriteOptions) error {
 	return d.applyInternal(batch, opts, true)
 }
 
+// checkWriteSizeLimits returns an error if the batch exceeds one of the limits
+// on the size of writes (see Options.Experimental.MaxKeySize), counting the
+// rejection in the DB's metrics. Two-phase commit markers aren't checked,
+// because the prepared batch was checked by Batch.Prepare.
+func (d *DB) checkWriteSizeLimits(b *Batch) error {
+	maxKeySize := d.opts.Experimental.MaxKeySize
+	maxValueSize := d.opts.Experimental.MaxValueSize
+	maxBatchSize := d.opts.Experimental.MaxBatchSize
+	if (maxKeySize == 0 && maxValueSize == 0 && maxBatchSize == 0) || b.txnMarker {
+		return nil
+	}
+	if maxBatchSize > 0 && len(b.data) > maxBatchSize {
+		atomic.AddInt64(&d.atomic.batchTooLargeCount, 1)
+		return errors.Mark(errors.Newf("pebble: batch too large: %d bytes exceeds MaxBatchSize of %d bytes",
+			errors.Safe(len(b.data)), errors.Safe(maxBatchSize)), ErrBatchTooLarge)
+	}
+	for r := b.Reader(); ; {
+		kind, ukey, value, ok := r.Next()
+		if !ok {
+			// An invalid batch fails to commit regardless.
+			return nil
+		}
+		var endKey []byte
+		switch kind {
+		case InternalKeyKindLogData, InternalKeyKindIngestSST,
+			InternalKeyKindBatchChunk, InternalKeyKindCommitChunks, InternalKeyKindIdempotencyToken:
+			continue
+		case InternalKeyKindRangeDelete:
+			endKey, value = value, nil
+		case InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete:
+			if endKey, value, ok = rangekey.DecodeEndKey(kind, value); !ok {
+				return nil
+			}
+		}
+		if len(endKey) > len(ukey) {
+			ukey = endKey
+		}
+		if maxKeySize > 0 && len(ukey) > maxKeySize {
+			atomic.AddInt64(&d.atomic.keyTooLargeCount, 1)
+			return errors.Mark(errors.Newf("pebble: key too large: %d bytes exceeds MaxKeySize of %d bytes",
+				errors.Safe(len(ukey)), errors.Safe(maxKeySize)), ErrKeyTooLarge)
+		}
+		if maxValueSize > 0 && len(value) > maxValueSize {
+			atomic.AddInt64(&d.atomic.valueTooLargeCount, 1)
+			return errors.Mark(errors.Newf("pebble: value too large: %d bytes exceeds MaxValueSize of %d bytes",
+				errors.Safe(len(value)), errors.Safe(maxValueSize)), ErrValueTooLarge)
+		}
+	}
+}
+
 // REQUIRES: noSyncWait => opts.Sync
 func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) error {
 	if err := d.closed.Load(); err != nil {
@@ -770,6 +1103,9 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 	if d.opts.ReadOnly {
 		return ErrReadOnly
 	}
+	if err := d.diskFullErr(); err != nil {
+		return err
+	}
 	if batch.db != nil && batch.db != d {
 		panic(fmt.Sprintf("pebble: batch db mismatch: %p != %p", batch.db, d))
 	}
@@ -792,14 +1128,30 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 
 		// TODO(jackson): Assert that all range key operands are suffixless.
 	}
+	if err := d.checkWriteSizeLimits(batch); err != nil {
+		return err
+	}
 
 	if batch.db == nil {
 		batch.refreshMemTableSize()
 	}
+	if batch.idempotencyTokens {
+		// The tokens of a batch that wasn't created by the DB weren't checked by
+		// Batch.AddIdempotencyToken.
+		if err := d.checkIdempotencyTokens(); err != nil {
+			return err
+		}
+	}
 	if int(batch.memTableSize) >= d.largeBatchThreshold {
 		batch.flushable = newFlushableBatch(batch, d.opts.Comparer)
 	}
 	if err := d.commit.Commit(batch, sync, noSyncWait); err != nil {
+		if errors.Is(err, ErrDiskFull) {
+			return err
+		}
+		if err := d.handleDiskFull(err); err != nil {
+			return err
+		}
 		// There isn't much we can do on an error here. The commit pipeline will be
 		// horked at this point.
 		d.opts.Logger.Fatalf("pebble: fatal commit error: %v", err)
@@ -872,6 +1224,9 @@ func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*mem
 			var err error
 			size, err = d.mu.log.SyncRecord(repr, syncWG, syncErr)
 			if err != nil {
+				if err := d.handleDiskFull(err); err != nil {
+					return nil, err
+				}
 				panic(err)
 			}
 		}
@@ -879,6 +1234,12 @@ func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*mem
 
 	d.mu.Lock()
 
+	if b.flushable != nil && b.idempotencyTokens && !d.opts.DisableWAL {
+		// The large batch was written to the WAL before the memtable is
+		// rotated, so its tokens must be written to the new WAL.
+		d.applyIdempotencyTokensLocked(b)
+	}
+
 	var err error
 	if !b.ingestedSSTBatch {
 		// Batches which contain keys of kind InternalKeyKindIngestSST will
@@ -910,10 +1271,36 @@ func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*mem
 	if b.flushable == nil {
 		size, err = d.mu.log.SyncRecord(repr, syncWG, syncErr)
 		if err != nil {
+			if err := d.handleDiskFull(err); err != nil {
+				// Release the reference to the memtable acquired by
+				// makeRoomForWrite, as the batch will not be applied.
+				if mem.writerUnref() {
+					d.mu.Lock()
+					d.maybeScheduleFlush()
+					d.mu.Unlock()
+				}
+				return nil, err
+			}
 			panic(err)
 		}
 	}
 
+	if b.txnMarker {
+		// Now that the batch is written to the WAL, any later WAL begins with
+		// the prepare record of a newly prepared transaction, and no longer
+		// with that of a committed or rolled back transaction.
+		d.mu.Lock()
+		d.applyTxnMarkerLocked(b)
+		d.mu.Unlock()
+	}
+	if b.flushable == nil && b.idempotencyTokens {
+		// Like the prepare records, the tokens of the batch are written to any
+		// later WAL once the batch is written to the WAL.
+		d.mu.Lock()
+		d.applyIdempotencyTokensLocked(b)
+		d.mu.Unlock()
+	}
+
 	atomic.StoreUint64(&d.atomic.logSize, uint64(size))
 	return mem, err
 }
@@ -952,12 +1339,8 @@ func (d *DB) newIter(ctx context.Context, batch *Batch, s *Snapshot, o *IterOpti
 	if o != nil && o.RangeKeyMasking.Suffix != nil && o.KeyTypes != IterKeyTypePointsAndRanges {
 		panic("pebble: range key masking requires IterKeyTypePointsAndRanges")
 	}
-	if (batch != nil || s != nil) && (o != nil && o.OnlyReadGuaranteedDurable) {
-		// We could add support for OnlyReadGuaranteedDurable on snapshots if
-		// there was a need: this would require checking that the sequence number
-		// of the snapshot has been flushed, by comparing with
-		// DB.mem.queue[0].logSeqNum.
-		panic("OnlyReadGuaranteedDurable is not supported for batches or snapshots")
+	if batch != nil && (o != nil && o.OnlyReadGuaranteedDurable) {
+		panic("OnlyReadGuaranteedDurable is not supported for batches")
 	}
 	// Grab and reference the current readState. This prevents the underlying
 	// files in the associated version from being deleted if there is a current
@@ -975,6 +1358,7 @@ func (d *DB) newIter(ctx context.Context, batch *Batch, s *Snapshot, o *IterOpti
 
 	// Bundle various structures under a single umbrella in order to allocate
 	// them together.
+	atomic.AddInt64(&d.atomic.iterCount, 1)
 	buf := iterAllocPool.Get().(*iterAlloc)
 	dbi := &buf.dbi
 	*dbi = Iterator{
@@ -1372,10 +1756,10 @@ func (d *DB) NewIterWithContext(ctx context.Context, o *IterOptions) *Iterator {
 // created with this handle will all observe a stable snapshot of the current
 // DB state. The caller must call Snapshot.Close() when the snapshot is no
 // longer needed. Snapshots are not persisted across DB restarts (close ->
-// open). Unlike the implicit snapshot maintained by an iterator, a snapshot
-// will not prevent memtables from being released or sstables from being
-// deleted. Instead, a snapshot prevents deletion of sequence numbers
-// referenced by the snapshot.
+// open), unless exported (see Snapshot.Export). Unlike the implicit snapshot
+// maintained by an iterator, a snapshot will not prevent memtables from being
+// released or sstables from being deleted. Instead, a snapshot prevents
+// deletion of sequence numbers referenced by the snapshot.
 func (d *DB) NewSnapshot() *Snapshot {
 	if err := d.closed.Load(); err != nil {
 		panic(err)
@@ -1432,6 +1816,7 @@ func (d *DB) Close() error {
 	close(d.closedCh)
 
 	defer d.opts.Cache.Unref()
+	defer d.opts.Cache.ReleaseID(d.cacheID)
 
 	for d.mu.compact.compactingCount > 0 || d.mu.compact.flushing {
 		d.mu.compact.cond.Wait()
@@ -1522,6 +1907,12 @@ func (d *DB) Close() error {
 	}
 
 	// Return an error if the user failed to close all open snapshots.
+	for _, pin := range d.mu.exportedSnapshots {
+		d.mu.snapshots.remove(pin)
+	}
+	for p := range d.mu.seqNumPins {
+		d.mu.snapshots.remove(p.pin)
+	}
 	if v := d.mu.snapshots.count(); v > 0 {
 		err = firstError(err, errors.Errorf("leaked snapshots: %d open snapshots on DB %p", v, d))
 	}
@@ -1537,6 +1928,9 @@ func (d *DB) Compact(start, end []byte, parallelize bool) error {
 	if d.opts.ReadOnly {
 		return ErrReadOnly
 	}
+	if err := d.diskFullErr(); err != nil {
+		return err
+	}
 	if d.cmp(start, end) >= 0 {
 		return errors.Errorf("Compact start %s is not less than end %s",
 			d.opts.Comparer.FormatKey(start), d.opts.Comparer.FormatKey(end))
@@ -1681,6 +2075,12 @@ func (d *DB) Flush() error {
 	if err != nil {
 		return err
 	}
+	if d.opts.Experimental.ReadOnlyOnDiskFull {
+		// The flush may never complete if the DB runs out of disk space.
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.waitForFlushLocked(flushDone)
+	}
 	<-flushDone
 	return nil
 }
@@ -1696,6 +2096,9 @@ func (d *DB) AsyncFlush() (<-chan struct{}, error) {
 	if d.opts.ReadOnly {
 		return nil, ErrReadOnly
 	}
+	if err := d.diskFullErr(); err != nil {
+		return nil, err
+	}
 
 	d.commit.mu.Lock()
 	defer d.commit.mu.Unlock()
@@ -1767,6 +2170,9 @@ func (d *DB) Metrics() *Metrics {
 	// TODO(jackson): Consider making these metrics optional.
 	metrics.Keys.RangeKeySetsCount = countRangeKeySetFragments(vers)
 	metrics.Keys.TombstoneCount = countTombstones(vers)
+	metrics.RejectedWrites.KeyTooLargeCount = atomic.LoadInt64(&d.atomic.keyTooLargeCount)
+	metrics.RejectedWrites.ValueTooLargeCount = atomic.LoadInt64(&d.atomic.valueTooLargeCount)
+	metrics.RejectedWrites.BatchTooLargeCount = atomic.LoadInt64(&d.atomic.batchTooLargeCount)
 
 	d.mu.versions.logLock()
 	metrics.private.manifestFileSize = uint64(d.mu.versions.manifest.Size())
@@ -1782,12 +2188,28 @@ func (d *DB) Metrics() *Metrics {
 	}
 	for i := 0; i < numLevels; i++ {
 		metrics.Levels[i].Additional.ValueBlocksSize = valueBlocksSizeForLevel(vers, i)
+		metrics.Levels[i].Additional.MVCCGarbage = mvccGarbageForLevel(vers, i)
+	}
+	if l0 := vers.L0Sublevels; l0 != nil {
+		metrics.L0.Sublevels = make([]L0SublevelMetrics, len(l0.Levels))
+		for i, files := range l0.Levels {
+			metrics.L0.Sublevels[i] = L0SublevelMetrics{
+				NumFiles: int64(files.Len()),
+				Size:     int64(files.SizeSum()),
+			}
+		}
+		metrics.L0.NumIntervals = l0.NumIntervals()
+		metrics.L0.NumFlushSplitKeys = len(l0.FlushSplitKeys())
+		metrics.L0.MaxDepthAfterOngoingCompactions = l0.MaxDepthAfterOngoingCompactions()
 	}
 
 	d.mu.Unlock()
 
 	metrics.BlockCache = d.opts.Cache.Metrics()
+	metrics.BlockCacheDB = d.opts.Cache.IDMetrics(d.cacheID)
+	metrics.Memory = d.memoryUsage()
 	metrics.TableCache, metrics.Filter = d.tableCache.metrics()
+	metrics.TableCacheEvictions, metrics.TableCacheLevels = d.tableCache.levelMetrics()
 	metrics.TableIters = int64(d.tableCache.iterCount())
 	return metrics
 }
@@ -1859,7 +2281,7 @@ func (d *DB) SSTables(opts ...SSTablesOption) ([][]SSTableInfo, error) {
 			destTables[j] = SSTableInfo{TableInfo: m.TableInfo()}
 			if opt.withProperties {
 				p, err := d.tableCache.getTableProperties(
-					m.PhysicalMeta(),
+					m,
 				)
 				if err != nil {
 					return nil, err
@@ -1901,40 +2323,332 @@ func (d *DB) EstimateDiskUsage(start, end []byte) (uint64, error) {
 	readState := d.loadReadState()
 	defer readState.unref()
 
+	return d.estimateDiskUsage(readState.current, start, end)
+}
+
+func (d *DB) estimateDiskUsage(v *version, start, end []byte) (uint64, error) {
 	var totalSize uint64
-	for level, files := range readState.current.Levels {
-		iter := files.Iter()
-		if level > 0 {
-			// We can only use `Overlaps` to restrict `files` at L1+ since at L0 it
-			// expands the range iteratively until it has found a set of files that
-			// do not overlap any other L0 files outside that set.
-			overlaps := readState.current.Overlaps(level, d.opts.Comparer.Compare, start, end, false /* exclusiveEnd */)
-			iter = overlaps.Iter()
+	for level := range v.Levels {
+		size, _, err := d.estimateLevelDiskUsage(v, level, start, end)
+		if err != nil {
+			return 0, err
+		}
+		totalSize += size
+	}
+	return totalSize, nil
+}
+
+// estimateLevelDiskUsage returns the estimated disk usage of the range
+// `[start, end]` in the level, along with the number of files of the level
+// overlapping the range.
+func (d *DB) estimateLevelDiskUsage(
+	v *version, level int, start, end []byte,
+) (totalSize uint64, numFiles int, _ error) {
+	iter := v.Levels[level].Iter()
+	if level > 0 {
+		// We can only use `Overlaps` to restrict `files` at L1+ since at L0 it
+		// expands the range iteratively until it has found a set of files that
+		// do not overlap any other L0 files outside that set.
+		overlaps := v.Overlaps(level, d.opts.Comparer.Compare, start, end, false /* exclusiveEnd */)
+		iter = overlaps.Iter()
+	}
+	for file := iter.First(); file != nil; file = iter.Next() {
+		size, overlaps, err := d.estimateFileDiskUsage(file, start, end)
+		if err != nil {
+			return 0, 0, err
+		}
+		if overlaps {
+			totalSize += size
+			numFiles++
+		}
+	}
+	return totalSize, numFiles, nil
+}
+
+// estimateFileDiskUsage returns the estimated disk usage of the range
+// `[start, end]` within the file, and whether the file overlaps the range.
+func (d *DB) estimateFileDiskUsage(
+	file *fileMetadata, start, end []byte,
+) (size uint64, overlaps bool, err error) {
+	if d.opts.Comparer.Compare(start, file.Smallest.UserKey) <= 0 &&
+		d.opts.Comparer.Compare(file.Largest.UserKey, end) <= 0 {
+		// The range fully contains the file, so skip looking it up in
+		// table cache/looking at its indexes, and add the full file size.
+		return file.Size, true, nil
+	}
+	if d.opts.Comparer.Compare(file.Smallest.UserKey, end) > 0 ||
+		d.opts.Comparer.Compare(start, file.Largest.UserKey) > 0 {
+		return 0, false, nil
+	}
+	if file.Virtual {
+		err = d.tableCache.withVirtualReader(
+			file.VirtualMeta(),
+			func(r sstable.VirtualReader) (err error) {
+				size, err = r.EstimateDiskUsage(start, end)
+				return err
+			},
+		)
+	} else {
+		err = d.tableCache.withReader(
+			file,
+			func(r *sstable.Reader) (err error) {
+				size, err = r.EstimateDiskUsage(start, end)
+				return err
+			},
+		)
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return size, true, nil
+}
+
+// LevelSizeEstimate is the estimated size of the data of a key range within a
+// level of the LSM.
+type LevelSizeEstimate struct {
+	// Size is the estimated disk usage in bytes of the range in the level.
+	Size uint64
+	// NumFiles is the number of files of the level overlapping the range.
+	NumFiles int
+}
+
+// SizeEstimate is the estimated size of the data of a key range, broken down
+// by where the data lives, as returned by EstimateSizes.
+type SizeEstimate struct {
+	// Levels holds the estimates for each level of the LSM.
+	Levels [numLevels]LevelSizeEstimate
+	// MemTableSize is the number of bytes of the keys and values of the point
+	// keys within the range in the memtables, including the immutable
+	// memtables queued for flushing.
+	MemTableSize uint64
+	// MemTableCount is the number of point keys within the range in the
+	// memtables, including the immutable memtables queued for flushing.
+	MemTableCount uint64
+	// Ingested holds the estimate for the sstables of the ingestions queued
+	// for flushing, which are added to L0 once the memtables preceding them
+	// are flushed. See Options.Experimental.DisableIngestAsFlushable.
+	Ingested LevelSizeEstimate
+}
+
+// Total returns the estimated size of the range across the levels, the
+// memtables and the queued ingestions.
+func (e *SizeEstimate) Total() uint64 {
+	total := e.MemTableSize + e.Ingested.Size
+	for i := range e.Levels {
+		total += e.Levels[i].Size
+	}
+	return total
+}
+
+// EstimateSizes returns the estimated size of the range `[start, end]`,
+// broken down by level, as well as the size of the range within the
+// memtables. The sum of the level sizes is the value returned by
+// EstimateDiskUsage. The memtable sizes are computed by iterating over the
+// range's keys in the memtables, so their cost is proportional to the amount
+// of memtable data within the range. The sstables of ingestions queued for
+// flushing are estimated like the files of a level.
+func (d *DB) EstimateSizes(start, end []byte) (SizeEstimate, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.Comparer.Compare(start, end) > 0 {
+		return SizeEstimate{}, errors.New("invalid key-range specified (start > end)")
+	}
+
+	readState := d.loadReadState()
+	defer readState.unref()
+
+	var e SizeEstimate
+	for level := range e.Levels {
+		var err error
+		e.Levels[level].Size, e.Levels[level].NumFiles, err =
+			d.estimateLevelDiskUsage(readState.current, level, start, end)
+		if err != nil {
+			return SizeEstimate{}, err
+		}
+	}
+	for _, mem := range readState.memtables {
+		if ingested, ok := mem.flushable.(*ingestedFlushable); ok {
+			for _, file := range ingested.files {
+				size, overlaps, err := d.estimateFileDiskUsage(file.FileMetadata, start, end)
+				if err != nil {
+					return SizeEstimate{}, err
+				}
+				if overlaps {
+					e.Ingested.Size += size
+					e.Ingested.NumFiles++
+				}
+			}
+			continue
+		}
+		iter := mem.newIter(nil)
+		for key, value := iter.SeekGE(start, base.SeekGEFlagsNone); key != nil &&
+			d.cmp(key.UserKey, end) <= 0; key, value = iter.Next() {
+			e.MemTableSize += uint64(len(key.UserKey) + value.Len())
+			e.MemTableCount++
+		}
+		if err := iter.Close(); err != nil {
+			return SizeEstimate{}, err
+		}
+	}
+	return e, nil
+}
+
+// DiskUsageEstimate is an estimate of the filesystem space used for storing a
+// key range, as returned by EstimateDiskUsageWithDeletions.
+type DiskUsageEstimate struct {
+	// Physical is the estimated filesystem space used for storing the range,
+	// as returned by EstimateDiskUsage.
+	Physical uint64
+	// PostCompaction is the estimated filesystem space used for storing the
+	// range once the range tombstones within it have been compacted, i.e.
+	// Physical without the data deleted by the range tombstones.
+	PostCompaction uint64
+}
+
+// EstimateDiskUsageWithDeletions returns the estimated filesystem space used
+// in bytes for storing the range `[start, end]`, as computed by
+// EstimateDiskUsage, alongside an estimate of the space used once the range
+// tombstones within the range have been compacted.
+//
+// The data deleted by a range tombstone is estimated as the disk usage of the
+// tombstone's span, clipped to the range `[start, end]`, in the levels beneath
+// the tombstone's level. Spans deleted by tombstones in several levels are
+// counted once. Data deleted by a tombstone within its own level, such as the
+// data kept by an open snapshot in the bottommost level, isn't included.
+func (d *DB) EstimateDiskUsageWithDeletions(start, end []byte) (DiskUsageEstimate, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.Comparer.Compare(start, end) > 0 {
+		return DiskUsageEstimate{}, errors.New("invalid key-range specified (start > end)")
+	}
+
+	readState := d.loadReadState()
+	defer readState.unref()
+
+	physical, err := d.estimateDiskUsage(readState.current, start, end)
+	if err != nil {
+		return DiskUsageEstimate{}, err
+	}
+	deleted, err := d.estimateRangeDeletedDiskUsage(readState.current, start, end)
+	if err != nil {
+		return DiskUsageEstimate{}, err
+	}
+	if deleted > physical {
+		deleted = physical
+	}
+	return DiskUsageEstimate{Physical: physical, PostCompaction: physical - deleted}, nil
+}
+
+// estimateRangeDeletedDiskUsage estimates the disk usage of the data within
+// [start, end] deleted by the range tombstones of the version.
+func (d *DB) estimateRangeDeletedDiskUsage(v *version, start, end []byte) (uint64, error) {
+	// Collect the range tombstones overlapping the range, clipped to
+	// [start, end). The sequence number of the keys of the collected spans is
+	// the level of the tombstone, so that the keys of the fragments are
+	// ordered by descending level. As the spans can't express the inclusive
+	// end bound, the highest level of the tombstones deleting the end key is
+	// tracked separately.
+	var spans []keyspan.Span
+	endLevel := -1
+	collect := func(level int, iter keyspan.FragmentIterator) error {
+		defer iter.Close()
+		for s := iter.SeekGE(start); s != nil && d.cmp(s.Start, end) <= 0; s = iter.Next() {
+			if d.cmp(s.End, end) > 0 && (endLevel == -1 || level < endLevel) {
+				endLevel = level
+			}
+			spanStart, spanEnd := s.Start, s.End
+			if d.cmp(spanStart, start) < 0 {
+				spanStart = start
+			}
+			if d.cmp(spanEnd, end) > 0 {
+				spanEnd = end
+			}
+			if d.cmp(spanStart, spanEnd) >= 0 {
+				continue
+			}
+			spans = append(spans, keyspan.Span{
+				Start: append([]byte(nil), spanStart...),
+				End:   append([]byte(nil), spanEnd...),
+				Keys: []keyspan.Key{{
+					Trailer: base.MakeTrailer(uint64(level), base.InternalKeyKindRangeDelete),
+				}},
+			})
 		}
+		return iter.Error()
+	}
+	for level := range v.Levels {
+		overlaps := v.Overlaps(level, d.cmp, start, end, false /* exclusiveEnd */)
+		iter := overlaps.Iter()
 		for file := iter.First(); file != nil; file = iter.Next() {
-			if d.opts.Comparer.Compare(start, file.Smallest.UserKey) <= 0 &&
-				d.opts.Comparer.Compare(file.Largest.UserKey, end) <= 0 {
-				// The range fully contains the file, so skip looking it up in
-				// table cache/looking at its indexes, and add the full file size.
-				totalSize += file.Size
-			} else if d.opts.Comparer.Compare(file.Smallest.UserKey, end) <= 0 &&
-				d.opts.Comparer.Compare(start, file.Largest.UserKey) <= 0 {
-				var size uint64
-				err := d.tableCache.withReader(
+			var err error
+			if file.Virtual {
+				err = d.tableCache.withVirtualReader(
+					file.VirtualMeta(),
+					func(r sstable.VirtualReader) error {
+						rangeDelIter, err := r.NewRawRangeDelIter()
+						if err != nil || rangeDelIter == nil {
+							return err
+						}
+						return collect(level, rangeDelIter)
+					},
+				)
+			} else {
+				err = d.tableCache.withReader(
 					file,
-					func(r *sstable.Reader) (err error) {
-						size, err = r.EstimateDiskUsage(start, end)
-						return err
+					func(r *sstable.Reader) error {
+						rangeDelIter, err := r.NewRawRangeDelIter()
+						if err != nil || rangeDelIter == nil {
+							return err
+						}
+						return collect(level, rangeDelIter)
 					},
 				)
-				if err != nil {
-					return 0, err
-				}
-				totalSize += size
+			}
+			if err != nil {
+				return 0, err
 			}
 		}
 	}
-	return totalSize, nil
+
+	// Fragment the tombstones of all the levels, attributing each fragment to
+	// the tombstone in its highest level, which deletes the data in all the
+	// levels beneath it.
+	var fragments []keyspan.Span
+	frag := keyspan.Fragmenter{
+		Cmp:    d.cmp,
+		Format: d.opts.Comparer.FormatKey,
+		Emit: func(s keyspan.Span) {
+			fragments = append(fragments, s)
+		},
+	}
+	keyspan.Sort(d.cmp, spans)
+	for _, s := range spans {
+		frag.Add(s)
+	}
+	frag.Finish()
+
+	var deleted uint64
+	for _, s := range fragments {
+		level := int(s.SmallestSeqNum())
+		estimate, _, err := d.estimateReclaimedSizeBeneath(
+			v, level, s.Start, s.End, deleteCompactionHintTypePointKeyOnly)
+		if err != nil {
+			return 0, err
+		}
+		deleted += estimate
+	}
+	if endLevel != -1 {
+		for level := endLevel + 1; level < numLevels; level++ {
+			estimate, _, err := d.estimateLevelDiskUsage(v, level, end, end)
+			if err != nil {
+				return 0, err
+			}
+			deleted += estimate
+		}
+	}
+	return deleted, nil
 }
 
 func (d *DB) walPreallocateSize() int {
@@ -2042,10 +2756,28 @@ func (d *DB) makeRoomForWrite(b *Batch) error {
 						Reason: "memtable count limit reached",
 					})
 				}
+				if err := d.diskFullStallErr(stalled); err != nil {
+					return err
+				}
 				d.mu.compact.cond.Wait()
 				continue
 			}
 		}
+		if b != nil && d.memoryBudgetExceededLocked() {
+			// The memory budget is exceeded, and flushing the queued memtables
+			// will reduce the memory usage, so we wait.
+			if !stalled {
+				stalled = true
+				d.opts.EventListener.WriteStallBegin(WriteStallBeginInfo{
+					Reason: "memory budget exceeded",
+				})
+			}
+			if err := d.diskFullStallErr(stalled); err != nil {
+				return err
+			}
+			d.mu.compact.cond.Wait()
+			continue
+		}
 		l0ReadAmp := d.mu.versions.currentVersion().L0Sublevels.ReadAmplification()
 		if l0ReadAmp >= d.opts.L0StopWritesThreshold {
 			// There are too many level-0 files, so we wait.
@@ -2055,6 +2787,9 @@ func (d *DB) makeRoomForWrite(b *Batch) error {
 					Reason: "L0 file count limit exceeded",
 				})
 			}
+			if err := d.diskFullStallErr(stalled); err != nil {
+				return err
+			}
 			d.mu.compact.cond.Wait()
 			continue
 		}
@@ -2062,7 +2797,11 @@ func (d *DB) makeRoomForWrite(b *Batch) error {
 		var newLogNum base.FileNum
 		var prevLogSize uint64
 		if !d.opts.DisableWAL {
-			newLogNum, prevLogSize = d.recycleWAL()
+			var err error
+			newLogNum, prevLogSize, err = d.recycleWAL()
+			if err != nil {
+				return err
+			}
 		}
 
 		immMem := d.mu.mem.mutable
@@ -2106,6 +2845,11 @@ func (d *DB) makeRoomForWrite(b *Batch) error {
 		} else {
 			logSeqNum = atomic.LoadUint64(&d.mu.versions.atomic.logSeqNum)
 		}
+		if !d.opts.DisableWAL {
+			if err := d.logCarriedOverRecordsLocked(logSeqNum); err != nil {
+				return err
+			}
+		}
 		d.rotateMemtable(newLogNum, logSeqNum, immMem)
 		force = false
 	}
@@ -2132,14 +2876,19 @@ func (d *DB) rotateMemtable(newLogNum FileNum, logSeqNum uint64, prev *memTable)
 	d.mu.mem.mutable, entry = d.newMemTable(newLogNum, logSeqNum)
 	d.mu.mem.queue = append(d.mu.mem.queue, entry)
 	d.updateReadStateLocked(nil)
+	// Every key written to the new memtable has a sequence number at or above
+	// logSeqNum.
+	d.sampleHistoryLocked(logSeqNum)
 	if prev.writerUnref() {
 		d.maybeScheduleFlush()
 	}
 }
 
 // Both DB.mu and commitPipeline.mu must be held by the caller. Note that DB.mu
-// may be released and reacquired.
-func (d *DB) recycleWAL() (newLogNum FileNum, prevLogSize uint64) {
+// may be released and reacquired. An error is only returned if the DB
+// transitioned into read-only mode after running out of disk space; other
+// errors, including those writing the header of an encrypted WAL, are fatal.
+func (d *DB) recycleWAL() (newLogNum FileNum, prevLogSize uint64, err error) {
 	if d.opts.DisableWAL {
 		panic("pebble: invalid function call")
 	}
@@ -2158,13 +2907,18 @@ func (d *DB) recycleWAL() (newLogNum FileNum, prevLogSize uint64) {
 	}
 	d.mu.Unlock()
 
-	var err error
 	// Close the previous log first. This writes an EOF trailer
 	// signifying the end of the file and syncs it to disk. We must
 	// close the previous log before linking the new log file,
 	// otherwise a crash could leave both logs with unclean tails, and
 	// Open will treat the previous log as corrupt.
 	err = d.mu.log.LogWriter.Close()
+	if err != nil && atomic.LoadUint32(&d.atomic.diskFull) != diskFullNone {
+		// The previous log failed after running out of disk space. Any writes
+		// that didn't reach it remain in the memtables, which are flushed
+		// before writes resume (see DB.ResumeWrites).
+		err = nil
+	}
 	metrics := d.mu.log.LogWriter.Metrics()
 	d.mu.Lock()
 	if err := d.mu.log.metrics.Merge(metrics); err != nil {
@@ -2228,6 +2982,23 @@ func (d *DB) recycleWAL() (newLogNum FileNum, prevLogSize uint64) {
 		})
 	}
 
+	var newLogWriter *record.LogWriter
+	if err == nil {
+		newLogWriter = record.NewLogWriter(newLogFile, newLogNum, record.LogWriterConfig{
+			WALFsyncLatency:    d.mu.log.metrics.fsyncLatency,
+			WALMinSyncInterval: d.opts.WALMinSyncInterval,
+			QueueSemChan:       d.commit.logSyncQSem,
+		})
+		// The header of an encrypted WAL is written before its LogWriter is
+		// installed. If it fails, the WAL is removed, as it would otherwise be
+		// replayed by the next open.
+		if err = d.writeWALHeader(newLogWriter); err != nil {
+			_ = newLogWriter.Close()
+			_ = d.opts.FS.Remove(newLogName)
+			err = errors.Wrap(err, "pebble: writing the WAL header")
+		}
+	}
+
 	if recycleOK {
 		err = firstError(err, d.logRecycler.pop(recycleLog.fileNum))
 	}
@@ -2246,6 +3017,9 @@ func (d *DB) recycleWAL() (newLogNum FileNum, prevLogSize uint64) {
 	d.mu.versions.metrics.WAL.Files++
 
 	if err != nil {
+		if err := d.handleDiskFull(err); err != nil {
+			return 0, 0, err
+		}
 		// TODO(peter): avoid chewing through file numbers in a tight loop if there
 		// is an error here.
 		//
@@ -2255,11 +3029,8 @@ func (d *DB) recycleWAL() (newLogNum FileNum, prevLogSize uint64) {
 	}
 
 	d.mu.log.queue = append(d.mu.log.queue, fileInfo{fileNum: newLogNum, fileSize: newLogSize})
-	d.mu.log.LogWriter = record.NewLogWriter(newLogFile, newLogNum, record.LogWriterConfig{
-		WALFsyncLatency:    d.mu.log.metrics.fsyncLatency,
-		WALMinSyncInterval: d.opts.WALMinSyncInterval,
-		QueueSemChan:       d.commit.logSyncQSem,
-	})
+	d.mu.log.LogWriter = newLogWriter
+	d.mu.log.startLog(d.opts.Experimental.WALCipher, newLogNum)
 
 	return
 }
@@ -2333,3 +3104,27 @@ func (d *DB) SetCreatorID(creatorID uint64) error {
 	}
 	return d.objProvider.SetCreatorID(objstorage.CreatorID(creatorID))
 }
+
+// CollectSharedGarbage deletes the objects of the shared storage that are no
+// longer referenced by any DB. Shared objects are reference counted across the
+// DBs using them, but a DB that stops using an object only drops its
+// reference: the object is deleted by CollectSharedGarbage, as another DB may
+// be about to reference it. CollectSharedGarbage is expected to be called
+// periodically: an object is only deleted once it was found unreferenced by
+// an earlier call at least gracePeriod earlier, which must exceed the time
+// taken to create a shared object or to attach it to another DB. The shared
+// objects created by versions of Pebble that didn't reference count them are
+// never deleted. It returns the number of deleted objects.
+//
+// Does nothing if SharedStorage was not set in the options when the DB was
+// opened or if the DB is in read-only mode.
+func (d *DB) CollectSharedGarbage(gracePeriod time.Duration) (int, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.Experimental.SharedStorage == nil || d.opts.ReadOnly {
+		return 0, nil
+	}
+	deleted, err := d.objProvider.CollectSharedGarbage(gracePeriod)
+	return len(deleted), err
+}
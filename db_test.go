@@ -7,6 +7,7 @@ package pebble
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"path/filepath"
@@ -19,8 +20,11 @@ import (
 	"time"
 
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/bloom"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/errorfs"
 	"github.com/cockroachdb/pebble/internal/invariants"
+	"github.com/cockroachdb/pebble/internal/testkeys"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
@@ -483,6 +487,293 @@ func TestGetMerge(t *testing.T) {
 	require.NoError(t, d.Close())
 }
 
+// TestGetMergeReadError tests that a Get of a merged key surfaces an error
+// reading the older operands of the key, rather than returning the value
+// merged from the newer operands alone.
+func TestGetMergeReadError(t *testing.T) {
+	mem := vfs.NewMem()
+	var inject atomic.Bool
+	var l6Tables []string
+	fs := errorfs.Wrap(mem, errorfs.InjectorFunc(func(op errorfs.Op, path string) error {
+		if op == errorfs.OpFileReadAt && inject.Load() {
+			for _, name := range l6Tables {
+				if filepath.Base(path) == name {
+					return errorfs.ErrInjected
+				}
+			}
+		}
+		return nil
+	}))
+	cache := NewCache(0)
+	defer cache.Unref()
+	d, err := Open("", &Options{
+		Cache: cache,
+		FS:    fs,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	key := []byte("a")
+	require.NoError(t, d.Merge(key, []byte("1"), nil))
+	require.NoError(t, d.Compact([]byte("a"), []byte("b"), false /* parallelize */))
+	l6Tables, err = mem.List("")
+	require.NoError(t, err)
+	require.NoError(t, d.Merge(key, []byte("2"), nil))
+	require.NoError(t, d.Flush())
+
+	// The Get reads the operand in L0 before opening L6, whose read fails.
+	inject.Store(true)
+	_, _, err = d.Get(key)
+	require.ErrorIs(t, err, errorfs.ErrInjected)
+
+	inject.Store(false)
+	val, closer, err := d.Get(key)
+	require.NoError(t, err)
+	require.Equal(t, "12", string(val))
+	require.NoError(t, closer.Close())
+}
+
+// TestGetValueBlockReadError tests that a Get of a key whose value is stored
+// in a value block surfaces an error reading the value block, rather than
+// returning an empty value.
+func TestGetValueBlockReadError(t *testing.T) {
+	mem := vfs.NewMem()
+	var inject atomic.Bool
+	fs := errorfs.Wrap(mem, errorfs.InjectorFunc(func(op errorfs.Op, path string) error {
+		if op == errorfs.OpFileReadAt && inject.Load() {
+			return errorfs.ErrInjected
+		}
+		return nil
+	}))
+	opts := &Options{
+		Comparer:           testkeys.Comparer,
+		FS:                 fs,
+		FormatMajorVersion: FormatSSTableValueBlocks,
+	}
+	opts.Experimental.EnableValueBlocks = func() bool { return true }
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// The value of the older version of the key is stored in a value block.
+	require.NoError(t, d.Set([]byte("a@2"), []byte("newer"), nil))
+	require.NoError(t, d.Set([]byte("a@1"), []byte("older"), nil))
+	require.NoError(t, d.Flush())
+
+	// Load the table's index and data block into the cache, so that only the
+	// read of the value block fails.
+	val, closer, err := d.Get([]byte("a@2"))
+	require.NoError(t, err)
+	require.Equal(t, "newer", string(val))
+	require.NoError(t, closer.Close())
+
+	inject.Store(true)
+	_, _, err = d.Get([]byte("a@1"))
+	require.ErrorIs(t, err, errorfs.ErrInjected)
+
+	inject.Store(false)
+	val, closer, err = d.Get([]byte("a@1"))
+	require.NoError(t, err)
+	require.Equal(t, "older", string(val))
+	require.NoError(t, closer.Close())
+}
+
+func TestGetPinned(t *testing.T) {
+	d, err := Open("", testingRandomized(&Options{
+		FS: vfs.NewMem(),
+	}))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	verify := func(g func([]byte) (PinnedValue, error), key, expected string) {
+		t.Helper()
+		v, err := g([]byte(key))
+		if expected == "" {
+			require.ErrorIs(t, err, ErrNotFound)
+			require.Zero(t, v)
+			return
+		}
+		require.NoError(t, err)
+		require.Equal(t, len(expected), v.Len())
+		for j := 0; j < 2; j++ {
+			val, err := v.Value()
+			require.NoError(t, err)
+			require.Equal(t, expected, string(val))
+		}
+		require.NoError(t, v.Close())
+		require.ErrorIs(t, v.Close(), ErrClosed)
+		require.Zero(t, v.Len())
+		_, err = v.Value()
+		require.ErrorIs(t, err, ErrClosed)
+	}
+
+	large := strings.Repeat("x", 1<<16)
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte(large), nil))
+	verify(d.GetPinned, "a", "1")
+	verify(d.GetPinned, "b", large)
+	verify(d.GetPinned, "c", "")
+
+	s := d.NewSnapshot()
+	defer func() { require.NoError(t, s.Close()) }()
+	require.NoError(t, d.Set([]byte("a"), []byte("2"), nil))
+	require.NoError(t, d.Merge([]byte("b"), []byte("y"), nil))
+	require.NoError(t, d.Flush())
+
+	verify(d.GetPinned, "a", "2")
+	verify(d.GetPinned, "b", large+"y")
+	verify(s.GetPinned, "a", "1")
+	verify(s.GetPinned, "b", large)
+}
+
+func TestExists(t *testing.T) {
+	d, err := Open("", testingRandomized(&Options{
+		FS: vfs.NewMem(),
+	}))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	verify := func(f func([]byte) (bool, error), key string, expected bool) {
+		t.Helper()
+		ok, err := f([]byte(key))
+		require.NoError(t, err)
+		require.Equal(t, expected, ok, "key %q", key)
+	}
+
+	require.NoError(t, d.Set([]byte("a"), []byte("a"), nil))
+	require.NoError(t, d.Set([]byte("b"), nil, nil))
+	require.NoError(t, d.Set([]byte("bb"), []byte("bb"), nil))
+	require.NoError(t, d.Flush())
+	s := d.NewSnapshot()
+	defer func() { require.NoError(t, s.Close()) }()
+	require.NoError(t, d.Delete([]byte("a"), nil))
+	require.NoError(t, d.DeleteRange([]byte("bb"), []byte("c"), nil))
+	require.NoError(t, d.Set([]byte("c"), []byte("c"), nil))
+
+	verify(d.Exists, "a", false)
+	verify(d.Exists, "b", true)
+	verify(d.Exists, "ba", false)
+	verify(d.Exists, "bb", false)
+	verify(d.Exists, "c", true)
+	verify(s.Exists, "a", true)
+	verify(s.Exists, "bb", true)
+	verify(s.Exists, "c", false)
+
+	require.NoError(t, d.Flush())
+	verify(d.Exists, "a", false)
+	verify(d.Exists, "b", true)
+	verify(d.Exists, "c", true)
+	verify(s.Exists, "a", true)
+}
+
+func TestExistsFilter(t *testing.T) {
+	d, err := Open("", &Options{
+		Comparer: testkeys.Comparer,
+		FS:       vfs.NewMem(),
+		Levels:   []LevelOptions{{FilterPolicy: bloom.FilterPolicy(10)}},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("a"), nil))
+	require.NoError(t, d.Set([]byte("c"), []byte("c"), nil))
+	require.NoError(t, d.Flush())
+
+	// The filter of the sstable excludes the key, so its data block isn't
+	// loaded.
+	hits := d.Metrics().Filter.Hits
+	ok, err := d.Exists([]byte("b"))
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, hits+1, d.Metrics().Filter.Hits)
+
+	ok, err = d.Exists([]byte("c"))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, hits+1, d.Metrics().Filter.Hits)
+}
+
+func TestMultiGet(t *testing.T) {
+	d, err := Open("", testingRandomized(&Options{
+		FS: vfs.NewMem(),
+	}))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("a1"), nil))
+	require.NoError(t, d.Set([]byte("c"), []byte("c1"), nil))
+	require.NoError(t, d.Set([]byte("e"), nil, nil))
+	require.NoError(t, d.Flush())
+	s := d.NewSnapshot()
+	defer func() { require.NoError(t, s.Close()) }()
+	require.NoError(t, d.Set([]byte("b"), []byte("b2"), nil))
+	require.NoError(t, d.Merge([]byte("c"), []byte("c2"), nil))
+	require.NoError(t, d.Delete([]byte("a"), nil))
+
+	keys := [][]byte{[]byte("c"), []byte("a"), []byte("e"), []byte("d"), []byte("b"), []byte("c")}
+	format := func(values [][]byte) string {
+		var parts []string
+		for _, v := range values {
+			if v == nil {
+				parts = append(parts, "<nil>")
+			} else {
+				parts = append(parts, fmt.Sprintf("%q", v))
+			}
+		}
+		return strings.Join(parts, " ")
+	}
+
+	values, err := d.MultiGet(keys)
+	require.NoError(t, err)
+	require.Equal(t, `"c1c2" <nil> "" <nil> "b2" "c1c2"`, format(values))
+
+	values, err = s.MultiGet(keys)
+	require.NoError(t, err)
+	require.Equal(t, `"c1" "a1" "" <nil> <nil> "c1"`, format(values))
+
+	values, err = d.MultiGet(nil)
+	require.NoError(t, err)
+	require.Len(t, values, 0)
+}
+
+func TestMultiGetReadError(t *testing.T) {
+	mem := vfs.NewMem()
+	var inject atomic.Bool
+	fs := errorfs.Wrap(mem, errorfs.InjectorFunc(func(op errorfs.Op, path string) error {
+		if op == errorfs.OpFileReadAt && inject.Load() {
+			return errorfs.ErrInjected
+		}
+		return nil
+	}))
+	d, err := Open("", &Options{
+		FS:                          fs,
+		DisableAutomaticCompactions: true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("a1"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("d"), []byte("d1"), nil))
+	require.NoError(t, d.Flush())
+
+	// Load the blocks of the table containing d into the cache, so that only
+	// the lookup of a fails, and the lookup of d that follows it succeeds.
+	val, closer, err := d.Get([]byte("d"))
+	require.NoError(t, err)
+	require.Equal(t, "d1", string(val))
+	require.NoError(t, closer.Close())
+
+	inject.Store(true)
+	_, err = d.MultiGet([][]byte{[]byte("d"), []byte("a")})
+	require.ErrorIs(t, err, errorfs.ErrInjected)
+
+	inject.Store(false)
+	values, err := d.MultiGet([][]byte{[]byte("d"), []byte("a")})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("d1"), []byte("a1")}, values)
+}
+
 func TestMergeOrderSameAfterFlush(t *testing.T) {
 	// Ensure compaction iterator (used by flush) and user iterator process merge
 	// operands in the same order
@@ -1087,9 +1378,12 @@ func TestDBClosed(t *testing.T) {
 
 	require.True(t, errors.Is(catch(func() { _ = d.Compact(nil, nil, false) }), ErrClosed))
 	require.True(t, errors.Is(catch(func() { _ = d.Flush() }), ErrClosed))
+	require.True(t, errors.Is(catch(func() { _, _ = d.EstimateDiskUsageWithDeletions(nil, nil) }), ErrClosed))
+	require.True(t, errors.Is(catch(func() { _, _ = d.CollectSharedGarbage(0) }), ErrClosed))
 	require.True(t, errors.Is(catch(func() { _, _ = d.AsyncFlush() }), ErrClosed))
 
 	require.True(t, errors.Is(catch(func() { _, _, _ = d.Get(nil) }), ErrClosed))
+	require.True(t, errors.Is(catch(func() { _, _ = d.GetPinned(nil) }), ErrClosed))
 	require.True(t, errors.Is(catch(func() { _ = d.Delete(nil, nil) }), ErrClosed))
 	require.True(t, errors.Is(catch(func() { _ = d.DeleteRange(nil, nil, nil) }), ErrClosed))
 	require.True(t, errors.Is(catch(func() { _ = d.Ingest(nil) }), ErrClosed))
@@ -1106,6 +1400,192 @@ func TestDBClosed(t *testing.T) {
 	require.True(t, errors.Is(catch(func() { _ = b.NewIter(nil) }), ErrClosed))
 }
 
+func TestEstimateDiskUsageWithDeletions(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	value := bytes.Repeat([]byte("v"), 1<<10)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%04d", i)), value, nil))
+	}
+	require.NoError(t, d.Compact([]byte("k"), []byte("l"), false /* parallelize */))
+
+	// Without range tombstones, the post-compaction estimate is the physical
+	// estimate.
+	e, err := d.EstimateDiskUsageWithDeletions([]byte("k0000"), []byte("k0999"))
+	require.NoError(t, err)
+	require.NotZero(t, e.Physical)
+	require.Equal(t, e.Physical, e.PostCompaction)
+	physical, err := d.EstimateDiskUsage([]byte("k0000"), []byte("k0999"))
+	require.NoError(t, err)
+	require.Equal(t, physical, e.Physical)
+
+	// Delete half of the keys, in two overlapping tombstones in different
+	// levels, which must not be double counted.
+	require.NoError(t, d.DeleteRange([]byte("k0000"), []byte("k0400"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.DeleteRange([]byte("k0200"), []byte("k0500"), nil))
+	require.NoError(t, d.Flush())
+
+	e, err = d.EstimateDiskUsageWithDeletions([]byte("k0000"), []byte("k0999"))
+	require.NoError(t, err)
+	require.Less(t, e.PostCompaction, e.Physical)
+	require.InDelta(t, float64(e.Physical)/2, float64(e.PostCompaction), float64(e.Physical)/10)
+
+	// The deleted data outside of the range isn't included.
+	e, err = d.EstimateDiskUsageWithDeletions([]byte("k0500"), []byte("k0999"))
+	require.NoError(t, err)
+	require.InDelta(t, float64(e.Physical), float64(e.PostCompaction), float64(e.Physical)/10)
+	e, err = d.EstimateDiskUsageWithDeletions([]byte("k0300"), []byte("k0400"))
+	require.NoError(t, err)
+	require.Less(t, e.PostCompaction, e.Physical/10)
+
+	// Once compacted, the data is gone and the estimates agree.
+	require.NoError(t, d.Compact([]byte("k"), []byte("l"), false /* parallelize */))
+	e, err = d.EstimateDiskUsageWithDeletions([]byte("k0000"), []byte("k0999"))
+	require.NoError(t, err)
+	require.Equal(t, e.Physical, e.PostCompaction)
+	require.InDelta(t, float64(physical)/2, float64(e.Physical), float64(physical)/10)
+
+	_, err = d.EstimateDiskUsageWithDeletions([]byte("b"), []byte("a"))
+	require.Error(t, err)
+}
+
+func TestEstimateDiskUsageWithDeletionsEndBound(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Write "a" and "b" and, with an incompressible value, "c" into two
+	// separate tables in L6.
+	value := make([]byte, 64<<10)
+	rand.New(rand.NewSource(0)).Read(value)
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("b"), false /* parallelize */))
+	require.NoError(t, d.Set([]byte("c"), value, nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("c"), []byte("c\x00"), false /* parallelize */))
+	endSize, err := d.EstimateDiskUsage([]byte("c"), []byte("c"))
+	require.NoError(t, err)
+	require.Greater(t, endSize, uint64(len(value)/2))
+
+	// A tombstone ending at the end of the range doesn't delete the end key.
+	require.NoError(t, d.DeleteRange([]byte("a"), []byte("c"), nil))
+	require.NoError(t, d.Flush())
+	e, err := d.EstimateDiskUsageWithDeletions([]byte("a"), []byte("c"))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, e.PostCompaction, endSize)
+
+	// A tombstone starting at the end of the range deletes the end key.
+	require.NoError(t, d.DeleteRange([]byte("c"), []byte("d"), nil))
+	require.NoError(t, d.Flush())
+	e, err = d.EstimateDiskUsageWithDeletions([]byte("a"), []byte("c"))
+	require.NoError(t, err)
+	require.Less(t, e.PostCompaction, endSize)
+}
+
+func TestEstimateSizes(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	value := bytes.Repeat([]byte("v"), 1<<10)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%04d", i)), value, nil))
+	}
+	require.NoError(t, d.Compact([]byte("k"), []byte("l"), false /* parallelize */))
+	for i := 0; i < 100; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%04d", i)), value, nil))
+	}
+	require.NoError(t, d.Flush())
+	for i := 500; i < 510; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%04d", i)), value, nil))
+	}
+
+	e, err := d.EstimateSizes([]byte("k0000"), []byte("k0999"))
+	require.NoError(t, err)
+	physical, err := d.EstimateDiskUsage([]byte("k0000"), []byte("k0999"))
+	require.NoError(t, err)
+	require.Equal(t, physical, e.Total()-e.MemTableSize)
+	require.Equal(t, 1, e.Levels[0].NumFiles)
+	require.Equal(t, 1, e.Levels[numLevels-1].NumFiles)
+	require.InDelta(t, float64(10*e.Levels[0].Size), float64(e.Levels[numLevels-1].Size),
+		float64(e.Levels[numLevels-1].Size)/10)
+	for level := 1; level < numLevels-1; level++ {
+		require.Zero(t, e.Levels[level])
+	}
+	require.Equal(t, uint64(10), e.MemTableCount)
+	require.Equal(t, uint64(10*(5+len(value))), e.MemTableSize)
+
+	// A range that doesn't overlap the L0 file nor the memtable keys.
+	e, err = d.EstimateSizes([]byte("k0200"), []byte("k0299"))
+	require.NoError(t, err)
+	require.Zero(t, e.Levels[0])
+	require.Zero(t, e.MemTableCount)
+	require.Equal(t, 1, e.Levels[numLevels-1].NumFiles)
+	require.InDelta(t, float64(physical)/11, float64(e.Levels[numLevels-1].Size), float64(physical)/50)
+
+	_, err = d.EstimateSizes([]byte("b"), []byte("a"))
+	require.Error(t, err)
+}
+
+func TestEstimateSizesIngestedFlushable(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{
+		FS:                          mem,
+		FormatMajorVersion:          FormatNewest,
+		DisableAutomaticCompactions: true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	f, err := mem.Create("ext")
+	require.NoError(t, err)
+	w := sstable.NewWriter(objstorageprovider.NewFileWritable(f),
+		d.opts.MakeWriterOptions(0 /* level */, d.FormatMajorVersion().MaxTableFormat()))
+	for _, k := range []string{"a", "b", "c"} {
+		require.NoError(t, w.Set([]byte(k), []byte(k)))
+	}
+	require.NoError(t, w.Close())
+
+	// The ingested sstable overlaps the memtable, so it's queued behind it as
+	// a flushable while flushes are blocked.
+	require.NoError(t, d.Set([]byte("b"), []byte("1"), nil))
+	d.mu.Lock()
+	d.mu.compact.flushing = true
+	d.mu.Unlock()
+	require.NoError(t, d.Ingest([]string{"ext"}))
+
+	e, err := d.EstimateSizes([]byte("a"), []byte("z"))
+	require.NoError(t, err)
+	require.Equal(t, 1, e.Ingested.NumFiles)
+	require.NotZero(t, e.Ingested.Size)
+	require.Equal(t, uint64(1), e.MemTableCount)
+	require.Zero(t, e.Levels[0])
+
+	d.mu.Lock()
+	d.mu.compact.flushing = false
+	d.mu.Unlock()
+	require.NoError(t, d.Flush())
+	e, err = d.EstimateSizes([]byte("a"), []byte("z"))
+	require.NoError(t, err)
+	require.Zero(t, e.Ingested)
+	require.Zero(t, e.MemTableCount)
+	require.Equal(t, 2, e.Levels[0].NumFiles)
+}
+
 func TestDBConcurrentCommitCompactFlush(t *testing.T) {
 	d, err := Open("", testingRandomized(&Options{
 		FS: vfs.NewMem(),
@@ -1217,6 +1697,68 @@ func TestDBApplyBatchMismatch(t *testing.T) {
 	require.NoError(t, applyDB.Close())
 }
 
+func TestDBWriteSizeLimits(t *testing.T) {
+	opts := &Options{FS: vfs.NewMem(), Comparer: testkeys.Comparer, FormatMajorVersion: FormatNewest}
+	opts.Experimental.MaxKeySize = 8
+	opts.Experimental.MaxValueSize = 16
+	opts.Experimental.MaxBatchSize = 256
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	long := func(n int) []byte { return bytes.Repeat([]byte("x"), n) }
+	testCases := []struct {
+		write  func(b *Batch) error
+		target error
+	}{
+		{func(b *Batch) error { return b.Set(long(8), long(16), nil) }, nil},
+		{func(b *Batch) error { return b.Set(long(9), nil, nil) }, ErrKeyTooLarge},
+		{func(b *Batch) error { return b.Set([]byte("a"), long(17), nil) }, ErrValueTooLarge},
+		{func(b *Batch) error { return b.Merge([]byte("a"), long(17), nil) }, ErrValueTooLarge},
+		{func(b *Batch) error { return b.Delete(long(9), nil) }, ErrKeyTooLarge},
+		{func(b *Batch) error { return b.DeleteRange([]byte("a"), long(9), nil) }, ErrKeyTooLarge},
+		{func(b *Batch) error { return b.RangeKeySet([]byte("a"), long(9), nil, nil, nil) }, ErrKeyTooLarge},
+		{func(b *Batch) error { return b.RangeKeySet([]byte("a"), []byte("b"), nil, long(17), nil) }, ErrValueTooLarge},
+		{func(b *Batch) error { return b.LogData(long(100), nil) }, nil},
+		{func(b *Batch) error {
+			for i := 0; i < 20; i++ {
+				if err := b.Set([]byte(fmt.Sprintf("k%d", i)), long(8), nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, ErrBatchTooLarge},
+	}
+	for i, tc := range testCases {
+		b := d.NewBatch()
+		require.NoError(t, tc.write(b))
+		err := b.Commit(nil)
+		if tc.target == nil {
+			require.NoError(t, err, "%d", i)
+		} else {
+			require.True(t, errors.Is(err, tc.target), "%d: %v", i, err)
+		}
+		require.NoError(t, b.Close())
+	}
+
+	// None of the writes of a rejected batch are applied.
+	_, _, err = d.Get([]byte("k0"))
+	require.True(t, errors.Is(err, ErrNotFound))
+	require.True(t, errors.Is(d.Set(long(9), nil, nil), ErrKeyTooLarge))
+
+	// The limits also apply to chunked commits and prepared transactions.
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("a"), long(17), nil))
+	require.True(t, errors.Is(b.CommitChunked(), ErrValueTooLarge))
+	require.True(t, errors.Is(b.Prepare([]byte("txn"), nil), ErrValueTooLarge))
+	require.NoError(t, b.Close())
+
+	m := d.Metrics()
+	require.EqualValues(t, 5, m.RejectedWrites.KeyTooLargeCount)
+	require.EqualValues(t, 5, m.RejectedWrites.ValueTooLargeCount)
+	require.EqualValues(t, 1, m.RejectedWrites.BatchTooLargeCount)
+}
+
 func TestCloseCleanerRace(t *testing.T) {
 	mem := vfs.NewMem()
 	for i := 0; i < 20; i++ {
@@ -1290,6 +1832,48 @@ func TestSSTables(t *testing.T) {
 	}
 }
 
+func TestLSMView(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	// Create two overlapping L0 sstables and one L6 sstable.
+	require.NoError(t, d.Set([]byte("a"), nil, nil))
+	require.NoError(t, d.Set([]byte("c"), nil, nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("d"), false))
+	require.NoError(t, d.Set([]byte("b"), nil, nil))
+	require.NoError(t, d.Set([]byte("d"), nil, nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("c"), nil, nil))
+	require.NoError(t, d.Flush())
+
+	view := d.LSMView()
+	require.Equal(t, LSMViewSchemaVersion, view.SchemaVersion)
+	require.Equal(t, numLevels, len(view.Levels))
+	require.Equal(t, 2, view.Levels[0].NumFiles)
+	require.Equal(t, 2, view.Levels[0].Sublevels)
+	require.Equal(t, 1, view.Levels[6].NumFiles)
+
+	var decoded LSMView
+	require.NoError(t, json.Unmarshal(view.JSON(), &decoded))
+	require.Equal(t, *view, decoded)
+
+	l0 := decoded.Levels[0].Files
+	require.Equal(t, "b", l0[0].Smallest)
+	require.Equal(t, "d", l0[0].Largest)
+	require.Equal(t, 0, l0[0].Sublevel)
+	require.Equal(t, []byte("c"), l0[1].SmallestKey)
+	require.Equal(t, 1, l0[1].Sublevel)
+	require.Equal(t, uint64(5), l0[1].SmallestSeqNum)
+	require.Equal(t, view.Levels[0].Size, l0[0].Size+l0[1].Size)
+}
+
 type testTracer struct {
 	enabledOnlyForNonBackgroundContext bool
 	buf                                strings.Builder
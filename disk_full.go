@@ -0,0 +1,141 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"sync/atomic"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// The disk full states of a DB, stored in DB.atomic.diskFull.
+const (
+	// diskFullNone is the state of a DB operating normally.
+	diskFullNone uint32 = iota
+	// diskFullReadOnly is the state of a DB that ran out of disk space. Writes
+	// are rejected, and flushes and compactions are paused.
+	diskFullReadOnly
+	// diskFullResuming is the state of a DB resuming writes in DB.ResumeWrites.
+	// Writes are rejected until the memtables are flushed, but flushes and
+	// compactions may run.
+	diskFullResuming
+)
+
+// diskFullErr returns ErrDiskFull if the DB is in read-only mode after running
+// out of disk space.
+func (d *DB) diskFullErr() error {
+	if atomic.LoadUint32(&d.atomic.diskFull) != diskFullNone {
+		return ErrDiskFull
+	}
+	return nil
+}
+
+// handleDiskFull transitions the DB into read-only mode if
+// Options.Experimental.ReadOnlyOnDiskFull is set and err indicates that the
+// disk is out of space. In that case, it returns err marked as ErrDiskFull.
+// Any error is considered to be caused by the lack of disk space once the DB
+// is in read-only mode, as the WAL may then be unusable. Otherwise,
+// handleDiskFull returns nil, and the caller should handle err as it would
+// without this mode.
+func (d *DB) handleDiskFull(err error) error {
+	if !d.opts.Experimental.ReadOnlyOnDiskFull {
+		return nil
+	}
+	state := atomic.LoadUint32(&d.atomic.diskFull)
+	if !vfs.IsNoSpaceError(err) {
+		if state == diskFullNone {
+			return nil
+		}
+		return errors.Mark(err, ErrDiskFull)
+	}
+	for state != diskFullReadOnly {
+		if atomic.CompareAndSwapUint32(&d.atomic.diskFull, state, diskFullReadOnly) {
+			d.opts.EventListener.DiskFull(DiskFullInfo{Err: err})
+			// Wake up any goroutines waiting for flushes or compactions,
+			// which are now paused.
+			d.mu.compact.cond.Broadcast()
+			break
+		}
+		state = atomic.LoadUint32(&d.atomic.diskFull)
+	}
+	return errors.Mark(err, ErrDiskFull)
+}
+
+// ResumeWrites returns a DB that transitioned into read-only mode after
+// running out of disk space (see Options.Experimental.ReadOnlyOnDiskFull) to
+// normal operation. It should be called once disk space has been freed.
+//
+// ResumeWrites rotates the WAL and flushes the memtables, which may contain
+// writes that never reached the WAL, before accepting writes again. If the
+// disk is still out of space, ResumeWrites returns an error marked as
+// ErrDiskFull and the DB remains read-only. ResumeWrites is a no-op if the DB
+// isn't read-only.
+func (d *DB) ResumeWrites() error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if !atomic.CompareAndSwapUint32(&d.atomic.diskFull, diskFullReadOnly, diskFullResuming) {
+		return nil
+	}
+
+	d.commit.mu.Lock()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Flushes and compactions were paused, and may be necessary for the
+	// memtable rotation to proceed.
+	d.maybeScheduleFlush()
+	d.maybeScheduleCompaction()
+	flushed := d.mu.mem.queue[len(d.mu.mem.queue)-1].flushed
+	err := d.makeRoomForWrite(nil)
+	d.commit.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := d.waitForFlushLocked(flushed); err != nil {
+		return err
+	}
+	if !atomic.CompareAndSwapUint32(&d.atomic.diskFull, diskFullResuming, diskFullNone) {
+		return errDiskFullWhileFlushing
+	}
+	return nil
+}
+
+var errDiskFullWhileFlushing = errors.Mark(
+	errors.New("pebble: out of disk space while flushing"), ErrDiskFull)
+
+// diskFullStallErr returns ErrDiskFull if a write stall can't end because the
+// DB is in read-only mode, pausing the flushes and compactions that would end
+// it. It ends the stall if so.
+//
+// d.mu must be held when calling this.
+func (d *DB) diskFullStallErr(stalled bool) error {
+	if atomic.LoadUint32(&d.atomic.diskFull) != diskFullReadOnly {
+		return nil
+	}
+	if stalled {
+		d.opts.EventListener.WriteStallEnd()
+	}
+	return ErrDiskFull
+}
+
+// waitForFlushLocked waits for a flush signaled by the flushed channel to
+// complete. It returns an error marked as ErrDiskFull if the DB transitions
+// into read-only mode in the meantime, since flushes are then paused.
+//
+// d.mu must be held when calling this.
+func (d *DB) waitForFlushLocked(flushed <-chan struct{}) error {
+	for {
+		select {
+		case <-flushed:
+			return nil
+		default:
+		}
+		if atomic.LoadUint32(&d.atomic.diskFull) == diskFullReadOnly {
+			return errDiskFullWhileFlushing
+		}
+		d.mu.compact.cond.Wait()
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/errorfs"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnlyOnDiskFull(t *testing.T) {
+	mem := vfs.NewMem()
+	var full uint32
+	fs := errorfs.Wrap(mem, errorfs.InjectorFunc(func(op errorfs.Op, path string) error {
+		if atomic.LoadUint32(&full) == 0 || op.OpKind() != errorfs.OpKindWrite || op == errorfs.OpRemove {
+			return nil
+		}
+		return &os.PathError{Op: "write", Path: path, Err: syscall.ENOSPC}
+	}))
+	var diskFullEvents int
+	opts := &Options{
+		FS: fs,
+		EventListener: &EventListener{
+			DiskFull: func(info DiskFullInfo) {
+				require.True(t, vfs.IsNoSpaceError(info.Err))
+				diskFullEvents++
+			},
+		},
+	}
+	opts.Experimental.ReadOnlyOnDiskFull = true
+	d, err := Open("", opts)
+	require.NoError(t, err)
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), Sync))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("b"), []byte("2"), Sync))
+
+	// A write failing due to the lack of disk space transitions the DB into
+	// read-only mode.
+	atomic.StoreUint32(&full, 1)
+	err = d.Set([]byte("c"), []byte("3"), Sync)
+	require.True(t, errors.Is(err, ErrDiskFull), "%+v", err)
+	require.Equal(t, 1, diskFullEvents)
+
+	// Writes are rejected, but reads are served.
+	require.True(t, errors.Is(d.Set([]byte("d"), []byte("4"), NoSync), ErrDiskFull))
+	require.True(t, errors.Is(d.Delete([]byte("a"), NoSync), ErrDiskFull))
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("d"), []byte("4"), nil))
+	require.True(t, errors.Is(b.CommitChunked(), ErrDiskFull))
+	require.NoError(t, b.Close())
+	require.True(t, errors.Is(d.Flush(), ErrDiskFull))
+	require.True(t, errors.Is(d.Compact([]byte("a"), []byte("z"), false), ErrDiskFull))
+	for _, k := range []string{"a", "b"} {
+		v, closer, err := d.Get([]byte(k))
+		require.NoError(t, err)
+		require.NotEmpty(t, v)
+		require.NoError(t, closer.Close())
+	}
+	iter := d.NewIter(nil)
+	require.True(t, iter.First())
+	require.Equal(t, []byte("a"), iter.Key())
+	require.NoError(t, iter.Close())
+
+	// Resuming writes fails while the disk remains full.
+	require.True(t, errors.Is(d.ResumeWrites(), ErrDiskFull))
+	require.True(t, errors.Is(d.Set([]byte("d"), []byte("4"), NoSync), ErrDiskFull))
+
+	// Once disk space is freed, writes resume.
+	atomic.StoreUint32(&full, 0)
+	require.NoError(t, d.ResumeWrites())
+	require.NoError(t, d.Set([]byte("d"), []byte("4"), Sync))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Close())
+
+	// The writes committed before and after running out of disk space are
+	// durable.
+	d, err = Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	for _, k := range []string{"a", "b", "d"} {
+		v, closer, err := d.Get([]byte(k))
+		require.NoError(t, err, "key %q", k)
+		require.NotEmpty(t, v)
+		require.NoError(t, closer.Close())
+	}
+	require.NoError(t, d.Close())
+}
+
+func TestReadOnlyOnDiskFullFlush(t *testing.T) {
+	mem := vfs.NewMem()
+	var full uint32
+	fs := errorfs.Wrap(mem, errorfs.InjectorFunc(func(op errorfs.Op, path string) error {
+		if atomic.LoadUint32(&full) == 0 || op.OpKind() != errorfs.OpKindWrite || op == errorfs.OpRemove {
+			return nil
+		}
+		return &os.PathError{Op: "write", Path: path, Err: syscall.ENOSPC}
+	}))
+	opts := &Options{FS: fs, DisableWAL: true, Logger: panicLogger{}}
+	opts.Experimental.ReadOnlyOnDiskFull = true
+	d, err := Open("", opts)
+	require.NoError(t, err)
+
+	// A flush failing due to the lack of disk space transitions the DB into
+	// read-only mode, rather than being retried.
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), NoSync))
+	atomic.StoreUint32(&full, 1)
+	require.True(t, errors.Is(d.Flush(), ErrDiskFull))
+	require.True(t, errors.Is(d.Set([]byte("b"), []byte("2"), NoSync), ErrDiskFull))
+	v, closer, err := d.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), v)
+	require.NoError(t, closer.Close())
+
+	atomic.StoreUint32(&full, 0)
+	require.NoError(t, d.ResumeWrites())
+	require.NoError(t, d.Set([]byte("b"), []byte("2"), NoSync))
+	require.NoError(t, d.Close())
+
+	d, err = Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	v, closer, err = d.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), v)
+	require.NoError(t, closer.Close())
+	require.NoError(t, d.Close())
+}
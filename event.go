@@ -117,6 +117,22 @@ func (i levelInfos) SafeFormat(w redact.SafePrinter, _ rune) {
 	}
 }
 
+// DiskFullInfo contains the info for the event of a DB transitioning into
+// read-only mode after running out of disk space.
+type DiskFullInfo struct {
+	// Err is the error that triggered the transition.
+	Err error
+}
+
+func (i DiskFullInfo) String() string {
+	return redact.StringWithoutMarkers(i)
+}
+
+// SafeFormat implements redact.SafeFormatter.
+func (i DiskFullInfo) SafeFormat(w redact.SafePrinter, _ rune) {
+	w.Printf("out of disk space; writes are rejected until resumed: %s", i.Err)
+}
+
 // DiskSlowInfo contains the info for a disk slowness event when writing to a
 // file.
 type DiskSlowInfo = vfs.DiskSlowInfo
@@ -461,6 +477,12 @@ type EventListener struct {
 	// has been installed.
 	CompactionEnd func(CompactionInfo)
 
+	// DiskFull is invoked when the DB transitions into read-only mode after
+	// running out of disk space (see Options.Experimental.ReadOnlyOnDiskFull).
+	// Writes are rejected until DB.ResumeWrites is called once disk space has
+	// been freed.
+	DiskFull func(DiskFullInfo)
+
 	// DiskSlow is invoked after a disk write operation on a file created with a
 	// disk health checking vfs.FS (see vfs.DefaultWithDiskHealthChecks) is
 	// observed to exceed the specified disk slowness threshold duration. DiskSlow
@@ -539,6 +561,9 @@ func (l *EventListener) EnsureDefaults(logger Logger) {
 	if l.CompactionEnd == nil {
 		l.CompactionEnd = func(info CompactionInfo) {}
 	}
+	if l.DiskFull == nil {
+		l.DiskFull = func(info DiskFullInfo) {}
+	}
 	if l.DiskSlow == nil {
 		l.DiskSlow = func(info DiskSlowInfo) {}
 	}
@@ -603,6 +628,9 @@ func MakeLoggingEventListener(logger Logger) EventListener {
 		CompactionEnd: func(info CompactionInfo) {
 			logger.Infof("%s", info)
 		},
+		DiskFull: func(info DiskFullInfo) {
+			logger.Infof("%s", info)
+		},
 		DiskSlow: func(info DiskSlowInfo) {
 			logger.Infof("%s", info)
 		},
@@ -668,6 +696,10 @@ func TeeEventListener(a, b EventListener) EventListener {
 			a.CompactionEnd(info)
 			b.CompactionEnd(info)
 		},
+		DiskFull: func(info DiskFullInfo) {
+			a.DiskFull(info)
+			b.DiskFull(info)
+		},
 		DiskSlow: func(info DiskSlowInfo) {
 			a.DiskSlow(info)
 			b.DiskSlow(info)
@@ -0,0 +1,309 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// Excise removes all keys within the span of user keys [start, end) from the
+// DB, including range deletions and range keys. Unlike DeleteRange, Excise
+// doesn't write a tombstone: sstables within the span are removed from the
+// LSM, and sstables overlapping the span only partially are replaced by
+// virtual sstables exposing the keys of the original sstable outside of the
+// span, without rewriting them.
+//
+// Keys within the span in the memtables are flushed before being excised. The
+// excised keys remain visible to iterators opened before Excise, but are
+// removed from any open snapshots. Keys written concurrently with Excise may
+// or may not be excised.
+//
+// Excise requires a format major version of at least FormatVirtualSSTables.
+func (d *DB) Excise(start, end []byte) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if err := d.diskFullErr(); err != nil {
+		return err
+	}
+	if v := d.FormatMajorVersion(); v < FormatVirtualSSTables {
+		return errors.Newf(
+			"pebble: database has format major version %d; Excise requires at least %d",
+			errors.Safe(v), errors.Safe(FormatVirtualSSTables),
+		)
+	}
+	if d.cmp(start, end) >= 0 {
+		return errors.New("pebble: invalid excise span (start >= end)")
+	}
+
+	// Flush the memtables if they contain keys within the span, so that only
+	// sstables need to be excised.
+	span := (&fileMetadata{}).ExtendPointKeyBounds(
+		d.cmp,
+		base.MakeInternalKey(start, InternalKeySeqNumMax, InternalKeyKindMax),
+		base.MakeRangeDeleteSentinelKey(end),
+	)
+	d.mu.Lock()
+	var overlaps bool
+	for _, mem := range d.mu.mem.queue {
+		if ingestMemtableOverlaps(d.cmp, mem, []*fileMetadata{span}) {
+			overlaps = true
+			break
+		}
+	}
+	d.mu.Unlock()
+	if overlaps {
+		if err := d.Flush(); err != nil {
+			return err
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var excised []excisedTable
+	for {
+		// The sstables being excised must not be inputs of in-progress
+		// compactions, which would attempt to delete them once complete.
+		for d.exciseOverlapsCompacting(start, end) {
+			d.mu.compact.cond.Wait()
+		}
+		current := d.mu.versions.currentVersion()
+		excised = d.excisedTables(current, start, end)
+		if len(excised) == 0 {
+			return nil
+		}
+		for i := range excised {
+			excised[i].newFiles = d.exciseTable(start, end, excised[i].meta)
+		}
+
+		// Like the sstables being ingested, the virtual sstables are loaded
+		// before the manifest is locked, as the estimation of their sizes reads
+		// the sstables. The current version is referenced so that the backing
+		// sstables remain.
+		current.Ref()
+		d.mu.Unlock()
+		var err error
+		for i := 0; i < len(excised) && err == nil; i++ {
+			err = d.estimateVirtualTableSizes(excised[i].meta, excised[i].newFiles)
+		}
+		d.mu.Lock()
+		current.UnrefLocked()
+		if err != nil {
+			return err
+		}
+
+		// Lock the manifest for writing, which excludes the picking of
+		// compactions until the version edit is applied. logAndApply
+		// unconditionally releases the manifest lock. The sstables are excised
+		// unless the sstables overlapping the span changed, or started being
+		// compacted, while d.mu was released.
+		d.mu.versions.logLock()
+		if !d.exciseOverlapsCompacting(start, end) &&
+			excisedTablesEqual(excised, d.excisedTables(d.mu.versions.currentVersion(), start, end)) {
+			break
+		}
+		d.mu.versions.logUnlock()
+	}
+
+	jobID := d.mu.nextJobID
+	d.mu.nextJobID++
+	ve := &versionEdit{
+		DeletedFiles: map[deletedFileEntry]*fileMetadata{},
+	}
+	metrics := make(map[int]*LevelMetrics)
+	for _, t := range excised {
+		m := t.meta
+		ve.DeletedFiles[deletedFileEntry{Level: t.level, FileNum: m.FileNum}] = m
+		levelMetrics := metrics[t.level]
+		if levelMetrics == nil {
+			levelMetrics = &LevelMetrics{}
+			metrics[t.level] = levelMetrics
+		}
+		levelMetrics.NumFiles--
+		levelMetrics.Size -= int64(m.Size)
+		if len(t.newFiles) > 0 && !m.Virtual {
+			// The physical sstable is virtualized for the first time.
+			ve.CreatedBackingTables = append(ve.CreatedBackingTables, m.FileBacking)
+		}
+		for _, nf := range t.newFiles {
+			ve.NewFiles = append(ve.NewFiles, newFileEntry{Level: t.level, Meta: nf})
+			levelMetrics.NumFiles++
+			levelMetrics.Size += int64(nf.Size)
+		}
+	}
+	if err := d.mu.versions.logAndApply(jobID, ve, metrics, false /* forceRotation */, func() []compactionInfo {
+		return d.getInProgressCompactionInfoLocked(nil)
+	}); err != nil {
+		return err
+	}
+	d.updateReadStateLocked(d.opts.DebugCheck)
+	d.updateTableStatsLocked(ve.NewFiles)
+	d.deleteObsoleteFiles(jobID, false /* waitForOngoing */)
+	d.maybeScheduleCompaction()
+	return nil
+}
+
+// excisedTable is an sstable overlapping the span being excised, and the
+// virtual sstables replacing it.
+type excisedTable struct {
+	level    int
+	meta     *fileMetadata
+	newFiles []*fileMetadata
+}
+
+// excisedTables returns the sstables of the version v which overlap the span
+// [start, end), without their virtual sstables.
+func (d *DB) excisedTables(v *version, start, end []byte) []excisedTable {
+	var excised []excisedTable
+	for level := range v.Levels {
+		overlaps := v.Overlaps(level, d.cmp, start, end, true /* exclusiveEnd */)
+		iter := overlaps.Iter()
+		for m := iter.First(); m != nil; m = iter.Next() {
+			if !m.Overlaps(d.cmp, start, end, true /* exclusiveEnd */) {
+				// At L0, Overlaps expands the span to the bounds of the
+				// overlapping files.
+				continue
+			}
+			excised = append(excised, excisedTable{level: level, meta: m})
+		}
+	}
+	return excised
+}
+
+// excisedTablesEqual returns true if a and b hold the same sstables, at the
+// same levels.
+func excisedTablesEqual(a, b []excisedTable) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].level != b[i].level || a[i].meta != b[i].meta {
+			return false
+		}
+	}
+	return true
+}
+
+// exciseOverlapsCompacting returns true if any sstable overlapping the span
+// [start, end) is being compacted.
+//
+// d.mu must be held when calling this.
+func (d *DB) exciseOverlapsCompacting(start, end []byte) bool {
+	current := d.mu.versions.currentVersion()
+	for level := range current.Levels {
+		overlaps := current.Overlaps(level, d.cmp, start, end, true /* exclusiveEnd */)
+		iter := overlaps.Iter()
+		for m := iter.First(); m != nil; m = iter.Next() {
+			if m.IsCompacting() && m.Overlaps(d.cmp, start, end, true /* exclusiveEnd */) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exciseTable returns the virtual sstables that replace the sstable m once
+// the span [start, end) is excised from it: one for the keys of m before the
+// span, and one for the keys of m after the span, if m has any such keys.
+//
+// The bounds of the virtual sstables are tight on the side of the bounds of m,
+// and loose on the side of the span. Their sizes are set by
+// estimateVirtualTableSizes.
+//
+// d.mu must be held when calling this.
+func (d *DB) exciseTable(start, end []byte, m *fileMetadata) []*fileMetadata {
+	var newFiles []*fileMetadata
+	newVirtual := func() *fileMetadata {
+		return &fileMetadata{
+			FileBacking:    m.FileBacking,
+			FileNum:        d.mu.versions.getNextFileNum(),
+			CreationTime:   time.Now().Unix(),
+			SmallestSeqNum: m.SmallestSeqNum,
+			LargestSeqNum:  m.LargestSeqNum,
+			Virtual:        true,
+		}
+	}
+	// before returns true if the bounds [smallest, largest] contain keys before
+	// start, and after returns true if they contain keys at or after end.
+	before := func(smallest *InternalKey) bool {
+		return d.cmp(smallest.UserKey, start) < 0
+	}
+	after := func(largest *InternalKey) bool {
+		c := d.cmp(largest.UserKey, end)
+		return c > 0 || (c == 0 && !largest.IsExclusiveSentinel())
+	}
+	// Keys before start are bounded by an exclusive sentinel at start, unless
+	// the largest key precedes start.
+	truncateLargest := func(largest InternalKey, sentinel InternalKey) InternalKey {
+		if c := d.cmp(largest.UserKey, start); c < 0 || (c == 0 && largest.IsExclusiveSentinel()) {
+			return largest
+		}
+		return sentinel
+	}
+	// Keys at or after end are bounded by the smallest internal key with the
+	// user key end, unless the smallest key follows end.
+	truncateSmallest := func(smallest InternalKey, kind InternalKeyKind) InternalKey {
+		if d.cmp(smallest.UserKey, end) >= 0 {
+			return smallest
+		}
+		return base.MakeInternalKey(end, InternalKeySeqNumMax, kind)
+	}
+
+	if before(&m.Smallest) {
+		leftFile := newVirtual()
+		if m.HasPointKeys && before(&m.SmallestPointKey) {
+			leftFile.ExtendPointKeyBounds(d.cmp, m.SmallestPointKey,
+				truncateLargest(m.LargestPointKey, base.MakeRangeDeleteSentinelKey(start)))
+		}
+		if m.HasRangeKeys && before(&m.SmallestRangeKey) {
+			leftFile.ExtendRangeKeyBounds(d.cmp, m.SmallestRangeKey,
+				truncateLargest(m.LargestRangeKey,
+					base.MakeExclusiveSentinelKey(InternalKeyKindRangeKeySet, start)))
+		}
+		newFiles = append(newFiles, leftFile)
+	}
+	if after(&m.Largest) {
+		rightFile := newVirtual()
+		if m.HasPointKeys && after(&m.LargestPointKey) {
+			rightFile.ExtendPointKeyBounds(d.cmp,
+				truncateSmallest(m.SmallestPointKey, InternalKeyKindMax), m.LargestPointKey)
+		}
+		if m.HasRangeKeys && after(&m.LargestRangeKey) {
+			rightFile.ExtendRangeKeyBounds(d.cmp,
+				truncateSmallest(m.SmallestRangeKey, InternalKeyKindRangeKeySet), m.LargestRangeKey)
+		}
+		newFiles = append(newFiles, rightFile)
+	}
+	return newFiles
+}
+
+// estimateVirtualTableSizes sets the sizes of the virtual sstables replacing
+// the sstable m, returned by exciseTable, and validates them. It reads the
+// backing sstable, so d.mu shouldn't be held.
+func (d *DB) estimateVirtualTableSizes(m *fileMetadata, newFiles []*fileMetadata) error {
+	for _, nf := range newFiles {
+		err := d.tableCache.withVirtualReader(nf.VirtualMeta(), func(r sstable.VirtualReader) (err error) {
+			nf.Size, err = r.EstimateDiskUsage(nf.Smallest.UserKey, nf.Largest.UserKey)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		// The estimate only accounts for point keys. A virtual sstable is
+		// never considered empty.
+		if nf.Size == 0 {
+			nf.Size = 1
+		}
+		nf.ValidateVirtual(m)
+	}
+	return nil
+}
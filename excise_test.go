@@ -0,0 +1,151 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/datadriven"
+	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExcise(t *testing.T) {
+	var mem vfs.FS
+	var d *DB
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	open := func() {
+		opts := &Options{
+			FS:                    mem,
+			Comparer:              testkeys.Comparer,
+			L0CompactionThreshold: 100,
+			L0StopWritesThreshold: 100,
+			DebugCheck:            DebugCheckLevels,
+			FormatMajorVersion:    FormatNewest,
+		}
+		opts.DisableAutomaticCompactions = true
+
+		var err error
+		d, err = Open("", opts)
+		require.NoError(t, err)
+	}
+	reset := func() {
+		if d != nil {
+			require.NoError(t, d.Close())
+		}
+		mem = vfs.NewMem()
+		require.NoError(t, mem.MkdirAll("ext", 0755))
+		open()
+	}
+	reset()
+
+	datadriven.RunTest(t, "testdata/excise", func(t *testing.T, td *datadriven.TestData) string {
+		switch td.Cmd {
+		case "reset":
+			reset()
+			return ""
+
+		case "reopen":
+			require.NoError(t, d.Close())
+			open()
+			return ""
+
+		case "batch":
+			b := d.NewIndexedBatch()
+			if err := runBatchDefineCmd(td, b); err != nil {
+				return err.Error()
+			}
+			if err := b.Commit(nil); err != nil {
+				return err.Error()
+			}
+			return ""
+
+		case "build":
+			if err := runBuildCmd(td, d, mem); err != nil {
+				return err.Error()
+			}
+			return ""
+
+		case "ingest":
+			if err := runIngestCmd(td, d, mem); err != nil {
+				return err.Error()
+			}
+			return ""
+
+		case "flush":
+			if err := d.Flush(); err != nil {
+				return err.Error()
+			}
+			return ""
+
+		case "excise":
+			if len(td.CmdArgs) != 2 {
+				return "excise <start> <end>"
+			}
+			if err := d.Excise([]byte(td.CmdArgs[0].Key), []byte(td.CmdArgs[1].Key)); err != nil {
+				return err.Error()
+			}
+			return ""
+
+		case "get":
+			return runGetCmd(td, d)
+
+		case "iter":
+			iter := d.NewIter(&IterOptions{
+				KeyTypes: IterKeyTypePointsAndRanges,
+			})
+			return runIterCmd(td, iter, true)
+
+		case "lsm":
+			return runLSMCmd(td, d)
+
+		case "compact":
+			if err := runCompactCmd(td, d); err != nil {
+				return err.Error()
+			}
+			return ""
+
+		case "ls":
+			list, err := mem.List("")
+			if err != nil {
+				return err.Error()
+			}
+			sort.Strings(list)
+			var buf strings.Builder
+			for _, name := range list {
+				if strings.HasSuffix(name, ".sst") {
+					fmt.Fprintln(&buf, name)
+				}
+			}
+			return buf.String()
+
+		case "virtual":
+			// Lists the sstables of the current version, and whether they're
+			// virtual.
+			var buf strings.Builder
+			d.mu.Lock()
+			current := d.mu.versions.currentVersion()
+			for level := range current.Levels {
+				iter := current.Levels[level].Iter()
+				for f := iter.First(); f != nil; f = iter.Next() {
+					fmt.Fprintf(&buf, "L%d %s: virtual=%t backing=%s\n",
+						level, f.FileNum, f.Virtual, f.FileBacking.FileNum)
+				}
+			}
+			d.mu.Unlock()
+			return buf.String()
+
+		default:
+			return fmt.Sprintf("unknown command: %s", td.Cmd)
+		}
+	})
+}
@@ -6,6 +6,7 @@ package pebble
 
 import (
 	"fmt"
+	"math/rand"
 	"testing"
 	"time"
 
@@ -127,3 +128,40 @@ func TestFlushEmptyKey(t *testing.T) {
 	require.NoError(t, closer.Close())
 	require.NoError(t, d.Close())
 }
+
+// TestFlushTargetFileSize tests that a flush is split into multiple output
+// sstables according to FlushTargetFileSize, with pacing between outputs.
+func TestFlushTargetFileSize(t *testing.T) {
+	opts := &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+	}
+	opts.Experimental.FlushTargetFileSize = 8 << 10
+	opts.Experimental.FlushOutputPacingRate = 1 << 30
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	// Use random values so that the sstables' sizes aren't reduced by
+	// compression.
+	rng := rand.New(rand.NewSource(0))
+	value := make([]byte, 100)
+	for i := 0; i < 1000; i++ {
+		rng.Read(value)
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("key%04d", i)), value, nil))
+	}
+	require.NoError(t, d.Flush())
+
+	m := d.Metrics()
+	require.Greater(t, m.Levels[0].NumFiles, int64(5))
+	require.Equal(t, uint64(m.Levels[0].NumFiles), m.Levels[0].TablesFlushed)
+	tables, err := d.SSTables()
+	require.NoError(t, err)
+	for _, info := range tables[0] {
+		// Outputs are split once they exceed the target size, so they may
+		// overshoot by up to a block.
+		require.Less(t, info.Size, uint64(16<<10))
+	}
+}
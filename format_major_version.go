@@ -151,6 +151,36 @@ const (
 	// compactions for files marked for compaction are complete.
 	FormatPrePebblev1MarkedCompacted
 
+	// FormatVirtualSSTables is a format major version that adds support for
+	// virtual sstables, which expose a span of the keys of a backing physical
+	// sstable. Virtual sstables are recorded in the manifest using fields that
+	// previous Pebble versions are unable to decode.
+	FormatVirtualSSTables
+
+	// FormatTwoPhaseCommit is a format major version that adds support for the
+	// two-phase commit of batches (see Batch.Prepare). The prepare, commit and
+	// rollback records are written to the WAL using key kinds that previous
+	// Pebble versions are unable to replay.
+	FormatTwoPhaseCommit
+
+	// FormatChunkedBatches is a format major version that adds support for the
+	// chunked commit of batches (see Batch.CommitChunked). The chunks of a
+	// batch and its commit marker are written to the WAL using key kinds that
+	// previous Pebble versions are unable to replay.
+	FormatChunkedBatches
+
+	// FormatExportedSnapshots is a format major version that adds support for
+	// exported snapshots (see Snapshot.Export). The exported snapshots are
+	// recorded in the manifest using fields that previous Pebble versions are
+	// unable to decode.
+	FormatExportedSnapshots
+
+	// FormatIdempotencyTokens is a format major version that adds support for
+	// the idempotency tokens of batches (see Batch.AddIdempotencyToken). The
+	// tokens are written to the WAL using a key kind that previous Pebble
+	// versions are unable to replay.
+	FormatIdempotencyTokens
+
 	// FormatNewest always contains the most recent format major version.
 	FormatNewest FormatMajorVersion = iota - 1
 )
@@ -169,7 +199,8 @@ func (v FormatMajorVersion) MaxTableFormat() sstable.TableFormat {
 		FormatUnusedPrePebblev1MarkedCompacted:
 		return sstable.TableFormatPebblev2
 	case FormatSSTableValueBlocks, FormatFlushableIngest,
-		FormatPrePebblev1MarkedCompacted:
+		FormatPrePebblev1MarkedCompacted, FormatVirtualSSTables, FormatTwoPhaseCommit,
+		FormatChunkedBatches, FormatExportedSnapshots, FormatIdempotencyTokens:
 		return sstable.TableFormatPebblev3
 	default:
 		panic(fmt.Sprintf("pebble: unsupported format major version: %s", v))
@@ -187,7 +218,9 @@ func (v FormatMajorVersion) MinTableFormat() sstable.TableFormat {
 		return sstable.TableFormatLevelDB
 	case FormatMinTableFormatPebblev1, FormatPrePebblev1Marked,
 		FormatUnusedPrePebblev1MarkedCompacted, FormatSSTableValueBlocks,
-		FormatFlushableIngest, FormatPrePebblev1MarkedCompacted:
+		FormatFlushableIngest, FormatPrePebblev1MarkedCompacted,
+		FormatVirtualSSTables, FormatTwoPhaseCommit, FormatChunkedBatches,
+		FormatExportedSnapshots, FormatIdempotencyTokens:
 		return sstable.TableFormatPebblev1
 	default:
 		panic(fmt.Sprintf("pebble: unsupported format major version: %s", v))
@@ -320,6 +353,21 @@ var formatMajorVersionMigrations = map[FormatMajorVersion]func(*DB) error{
 		}
 		return d.finalizeFormatVersUpgrade(FormatPrePebblev1MarkedCompacted)
 	},
+	FormatVirtualSSTables: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatVirtualSSTables)
+	},
+	FormatTwoPhaseCommit: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatTwoPhaseCommit)
+	},
+	FormatChunkedBatches: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatChunkedBatches)
+	},
+	FormatExportedSnapshots: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatExportedSnapshots)
+	},
+	FormatIdempotencyTokens: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatIdempotencyTokens)
+	},
 }
 
 const formatVersionMarkerName = `format-version`
@@ -378,6 +426,9 @@ func (d *DB) ratchetFormatMajorVersionLocked(formatVers FormatMajorVersion) erro
 	if d.opts.ReadOnly {
 		return ErrReadOnly
 	}
+	if err := d.diskFullErr(); err != nil {
+		return err
+	}
 	if formatVers > FormatNewest {
 		// Guard against accidentally forgetting to update FormatNewest.
 		return errors.Errorf("pebble: unknown format version %d", formatVers)
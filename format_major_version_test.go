@@ -62,6 +62,16 @@ func TestRatchetFormat(t *testing.T) {
 	require.Equal(t, FormatFlushableIngest, d.FormatMajorVersion())
 	require.NoError(t, d.RatchetFormatMajorVersion(FormatPrePebblev1MarkedCompacted))
 	require.Equal(t, FormatPrePebblev1MarkedCompacted, d.FormatMajorVersion())
+	require.NoError(t, d.RatchetFormatMajorVersion(FormatVirtualSSTables))
+	require.Equal(t, FormatVirtualSSTables, d.FormatMajorVersion())
+	require.NoError(t, d.RatchetFormatMajorVersion(FormatTwoPhaseCommit))
+	require.Equal(t, FormatTwoPhaseCommit, d.FormatMajorVersion())
+	require.NoError(t, d.RatchetFormatMajorVersion(FormatChunkedBatches))
+	require.Equal(t, FormatChunkedBatches, d.FormatMajorVersion())
+	require.NoError(t, d.RatchetFormatMajorVersion(FormatExportedSnapshots))
+	require.Equal(t, FormatExportedSnapshots, d.FormatMajorVersion())
+	require.NoError(t, d.RatchetFormatMajorVersion(FormatIdempotencyTokens))
+	require.Equal(t, FormatIdempotencyTokens, d.FormatMajorVersion())
 
 	require.NoError(t, d.Close())
 
@@ -225,6 +235,11 @@ func TestFormatMajorVersions_TableFormat(t *testing.T) {
 		FormatSSTableValueBlocks:               {sstable.TableFormatPebblev1, sstable.TableFormatPebblev3},
 		FormatFlushableIngest:                  {sstable.TableFormatPebblev1, sstable.TableFormatPebblev3},
 		FormatPrePebblev1MarkedCompacted:       {sstable.TableFormatPebblev1, sstable.TableFormatPebblev3},
+		FormatVirtualSSTables:                  {sstable.TableFormatPebblev1, sstable.TableFormatPebblev3},
+		FormatTwoPhaseCommit:                   {sstable.TableFormatPebblev1, sstable.TableFormatPebblev3},
+		FormatChunkedBatches:                   {sstable.TableFormatPebblev1, sstable.TableFormatPebblev3},
+		FormatExportedSnapshots:                {sstable.TableFormatPebblev1, sstable.TableFormatPebblev3},
+		FormatIdempotencyTokens:                {sstable.TableFormatPebblev1, sstable.TableFormatPebblev3},
 	}
 
 	// Valid versions.
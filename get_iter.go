@@ -36,6 +36,11 @@ type getIter struct {
 	iterKey      *InternalKey
 	iterValue    base.LazyValue
 	err          error
+	// If set, the sstables are positioned using SeekPrefixGE with the prefix of
+	// the key, so that their filters may exclude the key without loading a data
+	// block. Otherwise the sstables are positioned using SeekGE.
+	split  Split
+	prefix []byte
 }
 
 // TODO(sumeer): CockroachDB code doesn't use getIter, but, for completeness,
@@ -146,7 +151,13 @@ func (g *getIter) Next() (*InternalKey, base.LazyValue) {
 		// Create iterators from memtables from newest to oldest.
 		if n := len(g.mem); n > 0 {
 			m := g.mem[n-1]
-			g.iter = m.newIter(nil)
+			if mem, ok := m.flushable.(*memTable); ok {
+				// A memtable may index the point keys such that a lookup of a
+				// user key need only consider some of them.
+				g.iter = mem.newGetIter(g.key)
+			} else {
+				g.iter = m.newIter(nil)
+			}
 			g.rangeDelIter = m.newRangeDelIter(nil)
 			g.mem = g.mem[:n-1]
 			g.iterKey, g.iterValue = g.iter.SeekGE(g.key, base.SeekGEFlagsNone)
@@ -159,11 +170,11 @@ func (g *getIter) Next() (*InternalKey, base.LazyValue) {
 				files := g.l0[n-1].Iter()
 				g.l0 = g.l0[:n-1]
 				iterOpts := IterOptions{logger: g.logger}
-				g.levelIter.init(context.Background(), iterOpts, g.cmp, nil /* split */, g.newIters,
+				g.levelIter.init(context.Background(), iterOpts, g.cmp, g.split, g.newIters,
 					files, manifest.L0Sublevel(n), internalIterOpts{})
 				g.levelIter.initRangeDel(&g.rangeDelIter)
 				g.iter = &g.levelIter
-				g.iterKey, g.iterValue = g.iter.SeekGE(g.key, base.SeekGEFlagsNone)
+				g.seekLevel()
 				continue
 			}
 			g.level++
@@ -178,13 +189,22 @@ func (g *getIter) Next() (*InternalKey, base.LazyValue) {
 		}
 
 		iterOpts := IterOptions{logger: g.logger}
-		g.levelIter.init(context.Background(), iterOpts, g.cmp, nil /* split */, g.newIters,
+		g.levelIter.init(context.Background(), iterOpts, g.cmp, g.split, g.newIters,
 			g.version.Levels[g.level].Iter(), manifest.Level(g.level), internalIterOpts{})
 		g.levelIter.initRangeDel(&g.rangeDelIter)
 		g.level++
 		g.iter = &g.levelIter
-		g.iterKey, g.iterValue = g.iter.SeekGE(g.key, base.SeekGEFlagsNone)
+		g.seekLevel()
+	}
+}
+
+// seekLevel positions the levelIter at the first entry of the key.
+func (g *getIter) seekLevel() {
+	if g.prefix != nil {
+		g.iterKey, g.iterValue = g.levelIter.SeekPrefixGE(g.prefix, g.key, base.SeekGEFlagsNone)
+		return
 	}
+	g.iterKey, g.iterValue = g.levelIter.SeekGE(g.key, base.SeekGEFlagsNone)
 }
 
 func (g *getIter) Prev() (*InternalKey, base.LazyValue) {
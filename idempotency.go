@@ -0,0 +1,110 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import "github.com/cockroachdb/errors"
+
+// idempotencyTokens holds the idempotency tokens of the committed batches
+// which are retained (see Batch.AddIdempotencyToken).
+type idempotencyTokens struct {
+	// set holds the retained tokens.
+	set map[string]struct{}
+	// order holds the retained tokens in the order they were committed, oldest
+	// first.
+	order []string
+	// size is the total size in bytes of the retained tokens.
+	size int
+}
+
+// IdempotencyTokenCommitted returns true if a batch carrying the idempotency
+// token (see Batch.AddIdempotencyToken) was committed, and the token is still
+// retained. After reopening the DB, these are the tokens of the batches
+// replayed from the WAL, or whose memtables were flushed. A token is reported
+// as soon as its batch is written to the WAL, before the batch is synced; a
+// batch that's still being committed concurrently may or may not be reported.
+func (d *DB) IdempotencyTokenCommitted(token []byte) bool {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.mu.idempotencyTokens.set[string(token)]
+	return ok
+}
+
+func (d *DB) checkIdempotencyTokens() error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if d.opts.DisableWAL {
+		return errors.New("pebble: idempotency tokens require the WAL")
+	}
+	if v := d.FormatMajorVersion(); v < FormatIdempotencyTokens {
+		return errors.Newf(
+			"pebble: database has format major version %d; idempotency tokens require at least %d",
+			errors.Safe(v), errors.Safe(FormatIdempotencyTokens),
+		)
+	}
+	return nil
+}
+
+// applyIdempotencyTokensLocked retains the idempotency tokens of the batch b,
+// forgetting the oldest tokens beyond Options.Experimental.MaxIdempotencyTokens
+// and MaxIdempotencyTokensSize. It's called once b is written to the WAL, and
+// during WAL replay.
+//
+// d.mu must be held when calling this.
+func (d *DB) applyIdempotencyTokensLocked(b *Batch) {
+	t := &d.mu.idempotencyTokens
+	for r := b.Reader(); ; {
+		kind, token, _, ok := r.Next()
+		if !ok {
+			break
+		}
+		if kind != InternalKeyKindIdempotencyToken {
+			continue
+		}
+		if _, ok := t.set[string(token)]; ok {
+			// The token was committed again, or is replayed from the records
+			// written to a later WAL by logCarriedOverRecordsLocked.
+			continue
+		}
+		t.set[string(token)] = struct{}{}
+		t.order = append(t.order, string(token))
+		t.size += len(token)
+	}
+	var n int
+	for len(t.order)-n > d.opts.Experimental.MaxIdempotencyTokens ||
+		t.size > d.opts.Experimental.MaxIdempotencyTokensSize {
+		delete(t.set, t.order[n])
+		t.size -= len(t.order[n])
+		t.order[n] = ""
+		n++
+	}
+	t.order = t.order[n:]
+}
+
+// idempotencyTokensRecordLocked returns the WAL record holding the retained
+// idempotency tokens, in the order they were committed, with the sequence
+// number seqNum. It returns nil if no tokens are retained.
+//
+// d.mu must be held when calling this.
+func (d *DB) idempotencyTokensRecordLocked(seqNum uint64) []byte {
+	if len(d.mu.idempotencyTokens.order) == 0 {
+		return nil
+	}
+	var b Batch
+	for _, token := range d.mu.idempotencyTokens.order {
+		b.prepareDeferredKeyRecord(len(token), InternalKeyKindIdempotencyToken)
+		copy(b.deferredOp.Key, token)
+	}
+	// Like LogData, the tokens aren't added to the memtable.
+	b.count, b.memTableSize = 0, 0
+	b.setSeqNum(seqNum)
+	return b.Repr()
+}
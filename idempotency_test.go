@@ -0,0 +1,212 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyTokens(t *testing.T) {
+	opts := &Options{
+		FS:                 vfs.NewMem(),
+		FormatMajorVersion: FormatIdempotencyTokens,
+		MemTableSize:       256 << 10,
+	}
+	opts.Experimental.MaxIdempotencyTokens = 3
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	reopen := func() {
+		require.NoError(t, d.Close())
+		d, err = Open("", opts)
+		require.NoError(t, err)
+	}
+	commit := func(key, token string, value []byte) {
+		b := d.NewBatch()
+		require.NoError(t, b.Set([]byte(key), value, nil))
+		require.NoError(t, b.AddIdempotencyToken([]byte(token)))
+		require.NoError(t, d.Apply(b, Sync))
+		require.NoError(t, b.Close())
+	}
+	committed := func(tokens ...string) {
+		t.Helper()
+		for _, token := range tokens {
+			require.True(t, d.IdempotencyTokenCommitted([]byte(token)), "token %s", token)
+		}
+	}
+	notCommitted := func(tokens ...string) {
+		t.Helper()
+		for _, token := range tokens {
+			require.False(t, d.IdempotencyTokenCommitted([]byte(token)), "token %s", token)
+		}
+	}
+
+	// The tokens aren't visible to readers.
+	commit("a", "t1", []byte("1"))
+	committed("t1")
+	notCommitted("t2")
+	v, closer, err := d.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, "1", string(v))
+	require.NoError(t, closer.Close())
+
+	// A batch that isn't committed doesn't commit its tokens.
+	b := d.NewBatch()
+	require.NoError(t, b.AddIdempotencyToken([]byte("t2")))
+	require.NoError(t, b.Close())
+	notCommitted("t2")
+
+	// The tokens survive the deletion of the WALs they were written to.
+	commit("b", "t2", []byte("2"))
+	require.NoError(t, d.Flush())
+	reopen()
+	committed("t1", "t2")
+	reopen()
+	committed("t1", "t2")
+	require.False(t, d.IdempotencyTokenCommitted(nil))
+
+	// Only the most recent tokens are retained, including by large batches
+	// that are flushed from the queue of flushables.
+	commit("c", "t3", bytes.Repeat([]byte("x"), int(opts.MemTableSize)))
+	committed("t1", "t2", "t3")
+	commit("d", "t4", []byte("4"))
+	notCommitted("t1")
+	committed("t2", "t3", "t4")
+	require.NoError(t, d.Flush())
+	reopen()
+	notCommitted("t1")
+	committed("t2", "t3", "t4")
+
+	// The tokens of a prepared batch are committed along with the batch.
+	b = d.NewBatch()
+	require.NoError(t, b.Set([]byte("e"), []byte("5"), nil))
+	require.NoError(t, b.AddIdempotencyToken([]byte("t5")))
+	require.NoError(t, b.Prepare([]byte("txn"), Sync))
+	require.NoError(t, b.Close())
+	notCommitted("t5")
+	reopen()
+	notCommitted("t5")
+	require.NoError(t, d.CommitPrepared([]byte("txn"), Sync))
+	committed("t3", "t4", "t5")
+	reopen()
+	committed("t3", "t4", "t5")
+
+	// Chunked commits don't support idempotency tokens.
+	b = d.NewBatch()
+	require.NoError(t, b.Set([]byte("f"), []byte("6"), nil))
+	require.NoError(t, b.AddIdempotencyToken([]byte("t6")))
+	require.Error(t, b.CommitChunked())
+	require.NoError(t, b.Close())
+	notCommitted("t6")
+}
+
+func TestIdempotencyTokensRetention(t *testing.T) {
+	const maxTokens = 10
+	opts := &Options{
+		FS:                 vfs.NewMem(),
+		FormatMajorVersion: FormatIdempotencyTokens,
+	}
+	opts.Experimental.MaxIdempotencyTokens = maxTokens
+	opts.Experimental.MaxIdempotencyTokensSize = 100
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	reopen := func() {
+		require.NoError(t, d.Close())
+		d, err = Open("", opts)
+		require.NoError(t, err)
+	}
+	commit := func(token string) {
+		b := d.NewBatch()
+		require.NoError(t, b.Set([]byte("a"), []byte(token), nil))
+		require.NoError(t, b.AddIdempotencyToken([]byte(token)))
+		require.NoError(t, d.Apply(b, Sync))
+		require.NoError(t, b.Close())
+	}
+
+	// A token is retained until MaxIdempotencyTokens newer tokens are
+	// committed, across reopens that carry the tokens over to new WALs.
+	commit("t00")
+	for i := 1; i < maxTokens; i++ {
+		commit(fmt.Sprintf("t%02d", i))
+		require.NoError(t, d.Flush())
+		reopen()
+		require.True(t, d.IdempotencyTokenCommitted([]byte("t00")))
+	}
+	commit(fmt.Sprintf("t%02d", maxTokens))
+	require.NoError(t, d.Flush())
+	reopen()
+	require.False(t, d.IdempotencyTokenCommitted([]byte("t00")))
+	require.True(t, d.IdempotencyTokenCommitted([]byte("t01")))
+
+	// The oldest tokens are also forgotten once the retained tokens exceed
+	// MaxIdempotencyTokensSize, which bounds the size of the record written to
+	// every new WAL.
+	commit(string(bytes.Repeat([]byte("x"), 80)))
+	require.NoError(t, d.Flush())
+	reopen()
+	for i := 1; i <= maxTokens; i++ {
+		require.Equal(t, i > 4, d.IdempotencyTokenCommitted([]byte(fmt.Sprintf("t%02d", i))), "token t%02d", i)
+	}
+	b := d.NewBatch()
+	require.Error(t, b.AddIdempotencyToken(bytes.Repeat([]byte("x"), 101)))
+	require.NoError(t, b.Close())
+}
+
+func TestIdempotencyTokensUnsupported(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                 vfs.NewMem(),
+		FormatMajorVersion: FormatExportedSnapshots,
+	})
+	require.NoError(t, err)
+	b := d.NewBatch()
+	require.Error(t, b.AddIdempotencyToken([]byte("t1")))
+	require.NoError(t, b.Close())
+
+	// The tokens of batches that aren't created by the DB are checked when
+	// they're committed.
+	tokenBatch := func() *Batch {
+		b := new(Batch)
+		require.NoError(t, b.Set([]byte("a"), []byte("1"), nil))
+		require.NoError(t, b.AddIdempotencyToken([]byte("t1")))
+		return b
+	}
+	require.Error(t, d.Apply(tokenBatch(), nil))
+	b = new(Batch)
+	require.NoError(t, b.SetRepr(append([]byte(nil), tokenBatch().Repr()...)))
+	require.Error(t, d.Apply(b, nil))
+	b = d.NewBatch()
+	require.NoError(t, b.Apply(tokenBatch(), nil))
+	require.Error(t, d.Apply(b, nil))
+	require.NoError(t, b.Close())
+	require.False(t, d.IdempotencyTokenCommitted([]byte("t1")))
+
+	require.NoError(t, d.RatchetFormatMajorVersion(FormatIdempotencyTokens))
+	b = d.NewBatch()
+	require.Error(t, b.AddIdempotencyToken(nil))
+	require.NoError(t, b.AddIdempotencyToken([]byte("t1")))
+	require.NoError(t, b.Close())
+	require.NoError(t, d.Apply(tokenBatch(), nil))
+	require.True(t, d.IdempotencyTokenCommitted([]byte("t1")))
+	require.NoError(t, d.Close())
+
+	d, err = Open("", &Options{
+		FS:                 vfs.NewMem(),
+		FormatMajorVersion: FormatIdempotencyTokens,
+		DisableWAL:         true,
+	})
+	require.NoError(t, err)
+	b = d.NewBatch()
+	require.Error(t, b.AddIdempotencyToken([]byte("t1")))
+	require.NoError(t, b.Close())
+	require.Error(t, d.Apply(tokenBatch(), nil))
+	require.False(t, d.IdempotencyTokenCommitted([]byte("t1")))
+	require.NoError(t, d.Close())
+}
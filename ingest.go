@@ -385,18 +385,28 @@ func overlapWithIterator(
 	//    means boundary < L and hence is similar to 1).
 	// 4) boundary == L and L is sentinel,
 	//    we'll always overlap since for any values of i,j ranges [i, k) and [j, k) always overlap.
+	//
+	// An iterator that errors out is treated as overlapping, since the keys it
+	// failed to read could be in the way. Placing the file in a level that's too
+	// high only costs write amplification, while placing it too low would
+	// violate the sequence number invariant.
 	key, _ := iter.SeekGE(meta.Smallest.UserKey, base.SeekGEFlagsNone)
 	if key != nil {
 		c := sstableKeyCompare(cmp, *key, meta.Largest)
 		if c <= 0 {
 			return true
 		}
+	} else if iter.Error() != nil {
+		return true
 	}
 
 	computeOverlapWithSpans := func(rIter keyspan.FragmentIterator) bool {
 		// NB: The spans surfaced by the fragment iterator are non-overlapping.
 		span := rIter.SeekLT(meta.Smallest.UserKey)
 		if span == nil {
+			if rIter.Error() != nil {
+				return true
+			}
 			span = rIter.Next()
 		}
 		for ; span != nil; span = rIter.Next() {
@@ -417,7 +427,7 @@ func overlapWithIterator(
 				return true
 			}
 		}
-		return false
+		return rIter.Error() != nil
 	}
 
 	// rkeyIter is either a range key level iter, or a range key iterator
@@ -523,6 +533,10 @@ func ingestTargetLevel(
 		}
 		rkeyIter, err := newRangeKeyIter(meta0, nil)
 		if err != nil {
+			err = firstError(err, iter.Close())
+			if rangeDelIter != nil {
+				err = firstError(err, rangeDelIter.Close())
+			}
 			return 0, err
 		}
 		overlap := overlapWithIterator(iter, &rangeDelIter, rkeyIter, meta, cmp)
@@ -647,6 +661,9 @@ func (d *DB) Ingest(paths []string) error {
 	if d.opts.ReadOnly {
 		return ErrReadOnly
 	}
+	if err := d.diskFullErr(); err != nil {
+		return err
+	}
 	_, err := d.ingest(paths, ingestTargetLevel)
 	return err
 }
@@ -673,6 +690,9 @@ func (d *DB) IngestWithStats(paths []string) (IngestOperationStats, error) {
 	if d.opts.ReadOnly {
 		return IngestOperationStats{}, ErrReadOnly
 	}
+	if err := d.diskFullErr(); err != nil {
+		return IngestOperationStats{}, err
+	}
 	return d.ingest(paths, ingestTargetLevel)
 }
 
@@ -741,9 +761,13 @@ func (d *DB) handleIngestAsFlushable(meta []*fileMetadata, seqNum uint64) error
 		// We create a new WAL for the flushable instead of reusing the end of
 		// the previous WAL. This simplifies the increment of the minimum
 		// unflushed log number, and also simplifies WAL replay.
-		logNum, _ = d.recycleWAL()
+		var err error
+		logNum, _, err = d.recycleWAL()
+		if err != nil {
+			return err
+		}
 		d.mu.Unlock()
-		err := d.commit.directWrite(b)
+		err = d.commit.directWrite(b)
 		if err != nil {
 			d.opts.Logger.Fatalf("%v", err)
 		}
@@ -764,10 +788,13 @@ func (d *DB) handleIngestAsFlushable(meta []*fileMetadata, seqNum uint64) error
 		// This is WAL num of the next mutable memtable which comes after the
 		// ingestedFlushable in the flushable queue. The mutable memtable
 		// will be created below.
-		newLogNum, _ = d.recycleWAL()
+		newLogNum, _, err = d.recycleWAL()
 		if err != nil {
 			return err
 		}
+		if err := d.logCarriedOverRecordsLocked(nextSeqNum); err != nil {
+			return err
+		}
 	}
 
 	currMem := d.mu.mem.mutable
@@ -1100,6 +1127,13 @@ func (d *DB) validateSSTables() {
 				return r.ValidateBlockChecksums()
 			})
 		if err != nil {
+			if !errors.Is(err, base.ErrCorruption) {
+				// The table couldn't be read, e.g. due to a transient I/O
+				// error, which says nothing about its integrity. Report the
+				// error and leave the table unvalidated.
+				d.opts.EventListener.BackgroundError(err)
+				continue
+			}
 			// TODO(travers): Hook into the corruption reporting pipeline, once
 			// available. See pebble#1192.
 			d.opts.Logger.Fatalf("pebble: encountered corruption during ingestion: %s", err)
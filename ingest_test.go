@@ -14,6 +14,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -1948,6 +1949,56 @@ func TestIngestValidation(t *testing.T) {
 	}
 }
 
+// TestIngestValidationReadError tests that a failure to read an ingested
+// table during its validation is reported as a background error, rather than
+// as a corruption of the table.
+func TestIngestValidationReadError(t *testing.T) {
+	var inject atomic.Bool
+	mem := vfs.NewMem()
+	fs := errorfs.Wrap(mem, errorfs.InjectorFunc(func(op errorfs.Op, path string) error {
+		if inject.Load() && op == errorfs.OpFileReadAt && strings.HasSuffix(path, ".sst") {
+			return errorfs.ErrInjected
+		}
+		return nil
+	}))
+
+	errCh := make(chan error, 1)
+	logger := &fatalCapturingLogger{}
+	opts := &Options{
+		FS:     fs,
+		Logger: logger,
+		EventListener: &EventListener{
+			BackgroundError: func(err error) {
+				select {
+				case errCh <- err:
+				default:
+				}
+			},
+		},
+	}
+	opts.Experimental.ValidateOnIngest = true
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	f, err := mem.Create("ext")
+	require.NoError(t, err)
+	w := sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{})
+	require.NoError(t, w.Set([]byte("a"), []byte("1")))
+	require.NoError(t, w.Close())
+
+	// Fail the reads of the DB's tables, leaving the external table readable
+	// by the ingestion itself.
+	inject.Store(true)
+	require.NoError(t, d.Ingest([]string{"ext"}))
+	err = <-errCh
+	inject.Store(false)
+
+	require.True(t, errors.Is(err, errorfs.ErrInjected))
+	require.True(t, errors.Is(err, base.ErrTransientIO))
+	require.NoError(t, logger.err)
+}
+
 // BenchmarkManySSTables measures the cost of various operations with various
 // counts of SSTables within the database.
 func BenchmarkManySSTables(b *testing.B) {
@@ -11,22 +11,28 @@ type InternalKeyKind = base.InternalKeyKind
 
 // These constants are part of the file format, and should not be changed.
 const (
-	InternalKeyKindDelete          = base.InternalKeyKindDelete
-	InternalKeyKindSet             = base.InternalKeyKindSet
-	InternalKeyKindMerge           = base.InternalKeyKindMerge
-	InternalKeyKindLogData         = base.InternalKeyKindLogData
-	InternalKeyKindSingleDelete    = base.InternalKeyKindSingleDelete
-	InternalKeyKindRangeDelete     = base.InternalKeyKindRangeDelete
-	InternalKeyKindMax             = base.InternalKeyKindMax
-	InternalKeyKindSetWithDelete   = base.InternalKeyKindSetWithDelete
-	InternalKeyKindRangeKeySet     = base.InternalKeyKindRangeKeySet
-	InternalKeyKindRangeKeyUnset   = base.InternalKeyKindRangeKeyUnset
-	InternalKeyKindRangeKeyDelete  = base.InternalKeyKindRangeKeyDelete
-	InternalKeyKindIngestSST       = base.InternalKeyIngestSST
-	InternalKeyKindInvalid         = base.InternalKeyKindInvalid
-	InternalKeySeqNumBatch         = base.InternalKeySeqNumBatch
-	InternalKeySeqNumMax           = base.InternalKeySeqNumMax
-	InternalKeyRangeDeleteSentinel = base.InternalKeyRangeDeleteSentinel
+	InternalKeyKindDelete           = base.InternalKeyKindDelete
+	InternalKeyKindSet              = base.InternalKeyKindSet
+	InternalKeyKindMerge            = base.InternalKeyKindMerge
+	InternalKeyKindLogData          = base.InternalKeyKindLogData
+	InternalKeyKindPrepareTxn       = base.InternalKeyKindPrepareTxn
+	InternalKeyKindCommitTxn        = base.InternalKeyKindCommitTxn
+	InternalKeyKindRollbackTxn      = base.InternalKeyKindRollbackTxn
+	InternalKeyKindBatchChunk       = base.InternalKeyKindBatchChunk
+	InternalKeyKindCommitChunks     = base.InternalKeyKindCommitChunks
+	InternalKeyKindIdempotencyToken = base.InternalKeyKindIdempotencyToken
+	InternalKeyKindSingleDelete     = base.InternalKeyKindSingleDelete
+	InternalKeyKindRangeDelete      = base.InternalKeyKindRangeDelete
+	InternalKeyKindMax              = base.InternalKeyKindMax
+	InternalKeyKindSetWithDelete    = base.InternalKeyKindSetWithDelete
+	InternalKeyKindRangeKeySet      = base.InternalKeyKindRangeKeySet
+	InternalKeyKindRangeKeyUnset    = base.InternalKeyKindRangeKeyUnset
+	InternalKeyKindRangeKeyDelete   = base.InternalKeyKindRangeKeyDelete
+	InternalKeyKindIngestSST        = base.InternalKeyIngestSST
+	InternalKeyKindInvalid          = base.InternalKeyKindInvalid
+	InternalKeySeqNumBatch          = base.InternalKeySeqNumBatch
+	InternalKeySeqNumMax            = base.InternalKeySeqNumMax
+	InternalKeyRangeDeleteSentinel  = base.InternalKeyRangeDeleteSentinel
 )
 
 // InternalKey exports the base.InternalKey type.
@@ -38,6 +44,21 @@ type internalIterator = base.InternalIterator
 // sstable) isn't in the expected format.
 var ErrCorruption = base.ErrCorruption
 
+// ErrTransientIO is a marker to indicate that an I/O operation on a file or
+// object failed in a way that may succeed if retried. Use
+// errors.Is(err, ErrTransientIO) to check for this error.
+var ErrTransientIO = base.ErrTransientIO
+
+// ErrInvariant is a marker to indicate that an internal invariant was
+// violated, and the state of the DB can't be trusted. Use
+// errors.Is(err, ErrInvariant) to check for this error.
+var ErrInvariant = base.ErrInvariant
+
+// CorruptionError exports the base.CorruptionError type. Use errors.As to
+// retrieve the location of the corruption from a corruption error; not all
+// corruption errors carry a location.
+type CorruptionError = base.CorruptionError
+
 // AttributeAndLen exports the base.AttributeAndLen type.
 type AttributeAndLen = base.AttributeAndLen
 
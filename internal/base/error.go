@@ -4,7 +4,11 @@
 
 package base
 
-import "github.com/cockroachdb/errors"
+import (
+	"fmt"
+
+	"github.com/cockroachdb/errors"
+)
 
 // ErrNotFound means that a get or delete call did not find the requested key.
 var ErrNotFound = errors.New("pebble: not found")
@@ -26,3 +30,87 @@ func MarkCorruptionError(err error) error {
 func CorruptionErrorf(format string, args ...interface{}) error {
 	return errors.Mark(errors.Newf(format, args...), ErrCorruption)
 }
+
+// ErrTransientIO is a marker to indicate that an I/O operation on a file or
+// object failed in a way that may succeed if retried, e.g. a failed read from
+// local or shared storage. The data itself is not known to be corrupt.
+var ErrTransientIO = errors.New("pebble: transient I/O error")
+
+// ErrInvariant is a marker to indicate that an internal invariant was
+// violated. It indicates a bug in Pebble or in its use, and the state of the
+// DB can't be trusted.
+var ErrInvariant = errors.New("pebble: invariant violation")
+
+// MarkTransientIOError marks given error as a transient I/O error. Corruption
+// errors are left untouched, as retrying won't help them.
+func MarkTransientIOError(err error) error {
+	if err == nil || errors.Is(err, ErrTransientIO) || errors.Is(err, ErrCorruption) {
+		return err
+	}
+	return errors.Mark(err, ErrTransientIO)
+}
+
+// InvariantErrorf formats according to a format specifier and returns the
+// string as an assertion failure that is marked as an invariant violation.
+func InvariantErrorf(format string, args ...interface{}) error {
+	return errors.Mark(errors.AssertionFailedf(format, args...), ErrInvariant)
+}
+
+// CorruptionError is a corruption error that carries the location of the
+// corruption. It is marked as ErrCorruption; use errors.As to retrieve the
+// location from an error returned by Pebble.
+type CorruptionError struct {
+	// FileType is the type of the corrupt file.
+	FileType FileType
+	// FileNum is the file number of the corrupt file.
+	FileNum FileNum
+	// Offset is the offset of the corruption within the file, or -1 if it is
+	// not known.
+	Offset int64
+
+	cause error
+}
+
+var _ errors.SafeFormatter = (*CorruptionError)(nil)
+
+// Error implements the error interface.
+func (e *CorruptionError) Error() string { return e.cause.Error() }
+
+// Unwrap returns the underlying corruption error.
+func (e *CorruptionError) Unwrap() error { return e.cause }
+
+// Format implements fmt.Formatter.
+func (e *CorruptionError) Format(s fmt.State, verb rune) { errors.FormatError(e, s, verb) }
+
+// SafeFormatError implements errors.SafeFormatter.
+func (e *CorruptionError) SafeFormatError(p errors.Printer) (next error) {
+	if p.Detail() {
+		p.Printf("corruption in %s at offset %d",
+			errors.Safe(MakeFilename(e.FileType, e.FileNum)), errors.Safe(e.Offset))
+	}
+	return e.cause
+}
+
+// MarkCorruptionErrorAt marks given error as a corruption error at the given
+// location within a file. If the error already carries a location, it is
+// returned unchanged.
+func MarkCorruptionErrorAt(err error, fileType FileType, fileNum FileNum, offset int64) error {
+	var ce *CorruptionError
+	if errors.As(err, &ce) {
+		return err
+	}
+	return &CorruptionError{
+		FileType: fileType,
+		FileNum:  fileNum,
+		Offset:   offset,
+		cause:    MarkCorruptionError(err),
+	}
+}
+
+// CorruptionErrorAtf formats according to a format specifier and returns the
+// string as a corruption error at the given location within a file.
+func CorruptionErrorAtf(
+	fileType FileType, fileNum FileNum, offset int64, format string, args ...interface{},
+) error {
+	return MarkCorruptionErrorAt(CorruptionErrorf(format, args...), fileType, fileNum, offset)
+}
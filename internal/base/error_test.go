@@ -0,0 +1,54 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package base
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorruptionError(t *testing.T) {
+	err := CorruptionErrorAtf(FileTypeTable, 5, 123, "bad block %d", 7)
+	require.EqualError(t, err, "bad block 7")
+	require.True(t, errors.Is(err, ErrCorruption))
+	require.False(t, errors.Is(err, ErrTransientIO))
+
+	// The location survives wrapping, and the innermost location is kept.
+	wrapped := errors.Wrap(MarkCorruptionErrorAt(err, FileTypeLog, 6, 0), "reading")
+	var ce *CorruptionError
+	require.True(t, errors.As(wrapped, &ce))
+	require.Equal(t, FileTypeTable, ce.FileType)
+	require.Equal(t, FileNum(5), ce.FileNum)
+	require.Equal(t, int64(123), ce.Offset)
+	require.Contains(t, fmt.Sprintf("%+v", wrapped), "corruption in 000005.sst at offset 123")
+
+	// Marking an unmarked error at a location also marks it as corruption.
+	err = MarkCorruptionErrorAt(io.ErrUnexpectedEOF, FileTypeManifest, 1, -1)
+	require.True(t, errors.Is(err, ErrCorruption))
+	require.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+}
+
+func TestTransientIOError(t *testing.T) {
+	require.NoError(t, MarkTransientIOError(nil))
+
+	err := MarkTransientIOError(errors.New("injected"))
+	require.True(t, errors.Is(err, ErrTransientIO))
+	require.False(t, errors.Is(err, ErrCorruption))
+
+	// Corruption errors aren't retryable.
+	err = MarkTransientIOError(CorruptionErrorf("bad"))
+	require.False(t, errors.Is(err, ErrTransientIO))
+}
+
+func TestInvariantError(t *testing.T) {
+	err := InvariantErrorf("unexpected %s", "state")
+	require.True(t, errors.Is(err, ErrInvariant))
+	require.True(t, errors.HasAssertionFailure(err))
+	require.False(t, errors.Is(err, ErrCorruption))
+}
@@ -26,12 +26,34 @@ const (
 	//InternalKeyKindColumnFamilyMerge        InternalKeyKind = 6
 	InternalKeyKindSingleDelete InternalKeyKind = 7
 	//InternalKeyKindColumnFamilySingleDelete InternalKeyKind = 8
-	//InternalKeyKindBeginPrepareXID          InternalKeyKind = 9
-	//InternalKeyKindEndPrepareXID            InternalKeyKind = 10
-	//InternalKeyKindCommitXID                InternalKeyKind = 11
-	//InternalKeyKindRollbackXID              InternalKeyKind = 12
-	//InternalKeyKindNoop                     InternalKeyKind = 13
-	//InternalKeyKindColumnFamilyRangeDelete  InternalKeyKind = 14
+
+	// InternalKeyKindIdempotencyToken records an idempotency token of a batch
+	// (see Batch.AddIdempotencyToken), which is known to be committed once the
+	// batch is written to the WAL. It's only written to the WAL, and never
+	// appears in memtables or sstables.
+	//
+	// NOTE: the RocksDB value (BeginPrepareXID) has been repurposed.
+	InternalKeyKindIdempotencyToken InternalKeyKind = 9
+
+	// InternalKeyKindPrepareTxn, InternalKeyKindCommitTxn and
+	// InternalKeyKindRollbackTxn are markers of the two-phase commit of a
+	// transaction, keyed by the transaction's ID. They are only written to the
+	// WAL, as the first record of a batch, and never appear in memtables or
+	// sstables. The value of a PrepareTxn record contains the prepared
+	// batch's records.
+	InternalKeyKindPrepareTxn  InternalKeyKind = 10
+	InternalKeyKindCommitTxn   InternalKeyKind = 11
+	InternalKeyKindRollbackTxn InternalKeyKind = 12
+
+	// InternalKeyKindBatchChunk and InternalKeyKindCommitChunks are markers of
+	// the chunked commit of a batch (see Batch.CommitChunked). A BatchChunk
+	// record begins every chunk of the batch written to the WAL, which is only
+	// replayed once it's followed by a CommitChunks record. They are only
+	// written to the WAL, as the first record of a batch, and never appear in
+	// memtables or sstables.
+	InternalKeyKindBatchChunk   InternalKeyKind = 13
+	InternalKeyKindCommitChunks InternalKeyKind = 14
+
 	InternalKeyKindRangeDelete InternalKeyKind = 15
 	//InternalKeyKindColumnFamilyBlobIndex    InternalKeyKind = 16
 	//InternalKeyKindBlobIndex                InternalKeyKind = 17
@@ -106,19 +128,25 @@ const (
 )
 
 var internalKeyKindNames = []string{
-	InternalKeyKindDelete:         "DEL",
-	InternalKeyKindSet:            "SET",
-	InternalKeyKindMerge:          "MERGE",
-	InternalKeyKindLogData:        "LOGDATA",
-	InternalKeyKindSingleDelete:   "SINGLEDEL",
-	InternalKeyKindRangeDelete:    "RANGEDEL",
-	InternalKeyKindSeparator:      "SEPARATOR",
-	InternalKeyKindSetWithDelete:  "SETWITHDEL",
-	InternalKeyKindRangeKeySet:    "RANGEKEYSET",
-	InternalKeyKindRangeKeyUnset:  "RANGEKEYUNSET",
-	InternalKeyKindRangeKeyDelete: "RANGEKEYDEL",
-	InternalKeyIngestSST:          "INGESTSST",
-	InternalKeyKindInvalid:        "INVALID",
+	InternalKeyKindDelete:           "DEL",
+	InternalKeyKindSet:              "SET",
+	InternalKeyKindMerge:            "MERGE",
+	InternalKeyKindLogData:          "LOGDATA",
+	InternalKeyKindPrepareTxn:       "PREPARETXN",
+	InternalKeyKindCommitTxn:        "COMMITTXN",
+	InternalKeyKindRollbackTxn:      "ROLLBACKTXN",
+	InternalKeyKindBatchChunk:       "BATCHCHUNK",
+	InternalKeyKindCommitChunks:     "COMMITCHUNKS",
+	InternalKeyKindIdempotencyToken: "IDEMPOTENCYTOKEN",
+	InternalKeyKindSingleDelete:     "SINGLEDEL",
+	InternalKeyKindRangeDelete:      "RANGEDEL",
+	InternalKeyKindSeparator:        "SEPARATOR",
+	InternalKeyKindSetWithDelete:    "SETWITHDEL",
+	InternalKeyKindRangeKeySet:      "RANGEKEYSET",
+	InternalKeyKindRangeKeyUnset:    "RANGEKEYUNSET",
+	InternalKeyKindRangeKeyDelete:   "RANGEKEYDEL",
+	InternalKeyIngestSST:            "INGESTSST",
+	InternalKeyKindInvalid:          "INVALID",
 }
 
 func (k InternalKeyKind) String() string {
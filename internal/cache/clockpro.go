@@ -111,6 +111,14 @@ type shard struct {
 	countHot  int64
 	countCold int64
 	countTest int64
+
+	// owners holds the accounting of the blocks of each ID. See owner.
+	owners map[uint64]*owner
+	// overLimit is the number of owners exceeding their limits, and
+	// protectedSize the size of the blocks protected by the reservations of
+	// their owners.
+	overLimit     int
+	protectedSize int64
 }
 
 func (c *shard) Get(id uint64, fileNum base.FileNum, offset uint64) Handle {
@@ -122,12 +130,19 @@ func (c *shard) Get(id uint64, fileNum base.FileNum, offset uint64) Handle {
 			atomic.StoreInt32(&e.referenced, 1)
 		}
 	}
+	o := c.owners[id]
 	c.mu.RUnlock()
 	if value == nil {
 		atomic.AddInt64(&c.misses, 1)
+		if o != nil {
+			atomic.AddInt64(&o.misses, 1)
+		}
 		return Handle{}
 	}
 	atomic.AddInt64(&c.hits, 1)
+	if o != nil {
+		atomic.AddInt64(&o.hits, 1)
+	}
 	return Handle{value: value}
 }
 
@@ -151,6 +166,7 @@ func (c *shard) Set(id uint64, fileNum base.FileNum, offset uint64, value *Value
 			value.ref.trace("add-cold")
 			c.sizeCold += e.size
 			c.countCold++
+			c.addResident(id, e.size, 1)
 		} else {
 			value.ref.trace("skip-cold")
 			e.free()
@@ -170,6 +186,7 @@ func (c *shard) Set(id uint64, fileNum base.FileNum, offset uint64, value *Value
 			value.ref.trace("add-cold")
 			c.sizeCold += delta
 		}
+		c.addResident(id, delta, 0)
 		c.evict()
 
 	default:
@@ -192,12 +209,14 @@ func (c *shard) Set(id uint64, fileNum base.FileNum, offset uint64, value *Value
 			value.ref.trace("add-hot")
 			c.sizeHot += e.size
 			c.countHot++
+			c.addResident(id, e.size, 1)
 		} else {
 			value.ref.trace("skip-hot")
 			e.free()
 			e = nil
 		}
 	}
+	c.evictOverLimit()
 
 	c.checkConsistency()
 
@@ -460,9 +479,11 @@ func (c *shard) metaEvict(e *entry) {
 	case etHot:
 		c.sizeHot -= e.size
 		c.countHot--
+		c.addResident(e.key.id, -e.size, -1)
 	case etCold:
 		c.sizeCold -= e.size
 		c.countCold--
+		c.addResident(e.key.id, -e.size, -1)
 	case etTest:
 		c.sizeTest -= e.size
 		c.countTest--
@@ -491,7 +512,9 @@ func (c *shard) runHandCold(countColdDebug, sizeColdDebug int64) {
 
 	e := c.handCold
 	if e.ptype == etCold {
-		if atomic.LoadInt32(&e.referenced) == 1 {
+		// Blocks protected by the reservation of their owner are treated like
+		// referenced blocks, and kept in the cache.
+		if atomic.LoadInt32(&e.referenced) == 1 || c.isProtected(e) {
 			atomic.StoreInt32(&e.referenced, 0)
 			e.ptype = etHot
 			c.sizeCold -= e.size
@@ -505,6 +528,7 @@ func (c *shard) runHandCold(countColdDebug, sizeColdDebug int64) {
 			c.countCold--
 			c.sizeTest += e.size
 			c.countTest++
+			c.addResident(e.key.id, -e.size, -1)
 			for c.targetSize() < c.sizeTest && c.handTest != nil {
 				c.runHandTest()
 			}
@@ -658,6 +682,7 @@ func newShards(size int64, shards int) *Cache {
 		c.shards[i] = shard{
 			maxSize:    size / int64(len(c.shards)),
 			coldTarget: size / int64(len(c.shards)),
+			owners:     make(map[uint64]*owner),
 		}
 		if entriesGoAllocated {
 			c.shards[i].entries = make(map[*entry]struct{})
@@ -835,7 +860,15 @@ func (c *Cache) Metrics() Metrics {
 }
 
 // NewID returns a new ID to be used as a namespace for cached file
-// blocks.
+// blocks. The usage of the cache by the ID is accounted for (see
+// Cache.IDMetrics) until the ID is released by Cache.ReleaseID.
 func (c *Cache) NewID() uint64 {
-	return atomic.AddUint64(&c.idAlloc, 1)
+	id := atomic.AddUint64(&c.idAlloc, 1)
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		s.updateOwner(id, func(o *owner) { o.registered = true })
+		s.mu.Unlock()
+	}
+	return id
 }
@@ -157,6 +157,92 @@ func TestMultipleDBs(t *testing.T) {
 	}
 }
 
+func TestIDMetrics(t *testing.T) {
+	cache := newShards(100, 1)
+	defer cache.Unref()
+
+	id1, id2 := cache.NewID(), cache.NewID()
+	cache.Set(id1, 0, 0, testValue(cache, "a", 5)).Release()
+	cache.Set(id1, 1, 0, testValue(cache, "a", 5)).Release()
+	cache.Set(id2, 0, 0, testValue(cache, "b", 20)).Release()
+	cache.Get(id1, 0, 0).Release()
+	cache.Get(id1, 2, 0).Release()
+	cache.Get(id2, 1, 0).Release()
+	require.Equal(t, Metrics{Size: 10, Count: 2, Hits: 1, Misses: 1}, cache.IDMetrics(id1))
+	require.Equal(t, Metrics{Size: 20, Count: 1, Hits: 0, Misses: 1}, cache.IDMetrics(id2))
+
+	cache.EvictFile(id1, 0)
+	require.Equal(t, Metrics{Size: 5, Count: 1, Hits: 1, Misses: 1}, cache.IDMetrics(id1))
+
+	// Once released, the owner of the ID is removed along with its last block.
+	cache.ReleaseID(id1)
+	require.EqualValues(t, 5, cache.IDMetrics(id1).Size)
+	cache.EvictFile(id1, 1)
+	require.Equal(t, Metrics{}, cache.IDMetrics(id1))
+	require.Len(t, cache.shards[0].owners, 1)
+}
+
+func TestIDLimit(t *testing.T) {
+	cache := newShards(100, 1)
+	defer cache.Unref()
+
+	id1, id2 := cache.NewID(), cache.NewID()
+	cache.SetLimit(id1, 20)
+	for i := 0; i < 10; i++ {
+		cache.Set(id1, base.FileNum(i), 0, testValue(cache, "a", 5)).Release()
+		cache.Set(id2, base.FileNum(i), 0, testValue(cache, "b", 5)).Release()
+	}
+	// The blocks of id1 are limited to 20 bytes, though the cache has room for
+	// more.
+	require.EqualValues(t, 20, cache.IDMetrics(id1).Size)
+	require.EqualValues(t, 50, cache.IDMetrics(id2).Size)
+	require.EqualValues(t, 70, cache.Size())
+
+	// Lowering the limit evicts blocks, and removing it lets the blocks of id1
+	// fill the cache.
+	cache.SetLimit(id1, 10)
+	require.EqualValues(t, 10, cache.IDMetrics(id1).Size)
+	cache.SetLimit(id1, 0)
+	for i := 0; i < 10; i++ {
+		cache.Set(id1, base.FileNum(i), 0, testValue(cache, "a", 5)).Release()
+	}
+	require.EqualValues(t, 50, cache.IDMetrics(id1).Size)
+}
+
+func TestIDReservation(t *testing.T) {
+	cache := newShards(100, 1)
+	defer cache.Unref()
+
+	id1, id2, id3 := cache.NewID(), cache.NewID(), cache.NewID()
+	cache.SetReservation(id1, 30)
+	for i := 0; i < 6; i++ {
+		cache.Set(id1, base.FileNum(i), 0, testValue(cache, "a", 5)).Release()
+		cache.Set(id3, base.FileNum(i), 0, testValue(cache, "c", 5)).Release()
+	}
+	// Filling the cache with the frequently accessed blocks of id2 doesn't
+	// evict the blocks of id1 within its reservation, unlike the blocks of id3.
+	for i := 0; i < 200; i++ {
+		cache.Set(id2, base.FileNum(i), 0, testValue(cache, "b", 5)).Release()
+		cache.Get(id2, base.FileNum(i), 0).Release()
+	}
+	require.EqualValues(t, 30, cache.IDMetrics(id1).Size)
+	require.EqualValues(t, 0, cache.IDMetrics(id3).Size)
+	for i := 0; i < 6; i++ {
+		h := cache.Get(id1, base.FileNum(i), 0)
+		require.NotNil(t, h.Get())
+		h.Release()
+	}
+
+	// Reservations stop protecting blocks once they'd fill the cache.
+	cache.SetReservation(id2, 100)
+	for i := 0; i < 200; i++ {
+		cache.Set(id2, base.FileNum(i+200), 0, testValue(cache, "b", 5)).Release()
+		cache.Get(id2, base.FileNum(i+200), 0).Release()
+	}
+	require.LessOrEqual(t, cache.Size(), int64(100))
+	require.Less(t, cache.IDMetrics(id1).Size, int64(30))
+}
+
 func TestZeroSize(t *testing.T) {
 	cache := newShards(0, 1)
 	defer cache.Unref()
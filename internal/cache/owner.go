@@ -0,0 +1,200 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package cache
+
+import "sync/atomic"
+
+// owner holds the accounting of the blocks cached by a shard under an ID. An
+// ID is usually allocated by Cache.NewID for a DB, so that a Cache shared by
+// multiple DBs can account for the blocks of each DB.
+type owner struct {
+	// hits and misses are the number of cache hits and misses of the ID. They
+	// are updated atomically.
+	hits   int64
+	misses int64
+	// size and count are the size and count of the blocks of the ID resident in
+	// the shard.
+	size  int64
+	count int64
+	// limit and reserved are the shard's shares of the limit and reservation of
+	// the ID (see Cache.SetLimit and Cache.SetReservation). Zero means none.
+	limit    int64
+	reserved int64
+	// registered is set for the IDs allocated by Cache.NewID, until they are
+	// released by Cache.ReleaseID. The owners of the other IDs are removed once
+	// their blocks are evicted.
+	registered bool
+}
+
+func (o *owner) overLimit() bool {
+	return o.limit > 0 && o.size > o.limit
+}
+
+// protectedSize returns the size of the blocks of the ID that fit within its
+// reservation.
+func (o *owner) protectedSize() int64 {
+	if o.size < o.reserved {
+		return o.size
+	}
+	return o.reserved
+}
+
+func (o *owner) empty() bool {
+	return o.size == 0 && o.count == 0 && o.limit == 0 && o.reserved == 0 && !o.registered
+}
+
+// updateOwner applies fn to the owner of the ID, creating the owner if
+// necessary, and maintains the shard's counts of the owners that exceed their
+// limits and of the size of the blocks protected by reservations.
+//
+// c.mu must be held when calling this.
+func (c *shard) updateOwner(id uint64, fn func(o *owner)) {
+	o := c.owners[id]
+	if o == nil {
+		o = &owner{}
+		c.owners[id] = o
+	}
+	wasOverLimit, wasProtected := o.overLimit(), o.protectedSize()
+	fn(o)
+	if isOverLimit := o.overLimit(); isOverLimit != wasOverLimit {
+		if isOverLimit {
+			c.overLimit++
+		} else {
+			c.overLimit--
+		}
+	}
+	c.protectedSize += o.protectedSize() - wasProtected
+	if o.empty() {
+		delete(c.owners, id)
+	}
+}
+
+// addResident accounts for a block of the ID becoming resident (n > 0) or
+// being evicted (n < 0), where size is the (signed) size of the block.
+//
+// c.mu must be held when calling this.
+func (c *shard) addResident(id uint64, size int64, n int64) {
+	c.updateOwner(id, func(o *owner) {
+		o.size += size
+		o.count += n
+	})
+}
+
+// isProtected returns whether the block is protected from eviction by the
+// reservation of its ID, which is the case while the blocks of the ID fit
+// within the reservation. Reservations stop protecting blocks once the
+// protected blocks would fill the shard, so that eviction always makes
+// progress.
+//
+// c.mu must be held when calling this.
+func (c *shard) isProtected(e *entry) bool {
+	o := c.owners[e.key.id]
+	return o != nil && o.reserved > 0 && o.size <= o.reserved &&
+		c.protectedSize < c.targetSize()
+}
+
+// evictOverLimit evicts the blocks of the IDs that exceed their limits, in the
+// order of the clock, starting from the cold hand.
+//
+// c.mu must be held when calling this.
+func (c *shard) evictOverLimit() {
+	e := c.handCold
+	for n := c.countHot + c.countCold + c.countTest; n > 0 && c.overLimit > 0 && e != nil; n-- {
+		next := e.next()
+		if o := c.owners[e.key.id]; o != nil && o.overLimit() && e.ptype != etTest {
+			c.metaEvict(e)
+			if c.handHot == nil {
+				// The shard is empty.
+				break
+			}
+		}
+		e = next
+	}
+}
+
+// setOwnerLimits applies fn, which sets the shard's shares of the limit and
+// reservation of the ID, to the owner of the ID.
+func (c *shard) setOwnerLimits(id uint64, fn func(o *owner)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.updateOwner(id, fn)
+	c.evictOverLimit()
+	c.checkConsistency()
+}
+
+// SetLimit limits the size of the blocks cached under the ID, usually the ID
+// of a DB sharing the cache with other DBs, to n bytes. The blocks of the ID
+// are evicted once it exceeds its limit, regardless of the space available in
+// the cache. The limit is split evenly among the shards of the cache. A
+// non-positive limit removes the limit.
+func (c *Cache) SetLimit(id uint64, n int64) {
+	if id == 0 {
+		panic("pebble: 0 cache ID is invalid")
+	}
+	limit := c.perShard(n)
+	for i := range c.shards {
+		c.shards[i].setOwnerLimits(id, func(o *owner) { o.limit = limit })
+	}
+}
+
+// SetReservation reserves n bytes of the cache for the blocks cached under the
+// ID, usually the ID of a DB sharing the cache with other DBs. The blocks of
+// the ID aren't evicted to make room for the blocks of other IDs while their
+// size is within the reservation. The reservation is split evenly among the
+// shards of the cache, and reservations stop protecting blocks once the
+// protected blocks would fill a shard. A non-positive reservation removes the
+// reservation.
+//
+// Unlike Cache.Reserve, SetReservation doesn't shrink the cache.
+func (c *Cache) SetReservation(id uint64, n int64) {
+	if id == 0 {
+		panic("pebble: 0 cache ID is invalid")
+	}
+	reserved := c.perShard(n)
+	for i := range c.shards {
+		c.shards[i].setOwnerLimits(id, func(o *owner) { o.reserved = reserved })
+	}
+}
+
+// perShard returns the per-shard share of n bytes, rounded up.
+func (c *Cache) perShard(n int64) int64 {
+	if n <= 0 {
+		return 0
+	}
+	return (n + int64(len(c.shards)) - 1) / int64(len(c.shards))
+}
+
+// ReleaseID releases an ID allocated by Cache.NewID, usually once the DB it
+// was allocated for is closed, removing its limit and reservation. The blocks
+// still cached under the ID remain accounted to it until they're evicted.
+func (c *Cache) ReleaseID(id uint64) {
+	for i := range c.shards {
+		c.shards[i].setOwnerLimits(id, func(o *owner) {
+			o.limit = 0
+			o.reserved = 0
+			o.registered = false
+		})
+	}
+}
+
+// IDMetrics returns the metrics of the blocks cached under the ID, usually
+// the ID of a DB sharing the cache with other DBs. Hits and misses are only
+// counted for the IDs allocated by Cache.NewID, and for the other IDs while
+// they have blocks in the cache.
+func (c *Cache) IDMetrics(id uint64) Metrics {
+	var m Metrics
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.RLock()
+		if o := s.owners[id]; o != nil {
+			m.Size += o.size
+			m.Count += o.count
+			m.Hits += atomic.LoadInt64(&o.hits)
+			m.Misses += atomic.LoadInt64(&o.misses)
+		}
+		s.mu.RUnlock()
+	}
+	return m
+}
@@ -7,12 +7,18 @@
 package datatest
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"strings"
 	"sync"
 
 	"github.com/cockroachdb/datadriven"
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
 )
 
 // TODO(jackson): Consider a refactoring that can consolidate this package and
@@ -26,71 +32,394 @@ func DefineBatch(d *datadriven.TestData, b *pebble.Batch) error {
 		if len(parts) == 0 {
 			continue
 		}
-		if parts[1] == `<nil>` {
-			parts[1] = ""
+		if err := applyWriteOp(b, parts); err != nil {
+			return err
 		}
-		var err error
-		switch parts[0] {
-		case "set":
-			if len(parts) != 3 {
-				return errors.Errorf("%s expects 2 arguments", parts[0])
-			}
-			err = b.Set([]byte(parts[1]), []byte(parts[2]), nil)
-		case "del":
-			if len(parts) != 2 {
-				return errors.Errorf("%s expects 1 argument", parts[0])
-			}
-			err = b.Delete([]byte(parts[1]), nil)
-		case "singledel":
-			if len(parts) != 2 {
-				return errors.Errorf("%s expects 1 argument", parts[0])
+	}
+	return nil
+}
+
+// applyWriteOp applies the write operation described by parts to w.
+func applyWriteOp(w pebble.Writer, parts []string) error {
+	if len(parts) > 1 && parts[1] == `<nil>` {
+		parts[1] = ""
+	}
+	switch parts[0] {
+	case "set":
+		if len(parts) != 3 {
+			return errors.Errorf("%s expects 2 arguments", parts[0])
+		}
+		return w.Set([]byte(parts[1]), []byte(parts[2]), nil)
+	case "del":
+		if len(parts) != 2 {
+			return errors.Errorf("%s expects 1 argument", parts[0])
+		}
+		return w.Delete([]byte(parts[1]), nil)
+	case "singledel":
+		if len(parts) != 2 {
+			return errors.Errorf("%s expects 1 argument", parts[0])
+		}
+		return w.SingleDelete([]byte(parts[1]), nil)
+	case "del-range":
+		if len(parts) != 3 {
+			return errors.Errorf("%s expects 2 arguments", parts[0])
+		}
+		return w.DeleteRange([]byte(parts[1]), []byte(parts[2]), nil)
+	case "merge":
+		if len(parts) != 3 {
+			return errors.Errorf("%s expects 2 arguments", parts[0])
+		}
+		return w.Merge([]byte(parts[1]), []byte(parts[2]), nil)
+	case "range-key-set":
+		if len(parts) != 5 {
+			return errors.Errorf("%s expects 4 arguments", parts[0])
+		}
+		return w.RangeKeySet(
+			[]byte(parts[1]),
+			[]byte(parts[2]),
+			[]byte(parts[3]),
+			[]byte(parts[4]),
+			nil)
+	case "range-key-unset":
+		if len(parts) != 4 {
+			return errors.Errorf("%s expects 3 arguments", parts[0])
+		}
+		return w.RangeKeyUnset(
+			[]byte(parts[1]),
+			[]byte(parts[2]),
+			[]byte(parts[3]),
+			nil)
+	case "range-key-del":
+		if len(parts) != 3 {
+			return errors.Errorf("%s expects 2 arguments", parts[0])
+		}
+		return w.RangeKeyDelete(
+			[]byte(parts[1]),
+			[]byte(parts[2]),
+			nil)
+	default:
+		return errors.Errorf("unknown op: %s", parts[0])
+	}
+}
+
+// DB holds the state of datadriven tests run against a DB: the DB and the
+// snapshots created by the test's commands, by name. A DB is used by passing
+// the test's commands to RunCommand, leaving the commands RunCommand doesn't
+// know to the test.
+type DB struct {
+	// Opts holds the options used to open the DB. The DB is opened on a fresh
+	// in-memory filesystem if Opts.FS is nil.
+	Opts      *pebble.Options
+	DB        *pebble.DB
+	Snapshots map[string]*pebble.Snapshot
+
+	// opts holds the options the DB was opened with.
+	opts *pebble.Options
+}
+
+// Close closes the DB's snapshots and the DB.
+func (d *DB) Close() error {
+	var err error
+	for _, s := range d.Snapshots {
+		err = firstError(err, s.Close())
+	}
+	d.Snapshots = nil
+	if d.DB != nil {
+		err = firstError(err, d.DB.Close())
+		d.DB = nil
+	}
+	return err
+}
+
+// RunCommand runs the provided datadriven command, returning its output and
+// whether the command is known. The known commands are:
+//
+//	define                   (re)open the DB and perform the operations of
+//	                         the input, one-per-line: the write operations of
+//	                         DefineBatch, and snapshot <name>, flush,
+//	                         compact <start>-<end> and ingest <path>...
+//	batch                    commit a batch of the write operations of the
+//	                         input (see DefineBatch)
+//	build <path>             write an sstable holding the write operations
+//	                         of the input, which must be in key order
+//	ingest <path>...         ingest the sstables
+//	flush                    flush the memtables
+//	compact <start>-<end>    compact the key range
+//	snapshot <name>          create a snapshot
+//	iter [snapshot=<name>]   perform the iterator operations of the input,
+//	                         one-per-line, on an iterator over the DB or the
+//	                         snapshot, surfacing both point and range keys
+func (d *DB) RunCommand(td *datadriven.TestData) (output string, ok bool) {
+	var err error
+	switch td.Cmd {
+	case "define":
+		err = d.define(td)
+	case "batch":
+		if err = d.checkOpen(); err == nil {
+			b := d.DB.NewBatch()
+			if err = DefineBatch(td, b); err == nil {
+				err = b.Commit(nil)
 			}
-			err = b.SingleDelete([]byte(parts[1]), nil)
-		case "del-range":
-			if len(parts) != 3 {
-				return errors.Errorf("%s expects 2 arguments", parts[0])
+		}
+	case "build":
+		if len(td.CmdArgs) != 1 {
+			return "build <path>: argument missing", true
+		}
+		if err = d.checkOpen(); err == nil {
+			err = d.build(td.CmdArgs[0].String(), td.Input)
+		}
+	case "ingest", "flush", "compact", "snapshot":
+		if err = d.checkOpen(); err == nil {
+			parts := []string{td.Cmd}
+			for _, arg := range td.CmdArgs {
+				parts = append(parts, arg.String())
 			}
-			err = b.DeleteRange([]byte(parts[1]), []byte(parts[2]), nil)
-		case "merge":
-			if len(parts) != 3 {
-				return errors.Errorf("%s expects 2 arguments", parts[0])
+			err = d.runOp(parts)
+		}
+	case "iter":
+		if err = d.checkOpen(); err != nil {
+			return err.Error(), true
+		}
+		return d.runIter(td), true
+	default:
+		return "", false
+	}
+	if err != nil {
+		return err.Error(), true
+	}
+	return "", true
+}
+
+func (d *DB) checkOpen() error {
+	if d.DB == nil {
+		return errors.New("DB not defined")
+	}
+	return nil
+}
+
+func (d *DB) define(td *datadriven.TestData) error {
+	if err := d.Close(); err != nil {
+		return err
+	}
+	d.opts = d.Opts.Clone()
+	if d.opts.FS == nil {
+		d.opts.FS = vfs.NewMem()
+	}
+	d.opts.EnsureDefaults()
+	var err error
+	if d.DB, err = pebble.Open("", d.opts); err != nil {
+		return err
+	}
+	d.Snapshots = make(map[string]*pebble.Snapshot)
+	for _, line := range strings.Split(td.Input, "\n") {
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
+		if err := d.runOp(parts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runOp performs the operation described by parts on the DB.
+func (d *DB) runOp(parts []string) error {
+	switch parts[0] {
+	case "snapshot":
+		if len(parts) != 2 {
+			return errors.Errorf("%s expects 1 argument", parts[0])
+		}
+		if s := d.Snapshots[parts[1]]; s != nil {
+			if err := s.Close(); err != nil {
+				return err
 			}
-			err = b.Merge([]byte(parts[1]), []byte(parts[2]), nil)
-		case "range-key-set":
-			if len(parts) != 5 {
-				return errors.Errorf("%s expects 4 arguments", parts[0])
+		}
+		d.Snapshots[parts[1]] = d.DB.NewSnapshot()
+		return nil
+	case "flush":
+		if len(parts) != 1 {
+			return errors.Errorf("%s expects no arguments", parts[0])
+		}
+		return d.DB.Flush()
+	case "compact":
+		if len(parts) != 2 {
+			return errors.Errorf("%s expects 1 argument", parts[0])
+		}
+		keys := strings.Split(parts[1], "-")
+		if len(keys) != 2 {
+			return errors.Errorf("malformed key range: %s", parts[1])
+		}
+		return d.DB.Compact([]byte(keys[0]), []byte(keys[1]), false)
+	case "ingest":
+		if len(parts) < 2 {
+			return errors.Errorf("%s expects at least 1 argument", parts[0])
+		}
+		return d.DB.Ingest(parts[1:])
+	default:
+		return applyWriteOp(d.DB, parts)
+	}
+}
+
+// build writes an sstable at path on the DB's filesystem, holding the write
+// operations of input.
+func (d *DB) build(path, input string) error {
+	f, err := d.opts.FS.Create(path)
+	if err != nil {
+		return err
+	}
+	w := sstable.NewWriter(objstorageprovider.NewFileWritable(f),
+		d.opts.MakeWriterOptions(0 /* level */, d.DB.FormatMajorVersion().MaxTableFormat()))
+	for _, line := range strings.Split(input, "\n") {
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
+		if err := addToTable(w, parts); err != nil {
+			_ = w.Close()
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// addToTable adds the write operation described by parts to w.
+func addToTable(w *sstable.Writer, parts []string) error {
+	switch parts[0] {
+	case "set":
+		if len(parts) != 3 {
+			return errors.Errorf("%s expects 2 arguments", parts[0])
+		}
+		return w.Set([]byte(parts[1]), []byte(parts[2]))
+	case "del":
+		if len(parts) != 2 {
+			return errors.Errorf("%s expects 1 argument", parts[0])
+		}
+		return w.Delete([]byte(parts[1]))
+	case "del-range":
+		if len(parts) != 3 {
+			return errors.Errorf("%s expects 2 arguments", parts[0])
+		}
+		return w.DeleteRange([]byte(parts[1]), []byte(parts[2]))
+	case "merge":
+		if len(parts) != 3 {
+			return errors.Errorf("%s expects 2 arguments", parts[0])
+		}
+		return w.Merge([]byte(parts[1]), []byte(parts[2]))
+	case "range-key-set":
+		if len(parts) != 5 {
+			return errors.Errorf("%s expects 4 arguments", parts[0])
+		}
+		return w.RangeKeySet([]byte(parts[1]), []byte(parts[2]), []byte(parts[3]), []byte(parts[4]))
+	case "range-key-unset":
+		if len(parts) != 4 {
+			return errors.Errorf("%s expects 3 arguments", parts[0])
+		}
+		return w.RangeKeyUnset([]byte(parts[1]), []byte(parts[2]), []byte(parts[3]))
+	case "range-key-del":
+		if len(parts) != 3 {
+			return errors.Errorf("%s expects 2 arguments", parts[0])
+		}
+		return w.RangeKeyDelete([]byte(parts[1]), []byte(parts[2]))
+	default:
+		return errors.Errorf("unknown op: %s", parts[0])
+	}
+}
+
+func (d *DB) runIter(td *datadriven.TestData) string {
+	iterOpts := &pebble.IterOptions{KeyTypes: pebble.IterKeyTypePointsAndRanges}
+	var iter *pebble.Iterator
+	if len(td.CmdArgs) == 1 {
+		if td.CmdArgs[0].Key != "snapshot" {
+			return fmt.Sprintf("unknown argument: %s", td.CmdArgs[0])
+		}
+		if len(td.CmdArgs[0].Vals) != 1 {
+			return fmt.Sprintf("%s expects 1 value: %s", td.CmdArgs[0].Key, td.CmdArgs[0])
+		}
+		name := td.CmdArgs[0].Vals[0]
+		snapshot := d.Snapshots[name]
+		if snapshot == nil {
+			return fmt.Sprintf("unable to find snapshot \"%s\"", name)
+		}
+		iter = snapshot.NewIter(iterOpts)
+	} else {
+		iter = d.DB.NewIter(iterOpts)
+	}
+	defer iter.Close()
+
+	var b bytes.Buffer
+	for _, line := range strings.Split(td.Input, "\n") {
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
+		switch parts[0] {
+		case "first":
+			iter.First()
+		case "last":
+			iter.Last()
+		case "seek-ge":
+			if len(parts) != 2 {
+				return "seek-ge <key>\n"
 			}
-			err = b.RangeKeySet(
-				[]byte(parts[1]),
-				[]byte(parts[2]),
-				[]byte(parts[3]),
-				[]byte(parts[4]),
-				nil)
-		case "range-key-unset":
-			if len(parts) != 4 {
-				return errors.Errorf("%s expects 3 arguments", parts[0])
+			iter.SeekGE([]byte(parts[1]))
+		case "seek-prefix-ge":
+			if len(parts) != 2 {
+				return "seek-prefix-ge <key>\n"
 			}
-			err = b.RangeKeyUnset(
-				[]byte(parts[1]),
-				[]byte(parts[2]),
-				[]byte(parts[3]),
-				nil)
-		case "range-key-del":
-			if len(parts) != 3 {
-				return errors.Errorf("%s expects 2 arguments", parts[0])
+			iter.SeekPrefixGE([]byte(parts[1]))
+		case "seek-lt":
+			if len(parts) != 2 {
+				return "seek-lt <key>\n"
 			}
-			err = b.RangeKeyDelete(
-				[]byte(parts[1]),
-				[]byte(parts[2]),
-				nil)
+			iter.SeekLT([]byte(parts[1]))
+		case "next":
+			iter.Next()
+		case "prev":
+			iter.Prev()
 		default:
-			return errors.Errorf("unknown op: %s", parts[0])
+			return fmt.Sprintf("unknown op: %s", parts[0])
 		}
-		if err != nil {
-			return err
+		if iter.Valid() {
+			printIterPosition(&b, iter)
+		} else if err := iter.Error(); err != nil {
+			fmt.Fprintf(&b, "err=%v\n", err)
+		} else {
+			fmt.Fprintf(&b, ".\n")
 		}
 	}
-	return nil
+	return b.String()
+}
+
+// printIterPosition prints the key and value the iterator is positioned at
+// as <key>:<value>, followed by the bounds and the suffixes and values of the
+// range keys the iterator is positioned over, if any. The value is printed as
+// '.' if the iterator is positioned over range keys only.
+func printIterPosition(b io.Writer, iter *pebble.Iterator) {
+	hasPoint, hasRange := iter.HasPointAndRange()
+	if hasPoint {
+		fmt.Fprintf(b, "%s:%s", iter.Key(), iter.Value())
+	} else {
+		fmt.Fprintf(b, "%s:.", iter.Key())
+	}
+	if hasRange {
+		start, end := iter.RangeBounds()
+		fmt.Fprintf(b, " [%s-%s)", start, end)
+		for i, k := range iter.RangeKeys() {
+			if i > 0 {
+				fmt.Fprint(b, ",")
+			}
+			fmt.Fprintf(b, " %s=%s", k.Suffix, k.Value)
+		}
+	}
+	fmt.Fprintln(b)
+}
+
+func firstError(err0, err1 error) error {
+	if err0 != nil {
+		return err0
+	}
+	return err1
 }
 
 // CompactionTracker is a listener that tracks the number of compactions.
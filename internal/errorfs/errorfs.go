@@ -135,6 +135,19 @@ func WithProbability(op OpKind, p float64) Injector {
 	})
 }
 
+// Any returns an injector that injects the error of the first of the provided
+// injectors that returns an error.
+func Any(injectors ...Injector) Injector {
+	return InjectorFunc(func(op Op, path string) error {
+		for _, inj := range injectors {
+			if err := inj.MaybeError(op, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // InjectorFunc implements the Injector interface for a function with
 // MaybeError's signature.
 type InjectorFunc func(Op, string) error
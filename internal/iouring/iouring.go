@@ -0,0 +1,17 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package iouring implements asynchronous file reads through a Linux io_uring
+// instance. A Ring is shared by the goroutines reading through it, which can
+// have many reads in flight at once without a thread blocked on each read.
+package iouring
+
+import "github.com/cockroachdb/errors"
+
+// ErrNotSupported is returned by New if io_uring isn't supported by the
+// platform or by the kernel, or is disallowed (e.g. by a seccomp policy).
+var ErrNotSupported = errors.New("pebble: io_uring is not supported")
+
+// ErrClosed is returned by the reads submitted to a closed Ring.
+var ErrClosed = errors.New("pebble: io_uring ring is closed")
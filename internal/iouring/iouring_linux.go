@@ -0,0 +1,436 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package iouring
+
+import (
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/cockroachdb/errors"
+	"golang.org/x/sys/unix"
+)
+
+// The io_uring ABI, from include/uapi/linux/io_uring.h.
+const (
+	opNop  = 0
+	opRead = 22
+
+	enterGetEvents = 1 << 0
+
+	// featRWCurPos was added along with opRead (Linux 5.6), so it's used to
+	// detect the support of opRead.
+	featSingleMmap = 1 << 0
+	featRWCurPos   = 1 << 3
+
+	offSQRing = 0
+	offCQRing = 0x8000000
+	offSQEs   = 0x10000000
+)
+
+type sqringOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	resv2                                                           uint64
+}
+
+type cqringOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	resv2                                                           uint64
+}
+
+type params struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFD uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  sqringOffsets
+	cqOff                                                                  cqringOffsets
+}
+
+// sqe is a submission queue entry.
+type sqe struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	rwFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFDIn  int32
+	addr3       uint64
+	pad         uint64
+}
+
+// cqe is a completion queue entry.
+type cqe struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// closeUserData is the user data of the no-op submitted by Close to stop the
+// goroutine reaping the completions.
+const closeUserData = math.MaxUint64
+
+// Ring is an io_uring instance. Reads are submitted to the ring by the
+// goroutines reading through it, and their completions are reaped by a
+// goroutine of the ring, which wakes up the readers.
+type Ring struct {
+	fd int
+
+	sqMem, cqMem, sqesMem []byte
+
+	sqTail  *uint32
+	sqHead  *uint32
+	sqMask  uint32
+	sqArray []uint32
+	sqes    []sqe
+
+	cqHead *uint32
+	cqTail *uint32
+	cqMask uint32
+	cqes   []cqe
+
+	// ops holds the reads in flight, indexed by their user data. free holds
+	// the indexes of the unused ops, bounding the number of reads in flight
+	// so that the completion queue can't overflow.
+	ops  []Op
+	free chan uint32
+
+	// mu serializes the submissions, which the kernel requires.
+	mu struct {
+		sync.Mutex
+		closed bool
+		// err is set once the completions can't be reaped. The reads in flight
+		// then fail, and no more reads are submitted.
+		err error
+	}
+	// closing is closed once Close is called, and reaperDone once the
+	// goroutine reaping the completions exits.
+	closing    chan struct{}
+	reaperDone chan struct{}
+}
+
+// Op is a read submitted to a Ring. It's owned by the Ring, and must not be
+// used once Wait returns.
+type Op struct {
+	r   *Ring
+	idx uint32
+	fd  uintptr
+	buf []byte
+	off int64
+	n   int
+	// pending is set while the read is submitted and its completion isn't
+	// reaped yet. It's only set with Ring.mu held.
+	pending atomic.Bool
+	// done receives the result of the read from the goroutine reaping the
+	// completions.
+	done chan int32
+}
+
+// New creates an io_uring instance with room for the given number of reads in
+// flight. It returns ErrNotSupported if io_uring can't be used.
+func New(entries uint32) (*Ring, error) {
+	var p params
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(entries), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		if errno == unix.ENOSYS || errno == unix.EPERM {
+			return nil, ErrNotSupported
+		}
+		return nil, errors.Wrap(errno, "io_uring_setup")
+	}
+	r := &Ring{fd: int(fd)}
+	if p.features&featRWCurPos == 0 {
+		_ = unix.Close(r.fd)
+		return nil, ErrNotSupported
+	}
+	if err := r.mmap(&p); err != nil {
+		r.unmap()
+		_ = unix.Close(r.fd)
+		return nil, err
+	}
+
+	r.ops = make([]Op, p.sqEntries)
+	r.free = make(chan uint32, p.sqEntries)
+	for i := range r.ops {
+		r.ops[i] = Op{r: r, idx: uint32(i), done: make(chan int32, 1)}
+		r.free <- uint32(i)
+	}
+	r.closing = make(chan struct{})
+	r.reaperDone = make(chan struct{})
+	go r.reap()
+	return r, nil
+}
+
+func (r *Ring) mmap(p *params) error {
+	sqSize := int(p.sqOff.array + p.sqEntries*4)
+	cqSize := int(p.cqOff.cqes + p.cqEntries*uint32(unsafe.Sizeof(cqe{})))
+	if p.features&featSingleMmap != 0 && cqSize > sqSize {
+		sqSize = cqSize
+	}
+	var err error
+	const prot, flags = unix.PROT_READ | unix.PROT_WRITE, unix.MAP_SHARED | unix.MAP_POPULATE
+	if r.sqMem, err = unix.Mmap(r.fd, offSQRing, sqSize, prot, flags); err != nil {
+		return errors.Wrap(err, "mmap io_uring submission queue")
+	}
+	if p.features&featSingleMmap != 0 {
+		r.cqMem = r.sqMem
+	} else if r.cqMem, err = unix.Mmap(r.fd, offCQRing, cqSize, prot, flags); err != nil {
+		return errors.Wrap(err, "mmap io_uring completion queue")
+	}
+	sqesSize := int(p.sqEntries) * int(unsafe.Sizeof(sqe{}))
+	if r.sqesMem, err = unix.Mmap(r.fd, offSQEs, sqesSize, prot, flags); err != nil {
+		return errors.Wrap(err, "mmap io_uring submission queue entries")
+	}
+
+	r.sqHead = (*uint32)(unsafe.Pointer(&r.sqMem[p.sqOff.head]))
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sqMem[p.sqOff.tail]))
+	r.sqMask = *(*uint32)(unsafe.Pointer(&r.sqMem[p.sqOff.ringMask]))
+	r.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&r.sqMem[p.sqOff.array])), p.sqEntries)
+	r.sqes = unsafe.Slice((*sqe)(unsafe.Pointer(&r.sqesMem[0])), p.sqEntries)
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cqMem[p.cqOff.head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cqMem[p.cqOff.tail]))
+	r.cqMask = *(*uint32)(unsafe.Pointer(&r.cqMem[p.cqOff.ringMask]))
+	r.cqes = unsafe.Slice((*cqe)(unsafe.Pointer(&r.cqMem[p.cqOff.cqes])), p.cqEntries)
+	return nil
+}
+
+func (r *Ring) unmap() {
+	if r.sqesMem != nil {
+		_ = unix.Munmap(r.sqesMem)
+	}
+	if r.cqMem != nil && &r.cqMem[0] != &r.sqMem[0] {
+		_ = unix.Munmap(r.cqMem)
+	}
+	if r.sqMem != nil {
+		_ = unix.Munmap(r.sqMem)
+	}
+	r.sqMem, r.cqMem, r.sqesMem = nil, nil, nil
+}
+
+func (r *Ring) enter(toSubmit, minComplete, flags uint32) (int, error) {
+	for {
+		n, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd),
+			uintptr(toSubmit), uintptr(minComplete), uintptr(flags), 0, 0)
+		if errno == unix.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return 0, errno
+		}
+		return int(n), nil
+	}
+}
+
+// submit submits the entry of the read o to the submission queue.
+func (r *Ring) submit(e sqe, o *Op) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mu.closed {
+		return ErrClosed
+	}
+	if r.mu.err != nil {
+		return r.mu.err
+	}
+	o.pending.Store(true)
+	if err := r.submitLocked(e); err != nil {
+		o.pending.Store(false)
+		return err
+	}
+	return nil
+}
+
+// submitLocked submits an entry to the submission queue. r.mu must be held
+// when calling it.
+func (r *Ring) submitLocked(e sqe) error {
+	// The submissions are serialized and entered one by one, so the kernel
+	// consumes the submission queue before the next submission, and the
+	// queue can't be full.
+	tail := *r.sqTail
+	idx := tail & r.sqMask
+	r.sqes[idx] = e
+	r.sqArray[idx] = idx
+	atomic.StoreUint32(r.sqTail, tail+1)
+	if _, err := r.enter(1, 0, 0); err != nil {
+		if atomic.LoadUint32(r.sqHead) == tail {
+			// The kernel didn't consume the entry.
+			atomic.StoreUint32(r.sqTail, tail)
+			return errors.Wrap(err, "io_uring_enter")
+		}
+	}
+	return nil
+}
+
+// reap reaps the completions, until the completion of the no-op submitted by
+// Close, or until waiting for the completions fails.
+func (r *Ring) reap() {
+	defer close(r.reaperDone)
+	for {
+		head := *r.cqHead
+		tail := atomic.LoadUint32(r.cqTail)
+		if head == tail {
+			if _, err := r.enter(0, 1, enterGetEvents); err != nil {
+				r.fail(err)
+				return
+			}
+			continue
+		}
+		closed := false
+		for ; head != tail; head++ {
+			c := r.cqes[head&r.cqMask]
+			if c.userData == closeUserData {
+				closed = true
+				continue
+			}
+			if o := &r.ops[c.userData]; o.pending.Load() {
+				// The completions of the reads that were failed are dropped.
+				o.pending.Store(false)
+				o.done <- c.res
+			}
+		}
+		atomic.StoreUint32(r.cqHead, head)
+		if closed {
+			return
+		}
+	}
+}
+
+// fail fails the reads in flight with the error returned by io_uring_enter,
+// and the later submissions with the wrapped error.
+func (r *Ring) fail(err error) {
+	errno, ok := err.(unix.Errno)
+	if !ok {
+		errno = unix.EIO
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mu.err = errors.Wrap(err, "io_uring_enter")
+	for i := range r.ops {
+		if o := &r.ops[i]; o.pending.Load() {
+			o.pending.Store(false)
+			o.done <- -int32(errno)
+		}
+	}
+}
+
+// Read submits a read of len(p) bytes of the file at offset off, into p. The
+// read is asynchronous: p must not be touched until Op.Wait returns. Read
+// blocks while the ring is at its capacity of reads in flight.
+func (r *Ring) Read(fd uintptr, p []byte, off int64) (*Op, error) {
+	var o *Op
+	select {
+	case idx := <-r.free:
+		o = &r.ops[idx]
+	case <-r.closing:
+		return nil, ErrClosed
+	}
+	o.fd, o.buf, o.off, o.n = fd, p, off, 0
+	if err := o.submit(); err != nil {
+		o.release()
+		return nil, err
+	}
+	return o, nil
+}
+
+// ReadAt reads len(p) bytes of the file at offset off into p, with the
+// semantics of io.ReaderAt.
+func (r *Ring) ReadAt(fd uintptr, p []byte, off int64) (int, error) {
+	o, err := r.Read(fd, p, off)
+	if err != nil {
+		return 0, err
+	}
+	return o.Wait()
+}
+
+func (o *Op) submit() error {
+	if o.n == len(o.buf) {
+		// Nothing to read; complete the op without a syscall.
+		o.done <- 0
+		return nil
+	}
+	p := o.buf[o.n:]
+	return o.r.submit(sqe{
+		opcode:   opRead,
+		fd:       int32(o.fd),
+		off:      uint64(o.off) + uint64(o.n),
+		addr:     uint64(uintptr(unsafe.Pointer(&p[0]))),
+		len:      uint32(len(p)),
+		userData: uint64(o.idx),
+	}, o)
+}
+
+// Wait waits for the read to complete, and returns the number of bytes read,
+// with the semantics of io.ReaderAt: a read returning fewer than len(p) bytes
+// returns an error, which is io.EOF at the end of the file. The Op must not be
+// used once Wait returns.
+func (o *Op) Wait() (int, error) {
+	defer o.release()
+	for {
+		res := <-o.done
+		switch {
+		case res < 0:
+			return o.n, unix.Errno(-res)
+		case res == 0 && o.n < len(o.buf):
+			return o.n, io.EOF
+		}
+		o.n += int(res)
+		if o.n == len(o.buf) {
+			return o.n, nil
+		}
+		// A short read: read the rest.
+		if err := o.submit(); err != nil {
+			return o.n, err
+		}
+	}
+}
+
+func (o *Op) release() {
+	o.buf = nil
+	o.r.free <- o.idx
+}
+
+// Close waits for the reads in flight to complete and releases the ring.
+func (r *Ring) Close() error {
+	r.mu.Lock()
+	select {
+	case <-r.closing:
+		r.mu.Unlock()
+		return ErrClosed
+	default:
+		close(r.closing)
+	}
+	r.mu.Unlock()
+	// Wait for the reads in flight, which hold the ops missing from free.
+	for i := 0; i < len(r.ops); i++ {
+		<-r.free
+	}
+
+	r.mu.Lock()
+	err := r.submitLocked(sqe{opcode: opNop, userData: closeUserData})
+	failed := r.mu.err != nil
+	r.mu.closed = true
+	r.mu.Unlock()
+	if err == nil || failed {
+		// The goroutine reaping the completions exits once it reaps the
+		// no-op, or has exited if the ring failed.
+		<-r.reaperDone
+	}
+	r.unmap()
+	return firstError(err, unix.Close(r.fd))
+}
+
+func firstError(err0, err1 error) error {
+	if err0 != nil {
+		return err0
+	}
+	return err1
+}
@@ -0,0 +1,47 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package iouring
+
+import (
+	"os"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestRingFail(t *testing.T) {
+	r, err := New(8)
+	if errors.Is(err, ErrNotSupported) {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+
+	// A read of an empty pipe remains in flight until the pipe is written to.
+	pr, pw, err := os.Pipe()
+	require.NoError(t, err)
+	defer pr.Close()
+	defer pw.Close()
+	p := make([]byte, 10)
+	o, err := r.Read(pr.Fd(), p, 0)
+	require.NoError(t, err)
+
+	// The failure to reap the completions fails the reads in flight, and the
+	// later reads.
+	r.fail(unix.EBADF)
+	_, err = o.Wait()
+	require.Equal(t, unix.EBADF, err)
+	_, err = r.ReadAt(pr.Fd(), p, 0)
+	require.True(t, errors.Is(err, unix.EBADF), "%v", err)
+
+	// The completion of the failed read is dropped.
+	_, err = pw.Write([]byte("x"))
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+}
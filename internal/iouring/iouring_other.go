@@ -0,0 +1,39 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package iouring
+
+// Ring is an io_uring instance. It's only supported on Linux.
+type Ring struct{}
+
+// Op is a read submitted to a Ring.
+type Op struct{}
+
+// New returns ErrNotSupported on this platform.
+func New(entries uint32) (*Ring, error) {
+	return nil, ErrNotSupported
+}
+
+// Read is only supported on Linux.
+func (r *Ring) Read(fd uintptr, p []byte, off int64) (*Op, error) {
+	return nil, ErrNotSupported
+}
+
+// ReadAt is only supported on Linux.
+func (r *Ring) ReadAt(fd uintptr, p []byte, off int64) (int, error) {
+	return 0, ErrNotSupported
+}
+
+// Close is only supported on Linux.
+func (r *Ring) Close() error {
+	return ErrNotSupported
+}
+
+// Wait is only supported on Linux.
+func (o *Op) Wait() (int, error) {
+	return 0, ErrNotSupported
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package iouring
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRing(t *testing.T) {
+	r, err := New(8)
+	if errors.Is(err, ErrNotSupported) {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	path := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	// Many concurrent reads, more than the ring has room for.
+	var wg sync.WaitGroup
+	for g := 0; g < 32; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				off := int64((g*7919 + i*104729) % (len(data) - 4096))
+				p := make([]byte, 1+(g*i)%4096)
+				n, err := r.ReadAt(f.Fd(), p, off)
+				if err != nil || n != len(p) {
+					panic(fmt.Sprintf("ReadAt(%d, %d) = %d, %v", len(p), off, n, err))
+				}
+				if string(p) != string(data[off:off+int64(len(p))]) {
+					panic(fmt.Sprintf("ReadAt(%d, %d) read the wrong data", len(p), off))
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// Asynchronous reads in flight at once.
+	var ops []*Op
+	var bufs [][]byte
+	for i := 0; i < 4; i++ {
+		p := make([]byte, 4096)
+		o, err := r.Read(f.Fd(), p, int64(i)*4096)
+		require.NoError(t, err)
+		ops, bufs = append(ops, o), append(bufs, p)
+	}
+	for i, o := range ops {
+		n, err := o.Wait()
+		require.NoError(t, err)
+		require.Equal(t, 4096, n)
+		require.Equal(t, data[i*4096:(i+1)*4096], bufs[i])
+	}
+
+	// Reads past the end of the file.
+	p := make([]byte, 100)
+	n, err := r.ReadAt(f.Fd(), p, int64(len(data)-10))
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, 10, n)
+	require.Equal(t, data[len(data)-10:], p[:10])
+	n, err = r.ReadAt(f.Fd(), p[:0], int64(len(data)))
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	// Reads of a bad file descriptor.
+	_, err = r.ReadAt(^uintptr(0)>>1, p, 0)
+	require.Error(t, err)
+
+	require.NoError(t, r.Close())
+	require.Equal(t, ErrClosed, r.Close())
+	_, err = r.ReadAt(f.Fd(), p, 0)
+	require.Equal(t, ErrClosed, err)
+}
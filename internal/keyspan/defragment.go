@@ -227,10 +227,16 @@ func (i *DefragmentingIter) SeekGE(key []byte) *Span {
 	// The span we landed on has a Start bound ≤ key. There may be additional
 	// fragments before this span. Defragment backward to find the start of the
 	// defragmented span.
-	i.defragmentBackward()
+	if i.defragmentBackward() == nil {
+		// An error occurred.
+		return nil
+	}
 	if i.iterPos == iterPosPrev {
 		// Next once back onto the span.
-		i.iterSpan = i.iter.Next()
+		if i.iterSpan = i.iter.Next(); i.iterSpan == nil {
+			// An error occurred.
+			return nil
+		}
 	}
 	// Defragment the full span from its start.
 	return i.defragmentForward()
@@ -258,10 +264,16 @@ func (i *DefragmentingIter) SeekLT(key []byte) *Span {
 	// The span we landed on has a End bound ≥ key. There may be additional
 	// fragments after this span. Defragment forward to find the end of the
 	// defragmented span.
-	i.defragmentForward()
+	if i.defragmentForward() == nil {
+		// An error occurred.
+		return nil
+	}
 	if i.iterPos == iterPosNext {
 		// Prev once back onto the span.
-		i.iterSpan = i.iter.Prev()
+		if i.iterSpan = i.iter.Prev(); i.iterSpan == nil {
+			// An error occurred.
+			return nil
+		}
 	}
 	// Defragment the full span from its end.
 	return i.defragmentBackward()
@@ -304,8 +316,12 @@ func (i *DefragmentingIter) Next() *Span {
 		// Next once to move onto y, defragment forward to land on the first z
 		// position.
 		i.iterSpan = i.iter.Next()
-		if invariants.Enabled && i.iterSpan == nil {
-			panic("pebble: invariant violation: no next span while switching directions")
+		if i.iterSpan == nil {
+			if invariants.Enabled && i.iter.Error() == nil {
+				panic("pebble: invariant violation: no next span while switching directions")
+			}
+			i.iterPos = iterPosCurr
+			return nil
 		}
 		// We're now positioned on the first span that was defragmented into the
 		// current iterator position. Skip over the rest of the current iterator
@@ -380,8 +396,12 @@ func (i *DefragmentingIter) Prev() *Span {
 		// Prev once to move onto y, defragment backward to land on the last x
 		// position.
 		i.iterSpan = i.iter.Prev()
-		if invariants.Enabled && i.iterSpan == nil {
-			panic("pebble: invariant violation: no previous span while switching directions")
+		if i.iterSpan == nil {
+			if invariants.Enabled && i.iter.Error() == nil {
+				panic("pebble: invariant violation: no previous span while switching directions")
+			}
+			i.iterPos = iterPosCurr
+			return nil
 		}
 		// We're now positioned on the last span that was defragmented into the
 		// current iterator position. Skip over the rest of the current iterator
@@ -437,6 +457,11 @@ func (i *DefragmentingIter) defragmentForward() *Span {
 		i.keysBuf = i.reduce(i.keysBuf, i.iterSpan.Keys)
 		i.iterSpan = i.iter.Next()
 	}
+	// i.iterSpan is nil if i.iter is exhausted, or if it failed to load the
+	// next fragment, in which case the defragmented span is incomplete.
+	if i.iterSpan == nil && i.iter.Error() != nil {
+		return nil
+	}
 	i.curr.Keys = i.keysBuf
 	return &i.curr
 }
@@ -470,6 +495,11 @@ func (i *DefragmentingIter) defragmentBackward() *Span {
 		i.keysBuf = i.reduce(i.keysBuf, i.iterSpan.Keys)
 		i.iterSpan = i.iter.Prev()
 	}
+	// i.iterSpan is nil if i.iter is exhausted, or if it failed to load the
+	// previous fragment, in which case the defragmented span is incomplete.
+	if i.iterSpan == nil && i.iter.Error() != nil {
+		return nil
+	}
 	i.curr.Keys = i.keysBuf
 	return &i.curr
 }
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/cockroachdb/datadriven"
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/testkeys"
 	"github.com/pmezard/go-difflib/difflib"
@@ -292,3 +293,108 @@ func runIterOp(w io.Writer, it FragmentIterator, op string) {
 	}
 	fmt.Fprintln(w, s)
 }
+
+// TestDefragmentingIterError tests that the DefragmentingIter doesn't surface
+// a partially defragmented span when the underlying iterator fails to load a
+// fragment.
+func TestDefragmentingIterError(t *testing.T) {
+	spans := []Span{
+		ParseSpan("a-b:{(#3,RANGEKEYSET,@3,bananas)}"),
+		ParseSpan("b-c:{(#3,RANGEKEYSET,@3,bananas)}"),
+		ParseSpan("c-d:{(#3,RANGEKEYSET,@3,bananas)}"),
+	}
+	errInjected := errors.New("injected error")
+	for _, op := range []string{"first", "last", "seekge b", "seeklt c"} {
+		// Fail each of the operations on the underlying iterator in turn, until
+		// the defragmented span is loaded without an error.
+		for n := 0; ; n++ {
+			fi := &failingIter{iter: NewIter(testkeys.Comparer.Compare, spans), n: n, err: errInjected}
+			var iter DefragmentingIter
+			var bufs DefragmentingBuffers
+			iter.Init(testkeys.Comparer, fi, DefragmentInternal, StaticDefragmentReducer, &bufs)
+			var buf bytes.Buffer
+			runIterOp(&buf, &iter, op)
+			if fi.n >= 0 {
+				got := strings.TrimSpace(buf.String())
+				if want := "a-d:{(#3,RANGEKEYSET,@3,bananas)}"; !strings.HasSuffix(got, want) {
+					t.Fatalf("%s: got %q, want %q", op, got, want)
+				}
+				break
+			}
+			if got := strings.TrimSpace(buf.String()); !strings.HasSuffix(got, ".") {
+				t.Fatalf("%s: failing operation %d: got %q, want no span", op, n, got)
+			}
+			if err := iter.Error(); !errors.Is(err, errInjected) {
+				t.Fatalf("%s: failing operation %d: got error %v, want %v", op, n, err, errInjected)
+			}
+		}
+	}
+}
+
+// failingIter wraps a FragmentIterator, failing its n-th positioning
+// operation (counting from zero) with err.
+type failingIter struct {
+	iter   FragmentIterator
+	n      int
+	err    error
+	failed bool
+}
+
+var _ FragmentIterator = (*failingIter)(nil)
+
+func (i *failingIter) fail() bool {
+	i.failed = i.n == 0
+	i.n--
+	return i.failed
+}
+
+func (i *failingIter) SeekGE(key []byte) *Span {
+	if i.fail() {
+		return nil
+	}
+	return i.iter.SeekGE(key)
+}
+
+func (i *failingIter) SeekLT(key []byte) *Span {
+	if i.fail() {
+		return nil
+	}
+	return i.iter.SeekLT(key)
+}
+
+func (i *failingIter) First() *Span {
+	if i.fail() {
+		return nil
+	}
+	return i.iter.First()
+}
+
+func (i *failingIter) Last() *Span {
+	if i.fail() {
+		return nil
+	}
+	return i.iter.Last()
+}
+
+func (i *failingIter) Next() *Span {
+	if i.fail() {
+		return nil
+	}
+	return i.iter.Next()
+}
+
+func (i *failingIter) Prev() *Span {
+	if i.fail() {
+		return nil
+	}
+	return i.iter.Prev()
+}
+
+func (i *failingIter) Error() error {
+	if i.failed {
+		return i.err
+	}
+	return i.iter.Error()
+}
+
+func (i *failingIter) Close() error { return i.iter.Close() }
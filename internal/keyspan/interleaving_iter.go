@@ -631,6 +631,11 @@ func (i *InterleavingIter) interleaveForward(
 			}
 		}
 
+		// Is the point key or the span nil due to an error?
+		if i.positionError() != nil {
+			return i.yieldNil()
+		}
+
 		// Interleave.
 		switch {
 		case i.span == nil:
@@ -761,6 +766,11 @@ func (i *InterleavingIter) interleaveBackward() (*base.InternalKey, base.LazyVal
 			}
 		}
 
+		// Is the point key or the span nil due to an error?
+		if i.positionError() != nil {
+			return i.yieldNil()
+		}
+
 		// Interleave.
 		switch {
 		case i.span == nil:
@@ -942,6 +952,22 @@ func (i *InterleavingIter) checkBackwardBound() {
 	}
 }
 
+// positionError returns the error of the point or keyspan iterator if it's
+// exhausted. An iterator that's exhausted due to an error must not be treated
+// as out of keys, or the keys of the other iterator would be surfaced while
+// the keys it failed to read are silently omitted.
+func (i *InterleavingIter) positionError() error {
+	if i.pointKey == nil {
+		if err := i.pointIter.Error(); err != nil {
+			return err
+		}
+	}
+	if i.span == nil {
+		return i.keyspanIter.Error()
+	}
+	return nil
+}
+
 func (i *InterleavingIter) yieldNil() (*base.InternalKey, base.LazyValue) {
 	i.spanCoversKey = false
 	i.clearMask()
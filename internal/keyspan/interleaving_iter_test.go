@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/cockroachdb/datadriven"
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/testkeys"
 	"github.com/stretchr/testify/require"
@@ -278,3 +279,35 @@ func (i *pointIterator) String() string { return "test-point-iterator" }
 func (i *pointIterator) SetBounds(lower, upper []byte) {
 	i.lower, i.upper = lower, upper
 }
+
+// TestInterleavingIterError tests that the InterleavingIter doesn't surface
+// point keys when the keyspan iterator fails, which would omit the spans
+// covering them.
+func TestInterleavingIterError(t *testing.T) {
+	cmp := testkeys.Comparer.Compare
+	errInjected := errors.New("injected error")
+	pointIter := pointIterator{cmp: cmp, keys: []base.InternalKey{base.ParseInternalKey("b.SET.1")}}
+	spans := []Span{ParseSpan("a-c:{(#2,RANGEKEYSET,@3,bananas)}")}
+	for _, op := range []string{"first", "last", "seekge", "seeklt"} {
+		keyspanIter := &failingIter{iter: NewIter(cmp, spans), n: 0, err: errInjected}
+		var iter InterleavingIter
+		iter.Init(testkeys.Comparer, &pointIter, keyspanIter, nil /* mask */, nil, nil)
+		var k *base.InternalKey
+		switch op {
+		case "first":
+			k, _ = iter.First()
+		case "last":
+			k, _ = iter.Last()
+		case "seekge":
+			k, _ = iter.SeekGE([]byte("b"), base.SeekGEFlagsNone)
+		case "seeklt":
+			k, _ = iter.SeekLT([]byte("c"), base.SeekLTFlagsNone)
+		}
+		if k != nil {
+			t.Fatalf("%s: got %s, want no key", op, k)
+		}
+		if err := iter.Error(); !errors.Is(err, errInjected) {
+			t.Fatalf("%s: got error %v, want %v", op, err, errInjected)
+		}
+	}
+}
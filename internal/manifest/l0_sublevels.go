@@ -960,6 +960,12 @@ func (s *L0Sublevels) FlushSplitKeys() [][]byte {
 	return s.flushSplitUserKeys
 }
 
+// NumIntervals returns the number of intervals that the L0 key space is
+// divided into by the boundaries of L0 files.
+func (s *L0Sublevels) NumIntervals() int {
+	return len(s.orderedIntervals)
+}
+
 // MaxDepthAfterOngoingCompactions returns an estimate of maximum depth of
 // sublevels after all ongoing compactions run to completion. Used by compaction
 // picker to decide compaction score for L0. There is no scoring for intra-L0
@@ -68,6 +68,16 @@ type TableStats struct {
 	RangeDeletionsBytesEstimate uint64
 	// Total size of value blocks and value index block.
 	ValueBlocksSize uint64
+	// The number and total size of the point keys in the table that are
+	// shadowed by a newer point key with the same prefix in the table, and of
+	// the point deletions in the table. These are only collected for tables
+	// written with the MVCC garbage table properties (see
+	// pebble.Options.Experimental.MVCCGarbageProperties), and are zero
+	// otherwise.
+	OverwrittenCount uint64
+	OverwrittenSize  uint64
+	DeletionsCount   uint64
+	DeletionsSize    uint64
 }
 
 // boundType represents the type of key (point or range) present as the smallest
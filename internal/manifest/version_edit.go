@@ -49,16 +49,28 @@ const (
 	tagMaxColumnFamily  = 203
 
 	// Pebble tags.
-	tagNewFile5 = 104 // Range keys.
+	tagNewFile5            = 104 // Range keys.
+	tagCreatedBackingTable = 105
+	tagRemovedBackingTable = 106
+	tagExportedSnapshot    = 107
+	tagDeletedSnapshot     = 108
 
 	// The custom tags sub-format used by tagNewFile4 and above.
 	customTagTerminate         = 1
 	customTagNeedsCompaction   = 2
 	customTagCreationTime      = 6
 	customTagPathID            = 65
+	customTagVirtual           = 66
 	customTagNonSafeIgnoreMask = 1 << 6
 )
 
+// ExportedSnapshot is a snapshot pinned in the MANIFEST under a name, so that
+// it can be reopened after the DB is reopened.
+type ExportedSnapshot struct {
+	Name   string
+	SeqNum uint64
+}
+
 // DeletedFileEntry holds the state for a file deletion from a level. The file
 // itself might still be referenced by another level.
 type DeletedFileEntry struct {
@@ -137,11 +149,20 @@ type VersionEdit struct {
 	// and RemovedBackingTables. A file must be present in RemovedBackingTables
 	// in exactly one version edit.
 	RemovedBackingTables []base.FileNum
+	// ExportedSnapshots are the snapshots exported in this version edit, and
+	// DeletedSnapshots the names of the previously exported snapshots which
+	// are deleted by it. The version edit beginning a MANIFEST lists all the
+	// exported snapshots.
+	ExportedSnapshots []ExportedSnapshot
+	DeletedSnapshots  []string
 }
 
 // Decode decodes an edit from the specified reader.
 //
-// TODO(bananabrick): Support decoding of virtual sstable state.
+// The FileBacking of a decoded virtual sstable is shared with the matching
+// entry of CreatedBackingTables, if the backing table was created in the same
+// version edit. Otherwise, it is a placeholder holding only the FileNum of the
+// backing table, which is resolved by BulkVersionEdit.Accumulate.
 func (v *VersionEdit) Decode(r io.Reader) error {
 	br, ok := r.(byteReader)
 	if !ok {
@@ -299,6 +320,8 @@ func (v *VersionEdit) Decode(r io.Reader) error {
 			}
 			var markedForCompaction bool
 			var creationTime uint64
+			var virtual bool
+			var backingFileNum base.FileNum
 			if tag == tagNewFile4 || tag == tagNewFile5 {
 				for {
 					customTag, err := d.readUvarint()
@@ -329,6 +352,14 @@ func (v *VersionEdit) Decode(r io.Reader) error {
 					case customTagPathID:
 						return base.CorruptionErrorf("new-file4: path-id field not supported")
 
+					case customTagVirtual:
+						u, n := binary.Uvarint(field)
+						if n != len(field) {
+							return base.CorruptionErrorf("new-file4: invalid backing file number")
+						}
+						virtual = true
+						backingFileNum = base.FileNum(u)
+
 					default:
 						if (customTag & customTagNonSafeIgnoreMask) != 0 {
 							return base.CorruptionErrorf("new-file4: custom field not supported: %d", customTag)
@@ -374,12 +405,59 @@ func (v *VersionEdit) Decode(r io.Reader) error {
 				}
 			}
 			m.boundsSet = true
-			m.InitPhysicalBacking()
+			if virtual {
+				m.Virtual = true
+				m.FileBacking = &FileBacking{FileNum: backingFileNum}
+			} else {
+				m.InitPhysicalBacking()
+			}
 			v.NewFiles = append(v.NewFiles, NewFileEntry{
 				Level: level,
 				Meta:  m,
 			})
 
+		case tagCreatedBackingTable:
+			fileNum, err := d.readFileNum()
+			if err != nil {
+				return err
+			}
+			size, err := d.readUvarint()
+			if err != nil {
+				return err
+			}
+			v.CreatedBackingTables = append(v.CreatedBackingTables, &FileBacking{
+				FileNum: fileNum,
+				Size:    size,
+			})
+
+		case tagRemovedBackingTable:
+			fileNum, err := d.readFileNum()
+			if err != nil {
+				return err
+			}
+			v.RemovedBackingTables = append(v.RemovedBackingTables, fileNum)
+
+		case tagExportedSnapshot:
+			name, err := d.readBytes()
+			if err != nil {
+				return err
+			}
+			seqNum, err := d.readUvarint()
+			if err != nil {
+				return err
+			}
+			v.ExportedSnapshots = append(v.ExportedSnapshots, ExportedSnapshot{
+				Name:   string(name),
+				SeqNum: seqNum,
+			})
+
+		case tagDeletedSnapshot:
+			name, err := d.readBytes()
+			if err != nil {
+				return err
+			}
+			v.DeletedSnapshots = append(v.DeletedSnapshots, string(name))
+
 		case tagPrevLogNumber:
 			n, err := d.readUvarint()
 			if err != nil {
@@ -394,12 +472,24 @@ func (v *VersionEdit) Decode(r io.Reader) error {
 			return errCorruptManifest
 		}
 	}
+
+	// Share the FileBacking of virtual sstables with the backing tables created
+	// in this version edit.
+	for _, nf := range v.NewFiles {
+		if !nf.Meta.Virtual {
+			continue
+		}
+		for _, b := range v.CreatedBackingTables {
+			if b.FileNum == nf.Meta.FileBacking.FileNum {
+				nf.Meta.FileBacking = b
+				break
+			}
+		}
+	}
 	return nil
 }
 
 // Encode encodes an edit to the specified writer.
-//
-// TODO(bananabrick): Support encoding of virtual sstable state.
 func (v *VersionEdit) Encode(w io.Writer) error {
 	e := versionEditEncoder{new(bytes.Buffer)}
 
@@ -431,8 +521,26 @@ func (v *VersionEdit) Encode(w io.Writer) error {
 		e.writeUvarint(uint64(x.Level))
 		e.writeUvarint(uint64(x.FileNum))
 	}
+	for _, x := range v.CreatedBackingTables {
+		e.writeUvarint(tagCreatedBackingTable)
+		e.writeUvarint(uint64(x.FileNum))
+		e.writeUvarint(x.Size)
+	}
+	for _, fileNum := range v.RemovedBackingTables {
+		e.writeUvarint(tagRemovedBackingTable)
+		e.writeUvarint(uint64(fileNum))
+	}
+	for _, x := range v.ExportedSnapshots {
+		e.writeUvarint(tagExportedSnapshot)
+		e.writeString(x.Name)
+		e.writeUvarint(x.SeqNum)
+	}
+	for _, name := range v.DeletedSnapshots {
+		e.writeUvarint(tagDeletedSnapshot)
+		e.writeString(name)
+	}
 	for _, x := range v.NewFiles {
-		customFields := x.Meta.MarkedForCompaction || x.Meta.CreationTime != 0
+		customFields := x.Meta.MarkedForCompaction || x.Meta.CreationTime != 0 || x.Meta.Virtual
 		var tag uint64
 		switch {
 		case x.Meta.HasRangeKeys:
@@ -485,6 +593,12 @@ func (v *VersionEdit) Encode(w io.Writer) error {
 				e.writeUvarint(customTagNeedsCompaction)
 				e.writeBytes([]byte{1})
 			}
+			if x.Meta.Virtual {
+				e.writeUvarint(customTagVirtual)
+				var buf [binary.MaxVarintLen64]byte
+				n := binary.PutUvarint(buf[:], uint64(x.Meta.FileBacking.FileNum))
+				e.writeBytes(buf[:n])
+			}
 			e.writeUvarint(customTagTerminate)
 		}
 	}
@@ -593,6 +707,10 @@ type BulkVersionEdit struct {
 	AddedFileBacking   []*FileBacking
 	RemovedFileBacking []base.FileNum
 
+	// addedFileBackingByNum indexes AddedFileBacking by file number. It's used
+	// to resolve the FileBacking of virtual sstables decoded from a MANIFEST.
+	addedFileBackingByNum map[base.FileNum]*FileBacking
+
 	// AddedByFileNum maps file number to file metadata for all added files
 	// from accumulated version edits. AddedByFileNum is only populated if set
 	// to non-nil by a caller. It must be set to non-nil when replaying
@@ -625,6 +743,15 @@ type BulkVersionEdit struct {
 // of the accumulation, because we need to decrease the refcount of the
 // deleted file in Apply.
 func (b *BulkVersionEdit) Accumulate(ve *VersionEdit) error {
+	// Generate state for the backing files.
+	b.AddedFileBacking = append(b.AddedFileBacking, ve.CreatedBackingTables...)
+	for _, s := range ve.CreatedBackingTables {
+		if b.addedFileBackingByNum == nil {
+			b.addedFileBackingByNum = make(map[base.FileNum]*FileBacking)
+		}
+		b.addedFileBackingByNum[s.FileNum] = s
+	}
+
 	for df, m := range ve.DeletedFiles {
 		dmap := b.Deleted[df.Level]
 		if dmap == nil {
@@ -661,6 +788,17 @@ func (b *BulkVersionEdit) Accumulate(ve *VersionEdit) error {
 				return base.CorruptionErrorf("pebble: file deleted L%d.%s before it was inserted", nf.Level, nf.Meta.FileNum)
 			}
 		}
+		if nf.Meta.Virtual {
+			// The FileBacking of a virtual sstable decoded from a MANIFEST may
+			// be a placeholder for a backing table created in a preceding
+			// version edit.
+			if s, ok := b.addedFileBackingByNum[nf.Meta.FileBacking.FileNum]; ok {
+				nf.Meta.FileBacking = s
+			} else if b.AddedByFileNum != nil {
+				return base.CorruptionErrorf("pebble: virtual sstable %s has unknown backing table %s",
+					nf.Meta.FileNum, nf.Meta.FileBacking.FileNum)
+			}
+		}
 		if b.Added[nf.Level] == nil {
 			b.Added[nf.Level] = make(map[base.FileNum]*FileMetadata)
 		}
@@ -673,9 +811,6 @@ func (b *BulkVersionEdit) Accumulate(ve *VersionEdit) error {
 		}
 	}
 
-	// Generate state for the backing files.
-	b.AddedFileBacking = append(b.AddedFileBacking, ve.CreatedBackingTables...)
-
 	// Since a file can be removed from backing files in exactly one version
 	// edit it is safe to just append without any de-duplication.
 	b.RemovedFileBacking = append(b.RemovedFileBacking, ve.RemovedBackingTables...)
@@ -93,6 +93,21 @@ func TestVersionEditRoundTrip(t *testing.T) {
 	)
 	m4.InitPhysicalBacking()
 
+	backing := &FileBacking{FileNum: 810, Size: 8100}
+	m5 := (&FileMetadata{
+		FileNum:        811,
+		Size:           4050,
+		CreationTime:   811070,
+		SmallestSeqNum: 12,
+		LargestSeqNum:  14,
+		Virtual:        true,
+		FileBacking:    backing,
+	}).ExtendPointKeyBounds(
+		cmp,
+		base.MakeInternalKey([]byte("c"), 0, base.InternalKeyKindSet),
+		base.MakeRangeDeleteSentinelKey([]byte("f")),
+	)
+
 	testCases := []VersionEdit{
 		// An empty version edit.
 		{},
@@ -132,6 +147,32 @@ func TestVersionEditRoundTrip(t *testing.T) {
 				},
 			},
 		},
+		// A version edit virtualizing a physical sstable.
+		{
+			DeletedFiles: map[DeletedFileEntry]*FileMetadata{
+				{
+					Level:   6,
+					FileNum: 810,
+				}: nil,
+			},
+			NewFiles: []NewFileEntry{
+				{
+					Level: 6,
+					Meta:  m5,
+				},
+			},
+			CreatedBackingTables: []*FileBacking{backing},
+			RemovedBackingTables: []base.FileNum{790, 795},
+		},
+		// A version edit exporting and deleting snapshots.
+		{
+			LastSeqNum: 1000,
+			ExportedSnapshots: []ExportedSnapshot{
+				{Name: "backup", SeqNum: 990},
+				{Name: "", SeqNum: 1000},
+			},
+			DeletedSnapshots: []string{"old-backup"},
+		},
 	}
 	for _, tc := range testCases {
 		if err := checkRoundTrip(tc); err != nil {
@@ -28,6 +28,9 @@ type history struct {
 	err    atomic.Value
 	failRE *regexp.Regexp
 	log    *log.Logger
+	// sched, if non-nil, records the happens-before relation of the
+	// operations executed by a randomized schedule (see RandomSchedule).
+	sched *schedule
 }
 
 func newHistory(failRE *regexp.Regexp, writers ...io.Writer) *history {
@@ -97,6 +100,80 @@ func (h *history) recorder(thread int, op int) historyRecorder {
 	}
 }
 
+// recordSchedule configures the history to record the logical start and end
+// times of each of the n operations of the run.
+func (h *history) recordSchedule(n int) {
+	h.sched = &schedule{
+		threads: make([]int, n),
+		starts:  make([]uint64, n),
+		ends:    make([]uint64, n),
+	}
+}
+
+// opStarted records the start of the operation at index op on the provided
+// thread. It's a no-op if the history isn't recording the schedule.
+func (h *history) opStarted(thread int, op int) {
+	if h.sched == nil {
+		return
+	}
+	h.sched.threads[op] = thread
+	h.sched.starts[op] = h.sched.clock.Add(1)
+}
+
+// opFinished records the end of the operation at index op. It's a no-op if
+// the history isn't recording the schedule.
+func (h *history) opFinished(op int) {
+	if h.sched == nil {
+		return
+	}
+	h.sched.ends[op] = h.sched.clock.Add(1)
+}
+
+// verifySchedule verifies that the recorded schedule matches the provided
+// assignment of the operations to threads: every operation must have run to
+// completion on its thread, and the operations of each thread must have run
+// one after the other, in order. The recorded schedule is output as comments
+// to aid in debugging. verifySchedule must only be called once all the
+// operations finished.
+func (h *history) verifySchedule(opThreads []int) error {
+	if h.sched == nil {
+		return nil
+	}
+	s := h.sched
+	for i := range s.starts {
+		h.log.Printf("// SCHEDULE: #%d thread=%d [%d,%d]", i, s.threads[i], s.starts[i], s.ends[i])
+	}
+	if len(opThreads) != len(s.starts) {
+		return errors.Errorf("%d ops scheduled, %d recorded", len(opThreads), len(s.starts))
+	}
+	// prev maps a thread to the last op it ran.
+	prev := make(map[int]int)
+	for i, thread := range opThreads {
+		switch {
+		case s.starts[i] == 0 || s.ends[i] <= s.starts[i]:
+			return errors.Errorf("op #%d didn't run to completion: [%d,%d]", i, s.starts[i], s.ends[i])
+		case s.threads[i] != thread:
+			return errors.Errorf("op #%d ran on thread %d instead of thread %d", i, s.threads[i], thread)
+		}
+		if j, ok := prev[thread]; ok && s.ends[j] > s.starts[i] {
+			return errors.Errorf("op #%d started at %d on thread %d before op #%d finished at %d",
+				i, s.starts[i], thread, j, s.ends[j])
+		}
+		prev[thread] = i
+	}
+	return nil
+}
+
+// schedule records the operations' logical start and end times, drawn from a
+// shared clock. Two operations ran concurrently iff neither's interval ended
+// before the other's started.
+type schedule struct {
+	clock   atomic.Uint64
+	threads []int    // op index -> thread
+	starts  []uint64 // op index -> logical start time
+	ends    []uint64 // op index -> logical end time
+}
+
 // historyRecorder pairs a history with an operation, annotating all lines
 // recorded through it with the operation number.
 type historyRecorder struct {
@@ -42,6 +42,39 @@ func TestHistoryFail(t *testing.T) {
 	require.EqualError(t, h.Error(), `failure regexp "foo" matched output: foo bar #2`)
 }
 
+func TestHistoryVerifySchedule(t *testing.T) {
+	run := func(ops ...int) *history {
+		h := newHistory(nil, &bytes.Buffer{})
+		h.recordSchedule(3)
+		for _, op := range ops {
+			thread := op % 2
+			h.opStarted(thread, op)
+			h.opFinished(op)
+		}
+		return h
+	}
+	opThreads := []int{0, 1, 0}
+	require.NoError(t, run(0, 1, 2).verifySchedule(opThreads))
+	require.NoError(t, run(1, 0, 2).verifySchedule(opThreads))
+	// Op #2 ran before op #0 on thread 0.
+	require.Error(t, run(2, 1, 0).verifySchedule(opThreads))
+	// Op #2 didn't run.
+	require.Error(t, run(0, 1).verifySchedule(opThreads))
+	// Op #1 ran on thread 1 instead of thread 0.
+	require.Error(t, run(0, 1, 2).verifySchedule([]int{0, 0, 0}))
+
+	// Op #2 started on thread 0 before op #0 finished.
+	h := newHistory(nil, &bytes.Buffer{})
+	h.recordSchedule(3)
+	h.opStarted(0, 0)
+	h.opStarted(1, 1)
+	h.opStarted(0, 2)
+	for op := 0; op < 3; op++ {
+		h.opFinished(op)
+	}
+	require.Error(t, h.verifySchedule(opThreads))
+}
+
 func TestReorderHistory(t *testing.T) {
 	datadriven.RunTest(t, "testdata/reorder_history", func(t *testing.T, d *datadriven.TestData) string {
 		switch d.Cmd {
@@ -13,9 +13,11 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"testing"
 	"time"
 
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/errorfs"
@@ -114,6 +116,9 @@ func RunAndCompare(t *testing.T, rootDir string, rOpts ...RunOption) {
 	if runOpts.seed == 0 {
 		runOpts.seed = uint64(time.Now().UnixNano())
 	}
+	if runOpts.randomSchedule && runOpts.scheduleSeed == 0 {
+		runOpts.scheduleSeed = runOpts.seed
+	}
 
 	require.NoError(t, os.MkdirAll(rootDir, 0755))
 	metaDir, err := os.MkdirTemp(rootDir, time.Now().Format("060102-150405.000"))
@@ -174,6 +179,15 @@ func RunAndCompare(t *testing.T, rootDir string, rOpts ...RunOption) {
 		if runOpts.traceFile != "" {
 			args = append(args, "-test.trace="+filepath.Join(runDir, runOpts.traceFile))
 		}
+		if runOpts.errorRate > 0 {
+			args = append(args, "-error-rate="+fmt.Sprint(runOpts.errorRate))
+		}
+		if runOpts.tableErrorRate > 0 {
+			args = append(args, "-table-error-rate="+fmt.Sprint(runOpts.tableErrorRate))
+		}
+		if runOpts.randomSchedule {
+			args = append(args, "-random-schedule", "-schedule-seed="+fmt.Sprint(runOpts.scheduleSeed))
+		}
 
 		cmd := exec.Command(os.Args[0], args...)
 		out, err := cmd.CombinedOutput()
@@ -197,6 +211,15 @@ func RunAndCompare(t *testing.T, rootDir string, rOpts ...RunOption) {
 	// Create the standard options.
 	var names []string
 	options := map[string]*testOptions{}
+	if runOpts.randomSchedule {
+		// Run the default options on a single thread first, so that the
+		// histories of the randomly scheduled runs are compared against the
+		// history of a sequential execution of the same operations.
+		opts := defaultTestOptions()
+		opts.threads = 1
+		names = append(names, "sequential")
+		options["sequential"] = opts
+	}
 	for i, opts := range standardOptions() {
 		name := fmt.Sprintf("standard-%03d", i)
 		names = append(names, name)
@@ -293,7 +316,15 @@ type runOnceOptions struct {
 	keep       bool
 	maxThreads int
 	errorRate  float64
-	failRegexp *regexp.Regexp
+	// tableErrorRate is the probability of injecting errors into the I/O on
+	// the sstables of the DB (see InjectTableErrorsRate).
+	tableErrorRate float64
+	failRegexp     *regexp.Regexp
+	// randomSchedule is set when the operations are executed on randomly
+	// chosen threads, using a schedule generated from scheduleSeed (see
+	// RandomSchedule).
+	randomSchedule bool
+	scheduleSeed   uint64
 }
 
 // A RunOnceOption configures the behavior of a single run of the metamorphic
@@ -317,6 +348,21 @@ type InjectErrorsRate float64
 func (r InjectErrorsRate) apply(ro *runAndCompareOptions) { ro.errorRate = float64(r) }
 func (r InjectErrorsRate) applyOnce(ro *runOnceOptions)   { ro.errorRate = float64(r) }
 
+// InjectTableErrorsRate configures the run to inject errors into the creation,
+// writes and syncs of the sstables of the DB, and at a lower rate into their
+// reads (see tableReadErrorScale). The test doesn't retry
+// the failed writes: the DB is expected to recover from these errors by
+// retrying the flushes and compactions in the background, and the operations
+// of the test to succeed regardless, which the comparison of the histories of
+// the runs verifies. The failed reads are retried by the operations of the
+// test, and the run fails if those reported by the DB's event listener aren't
+// marked as transient I/O errors. Errors aren't injected into the WAL and the
+// MANIFEST, whose write errors are fatal to the DB.
+type InjectTableErrorsRate float64
+
+func (r InjectTableErrorsRate) apply(ro *runAndCompareOptions) { ro.tableErrorRate = float64(r) }
+func (r InjectTableErrorsRate) applyOnce(ro *runOnceOptions)   { ro.tableErrorRate = float64(r) }
+
 // MaxThreads sets an upper bound on the number of parallel execution threads
 // during replay.
 type MaxThreads int
@@ -324,6 +370,31 @@ type MaxThreads int
 func (m MaxThreads) apply(ro *runAndCompareOptions) { ro.maxThreads = int(m) }
 func (m MaxThreads) applyOnce(ro *runOnceOptions)   { ro.maxThreads = int(m) }
 
+// RandomSchedule configures the runs with more than one thread to execute each
+// operation on a randomly chosen thread, yielding the processor a random number
+// of times beforehand, rather than on the thread its receiver hashes to.
+// Operations synchronize only on the operations they depend on, including the
+// preceding operations with the same receiver, so the results must match those
+// of a sequential execution. RunAndCompare adds a single-threaded run to
+// compare the histories against. The logical start and end times of the
+// executed operations are recorded in the history and verified against the
+// schedule: each operation must have run on its thread, after the preceding
+// operations of the thread finished.
+//
+// The value is the seed of the pseudorandom number generator generating the
+// schedules. If zero, RunAndCompare uses the seed of the operations.
+type RandomSchedule uint64
+
+func (s RandomSchedule) apply(ro *runAndCompareOptions) {
+	ro.randomSchedule = true
+	ro.scheduleSeed = uint64(s)
+}
+
+func (s RandomSchedule) applyOnce(ro *runOnceOptions) {
+	ro.randomSchedule = true
+	ro.scheduleSeed = uint64(s)
+}
+
 // FailOnMatch configures the run to fail immediately if the history matches the
 // provided regular expression.
 type FailOnMatch struct {
@@ -397,8 +468,13 @@ func RunOnce(t TestingT, runDir string, seed uint64, historyPath string, rOpts .
 	}
 
 	// Wrap the filesystem with one that will inject errors into read
-	// operations with *errorRate probability.
-	opts.FS = errorfs.Wrap(opts.FS, errorfs.WithProbability(errorfs.OpKindRead, runOpts.errorRate))
+	// operations with *errorRate probability, and into the I/O on the DB's
+	// sstables with *tableErrorRate probability.
+	var inj errorfs.Injector = errorfs.WithProbability(errorfs.OpKindRead, runOpts.errorRate)
+	if runOpts.tableErrorRate > 0 {
+		inj = errorfs.Any(inj, tableErrors(opts.FS, dir, runOpts.tableErrorRate))
+	}
+	opts.FS = errorfs.Wrap(opts.FS, inj)
 
 	if opts.WALDir != "" {
 		opts.WALDir = opts.FS.PathJoin(runDir, opts.WALDir)
@@ -415,6 +491,7 @@ func RunOnce(t TestingT, runDir string, seed uint64, historyPath string, rOpts .
 	h := newHistory(runOpts.failRegexp, writers...)
 
 	m := newTest(ops)
+	m.orderReceivers = runOpts.randomSchedule && threads > 1
 	require.NoError(t, m.init(h, dir, testOpts))
 
 	if threads <= 1 {
@@ -427,17 +504,35 @@ func RunOnce(t TestingT, runDir string, seed uint64, historyPath string, rOpts .
 			}
 		}
 	} else {
+		// By default, all operations with the same receiver are performed on
+		// the thread the receiver hashes to. With a random schedule, each
+		// operation is performed on a random thread, after yielding the
+		// processor a random number of times.
+		opThreads := make([]int, len(m.ops))
+		var opYields []int
+		if m.orderReceivers {
+			rng := rand.New(rand.NewSource(runOpts.scheduleSeed))
+			opYields = make([]int, len(m.ops))
+			for idx := range m.ops {
+				opThreads[idx] = rng.Intn(threads)
+				opYields[idx] = rng.Intn(maxScheduleYields + 1)
+			}
+			h.recordSchedule(len(m.ops))
+		} else {
+			for idx := range m.ops {
+				opThreads[idx] = hashThread(m.ops[idx].receiver(), threads)
+			}
+		}
+
 		eg, ctx := errgroup.WithContext(context.Background())
 		for t := 0; t < threads; t++ {
 			t := t // bind loop var to scope
 			eg.Go(func() error {
 				for idx := 0; idx < len(m.ops); idx++ {
-					// Skip any operations whose receiver object hashes to a
-					// different thread. All operations with the same receiver
-					// are performed from the same thread. This goroutine is
-					// only responsible for executing operations that hash to
-					// `t`.
-					if hashThread(m.ops[idx].receiver(), threads) != t {
+					// Skip any operations assigned to a different thread.
+					// This goroutine is only responsible for executing
+					// operations assigned to `t`.
+					if opThreads[idx] != t {
 						continue
 					}
 
@@ -453,7 +548,15 @@ func RunOnce(t TestingT, runDir string, seed uint64, historyPath string, rOpts .
 						}
 					}
 
+					if opYields != nil {
+						for i := 0; i < opYields[idx]; i++ {
+							runtime.Gosched()
+						}
+					}
+
+					h.opStarted(t, idx)
 					m.ops[idx].run(m, h.recorder(t, idx))
+					h.opFinished(idx)
 
 					// If this operation has a done channel, close it so that
 					// other operations that synchronize on this operation know
@@ -469,7 +572,11 @@ func RunOnce(t TestingT, runDir string, seed uint64, historyPath string, rOpts .
 				return nil
 			})
 		}
-		if err := eg.Wait(); err != nil {
+		err := eg.Wait()
+		if err == nil {
+			err = h.verifySchedule(opThreads)
+		}
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "Seed: %d\n", seed)
 			fmt.Fprintln(os.Stderr, err)
 			m.maybeSaveData()
@@ -482,6 +589,74 @@ func RunOnce(t TestingT, runDir string, seed uint64, historyPath string, rOpts .
 	}
 }
 
+// errInjectedTableRead marks the errors injected into the reads of the
+// sstables of the DB (see tableErrors).
+var errInjectedTableRead = errors.New("injected sstable read error")
+
+// tableReadErrorScale scales the probability of injecting errors into the
+// reads of sstables down from that of their writes. A single operation of the
+// test, or a single check of the DB's levels, may read many blocks which must
+// all succeed for it to complete, while failed flushes and compactions are
+// retried in the background.
+const tableReadErrorScale = 0.05
+
+// tableErrors returns an injector that injects errors with probability p
+// into the creation, writes and syncs of the sstables of the DB in dir, and
+// with probability p*tableReadErrorScale into their reads. Unlike the WAL and
+// the MANIFEST, whose write errors are fatal, the sstables are written by
+// flushes and compactions, which the DB retries when they fail. The sstables
+// the test writes elsewhere to ingest them are left alone. The read errors
+// are marked with errInjectedTableRead, so that checkInjectedError can verify
+// how they surface.
+func tableErrors(fs vfs.FS, dir string, p float64) errorfs.Injector {
+	readInj := errorfs.WithProbability(errorfs.OpKindRead, p*tableReadErrorScale)
+	writeInj := errorfs.WithProbability(errorfs.OpKindWrite, p)
+	return errorfs.InjectorFunc(func(op errorfs.Op, path string) error {
+		switch op {
+		case errorfs.OpCreate, errorfs.OpFileRead, errorfs.OpFileReadAt,
+			errorfs.OpFileWrite, errorfs.OpFileSync:
+		default:
+			return nil
+		}
+		if fs.PathDir(path) != dir {
+			return nil
+		}
+		if fileType, _, ok := base.ParseFilename(fs, path); !ok || fileType != base.FileTypeTable {
+			return nil
+		}
+		if op.OpKind() == errorfs.OpKindRead {
+			if err := readInj.MaybeError(op, path); err != nil {
+				return errors.Mark(err, errInjectedTableRead)
+			}
+			return nil
+		}
+		return writeInj.MaybeError(op, path)
+	})
+}
+
+// checkInjectedError returns an error if err, an error reported by the DB
+// that stems from an injected error, isn't typed as expected: the failed
+// reads of sstables must surface as transient I/O errors, and must be
+// neither corruption errors nor invariant violations.
+func checkInjectedError(err error) error {
+	if !errors.Is(err, errInjectedTableRead) {
+		return nil
+	}
+	switch {
+	case !errors.Is(err, pebble.ErrTransientIO):
+		return errors.Errorf("injected read error not marked as a transient I/O error: %+v", err)
+	case errors.Is(err, pebble.ErrCorruption):
+		return errors.Errorf("injected read error marked as a corruption error: %+v", err)
+	case errors.Is(err, pebble.ErrInvariant):
+		return errors.Errorf("injected read error marked as an invariant violation: %+v", err)
+	}
+	return nil
+}
+
+// maxScheduleYields is the maximum number of times a randomly scheduled
+// operation yields the processor before running.
+const maxScheduleYields = 3
+
 func hashThread(objID objID, numThreads int) int {
 	// Fibonacci hash https://probablydance.com/2018/06/16/fibonacci-hashing-the-optimization-that-the-world-forgot-or-a-better-alternative-to-integer-modulo/
 	return int((11400714819323198485 * uint64(objID)) % uint64(numThreads))
@@ -38,6 +38,12 @@ var (
 	// error.
 	errorRate = flag.Float64("error-rate", 0.0,
 		"rate of errors injected into filesystem operations (0 ≤ r < 1)")
+	tableErrorRate = flag.Float64("table-error-rate", 0.0,
+		"rate of errors injected into the I/O on the DB's sstables (0 ≤ r < 1)")
+	randomSchedule = flag.Bool("random-schedule", false,
+		"execute the operations of multi-threaded runs on randomly chosen threads")
+	scheduleSeed = flag.Uint64("schedule-seed", 0,
+		"a pseudorandom number generator seed for random schedules (defaults to -seed)")
 	failRE = flag.String("fail", "",
 		"fail the test if the supplied regular expression matches the output")
 	traceFile = flag.String("trace-file", "",
@@ -123,6 +129,14 @@ func TestMeta(t *testing.T) {
 		opts = append(opts, InjectErrorsRate(*errorRate))
 		onceOpts = append(onceOpts, InjectErrorsRate(*errorRate))
 	}
+	if *tableErrorRate > 0 {
+		opts = append(opts, InjectTableErrorsRate(*tableErrorRate))
+		onceOpts = append(onceOpts, InjectTableErrorsRate(*tableErrorRate))
+	}
+	if *randomSchedule {
+		opts = append(opts, RandomSchedule(*scheduleSeed))
+		onceOpts = append(onceOpts, RandomSchedule(*scheduleSeed))
+	}
 	if *traceFile != "" {
 		opts = append(opts, RuntimeTrace(*traceFile))
 	}
@@ -156,3 +170,52 @@ func TestMeta(t *testing.T) {
 	}
 	RunAndCompare(t, *dir, opts...)
 }
+
+// TestMetaTableErrors runs a shorter metamorphic test injecting errors into
+// the reads and writes of the DB's sstables, verifying that the DB recovers
+// from the failed flushes and compactions, that the failed reads surface as
+// transient I/O errors, and that the histories of the runs match.
+func TestMetaTableErrors(t *testing.T) {
+	if *runDir != "" {
+		// The child process of a run (see RunAndCompare).
+		RunOnce(t, *runDir, *seed, filepath.Join(*runDir, "history"),
+			MaxThreads(*maxThreads), InjectTableErrorsRate(*tableErrorRate))
+		return
+	}
+	rate := *tableErrorRate
+	if rate == 0 {
+		rate = 0.05
+	}
+	opts := []RunOption{
+		Seed(*seed),
+		OpCount(randvar.NewUniform(500, 1000)),
+		MaxThreads(*maxThreads),
+		InjectTableErrorsRate(rate),
+	}
+	if *keep {
+		opts = append(opts, KeepData{})
+	}
+	RunAndCompare(t, *dir, opts...)
+}
+
+// TestMetaRandomSchedule runs a shorter metamorphic test executing the
+// operations of the multi-threaded runs on randomly chosen threads, verifying
+// that their histories match the history of a sequential run.
+func TestMetaRandomSchedule(t *testing.T) {
+	if *runDir != "" {
+		// The child process of a run (see RunAndCompare).
+		RunOnce(t, *runDir, *seed, filepath.Join(*runDir, "history"),
+			MaxThreads(*maxThreads), RandomSchedule(*scheduleSeed))
+		return
+	}
+	opts := []RunOption{
+		Seed(*seed),
+		OpCount(randvar.NewUniform(500, 1000)),
+		MaxThreads(*maxThreads),
+		RandomSchedule(*scheduleSeed),
+	}
+	if *keep {
+		opts = append(opts, KeepData{})
+	}
+	RunAndCompare(t, *dir, opts...)
+}
@@ -661,7 +661,7 @@ func (o *newIterOp) run(t *test, h historyRecorder) {
 		// close this iter and retry NewIter
 		_ = i.Close()
 	}
-	t.setIter(o.iterID, i, o.filterMin, o.filterMax)
+	t.setIter(o.iterID, i, cloneIterOptions(opts), o.filterMin, o.filterMax)
 
 	// Trash the bounds to ensure that Pebble doesn't rely on the stability of
 	// the user-provided bounds.
@@ -714,12 +714,15 @@ func (o *newIterUsingCloneOp) run(t *test, h historyRecorder) {
 		panic(err)
 	}
 	filterMin, filterMax := o.filterMin, o.filterMax
+	opts := iter.opts
 	if cloneOpts.IterOptions == nil {
 		// We're adopting the same block property filters as iter, so we need to
 		// adopt the same run-time filters to ensure determinism.
 		filterMin, filterMax = iter.filterMin, iter.filterMax
+	} else {
+		opts = cloneIterOptions(cloneOpts.IterOptions)
 	}
-	t.setIter(o.iterID, i, filterMin, filterMax)
+	t.setIter(o.iterID, i, opts, filterMin, filterMax)
 	h.Recordf("%s // %v", o, i.Error())
 }
 
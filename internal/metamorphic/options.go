@@ -333,7 +333,9 @@ func randomOptions(rng *rand.Rand) *testOptions {
 	opts.FormatMajorVersion += pebble.FormatMajorVersion(rng.Intn(n + 1))
 	opts.Experimental.L0CompactionConcurrency = 1 + rng.Intn(4)    // 1-4
 	opts.Experimental.LevelMultiplier = 5 << rng.Intn(7)           // 5 - 320
+	opts.Experimental.MemTableShards = 1 << rng.Intn(4)            // 1 - 8
 	opts.Experimental.MinDeletionRate = 1 << uint(20+rng.Intn(10)) // 1MB - 1GB
+	opts.Experimental.MVCCGarbageProperties = rng.Intn(2) != 0
 	opts.Experimental.ValidateOnIngest = rng.Intn(2) != 0
 	opts.L0CompactionThreshold = 1 + rng.Intn(100)     // 1 - 100
 	opts.L0CompactionFileThreshold = 1 << rng.Intn(11) // 1 - 1024
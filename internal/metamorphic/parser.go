@@ -328,7 +328,9 @@ func (p *parser) parseArgs(op op, methodName string, args []interface{}) {
 
 		case *pebble.FormatMajorVersion:
 			_, lit := p.scanToken(token.INT)
-			val, err := strconv.ParseUint(lit, 0, 64)
+			// Format major versions are zero-padded base 10 integers,
+			// which must not be parsed as octal.
+			val, err := strconv.ParseUint(lit, 10, 64)
 			if err != nil {
 				panic(err)
 			}
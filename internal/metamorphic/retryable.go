@@ -29,8 +29,18 @@ func withRetries(fn func() error) error {
 // iterator operations by running them again on a non-error iterator with the
 // same pre-operation state.
 type retryableIter struct {
-	iter    *pebble.Iterator
-	lastKey []byte
+	iter *pebble.Iterator
+
+	// opts holds the options of iter, kept up to date by SetBounds and
+	// SetOptions.
+	opts pebble.IterOptions
+	// ops holds the operations on iter since the last absolute positioning
+	// operation or call to SetOptions, and opsOpts the options of iter before
+	// them. Replaying ops on a clone of iter with opsOpts reproduces the state
+	// of iter after the last successful operation, including the states in
+	// which it's exhausted or paused at a limit, which a seek can't restore.
+	ops     []func()
+	opsOpts pebble.IterOptions
 
 	// When filterMax is >0, this iterator filters out keys with suffixes
 	// outside of the range [filterMin, filterMax). Keys without suffixes are
@@ -68,13 +78,23 @@ type retryableIter struct {
 	// at the previous position.
 	rangeKeyChanged bool
 
+	// retried is set if the current positioning op was retried after an
+	// injected error. The retries reposition retryableIter.iter, so its
+	// RangeKeyChanged() is relative to the position of the last retry rather
+	// than to the position before the op, and rangeKeyChanged is used instead.
+	retried bool
+
 	// When a filter is set on the iterator, one positioning op from the
 	// perspective of a client of the retryableIter, may result in multiple
 	// intermediary positioning ops. This bool is set if the current positioning
 	// op is intermediate.
 	intermediatePosition bool
 
-	rkeyBuff []byte
+	// hadRangeKey, rkeyBuff and rkeyEndBuff hold the range key at the position
+	// before the current top level positioning op.
+	hadRangeKey bool
+	rkeyBuff    []byte
+	rkeyEndBuff []byte
 }
 
 func (i *retryableIter) shouldFilter() bool {
@@ -99,20 +119,52 @@ func (i *retryableIter) needRetry() bool {
 	return errors.Is(i.iter.Error(), errorfs.ErrInjected)
 }
 
-func (i *retryableIter) withRetry(fn func()) {
+// withRetry runs fn, an operation on i.iter, retrying it while it fails with
+// an injected error. The absolute positioning operations are simply run
+// again, while i.iter is reset to its pre-operation state before retrying the
+// relative ones.
+func (i *retryableIter) withRetry(absolute bool, fn func()) {
 	for {
 		fn()
 		if !i.needRetry() {
 			break
 		}
-		for i.needRetry() {
-			i.iter.SeekGE(i.lastKey)
+		i.retried = true
+		if !absolute {
+			i.reset()
 		}
 	}
 
-	i.lastKey = i.lastKey[:0]
-	if i.iter.Valid() {
-		i.lastKey = append(i.lastKey, i.iter.Key()...)
+	if absolute {
+		i.ops = append(i.ops[:0], fn)
+		i.opsOpts = i.opts
+	} else {
+		i.ops = append(i.ops, fn)
+	}
+}
+
+// reset replaces i.iter with a clone on which the operations since the last
+// absolute positioning operation are replayed, restoring the state of i.iter
+// after the last successful operation. The clone observes the same view of
+// the DB, and of the indexed batch, as i.iter.
+func (i *retryableIter) reset() {
+	for {
+		opts := i.opsOpts
+		clone, err := i.iter.Clone(pebble.CloneOptions{IterOptions: &opts})
+		if err != nil {
+			panic(err)
+		}
+		// The iterator failed with an injected error, which Close returns.
+		_ = i.iter.Close()
+		i.iter = clone
+		for _, op := range i.ops {
+			if op(); i.needRetry() {
+				break
+			}
+		}
+		if !i.needRetry() {
+			return
+		}
 	}
 }
 
@@ -138,30 +190,34 @@ func (i *retryableIter) withPosition(fn func()) {
 	}()
 
 	if !intermediate {
-		// Clear out the previous value stored in the buff.
+		// Clear out the previous value stored in the buffs.
 		i.rkeyBuff = i.rkeyBuff[:0]
-		if _, hasRange := i.iter.HasPointAndRange(); hasRange {
+		i.rkeyEndBuff = i.rkeyEndBuff[:0]
+		_, i.hadRangeKey = i.iter.HasPointAndRange()
+		if i.hadRangeKey {
 			// This is a top level positioning op. We should determine if the iter
 			// is positioned over a range key to later determine if the range key
 			// changed.
-			startTmp, _ := i.iter.RangeBounds()
+			startTmp, endTmp := i.iter.RangeBounds()
 			i.rkeyBuff = append(i.rkeyBuff, startTmp...)
-
+			i.rkeyEndBuff = append(i.rkeyEndBuff, endTmp...)
 		}
-		// Set this to false. Any positioning op can set this to true.
+		// Set these to false. Any positioning op can set them to true.
 		i.rangeKeyChangeGuess = false
+		i.retried = false
 	}
 
 	fn()
 
 	if !intermediate {
-		// Check if the range key changed.
-		var newStartKey []byte
-		if _, hasRange := i.iter.HasPointAndRange(); hasRange {
-			newStartKey, _ = i.iter.RangeBounds()
+		// Check if the range key changed, the same way pebble.Iterator does:
+		// stepping onto or off a range key, or onto one with different bounds.
+		_, hasRange := i.iter.HasPointAndRange()
+		i.rangeKeyChanged = hasRange != i.hadRangeKey
+		if hasRange && i.hadRangeKey {
+			start, end := i.iter.RangeBounds()
+			i.rangeKeyChanged = !bytes.Equal(start, i.rkeyBuff) || !bytes.Equal(end, i.rkeyEndBuff)
 		}
-
-		i.rangeKeyChanged = !bytes.Equal(newStartKey, i.rkeyBuff)
 	}
 }
 
@@ -172,7 +228,7 @@ func (i *retryableIter) updateRangeKeyChangedGuess() {
 func (i *retryableIter) First() bool {
 	var valid bool
 	i.withPosition(func() {
-		i.withRetry(func() {
+		i.withRetry(true /* absolute */, func() {
 			valid = i.iter.First()
 		})
 		i.updateRangeKeyChangedGuess()
@@ -188,6 +244,9 @@ func (i *retryableIter) Key() []byte {
 }
 
 func (i *retryableIter) RangeKeyChanged() bool {
+	if i.retried {
+		return i.rangeKeyChanged
+	}
 	if i.filterMax == 0 {
 		return i.iter.RangeKeyChanged()
 	}
@@ -217,7 +276,7 @@ func (i *retryableIter) RangeKeys() []pebble.RangeKeyData {
 func (i *retryableIter) Last() bool {
 	var valid bool
 	i.withPosition(func() {
-		i.withRetry(func() { valid = i.iter.Last() })
+		i.withRetry(true /* absolute */, func() { valid = i.iter.Last() })
 		i.updateRangeKeyChangedGuess()
 		if valid && i.shouldFilter() {
 			valid = i.Prev()
@@ -229,7 +288,7 @@ func (i *retryableIter) Last() bool {
 func (i *retryableIter) Next() bool {
 	var valid bool
 	i.withPosition(func() {
-		i.withRetry(func() {
+		i.withRetry(false /* absolute */, func() {
 			valid = i.iter.Next()
 			i.updateRangeKeyChangedGuess()
 			for valid && i.shouldFilter() {
@@ -244,7 +303,7 @@ func (i *retryableIter) Next() bool {
 func (i *retryableIter) NextWithLimit(limit []byte) pebble.IterValidityState {
 	var validity pebble.IterValidityState
 	i.withPosition(func() {
-		i.withRetry(func() {
+		i.withRetry(false /* absolute */, func() {
 			validity = i.iter.NextWithLimit(limit)
 			i.updateRangeKeyChangedGuess()
 			for validity == pebble.IterValid && i.shouldFilter() {
@@ -260,7 +319,7 @@ func (i *retryableIter) NextWithLimit(limit []byte) pebble.IterValidityState {
 func (i *retryableIter) NextPrefix() bool {
 	var valid bool
 	i.withPosition(func() {
-		i.withRetry(func() {
+		i.withRetry(false /* absolute */, func() {
 			valid = i.iter.NextPrefix()
 			i.updateRangeKeyChangedGuess()
 			for valid && i.shouldFilter() {
@@ -275,7 +334,7 @@ func (i *retryableIter) NextPrefix() bool {
 func (i *retryableIter) Prev() bool {
 	var valid bool
 	i.withPosition(func() {
-		i.withRetry(func() {
+		i.withRetry(false /* absolute */, func() {
 			valid = i.iter.Prev()
 			i.updateRangeKeyChangedGuess()
 			for valid && i.shouldFilter() {
@@ -290,7 +349,7 @@ func (i *retryableIter) Prev() bool {
 func (i *retryableIter) PrevWithLimit(limit []byte) pebble.IterValidityState {
 	var validity pebble.IterValidityState
 	i.withPosition(func() {
-		i.withRetry(func() {
+		i.withRetry(false /* absolute */, func() {
 			validity = i.iter.PrevWithLimit(limit)
 			i.updateRangeKeyChangedGuess()
 			for validity == pebble.IterValid && i.shouldFilter() {
@@ -305,7 +364,7 @@ func (i *retryableIter) PrevWithLimit(limit []byte) pebble.IterValidityState {
 func (i *retryableIter) SeekGE(key []byte) bool {
 	var valid bool
 	i.withPosition(func() {
-		i.withRetry(func() { valid = i.iter.SeekGE(key) })
+		i.withRetry(true /* absolute */, func() { valid = i.iter.SeekGE(key) })
 		i.updateRangeKeyChangedGuess()
 		if valid && i.shouldFilter() {
 			valid = i.Next()
@@ -317,7 +376,7 @@ func (i *retryableIter) SeekGE(key []byte) bool {
 func (i *retryableIter) SeekGEWithLimit(key []byte, limit []byte) pebble.IterValidityState {
 	var validity pebble.IterValidityState
 	i.withPosition(func() {
-		i.withRetry(func() { validity = i.iter.SeekGEWithLimit(key, limit) })
+		i.withRetry(true /* absolute */, func() { validity = i.iter.SeekGEWithLimit(key, limit) })
 		i.updateRangeKeyChangedGuess()
 		if validity == pebble.IterValid && i.shouldFilter() {
 			validity = i.NextWithLimit(limit)
@@ -329,7 +388,7 @@ func (i *retryableIter) SeekGEWithLimit(key []byte, limit []byte) pebble.IterVal
 func (i *retryableIter) SeekLT(key []byte) bool {
 	var valid bool
 	i.withPosition(func() {
-		i.withRetry(func() { valid = i.iter.SeekLT(key) })
+		i.withRetry(true /* absolute */, func() { valid = i.iter.SeekLT(key) })
 		i.updateRangeKeyChangedGuess()
 		if valid && i.shouldFilter() {
 			valid = i.Prev()
@@ -341,7 +400,7 @@ func (i *retryableIter) SeekLT(key []byte) bool {
 func (i *retryableIter) SeekLTWithLimit(key []byte, limit []byte) pebble.IterValidityState {
 	var validity pebble.IterValidityState
 	i.withPosition(func() {
-		i.withRetry(func() { validity = i.iter.SeekLTWithLimit(key, limit) })
+		i.withRetry(true /* absolute */, func() { validity = i.iter.SeekLTWithLimit(key, limit) })
 		i.updateRangeKeyChangedGuess()
 		if validity == pebble.IterValid && i.shouldFilter() {
 			validity = i.PrevWithLimit(limit)
@@ -353,7 +412,7 @@ func (i *retryableIter) SeekLTWithLimit(key []byte, limit []byte) pebble.IterVal
 func (i *retryableIter) SeekPrefixGE(key []byte) bool {
 	var valid bool
 	i.withPosition(func() {
-		i.withRetry(func() { valid = i.iter.SeekPrefixGE(key) })
+		i.withRetry(true /* absolute */, func() { valid = i.iter.SeekPrefixGE(key) })
 		i.updateRangeKeyChangedGuess()
 		if valid && i.shouldFilter() {
 			valid = i.Next()
@@ -364,10 +423,19 @@ func (i *retryableIter) SeekPrefixGE(key []byte) bool {
 
 func (i *retryableIter) SetBounds(lower, upper []byte) {
 	i.iter.SetBounds(lower, upper)
+	lower, upper = cloneBound(lower), cloneBound(upper)
+	i.opts.LowerBound, i.opts.UpperBound = lower, upper
+	i.ops = append(i.ops, func() { i.iter.SetBounds(lower, upper) })
 }
 
 func (i *retryableIter) SetOptions(opts *pebble.IterOptions) {
 	i.iter.SetOptions(opts)
+	// SetOptions may refresh the iterator's view of an indexed batch, so it
+	// can't be replayed. It requires an absolute positioning operation before
+	// the next relative one though, so the operations to replay start afresh.
+	i.opts = cloneIterOptions(opts)
+	i.opsOpts = i.opts
+	i.ops = i.ops[:0]
 }
 
 func (i *retryableIter) Valid() bool {
@@ -375,5 +443,34 @@ func (i *retryableIter) Valid() bool {
 }
 
 func (i *retryableIter) Value() []byte {
-	return i.iter.Value()
+	for {
+		// Retrieving a value stored out of line may fail, which leaves the
+		// error on the iterator, so it's reset before retrying.
+		val, err := i.iter.ValueAndErr()
+		if !errors.Is(err, errorfs.ErrInjected) {
+			return val
+		}
+		i.retried = true
+		i.reset()
+	}
+}
+
+// cloneIterOptions returns a copy of opts whose bounds don't alias those of
+// opts, which the test trashes after passing them to the iterator.
+func cloneIterOptions(opts *pebble.IterOptions) pebble.IterOptions {
+	var o pebble.IterOptions
+	if opts != nil {
+		o = *opts
+	}
+	o.LowerBound, o.UpperBound = cloneBound(o.LowerBound), cloneBound(o.UpperBound)
+	return o
+}
+
+// cloneBound returns a copy of the iterator bound b, preserving whether it's
+// nil.
+func cloneBound(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
 }
@@ -24,6 +24,10 @@ type test struct {
 	opsWaitOn [][]int         // op index -> op indexes
 	opsDone   []chan struct{} // op index -> done channel
 	idx       int
+	// orderReceivers is set when operations with the same receiver may run on
+	// different threads, requiring them to synchronize on one another (see
+	// RandomSchedule).
+	orderReceivers bool
 	// The DB the test is run on.
 	dir       string
 	db        *pebble.DB
@@ -63,7 +67,7 @@ func (t *test) init(h *history, dir string, testOpts *testOptions) error {
 		})
 	}
 
-	t.opsWaitOn, t.opsDone = computeSynchronizationPoints(t.ops)
+	t.opsWaitOn, t.opsDone = computeSynchronizationPoints(t.ops, t.orderReceivers)
 
 	defer t.opts.Cache.Unref()
 
@@ -73,9 +77,14 @@ func (t *test) init(h *history, dir string, testOpts *testOptions) error {
 	// difference between in-memory and on-disk which causes different code paths
 	// and timings to be exercised.
 	maybeExit := func(err error) {
-		if err == nil || errors.Is(err, errorfs.ErrInjected) {
+		if err == nil {
 			return
 		}
+		if errors.Is(err, errorfs.ErrInjected) {
+			if err = checkInjectedError(err); err == nil {
+				return
+			}
+		}
 		t.maybeSaveData()
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -221,13 +230,16 @@ func (t *test) setBatch(id objID, b *pebble.Batch) {
 	t.batches[id.slot()] = b
 }
 
-func (t *test) setIter(id objID, i *pebble.Iterator, filterMin, filterMax uint64) {
+func (t *test) setIter(
+	id objID, i *pebble.Iterator, opts pebble.IterOptions, filterMin, filterMax uint64,
+) {
 	if id.tag() != iterTag {
 		panic(fmt.Sprintf("invalid iter ID: %s", id))
 	}
 	t.iters[id.slot()] = &retryableIter{
 		iter:      i,
-		lastKey:   nil,
+		opts:      opts,
+		opsOpts:   opts,
 		filterMin: filterMin,
 		filterMax: filterMax,
 	}
@@ -313,7 +325,12 @@ func (t *test) getWriter(id objID) pebble.Writer {
 // opsDone: the channel at index i must be closed when the operation at index i
 // completes. This slice is sparse. Operations that are never used as
 // synchronization points may have a nil channel.
-func computeSynchronizationPoints(ops []op) (opsWaitOn [][]int, opsDone []chan struct{}) {
+//
+// If orderReceivers is false, operations with the same receiver are assumed to
+// be performed on the same thread and don't synchronize on one another.
+func computeSynchronizationPoints(
+	ops []op, orderReceivers bool,
+) (opsWaitOn [][]int, opsDone []chan struct{}) {
 	opsDone = make([]chan struct{}, len(ops)) // operation index -> done channel
 	opsWaitOn = make([][]int, len(ops))       // operation index -> operation index
 	lastOpReference := make(map[objID]int)    // objID -> operation index
@@ -334,11 +351,11 @@ func computeSynchronizationPoints(ops []op) (opsWaitOn [][]int, opsDone []chan s
 		}
 
 		// The last operation that referenced `receiver` is the one at index
-		// `waitIndex`. All operations with the same receiver are performed on
-		// the same thread. We only need to synchronize on the operation at
-		// `waitIndex` if `receiver` isn't also the receiver on that operation
-		// too.
-		if ops[waitIndex].receiver() != receiver {
+		// `waitIndex`. Unless orderReceivers is set, all operations with the
+		// same receiver are performed on the same thread, and we only need to
+		// synchronize on the operation at `waitIndex` if `receiver` isn't also
+		// the receiver on that operation too.
+		if orderReceivers || ops[waitIndex].receiver() != receiver {
 			opsWaitOn[i] = append(opsWaitOn[i], waitIndex)
 		}
 
@@ -217,7 +217,15 @@ func (i *scanInternalIterator) constructRangeKeyIter() {
 		spanIterOpts := &keyspan.SpanIterOptions{RangeKeyFilters: i.opts.RangeKeyFilters}
 		spanIter, err := i.newIterRangeKey(f, spanIterOpts)
 		if err != nil {
-			i.rangeKey.iterConfig.AddLevel(&errorKeyspanIter{err: err})
+			// Fall back to a level iterator over this file alone, which
+			// surfaces the error and retries opening the file when it's
+			// repositioned, rather than failing every later operation. The
+			// level iterator requires a key-sorted slice, unlike the L0 one.
+			files := manifest.NewLevelSliceKeySorted(i.comparer.Compare, []*manifest.FileMetadata{f})
+			li := i.rangeKey.iterConfig.NewLevelIter()
+			li.Init(*spanIterOpts, i.comparer.Compare, i.newIterRangeKey, files.Iter(),
+				manifest.Level(0), manifest.KeyTypeRange)
+			i.rangeKey.iterConfig.AddLevel(li)
 			continue
 		}
 		i.rangeKey.iterConfig.AddLevel(spanIter)
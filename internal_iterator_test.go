@@ -87,6 +87,12 @@ func TestScanInternal(t *testing.T) {
 				for i := range opts.Levels {
 					opts.Levels[i].FilterPolicy = fp
 				}
+			case "history-retention-seqnums":
+				v, err := strconv.ParseUint(cmdArg.Vals[0], 10, 64)
+				if err != nil {
+					return nil, err
+				}
+				opts.Experimental.HistoryRetentionSeqNums = v
 			case "merger":
 				switch cmdArg.Vals[0] {
 				case "appender":
@@ -226,6 +226,9 @@ type Iterator struct {
 	readSampling        readSampling
 	stats               IteratorStats
 	externalReaders     [][]*sstable.Reader
+	// yieldBlockBytes is the value of stats.InternalStats.BlockBytes when
+	// IterOptions.Yield was last called.
+	yieldBlockBytes uint64
 
 	// Following fields used when constructing an iterator stack, eg, in Clone
 	// and SetOptions or when re-fragmenting a batch's range keys/range dels.
@@ -617,6 +620,12 @@ func (i *Iterator) findNextEntry(limit []byte) {
 			return
 		}
 	}
+
+	// Is iterKey nil due to an error?
+	if err := i.iter.Error(); err != nil {
+		i.err = err
+		i.iterValidityState = IterExhausted
+	}
 }
 
 func (i *Iterator) nextPointCurrentUserKey() bool {
@@ -624,7 +633,12 @@ func (i *Iterator) nextPointCurrentUserKey() bool {
 
 	i.iterKey, i.iterValue = i.iter.Next()
 	i.stats.ForwardStepCount[InternalIterCall]++
-	if i.iterKey == nil || !i.equal(i.key, i.iterKey.UserKey) {
+	if i.iterKey == nil {
+		if i.err = i.iter.Error(); i.err == nil {
+			i.pos = iterPosNext
+		}
+		return false
+	} else if !i.equal(i.key, i.iterKey.UserKey) {
 		i.pos = iterPosNext
 		return false
 	}
@@ -733,6 +747,26 @@ func (i *Iterator) nextUserKey() {
 	}
 }
 
+// maybeYield calls IterOptions.Yield if the iterator loaded at least
+// IterOptions.YieldBytes of blocks since the previous call. Like
+// maybeSampleRead, it's called when a public positioning method of Iterator is
+// returning. If Yield returns an error, the iterator is invalidated with that
+// error.
+func (i *Iterator) maybeYield() {
+	if i.opts.Yield == nil || i.opts.YieldBytes == 0 {
+		return
+	}
+	if i.stats.InternalStats.BlockBytes < i.yieldBlockBytes+i.opts.YieldBytes {
+		return
+	}
+	i.yieldBlockBytes = i.stats.InternalStats.BlockBytes
+	if err := i.opts.Yield(); err != nil {
+		i.err = err
+		i.iterValidityState = IterExhausted
+		i.lastPositioningOp = unknownLastPositionOp
+	}
+}
+
 func (i *Iterator) maybeSampleRead() {
 	// This method is only called when a public method of Iterator is
 	// returning, and below we exclude the case were the iterator is paused at
@@ -1037,6 +1071,13 @@ func (i *Iterator) findPrevEntry(limit []byte) {
 	}
 
 	// i.iterKey == nil, so broke out of the preceding loop.
+
+	// Is iterKey nil due to an error? If so, the value merged so far may be
+	// missing newer operands.
+	if i.err = i.iter.Error(); i.err != nil {
+		i.iterValidityState = IterExhausted
+		return
+	}
 	if i.iterValidityState == IterValid {
 		i.pos = iterPosPrev
 		if valueMerger != nil {
@@ -1088,7 +1129,11 @@ func (i *Iterator) mergeNext(key InternalKey, valueMerger ValueMerger) {
 		i.iterKey, i.iterValue = i.iter.Next()
 		i.stats.ForwardStepCount[InternalIterCall]++
 		if i.iterKey == nil {
-			i.pos = iterPosNext
+			// The iterator may be exhausted due to an error, in which case
+			// the older operands of the key are missing.
+			if i.err = i.iter.Error(); i.err == nil {
+				i.pos = iterPosNext
+			}
 			return
 		}
 		key = *i.iterKey
@@ -1264,6 +1309,7 @@ func (i *Iterator) SeekGEWithLimit(key []byte, limit []byte) IterValidityState {
 	}
 	i.findNextEntry(limit)
 	i.maybeSampleRead()
+	i.maybeYield()
 	if i.Error() == nil {
 		// Prepare state for a future noop optimization.
 		i.prefixOrFullSeekKey = append(i.prefixOrFullSeekKey[:0], key...)
@@ -1418,6 +1464,7 @@ func (i *Iterator) SeekPrefixGE(key []byte) bool {
 	i.stats.ForwardSeekCount[InternalIterCall]++
 	i.findNextEntry(nil)
 	i.maybeSampleRead()
+	i.maybeYield()
 	if i.Error() == nil {
 		i.lastPositioningOp = seekPrefixGELastPositioningOp
 	}
@@ -1518,6 +1565,7 @@ func (i *Iterator) SeekLTWithLimit(key []byte, limit []byte) IterValidityState {
 	}
 	i.findPrevEntry(limit)
 	i.maybeSampleRead()
+	i.maybeYield()
 	if i.Error() == nil && i.batch == nil {
 		// Prepare state for a future noop optimization.
 		i.prefixOrFullSeekKey = append(i.prefixOrFullSeekKey[:0], key...)
@@ -1555,6 +1603,7 @@ func (i *Iterator) First() bool {
 	i.iterFirstWithinBounds()
 	i.findNextEntry(nil)
 	i.maybeSampleRead()
+	i.maybeYield()
 	return i.iterValidityState == IterValid
 }
 
@@ -1587,6 +1636,7 @@ func (i *Iterator) Last() bool {
 	i.iterLastWithinBounds()
 	i.findPrevEntry(nil)
 	i.maybeSampleRead()
+	i.maybeYield()
 	return i.iterValidityState == IterValid
 }
 
@@ -1707,9 +1757,10 @@ func (i *Iterator) nextPrefix() IterValidityState {
 			// Move the internal iterator back onto the user key stored in
 			// i.key. iterPosPrev guarantees that it's positioned at the last
 			// key with the user key less than i.key, so we're guaranteed to
-			// land on the correct key with a single Next.
+			// land on the correct key with a single Next. The Next only fails
+			// to find a key if it errors, and findNextEntry surfaces the error.
 			i.iterKey, i.iterValue = i.iter.Next()
-			if invariants.Enabled && !i.equal(i.iterKey.UserKey, i.key) {
+			if invariants.Enabled && i.iterKey != nil && !i.equal(i.iterKey.UserKey, i.key) {
 				i.opts.logger.Fatalf("pebble: invariant violation: Nexting internal iterator from iterPosPrev landed on %q, not %q",
 					i.iterKey.UserKey, i.key)
 			}
@@ -1732,6 +1783,7 @@ func (i *Iterator) nextPrefix() IterValidityState {
 	i.stats.ForwardStepCount[InterfaceCall]++
 	i.findNextEntry(nil /* limit */)
 	i.maybeSampleRead()
+	i.maybeYield()
 	return i.iterValidityState
 }
 
@@ -1845,6 +1897,7 @@ func (i *Iterator) nextWithLimit(limit []byte) IterValidityState {
 	}
 	i.findNextEntry(limit)
 	i.maybeSampleRead()
+	i.maybeYield()
 	return i.iterValidityState
 }
 
@@ -1943,6 +1996,7 @@ func (i *Iterator) PrevWithLimit(limit []byte) IterValidityState {
 	}
 	i.findPrevEntry(limit)
 	i.maybeSampleRead()
+	i.maybeYield()
 	return i.iterValidityState
 }
 
@@ -2216,6 +2270,7 @@ func (i *Iterator) Close() error {
 			}
 		}
 
+		atomic.AddInt64(&i.readState.db.atomic.iterCount, -1)
 		i.readState.unref()
 		i.readState = nil
 	}
@@ -2600,6 +2655,7 @@ func (i *Iterator) Metrics() IteratorMetrics {
 // ResetStats resets the stats to 0.
 func (i *Iterator) ResetStats() {
 	i.stats = IteratorStats{}
+	i.yieldBlockBytes = 0
 }
 
 // Stats returns the current stats.
@@ -2656,6 +2712,7 @@ func (i *Iterator) CloneWithContext(ctx context.Context, opts CloneOptions) (*It
 	}
 	// i is already holding a ref, so there is no race with unref here.
 	readState.ref()
+	atomic.AddInt64(&readState.db.atomic.iterCount, 1)
 	// Bundle various structures under a single umbrella in order to allocate
 	// them together.
 	buf := iterAllocPool.Get().(*iterAlloc)
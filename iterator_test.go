@@ -1539,12 +1539,29 @@ func TestIteratorGuaranteedDurable(t *testing.T) {
 		iter := reader.NewIter(&iterOptions)
 		defer iter.Close()
 	}
-	t.Run("snapshot", func(t *testing.T) {
-		failFunc(t, d.NewSnapshot())
-	})
 	t.Run("batch", func(t *testing.T) {
 		failFunc(t, d.NewIndexedBatch())
 	})
+	t.Run("snapshot", func(t *testing.T) {
+		require.NoError(t, d.Set([]byte("b1"), []byte("v"), nil))
+		s := d.NewSnapshot()
+		defer s.Close()
+		require.NoError(t, d.Set([]byte("b2"), []byte("v"), nil))
+		foundKV := func(key string, o *IterOptions) bool {
+			iter := s.NewIter(o)
+			defer iter.Close()
+			return iter.SeekGE([]byte(key)) && string(iter.Key()) == key
+		}
+		// The snapshot's write of b1 isn't yet durable.
+		require.True(t, foundKV("b1", nil))
+		require.False(t, foundKV("b1", &iterOptions))
+		// Once flushed, the snapshot's writes are durable, and the writes
+		// after the snapshot remain invisible.
+		require.NoError(t, d.Flush())
+		require.True(t, foundKV("b1", &iterOptions))
+		require.False(t, foundKV("b2", &iterOptions))
+		require.False(t, foundKV("b2", nil))
+	})
 	t.Run("db", func(t *testing.T) {
 		d.Set([]byte("k"), []byte("v"), nil)
 		foundKV := func(o *IterOptions) bool {
@@ -1700,6 +1717,59 @@ func TestIteratorBoundsLifetimes(t *testing.T) {
 	})
 }
 
+func TestIteratorYield(t *testing.T) {
+	opts := &Options{FS: vfs.NewMem()}
+	opts.Levels = []LevelOptions{{BlockSize: 1 << 10}}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	const n = 1000
+	value := bytes.Repeat([]byte("v"), 100)
+	for i := 0; i < n; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%04d", i)), value, nil))
+	}
+	require.NoError(t, d.Flush())
+
+	var yields int
+	var yieldErr error
+	iter := d.NewIter(&IterOptions{
+		YieldBytes: 16 << 10,
+		Yield: func() error {
+			yields++
+			return yieldErr
+		},
+	})
+	var count int
+	for valid := iter.First(); valid; valid = iter.Next() {
+		count++
+	}
+	require.NoError(t, iter.Error())
+	require.Equal(t, n, count)
+	blockBytes := iter.Stats().InternalStats.BlockBytes
+	require.Equal(t, int(blockBytes/(16<<10)), yields)
+
+	// An error returned by Yield stops the scan, which may be resumed by a
+	// seek.
+	yields = 0
+	yieldErr = errors.New("yield")
+	count = 0
+	valid := iter.First()
+	for ; valid; valid = iter.Next() {
+		count++
+	}
+	require.Equal(t, yieldErr, iter.Error())
+	require.Equal(t, 1, yields)
+	require.Less(t, count, n)
+	yieldErr = nil
+	for valid = iter.SeekGE([]byte(fmt.Sprintf("k%04d", count))); valid; valid = iter.Next() {
+		count++
+	}
+	require.NoError(t, iter.Error())
+	require.Equal(t, n, count)
+	require.NoError(t, iter.Close())
+}
+
 func TestIteratorStatsMerge(t *testing.T) {
 	s := IteratorStats{
 		ForwardSeekCount: [NumStatsKind]int{1, 2},
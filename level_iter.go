@@ -761,6 +761,9 @@ func (l *levelIter) SeekPrefixGE(
 	if key, val := l.iter.SeekPrefixGE(prefix, key, flags); key != nil {
 		return l.verify(key, val)
 	}
+	if l.iter.Error() != nil {
+		return nil, base.LazyValue{}
+	}
 	// When SeekPrefixGE returns nil, we have not necessarily reached the end of
 	// the sstable. All we know is that a key with prefix does not exist in the
 	// current sstable. We do know that the key lies within the bounds of the
@@ -1007,6 +1010,11 @@ func (l *levelIter) skipEmptyFileForward() (*InternalKey, base.LazyValue) {
 	// that key, else the behavior described above if there is a corresponding
 	// rangeDelIterPtr.
 	for ; key == nil; key, val = l.iter.First() {
+		if l.iter.Error() != nil {
+			// The iterator was exhausted due to an error, which moving to the
+			// next file would lose.
+			return nil, base.LazyValue{}
+		}
 		if l.rangeDelIterPtr != nil {
 			// We're being used as part of a mergingIter and we've exhausted the
 			// current sstable. If an upper bound is present and the upper bound lies
@@ -1097,6 +1105,11 @@ func (l *levelIter) skipEmptyFileBackward() (*InternalKey, base.LazyValue) {
 	// that key, else the behavior described above if there is a corresponding
 	// rangeDelIterPtr.
 	for ; key == nil; key, val = l.iter.Last() {
+		if l.iter.Error() != nil {
+			// The iterator was exhausted due to an error, which moving to the
+			// previous file would lose.
+			return nil, base.LazyValue{}
+		}
 		if l.rangeDelIterPtr != nil {
 			// We're being used as part of a mergingIter and we've exhausted the
 			// current sstable. If a lower bound is present and the lower bound lies
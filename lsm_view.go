@@ -0,0 +1,136 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// LSMViewSchemaVersion is the version of the JSON schema produced by
+// LSMView.JSON. The version is incremented whenever a backwards incompatible
+// change is made to the schema. Fields may be added without incrementing the
+// version.
+const LSMViewSchemaVersion = 1
+
+// LSMView describes the structure of the LSM: the sstables within each level,
+// along with their bounds, sizes and sequence number ranges. An LSMView has a
+// stable JSON encoding (see LSMView.JSON), allowing external tooling to render
+// the shape of the LSM without parsing the output of Metrics.String.
+type LSMView struct {
+	// SchemaVersion is the value of LSMViewSchemaVersion at the time the view
+	// was constructed.
+	SchemaVersion int `json:"schema_version"`
+	// Comparer is the name of the Comparer used to order the keys within the
+	// view.
+	Comparer string `json:"comparer"`
+	// Levels holds one entry for every level of the LSM, indexed by level.
+	Levels []LSMLevelView `json:"levels"`
+}
+
+// LSMLevelView describes a single level of the LSM.
+type LSMLevelView struct {
+	// Level is the level of the LSM, with 0 being the top-most level.
+	Level int `json:"level"`
+	// Sublevels is the number of L0 sublevels. It's only set for L0.
+	Sublevels int `json:"sublevels,omitempty"`
+	// NumFiles is the number of sstables within the level.
+	NumFiles int `json:"num_files"`
+	// Size is the total size of the sstables within the level, in bytes.
+	Size uint64 `json:"size"`
+	// Files holds the sstables within the level in key order. L0 files are
+	// ordered by sequence number, oldest first.
+	Files []LSMFileView `json:"files"`
+}
+
+// LSMFileView describes a single sstable within the LSM.
+type LSMFileView struct {
+	// FileNum is the file number of the sstable.
+	FileNum uint64 `json:"file_num"`
+	// Size is the size of the sstable, in bytes.
+	Size uint64 `json:"size"`
+	// Smallest and Largest are the bounds of the sstable, formatted using the
+	// Comparer's FormatKey function.
+	Smallest string `json:"smallest"`
+	Largest  string `json:"largest"`
+	// SmallestKey and LargestKey are the raw user keys of the bounds of the
+	// sstable. They're encoded as base64 strings in JSON.
+	SmallestKey []byte `json:"smallest_key"`
+	LargestKey  []byte `json:"largest_key"`
+	// SmallestSeqNum and LargestSeqNum are the bounds of the range of sequence
+	// numbers of the keys within the sstable.
+	SmallestSeqNum uint64 `json:"smallest_seqnum"`
+	LargestSeqNum  uint64 `json:"largest_seqnum"`
+	// Sublevel is the L0 sublevel of the file. It's only set for L0 files.
+	Sublevel int `json:"sublevel,omitempty"`
+	// Virtual indicates whether the sstable is virtual.
+	Virtual bool `json:"virtual,omitempty"`
+}
+
+// JSON returns the encoding of the view using the stable JSON schema.
+func (v *LSMView) JSON() []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		// The view is composed of simple types that always marshal
+		// successfully.
+		panic(err)
+	}
+	return b
+}
+
+// LSMView returns a description of the current structure of the LSM. Note that
+// this information may be out of date due to concurrent flushes and
+// compactions.
+func (d *DB) LSMView() *LSMView {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+
+	// Grab and reference the current readState.
+	readState := d.loadReadState()
+	defer readState.unref()
+
+	formatKey := d.opts.Comparer.FormatKey
+	if formatKey == nil {
+		formatKey = base.DefaultFormatter
+	}
+	current := readState.current
+	view := &LSMView{
+		SchemaVersion: LSMViewSchemaVersion,
+		Comparer:      d.opts.Comparer.Name,
+		Levels:        make([]LSMLevelView, len(current.Levels)),
+	}
+	for level := range current.Levels {
+		lv := &view.Levels[level]
+		lv.Level = level
+		if level == 0 {
+			lv.Sublevels = len(current.L0SublevelFiles)
+		}
+		lv.NumFiles = current.Levels[level].Len()
+		lv.Files = make([]LSMFileView, 0, lv.NumFiles)
+		iter := current.Levels[level].Iter()
+		for m := iter.First(); m != nil; m = iter.Next() {
+			fv := LSMFileView{
+				FileNum:        uint64(m.FileNum),
+				Size:           m.Size,
+				Smallest:       fmt.Sprint(formatKey(m.Smallest.UserKey)),
+				Largest:        fmt.Sprint(formatKey(m.Largest.UserKey)),
+				SmallestKey:    m.Smallest.UserKey,
+				LargestKey:     m.Largest.UserKey,
+				SmallestSeqNum: m.SmallestSeqNum,
+				LargestSeqNum:  m.LargestSeqNum,
+				Virtual:        m.Virtual,
+			}
+			if level == 0 {
+				fv.Sublevel = m.SubLevel
+			}
+			lv.Size += m.Size
+			lv.Files = append(lv.Files, fv)
+		}
+	}
+	return view
+}
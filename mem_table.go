@@ -24,18 +24,36 @@ func memTableEntrySize(keyBytes, valueBytes int) uint64 {
 	return arenaskl.MaxNodeSize(uint32(keyBytes)+8, uint32(valueBytes))
 }
 
-// memTableEmptySize is the amount of allocated space in the arena when the
-// memtable is empty.
-var memTableEmptySize = func() uint32 {
-	var pointSkl arenaskl.Skiplist
+// memTableEmptySize returns the amount of allocated space in the arena when
+// the memtable is empty, with the point keys sharded across the specified
+// number of skiplists.
+func memTableEmptySize(shards int) uint32 {
+	if shards < 1 {
+		shards = 1
+	}
 	var rangeDelSkl arenaskl.Skiplist
 	var rangeKeySkl arenaskl.Skiplist
-	arena := arenaskl.NewArena(make([]byte, 16<<10 /* 16 KB */))
-	pointSkl.Reset(arena, bytes.Compare)
+	size := uint64(2*(shards+2))*arenaskl.MaxNodeSize(0, 0) + 1<<10
+	arena := arenaskl.NewArena(make([]byte, size))
+	newMemTablePoints(arena, nil, bytes.Compare, nil, shards)
 	rangeDelSkl.Reset(arena, bytes.Compare)
 	rangeKeySkl.Reset(arena, bytes.Compare)
 	return arena.Size()
-}()
+}
+
+// memTableShards returns the number of skiplists indexing the point keys of a
+// memtable of the specified size, given the configured number of shards (see
+// Options.Experimental.MemTableShards). The number of shards is reduced for
+// small memtables, so that the empty skiplists take up at most a quarter of
+// the arena.
+func memTableShards(size, shards int) int {
+	for ; shards > 1; shards /= 2 {
+		if uint64(2*(shards+2))*arenaskl.MaxNodeSize(0, 0) <= uint64(size)/4 {
+			break
+		}
+	}
+	return shards
+}
 
 // A memTable implements an in-memory layer of the LSM. A memTable is mutable,
 // but append-only. Records are added, but never removed. Deletion is supported
@@ -47,7 +65,9 @@ var memTableEmptySize = func() uint32 {
 // Options.MemTableSize). A memTable's memory consumption is thus fixed at the
 // time of creation (with the exception of the cached fragmented range
 // tombstones). The arena-backed skiplist provides both forward and reverse
-// links which makes forward and reverse iteration the same speed.
+// links which makes forward and reverse iteration the same speed. The point
+// keys may instead be sharded across several skiplists sharing the arena (see
+// Options.Experimental.MemTableShards).
 //
 // A batch is "applied" to a memTable in a two step process: prepare(batch) ->
 // apply(batch). memTable.prepare() is not thread-safe and must be called with
@@ -67,7 +87,8 @@ type memTable struct {
 	formatKey   base.FormatKey
 	equal       Equal
 	arenaBuf    []byte
-	skl         arenaskl.Skiplist
+	arena       *arenaskl.Arena
+	points      memTablePoints
 	rangeDelSkl arenaskl.Skiplist
 	rangeKeySkl arenaskl.Skiplist
 	// reserved tracks the amount of space used by the memtable, both by actual
@@ -86,6 +107,9 @@ type memTable struct {
 	// The current logSeqNum at the time the memtable was created. This is
 	// guaranteed to be less than or equal to any seqnum stored in the memtable.
 	logSeqNum uint64
+	// emptySize is the amount of allocated space in the arena when the
+	// memtable is empty (see memTableEmptySize).
+	emptySize uint32
 }
 
 // memTableOptions holds configuration used when creating a memTable. All of
@@ -139,10 +163,12 @@ func newMemTable(opts memTableOptions) *memTable {
 		m.arenaBuf = make([]byte, opts.size)
 	}
 
-	arena := arenaskl.NewArena(m.arenaBuf)
-	m.skl.Reset(arena, m.cmp)
-	m.rangeDelSkl.Reset(arena, m.cmp)
-	m.rangeKeySkl.Reset(arena, m.cmp)
+	m.arena = arenaskl.NewArena(m.arenaBuf)
+	m.points = newMemTablePoints(m.arena, opts.Logger, m.cmp, opts.Comparer.Split,
+		memTableShards(opts.size, opts.Experimental.MemTableShards))
+	m.rangeDelSkl.Reset(m.arena, m.cmp)
+	m.rangeKeySkl.Reset(m.arena, m.cmp)
+	m.emptySize = m.arena.Size()
 	return m
 }
 
@@ -189,7 +215,7 @@ func (m *memTable) apply(batch *Batch, seqNum uint64) error {
 			errors.Safe(seqNum), errors.Safe(m.logSeqNum))
 	}
 
-	var ins arenaskl.Inserter
+	var ins memTablePointsInserter
 	var tombstoneCount, rangeKeyCount uint32
 	startSeqNum := seqNum
 	for r := batch.Reader(); ; seqNum++ {
@@ -206,14 +232,17 @@ func (m *memTable) apply(batch *Batch, seqNum uint64) error {
 		case InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete:
 			err = m.rangeKeySkl.Add(ikey, value)
 			rangeKeyCount++
-		case InternalKeyKindLogData:
-			// Don't increment seqNum for LogData, since these are not applied
+		case InternalKeyKindLogData, InternalKeyKindPrepareTxn, InternalKeyKindCommitTxn,
+			InternalKeyKindRollbackTxn, InternalKeyKindBatchChunk, InternalKeyKindCommitChunks,
+			InternalKeyKindIdempotencyToken:
+			// Don't increment seqNum for LogData, two-phase commit and chunked
+			// commit markers or idempotency tokens, since these are not applied
 			// to the memtable.
 			seqNum--
 		case InternalKeyKindIngestSST:
 			panic("pebble: cannot apply ingested sstable key kind to memtable")
 		default:
-			err = ins.Add(&m.skl, ikey, value)
+			err = m.points.add(&ins, ikey, value)
 		}
 		if err != nil {
 			return err
@@ -236,11 +265,17 @@ func (m *memTable) apply(batch *Batch, seqNum uint64) error {
 // return false). The iterator can be positioned via a call to SeekGE,
 // SeekLT, First or Last.
 func (m *memTable) newIter(o *IterOptions) internalIterator {
-	return m.skl.NewIter(o.GetLowerBound(), o.GetUpperBound())
+	return m.points.newIter(o.GetLowerBound(), o.GetUpperBound())
+}
+
+// newGetIter returns an iterator for the lookup of the point keys with the
+// user key userKey, which may not surface any other user key.
+func (m *memTable) newGetIter(userKey []byte) internalIterator {
+	return m.points.newGetIter(userKey)
 }
 
 func (m *memTable) newFlushIter(o *IterOptions, bytesFlushed *uint64) internalIterator {
-	return m.skl.NewFlushIter(bytesFlushed)
+	return m.points.newFlushIter(bytesFlushed)
 }
 
 func (m *memTable) newRangeDelIter(*IterOptions) keyspan.FragmentIterator {
@@ -264,7 +299,7 @@ func (m *memTable) containsRangeKeys() bool {
 }
 
 func (m *memTable) availBytes() uint32 {
-	a := m.skl.Arena()
+	a := m.arena
 	if atomic.LoadInt32(&m.writerRefs) == 1 {
 		// If there are no other concurrent apply operations, we can update the
 		// reserved bytes setting to accurately reflect how many bytes of been
@@ -275,16 +310,16 @@ func (m *memTable) availBytes() uint32 {
 }
 
 func (m *memTable) inuseBytes() uint64 {
-	return uint64(m.skl.Size() - memTableEmptySize)
+	return uint64(m.arena.Size() - m.emptySize)
 }
 
 func (m *memTable) totalBytes() uint64 {
-	return uint64(m.skl.Arena().Capacity())
+	return uint64(m.arena.Capacity())
 }
 
 // empty returns whether the MemTable has no key/value pairs.
 func (m *memTable) empty() bool {
-	return m.skl.Size() == memTableEmptySize
+	return m.arena.Size() == m.emptySize
 }
 
 // A keySpanFrags holds a set of fragmented keyspan.Spans with a particular key
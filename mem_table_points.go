@@ -0,0 +1,242 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/pebble/internal/arenaskl"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// memTablePoints indexes the point keys of a memTable. Its nodes are allocated
+// in the memTable's arena. It is safe to call add concurrently with itself and
+// with the iterators over the index.
+type memTablePoints interface {
+	// add adds the key and value to the index. The inserter caches the
+	// position of the previous insertion performed with it, which speeds up
+	// insertions of increasing keys.
+	add(ins *memTablePointsInserter, key InternalKey, value []byte) error
+	// newIter returns an iterator over the point keys within [lower, upper).
+	newIter(lower, upper []byte) internalIterator
+	// newGetIter returns an iterator for the lookup of the point keys with the
+	// user key userKey. The iterator may not surface any other user key.
+	newGetIter(userKey []byte) internalIterator
+	// newFlushIter returns an iterator over all the point keys, which adds the
+	// size of the iterated nodes to bytesFlushed.
+	newFlushIter(bytesFlushed *uint64) internalIterator
+}
+
+// memTablePointsInserter holds the insertion state of a single writer to a
+// memTablePoints.
+type memTablePointsInserter struct {
+	ins arenaskl.Inserter
+	// shards holds an inserter per shard of a memTableShardedPoints, and is
+	// allocated on the first insertion.
+	shards []arenaskl.Inserter
+}
+
+// newMemTablePoints returns the point key index of a memtable with the
+// specified number of shards, whose nodes are allocated in the arena.
+func newMemTablePoints(
+	arena *arenaskl.Arena, logger Logger, cmp Compare, split Split, shards int,
+) memTablePoints {
+	if shards <= 1 {
+		p := &memTableSkiplistPoints{}
+		p.skl.Reset(arena, cmp)
+		return p
+	}
+	p := &memTableShardedPoints{
+		logger: logger,
+		cmp:    cmp,
+		split:  split,
+		shards: make([]arenaskl.Skiplist, shards),
+	}
+	for i := range p.shards {
+		p.shards[i].Reset(arena, cmp)
+	}
+	return p
+}
+
+// memTableSkiplistPoints indexes point keys in a single skiplist. It's the
+// default memTablePoints.
+type memTableSkiplistPoints struct {
+	skl arenaskl.Skiplist
+}
+
+var _ memTablePoints = (*memTableSkiplistPoints)(nil)
+
+func (p *memTableSkiplistPoints) add(
+	ins *memTablePointsInserter, key InternalKey, value []byte,
+) error {
+	return ins.ins.Add(&p.skl, key, value)
+}
+
+func (p *memTableSkiplistPoints) newIter(lower, upper []byte) internalIterator {
+	return p.skl.NewIter(lower, upper)
+}
+
+func (p *memTableSkiplistPoints) newGetIter(userKey []byte) internalIterator {
+	return p.skl.NewIter(nil, nil)
+}
+
+func (p *memTableSkiplistPoints) newFlushIter(bytesFlushed *uint64) internalIterator {
+	return p.skl.NewFlushIter(bytesFlushed)
+}
+
+// memTableShardedPoints indexes point keys in several skiplists, each holding
+// the keys whose prefix (see Comparer.Split) hashes to it. Sharding reduces
+// the contention between concurrent writers, and speeds up point lookups at
+// the expense of iteration, which merges the shards.
+type memTableShardedPoints struct {
+	logger Logger
+	cmp    Compare
+	split  Split
+	shards []arenaskl.Skiplist
+}
+
+var _ memTablePoints = (*memTableShardedPoints)(nil)
+
+// shard returns the index of the shard holding the keys with the user key
+// userKey.
+func (p *memTableShardedPoints) shard(userKey []byte) int {
+	if p.split != nil {
+		userKey = userKey[:p.split(userKey)]
+	}
+	// FNV-1a.
+	h := uint32(2166136261)
+	for _, c := range userKey {
+		h ^= uint32(c)
+		h *= 16777619
+	}
+	return int(h % uint32(len(p.shards)))
+}
+
+func (p *memTableShardedPoints) add(
+	ins *memTablePointsInserter, key InternalKey, value []byte,
+) error {
+	if ins.shards == nil {
+		ins.shards = make([]arenaskl.Inserter, len(p.shards))
+	}
+	i := p.shard(key.UserKey)
+	return ins.shards[i].Add(&p.shards[i], key, value)
+}
+
+func (p *memTableShardedPoints) newIter(lower, upper []byte) internalIterator {
+	it := &memTableShardedIter{
+		points: p,
+		iters:  make([]internalIterator, len(p.shards)),
+	}
+	for i := range p.shards {
+		it.iters[i] = p.shards[i].NewIter(lower, upper)
+	}
+	it.merging = newMergingIter(p.logger, &it.stats, p.cmp, p.split, it.iters...)
+	it.cur = it.merging
+	return it
+}
+
+func (p *memTableShardedPoints) newGetIter(userKey []byte) internalIterator {
+	return p.shards[p.shard(userKey)].NewIter(nil, nil)
+}
+
+func (p *memTableShardedPoints) newFlushIter(bytesFlushed *uint64) internalIterator {
+	iters := make([]internalIterator, len(p.shards))
+	for i := range p.shards {
+		iters[i] = p.shards[i].NewFlushIter(bytesFlushed)
+	}
+	return newMergingIter(p.logger, &base.InternalIteratorStats{}, p.cmp, p.split, iters...)
+}
+
+// memTableShardedIter iterates over the point keys of a
+// memTableShardedPoints. It merges the shards, except when seeking to a
+// prefix, since all the keys with the prefix are in a single shard.
+type memTableShardedIter struct {
+	points  *memTableShardedPoints
+	iters   []internalIterator
+	merging *mergingIter
+	stats   base.InternalIteratorStats
+	// cur is either merging, or the iterator over the shard of the prefix of
+	// the last SeekPrefixGE.
+	cur internalIterator
+}
+
+var _ internalIterator = (*memTableShardedIter)(nil)
+
+// useMerging switches to iterating over all the shards, reporting whether the
+// merging iterator was already in use. If it wasn't, one of its levels was
+// repositioned since its last positioning.
+func (it *memTableShardedIter) useMerging() bool {
+	if it.cur == it.merging {
+		return true
+	}
+	it.cur = it.merging
+	return false
+}
+
+func (it *memTableShardedIter) SeekGE(
+	key []byte, flags base.SeekGEFlags,
+) (*InternalKey, base.LazyValue) {
+	if !it.useMerging() {
+		flags = flags.DisableTrySeekUsingNext()
+	}
+	return it.cur.SeekGE(key, flags)
+}
+
+func (it *memTableShardedIter) SeekPrefixGE(
+	prefix, key []byte, flags base.SeekGEFlags,
+) (*InternalKey, base.LazyValue) {
+	if shard := it.iters[it.points.shard(prefix)]; it.cur != shard {
+		it.cur = shard
+		flags = flags.DisableTrySeekUsingNext()
+	}
+	return it.cur.SeekPrefixGE(prefix, key, flags)
+}
+
+func (it *memTableShardedIter) SeekLT(
+	key []byte, flags base.SeekLTFlags,
+) (*InternalKey, base.LazyValue) {
+	it.useMerging()
+	return it.cur.SeekLT(key, flags)
+}
+
+func (it *memTableShardedIter) First() (*InternalKey, base.LazyValue) {
+	it.useMerging()
+	return it.cur.First()
+}
+
+func (it *memTableShardedIter) Last() (*InternalKey, base.LazyValue) {
+	it.useMerging()
+	return it.cur.Last()
+}
+
+func (it *memTableShardedIter) Next() (*InternalKey, base.LazyValue) {
+	return it.cur.Next()
+}
+
+func (it *memTableShardedIter) NextPrefix(succKey []byte) (*InternalKey, base.LazyValue) {
+	return it.cur.NextPrefix(succKey)
+}
+
+func (it *memTableShardedIter) Prev() (*InternalKey, base.LazyValue) {
+	return it.cur.Prev()
+}
+
+func (it *memTableShardedIter) Error() error {
+	return it.cur.Error()
+}
+
+func (it *memTableShardedIter) Close() error {
+	// Closing the merging iterator closes the iterators over all the shards.
+	return it.merging.Close()
+}
+
+func (it *memTableShardedIter) SetBounds(lower, upper []byte) {
+	it.merging.SetBounds(lower, upper)
+	it.cur = it.merging
+}
+
+func (it *memTableShardedIter) String() string {
+	return fmt.Sprintf("memtable-sharded(%d)", len(it.iters))
+}
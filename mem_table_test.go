@@ -19,6 +19,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/arenaskl"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/rangekey"
+	"github.com/cockroachdb/pebble/internal/testkeys"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/exp/rand"
 	"golang.org/x/sync/errgroup"
@@ -27,7 +28,8 @@ import (
 // get gets the value for the given key. It returns ErrNotFound if the DB does
 // not contain the key.
 func (m *memTable) get(key []byte) (value []byte, err error) {
-	it := m.skl.NewIter(nil, nil)
+	it := m.newGetIter(key)
+	defer it.Close()
 	ikey, val := it.SeekGE(key, base.SeekGEFlagsNone)
 	if ikey == nil {
 		return nil, ErrNotFound
@@ -61,7 +63,8 @@ func (m *memTable) set(key InternalKey, value []byte) error {
 		m.rangeKeys.invalidate(1)
 		return nil
 	}
-	return m.skl.Add(key, value)
+	var ins memTablePointsInserter
+	return m.points.add(&ins, key, value)
 }
 
 // count returns the number of entries in a DB.
@@ -389,6 +392,104 @@ func TestMemTableConcurrentDeleteRange(t *testing.T) {
 	}
 }
 
+func TestMemTableShards(t *testing.T) {
+	// Concurrently write versions of keys to memtables with and without
+	// sharded point keys, and check that iteration, prefix seeks, lookups and
+	// flushes observe all of them.
+	for _, shards := range []int{0, 4} {
+		t.Run(fmt.Sprintf("shards=%d", shards), func(t *testing.T) {
+			opts := &Options{Comparer: testkeys.Comparer, MemTableSize: 4 << 20}
+			opts.Experimental.MemTableShards = shards
+			m := newMemTable(memTableOptions{Options: opts})
+
+			const workers, keys = 8, 100
+			eg, _ := errgroup.WithContext(context.Background())
+			seqNum := uint64(1)
+			for i := 0; i < workers; i++ {
+				i := i
+				eg.Go(func() error {
+					for j := 0; j < keys; j++ {
+						b := newBatch(nil)
+						key := testkeys.KeyAt(testkeys.Alpha(2), j, i+1)
+						if err := b.Set(key, key, nil); err != nil {
+							return err
+						}
+						n := atomic.AddUint64(&seqNum, 1) - 1
+						if err := m.apply(b, n); err != nil {
+							return err
+						}
+						b.release()
+					}
+					return nil
+				})
+			}
+			require.NoError(t, eg.Wait())
+			require.Equal(t, workers*keys, m.count())
+			require.Equal(t, m.inuseBytes(), m.bytesIterated(t))
+
+			// Iteration merges the shards in key order.
+			x := newInternalIterAdapter(m.newIter(nil))
+			var prev []byte
+			for valid := x.First(); valid; valid = x.Next() {
+				if prev != nil && testkeys.Comparer.Compare(prev, x.Key().UserKey) >= 0 {
+					t.Fatalf("keys out of order: %s, %s", prev, x.Key().UserKey)
+				}
+				prev = append(prev[:0], x.Key().UserKey...)
+			}
+			require.NoError(t, x.Close())
+
+			// SeekPrefixGE surfaces all the versions of a prefix, and subsequent
+			// seeks consider the keys of all the prefixes.
+			split := testkeys.Comparer.Split
+			it := m.newIter(nil)
+			for j := 0; j < keys; j++ {
+				prefix := testkeys.Key(testkeys.Alpha(2), j)
+				var n int
+				k, _ := it.SeekPrefixGE(prefix, prefix, base.SeekGEFlagsNone)
+				for ; k != nil && bytes.Equal(k.UserKey[:split(k.UserKey)], prefix); k, _ = it.Next() {
+					n++
+				}
+				require.Equal(t, workers, n, "prefix %s", prefix)
+				k, _ = it.SeekGE(prefix, base.SeekGEFlagsNone)
+				require.NotNil(t, k)
+				require.Equal(t, prefix, k.UserKey[:split(k.UserKey)])
+				k, _ = it.SeekLT(prefix, base.SeekLTFlagsNone)
+				require.Equal(t, j == 0, k == nil)
+			}
+			require.NoError(t, it.Close())
+
+			// Lookups find the latest version.
+			for j := 0; j < keys; j++ {
+				key := testkeys.KeyAt(testkeys.Alpha(2), j, workers)
+				v, err := m.get(key)
+				require.NoError(t, err)
+				require.Equal(t, key, v)
+			}
+		})
+	}
+}
+
+func TestMemTableShardsSmall(t *testing.T) {
+	// Small memtables use fewer shards, so that a batch below the large batch
+	// threshold fits in an empty memtable.
+	for _, size := range []int{2 << 10, 4 << 10, 64 << 10} {
+		t.Run(fmt.Sprintf("size=%d", size), func(t *testing.T) {
+			opts := &Options{MemTableSize: size}
+			opts.Experimental.MemTableShards = 8
+			m := newMemTable(memTableOptions{Options: opts})
+			shards := memTableShards(size, 8)
+			require.Equal(t, m.emptySize, memTableEmptySize(shards))
+
+			threshold := (size - int(memTableEmptySize(shards))) / 2
+			b := newBatch(nil)
+			require.NoError(t, b.Set([]byte("a"), make([]byte, threshold-64), nil))
+			require.NoError(t, m.prepare(b))
+			require.NoError(t, m.apply(b, 1))
+			m.writerUnref()
+		})
+	}
+}
+
 func buildMemTable(b *testing.B) (*memTable, [][]byte) {
 	m := newMemTable(memTableOptions{})
 	var keys [][]byte
@@ -0,0 +1,60 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// MemoryMetrics holds the estimated memory usage of a DB, broken down by
+// component, along with its memory budget (see
+// Options.Experimental.MemoryBudget).
+type MemoryMetrics struct {
+	// MemTables is the number of bytes allocated by the memtables and large
+	// (flushable) batches, including the zombie memtables that are still in
+	// use by iterators.
+	MemTables int64
+	// BlockCache is the size of the blocks of the DB in the block cache.
+	BlockCache int64
+	// TableCache is the estimated size of the sstable readers in the table
+	// cache.
+	TableCache int64
+	// Iterators is the estimated size of the open iterators.
+	Iterators int64
+	// Budget is the memory budget, or zero if there is no budget.
+	Budget int64
+}
+
+// Total returns the total estimated memory usage.
+func (m *MemoryMetrics) Total() int64 {
+	return m.MemTables + m.BlockCache + m.TableCache + m.Iterators
+}
+
+// memoryUsage returns the estimated memory usage of the DB.
+func (d *DB) memoryUsage() MemoryMetrics {
+	m := MemoryMetrics{
+		MemTables:  atomic.LoadInt64(&d.atomic.memTableReserved),
+		BlockCache: d.opts.Cache.IDMetrics(d.cacheID).Size,
+		Iterators:  atomic.LoadInt64(&d.atomic.iterCount) * int64(unsafe.Sizeof(iterAlloc{})),
+		Budget:     d.opts.Experimental.MemoryBudget,
+	}
+	tableCacheMetrics, _ := d.tableCache.metrics()
+	m.TableCache = tableCacheMetrics.Size
+	return m
+}
+
+// memoryBudgetExceededLocked returns whether writes should stall because the
+// memory budget is exceeded. Writes only stall while memtables are queued for
+// flushing, since flushing them is what reduces the memory usage.
+//
+// d.mu must be held when calling this.
+func (d *DB) memoryBudgetExceededLocked() bool {
+	if d.opts.Experimental.MemoryBudget <= 0 || len(d.mu.mem.queue) <= 1 {
+		return false
+	}
+	m := d.memoryUsage()
+	return m.Total() > m.Budget
+}
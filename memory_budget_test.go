@@ -0,0 +1,78 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryMetrics(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	iter := d.NewIter(nil)
+	require.True(t, iter.First())
+
+	m := d.Metrics().Memory
+	require.Zero(t, m.Budget)
+	require.EqualValues(t, d.Metrics().MemTable.Size+d.Metrics().MemTable.ZombieSize, m.MemTables)
+	require.NotZero(t, m.BlockCache)
+	require.NotZero(t, m.TableCache)
+	require.NotZero(t, m.Iterators)
+	require.Equal(t, m.MemTables+m.BlockCache+m.TableCache+m.Iterators, m.Total())
+
+	require.NoError(t, iter.Close())
+	require.Zero(t, d.Metrics().Memory.Iterators)
+}
+
+func TestMemoryBudgetWriteStall(t *testing.T) {
+	var mu sync.Mutex
+	var stallReasons []string
+	flushReleased := make(chan struct{})
+	var releaseOnce, delayOnce sync.Once
+	listener := &EventListener{
+		TableCreated: func(info TableCreateInfo) {
+			if info.Reason == "flushing" {
+				// Delay the first flush until writes stall.
+				delayOnce.Do(func() { <-flushReleased })
+			}
+		},
+		WriteStallBegin: func(info WriteStallBeginInfo) {
+			mu.Lock()
+			stallReasons = append(stallReasons, info.Reason)
+			mu.Unlock()
+			releaseOnce.Do(func() { close(flushReleased) })
+		},
+	}
+	opts := &Options{
+		EventListener:               listener,
+		FS:                          vfs.NewMem(),
+		MemTableSize:                initialMemTableSize,
+		MemTableStopWritesThreshold: 100,
+	}
+	opts.Experimental.MemoryBudget = 1
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Fill a few memtables. Once the first one is queued for flushing, the
+	// memory budget is exceeded, and writes stall until it's flushed.
+	v := make([]byte, 64<<10)
+	for i := 0; i < 4*initialMemTableSize/len(v); i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprint(i)), v, NoSync))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	require.Contains(t, stallReasons, "memory budget exceeded")
+	require.EqualValues(t, 1, d.Metrics().Memory.Budget)
+}
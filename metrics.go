@@ -90,6 +90,10 @@ type LevelMetrics struct {
 		// LevelMetrics.format, but are available to sophisticated clients.
 		BytesWrittenDataBlocks  uint64
 		BytesWrittenValueBlocks uint64
+		// The estimates of the MVCC garbage in the sstables in this level (see
+		// Options.Experimental.MVCCGarbageProperties). Not printed by
+		// LevelMetrics.format.
+		MVCCGarbage MVCCGarbageMetrics
 	}
 }
 
@@ -110,6 +114,7 @@ func (m *LevelMetrics) Add(u *LevelMetrics) {
 	m.Additional.BytesWrittenDataBlocks += u.Additional.BytesWrittenDataBlocks
 	m.Additional.BytesWrittenValueBlocks += u.Additional.BytesWrittenValueBlocks
 	m.Additional.ValueBlocksSize += u.Additional.ValueBlocksSize
+	m.Additional.MVCCGarbage.Add(&u.Additional.MVCCGarbage)
 }
 
 // WriteAmp computes the write amplification for compactions at this
@@ -147,6 +152,27 @@ func (m *LevelMetrics) format(
 	}
 }
 
+// TableCacheLevelMetrics holds the table cache telemetry of the tables of a
+// level.
+type TableCacheLevelMetrics struct {
+	// The number of lookups of the tables of the level that found the table
+	// open in the table cache (Hits), and that had to open it (Misses).
+	Hits   int64
+	Misses int64
+	// The number of tables of the level evicted from the table cache to make
+	// room for other tables. A table is attributed to the level it was last
+	// looked up from.
+	Evictions int64
+}
+
+// L0SublevelMetrics holds metrics for a single L0 sublevel.
+type L0SublevelMetrics struct {
+	// The number of files in the sublevel.
+	NumFiles int64
+	// The total size in bytes of the files in the sublevel.
+	Size int64
+}
+
 // Metrics holds metrics for various subsystems of the DB such as the Cache,
 // Compactions, WAL, and per-Level metrics.
 //
@@ -155,6 +181,10 @@ func (m *LevelMetrics) format(
 // metrics reflect those operations.
 type Metrics struct {
 	BlockCache CacheMetrics
+	// BlockCacheDB holds the metrics of the blocks of the DB in the block
+	// cache, which differ from the BlockCache metrics if the cache is shared
+	// with other DBs.
+	BlockCacheDB CacheMetrics
 
 	Compact struct {
 		// The total number of compactions, and per-compaction type counts.
@@ -203,6 +233,24 @@ type Metrics struct {
 
 	Levels [numLevels]LevelMetrics
 
+	// L0 holds metrics describing the construction of L0's sublevels. These
+	// metrics are not included in the output of Metrics.String.
+	L0 struct {
+		// Sublevels holds the number of files and their total size for each
+		// L0 sublevel, indexed by sublevel from oldest to newest.
+		Sublevels []L0SublevelMetrics
+		// NumIntervals is the number of intervals that the L0 key space is
+		// divided into by the boundaries of L0 files.
+		NumIntervals int
+		// NumFlushSplitKeys is the number of keys at which flushes are
+		// currently split (see Options.FlushSplitBytes).
+		NumFlushSplitKeys int
+		// MaxDepthAfterOngoingCompactions is an estimate of the maximum
+		// stack depth of L0 sublevels after all in-progress compactions
+		// complete. It's used to compute L0's compaction score.
+		MaxDepthAfterOngoingCompactions int
+	}
+
 	MemTable struct {
 		// The number of bytes allocated by memtables and large (flushable)
 		// batches.
@@ -216,6 +264,10 @@ type Metrics struct {
 		ZombieCount int64
 	}
 
+	// Memory holds the estimated memory usage of the DB, broken down by
+	// component.
+	Memory MemoryMetrics
+
 	Keys struct {
 		// The approximate count of internal range key set keys in the database.
 		RangeKeySetsCount uint64
@@ -224,6 +276,19 @@ type Metrics struct {
 		TombstoneCount uint64
 	}
 
+	// RejectedWrites holds the counts of the batches whose commit failed
+	// because they exceeded the limits on the size of writes (see
+	// Options.Experimental.MaxKeySize). These metrics are not included in the
+	// output of Metrics.String.
+	RejectedWrites struct {
+		// The number of batches rejected with ErrKeyTooLarge.
+		KeyTooLargeCount int64
+		// The number of batches rejected with ErrValueTooLarge.
+		ValueTooLargeCount int64
+		// The number of batches rejected with ErrBatchTooLarge.
+		BatchTooLargeCount int64
+	}
+
 	Snapshots struct {
 		// The number of currently open snapshots.
 		Count int
@@ -245,6 +310,13 @@ type Metrics struct {
 	}
 
 	TableCache CacheMetrics
+	// TableCacheEvictions is the number of tables of the DB evicted from the
+	// table cache to make room for other tables, and TableCacheLevels the
+	// table cache telemetry of the tables of each level. The lookups of tables
+	// irrespective of their level, like those of table properties, are only
+	// counted by TableCache.
+	TableCacheEvictions int64
+	TableCacheLevels    [numLevels]TableCacheLevelMetrics
 
 	// Count of the number of open sstable iterators.
 	TableIters int64
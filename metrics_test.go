@@ -6,6 +6,7 @@ package pebble
 
 import (
 	"fmt"
+	"math/rand"
 	"strconv"
 	"strings"
 	"testing"
@@ -267,6 +268,18 @@ func TestMetrics(t *testing.T) {
 			}
 			return b.String()
 
+		case "l0-sublevel-metrics":
+			m := d.Metrics()
+			var b strings.Builder
+			fmt.Fprintf(&b, "intervals: %d\n", m.L0.NumIntervals)
+			fmt.Fprintf(&b, "flush-split-keys: %d\n", m.L0.NumFlushSplitKeys)
+			fmt.Fprintf(&b, "max-depth-after-ongoing-compactions: %d\n", m.L0.MaxDepthAfterOngoingCompactions)
+			for i := len(m.L0.Sublevels) - 1; i >= 0; i-- {
+				fmt.Fprintf(&b, "L0.%d: %d files, %s\n", i, m.L0.Sublevels[i].NumFiles,
+					humanize.IEC.Int64(m.L0.Sublevels[i].Size))
+			}
+			return b.String()
+
 		default:
 			return fmt.Sprintf("unknown command: %s", td.Cmd)
 		}
@@ -322,3 +335,45 @@ func TestMetricsWAmpDisableWAL(t *testing.T) {
 	require.Greater(t, tot.WriteAmp(), 1.0)
 	require.NoError(t, d.Close())
 }
+
+func TestMetricsBlockCacheDB(t *testing.T) {
+	c := NewCache(64 << 20)
+	defer c.Unref()
+	open := func(limit int64) *DB {
+		opts := &Options{FS: vfs.NewMem(), Cache: c}
+		opts.Experimental.BlockCacheLimit = limit
+		d, err := Open("", opts)
+		require.NoError(t, err)
+		return d
+	}
+	fill := func(d *DB) {
+		rng := rand.New(rand.NewSource(1))
+		v := make([]byte, 1000)
+		for i := 0; i < 2000; i++ {
+			rng.Read(v)
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("%04d", i)), v, nil))
+		}
+		require.NoError(t, d.Flush())
+		iter := d.NewIter(nil)
+		for valid := iter.First(); valid; valid = iter.Next() {
+		}
+		require.NoError(t, iter.Close())
+	}
+
+	const limit = 1 << 20
+	d1, d2 := open(0), open(limit)
+	fill(d1)
+	fill(d2)
+	m1, m2 := d1.Metrics(), d2.Metrics()
+	// The DBs share the block cache, but account for their own blocks, and the
+	// blocks of the second DB are limited.
+	require.NotZero(t, m1.BlockCacheDB.Misses)
+	require.NotZero(t, m2.BlockCacheDB.Misses)
+	require.LessOrEqual(t, m1.BlockCacheDB.Size, m1.BlockCache.Size)
+	require.Greater(t, m1.BlockCacheDB.Size, int64(limit))
+	require.NotZero(t, m2.BlockCacheDB.Size)
+	require.LessOrEqual(t, m2.BlockCacheDB.Size, int64(limit))
+
+	require.NoError(t, d1.Close())
+	require.NoError(t, d2.Close())
+}
@@ -0,0 +1,262 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"math/bits"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// The names of the table properties collected by the MVCC garbage property
+// collector (see Options.Experimental.MVCCGarbageProperties). The values are
+// decimal integers.
+const (
+	mvccGarbageCollectorName        = "pebble.mvcc-garbage"
+	mvccGarbageOverwrittenCountProp = "pebble.mvcc.overwritten.count"
+	mvccGarbageOverwrittenSizeProp  = "pebble.mvcc.overwritten.size"
+	mvccGarbageDeletionsCountProp   = "pebble.mvcc.deletions.count"
+	mvccGarbageDeletionsSizeProp    = "pebble.mvcc.deletions.size"
+	mvccGarbageVersionProp          = "pebble.mvcc.version"
+	mvccGarbageVersion              = "1"
+)
+
+// MVCCGarbageMetrics holds estimates of the MVCC garbage in a set of tables,
+// collected by the MVCC garbage property collector (see
+// Options.Experimental.MVCCGarbageProperties). Only the tables written with the
+// collector, and whose table stats have been loaded, are included.
+//
+// A point key is overwritten if a newer point key with the same prefix (see
+// Comparer.Split) is in the same table. With MVCC keys, these are the older
+// versions of a key, which may be garbage collected by the application once
+// they fall outside its retention window. Overwritten keys that are in
+// different tables than their newer versions aren't counted, so these are
+// lower bounds. Overwritten point deletions are counted both as overwritten
+// keys and as deletions.
+type MVCCGarbageMetrics struct {
+	// The number and total size of the overwritten point keys.
+	OverwrittenCount uint64
+	OverwrittenSize  uint64
+	// The number and total size of the point deletions (DEL and SINGLEDEL
+	// keys).
+	DeletionsCount uint64
+	DeletionsSize  uint64
+}
+
+// Add adds the garbage estimates of u to m.
+func (m *MVCCGarbageMetrics) Add(u *MVCCGarbageMetrics) {
+	m.OverwrittenCount += u.OverwrittenCount
+	m.OverwrittenSize += u.OverwrittenSize
+	m.DeletionsCount += u.DeletionsCount
+	m.DeletionsSize += u.DeletionsSize
+}
+
+// mvccGarbageCollector is the TablePropertyCollector recording the MVCC
+// garbage of a table. It relies on the point keys being added in order, which
+// sstable.Writer enforces.
+type mvccGarbageCollector struct {
+	split     Split
+	prevKey   []byte
+	hasPrev   bool
+	collected MVCCGarbageMetrics
+}
+
+var _ sstable.SuffixReplaceableTableCollector = (*mvccGarbageCollector)(nil)
+var _ sstable.PrefixReplaceableTableCollector = (*mvccGarbageCollector)(nil)
+
+func newMVCCGarbageCollector(split Split) func() TablePropertyCollector {
+	return func() TablePropertyCollector {
+		return &mvccGarbageCollector{split: split}
+	}
+}
+
+// Add implements TablePropertyCollector.
+func (c *mvccGarbageCollector) Add(key InternalKey, value []byte) error {
+	switch kind := key.Kind(); kind {
+	case base.InternalKeyKindRangeDelete, base.InternalKeyKindRangeKeySet,
+		base.InternalKeyKindRangeKeyUnset, base.InternalKeyKindRangeKeyDelete:
+		return nil
+	case base.InternalKeyKindDelete, base.InternalKeyKindSingleDelete:
+		c.collected.DeletionsCount++
+		c.collected.DeletionsSize += uint64(key.Size() + len(value))
+	}
+	prefix := key.UserKey
+	if c.split != nil {
+		prefix = prefix[:c.split(prefix)]
+	}
+	if c.hasPrev && string(prefix) == string(c.prevKey) {
+		c.collected.OverwrittenCount++
+		c.collected.OverwrittenSize += uint64(key.Size() + len(value))
+		return nil
+	}
+	c.prevKey = append(c.prevKey[:0], prefix...)
+	c.hasPrev = true
+	return nil
+}
+
+// Finish implements TablePropertyCollector.
+func (c *mvccGarbageCollector) Finish(userProps map[string]string) error {
+	userProps[mvccGarbageVersionProp] = mvccGarbageVersion
+	userProps[mvccGarbageOverwrittenCountProp] = strconv.FormatUint(c.collected.OverwrittenCount, 10)
+	userProps[mvccGarbageOverwrittenSizeProp] = strconv.FormatUint(c.collected.OverwrittenSize, 10)
+	userProps[mvccGarbageDeletionsCountProp] = strconv.FormatUint(c.collected.DeletionsCount, 10)
+	userProps[mvccGarbageDeletionsSizeProp] = strconv.FormatUint(c.collected.DeletionsSize, 10)
+	return nil
+}
+
+// Name implements TablePropertyCollector.
+func (c *mvccGarbageCollector) Name() string {
+	return mvccGarbageCollectorName
+}
+
+// UpdateKeySuffixes implements sstable.SuffixReplaceableTableCollector. The
+// keys of a table whose suffixes are replaced all have the same suffix, so
+// the garbage of the table is unchanged.
+func (c *mvccGarbageCollector) UpdateKeySuffixes(
+	oldProps map[string]string, oldSuffix, newSuffix []byte,
+) error {
+	return c.copyProps(oldProps)
+}
+
+// UpdateKeyPrefixes implements sstable.PrefixReplaceableTableCollector. The
+// keys sharing a prefix still share one after prefix replacement, so the
+// garbage of the table is unchanged.
+func (c *mvccGarbageCollector) UpdateKeyPrefixes(
+	oldProps map[string]string, oldPrefix, newPrefix []byte,
+) error {
+	return c.copyProps(oldProps)
+}
+
+func (c *mvccGarbageCollector) copyProps(oldProps map[string]string) error {
+	collected, ok, err := decodeMVCCGarbageProps(oldProps)
+	if err != nil {
+		return err
+	}
+	if ok {
+		c.collected = collected
+	}
+	return nil
+}
+
+// decodeMVCCGarbageProps decodes the MVCC garbage properties of a table,
+// returning false if the table wasn't written with the collector.
+func decodeMVCCGarbageProps(userProps map[string]string) (MVCCGarbageMetrics, bool, error) {
+	var m MVCCGarbageMetrics
+	switch v := userProps[mvccGarbageVersionProp]; v {
+	case "":
+		return m, false, nil
+	case mvccGarbageVersion:
+	default:
+		return m, false, errors.Newf("pebble: unknown MVCC garbage properties version %q", v)
+	}
+	for _, p := range []struct {
+		name string
+		dst  *uint64
+	}{
+		{mvccGarbageOverwrittenCountProp, &m.OverwrittenCount},
+		{mvccGarbageOverwrittenSizeProp, &m.OverwrittenSize},
+		{mvccGarbageDeletionsCountProp, &m.DeletionsCount},
+		{mvccGarbageDeletionsSizeProp, &m.DeletionsSize},
+	} {
+		v, err := strconv.ParseUint(userProps[p.name], 10, 64)
+		if err != nil {
+			return m, false, errors.Wrapf(err, "pebble: invalid table property %s", p.name)
+		}
+		*p.dst = v
+	}
+	return m, true, nil
+}
+
+// loadMVCCGarbageStats loads the MVCC garbage properties of a table into its
+// stats. The properties of a virtual table are those of its backing table, so
+// they're scaled by the share of the backing table's size that the virtual
+// table covers.
+func loadMVCCGarbageStats(props *sstable.Properties, meta *fileMetadata, stats *manifest.TableStats) error {
+	m, ok, err := decodeMVCCGarbageProps(props.UserProperties)
+	if err != nil || !ok {
+		return err
+	}
+	if meta.Virtual && meta.FileBacking.Size > 0 {
+		scale := func(v uint64) uint64 {
+			return scaleBySize(v, meta.Size, meta.FileBacking.Size)
+		}
+		m.OverwrittenCount = scale(m.OverwrittenCount)
+		m.OverwrittenSize = scale(m.OverwrittenSize)
+		m.DeletionsCount = scale(m.DeletionsCount)
+		m.DeletionsSize = scale(m.DeletionsSize)
+	}
+	stats.OverwrittenCount = m.OverwrittenCount
+	stats.OverwrittenSize = m.OverwrittenSize
+	stats.DeletionsCount = m.DeletionsCount
+	stats.DeletionsSize = m.DeletionsSize
+	return nil
+}
+
+// scaleBySize returns v*size/backingSize, without overflowing for large
+// values. The size is capped at backingSize.
+func scaleBySize(v, size, backingSize uint64) uint64 {
+	if size >= backingSize {
+		return v
+	}
+	hi, lo := bits.Mul64(v, size)
+	// hi < backingSize since size < backingSize, so the quotient fits.
+	q, _ := bits.Div64(hi, lo, backingSize)
+	return q
+}
+
+// mvccGarbageAnnotator implements manifest.Annotator, annotating B-Tree nodes
+// with the sum of the files' MVCC garbage stats. Its annotation type is a
+// *MVCCGarbageMetrics. The stats may change once a table's stats are loaded
+// asynchronously, so its values are marked as cacheable only if a file's
+// stats have been loaded.
+type mvccGarbageAnnotator struct{}
+
+var _ manifest.Annotator = mvccGarbageAnnotator{}
+
+func (a mvccGarbageAnnotator) Zero(dst interface{}) interface{} {
+	if dst == nil {
+		return new(MVCCGarbageMetrics)
+	}
+	v := dst.(*MVCCGarbageMetrics)
+	*v = MVCCGarbageMetrics{}
+	return v
+}
+
+func (a mvccGarbageAnnotator) Accumulate(
+	f *fileMetadata, dst interface{},
+) (v interface{}, cacheOK bool) {
+	vptr := dst.(*MVCCGarbageMetrics)
+	vptr.Add(&MVCCGarbageMetrics{
+		OverwrittenCount: f.Stats.OverwrittenCount,
+		OverwrittenSize:  f.Stats.OverwrittenSize,
+		DeletionsCount:   f.Stats.DeletionsCount,
+		DeletionsSize:    f.Stats.DeletionsSize,
+	})
+	return vptr, f.StatsValidLocked()
+}
+
+func (a mvccGarbageAnnotator) Merge(src interface{}, dst interface{}) interface{} {
+	srcV := src.(*MVCCGarbageMetrics)
+	dstV := dst.(*MVCCGarbageMetrics)
+	dstV.Add(srcV)
+	return dstV
+}
+
+// mvccGarbageForLevel returns the MVCC garbage stats across all files for a
+// level of the LSM. It only includes the files for which table stats have
+// been loaded. It uses a b-tree annotator to cache intermediate values
+// between calculations when possible. It must not be called concurrently.
+//
+// REQUIRES: 0 <= level <= numLevels.
+func mvccGarbageForLevel(v *version, level int) MVCCGarbageMetrics {
+	if v.Levels[level].Empty() {
+		return MVCCGarbageMetrics{}
+	}
+	return *v.Levels[level].Annotation(mvccGarbageAnnotator{}).(*MVCCGarbageMetrics)
+}
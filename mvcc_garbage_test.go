@@ -0,0 +1,95 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"math"
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMVCCGarbageMetrics(t *testing.T) {
+	opts := &Options{
+		FS:       vfs.NewMem(),
+		Comparer: testkeys.Comparer,
+	}
+	opts.Experimental.MVCCGarbageProperties = true
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	value := []byte("value")
+	for _, k := range []string{"a@3", "a@2", "a@1", "b@5", "d@1"} {
+		require.NoError(t, d.Set([]byte(k), value, nil))
+	}
+	require.NoError(t, d.Delete([]byte("c"), nil))
+	require.NoError(t, d.Delete([]byte("d@2"), nil))
+	require.NoError(t, d.Flush())
+
+	garbage := func() [numLevels]MVCCGarbageMetrics {
+		d.mu.Lock()
+		d.waitTableStats()
+		d.mu.Unlock()
+		var g [numLevels]MVCCGarbageMetrics
+		m := d.Metrics()
+		for i := range m.Levels {
+			g[i] = m.Levels[i].Additional.MVCCGarbage
+		}
+		total := m.Total()
+		require.Equal(t, total.Additional.MVCCGarbage, func() (sum MVCCGarbageMetrics) {
+			for i := range g {
+				sum.Add(&g[i])
+			}
+			return sum
+		}())
+		return g
+	}
+
+	// a@2, a@1 and d@1 are overwritten, and c and d@2 are deletions.
+	keySize := func(k string) uint64 { return uint64(len(k) + 8) }
+	g := garbage()
+	require.Equal(t, MVCCGarbageMetrics{
+		OverwrittenCount: 3,
+		OverwrittenSize:  keySize("a@2") + keySize("a@1") + keySize("d@1") + 3*uint64(len(value)),
+		DeletionsCount:   2,
+		DeletionsSize:    keySize("c") + keySize("d@2"),
+	}, g[0])
+
+	// Compacting the table into the bottommost level elides the deletions, but
+	// not the overwritten versions, which share a prefix with newer versions
+	// without being the same user key.
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), true))
+	g = garbage()
+	require.Equal(t, MVCCGarbageMetrics{}, g[0])
+	require.Equal(t, MVCCGarbageMetrics{
+		OverwrittenCount: 2,
+		OverwrittenSize:  keySize("a@2") + keySize("a@1") + 2*uint64(len(value)),
+	}, g[numLevels-1])
+}
+
+func TestMVCCGarbageCollectorDisabled(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem(), Comparer: testkeys.Comparer})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	require.NoError(t, d.Set([]byte("a@2"), nil, nil))
+	require.NoError(t, d.Set([]byte("a@1"), nil, nil))
+	require.NoError(t, d.Flush())
+	d.mu.Lock()
+	d.waitTableStats()
+	d.mu.Unlock()
+	m := d.Metrics()
+	require.Equal(t, MVCCGarbageMetrics{}, m.Levels[0].Additional.MVCCGarbage)
+}
+
+func TestScaleBySize(t *testing.T) {
+	require.Equal(t, uint64(50), scaleBySize(100, 1, 2))
+	require.Equal(t, uint64(100), scaleBySize(100, 3, 2))
+	require.Equal(t, uint64(0), scaleBySize(100, 0, 2))
+	// The product of the value and the size overflows a uint64.
+	require.Equal(t, uint64(math.MaxUint64/4), scaleBySize(math.MaxUint64/2, 1<<40, 1<<41))
+}
@@ -7,6 +7,7 @@ package objstorage
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/vfs"
@@ -66,9 +67,11 @@ type ReadHandle interface {
 
 	Close() error
 
-	// MaxReadahead configures the implementation to expect large sequential
-	// reads. Used to skip any initial read-ahead ramp-up.
-	MaxReadahead()
+	// SetupForCompaction informs the implementation that the read handle will
+	// be used to read data blocks for a compaction. The implementation can
+	// expect large sequential reads, skipping any initial read-ahead ramp-up,
+	// and can decide not to retain the data it reads in any caches.
+	SetupForCompaction()
 
 	// RecordCacheHit informs the implementation that we were able to retrieve a
 	// block from cache.
@@ -136,7 +139,7 @@ type OpenOptions struct {
 // CreateOptions contains optional arguments for Create.
 type CreateOptions struct {
 	// PreferSharedStorage causes the object to be created on shared storage if
-	// the provider has shared storage configured.
+	// the provider has shared storage configured, and its creator ID is set.
 	PreferSharedStorage bool
 }
 
@@ -199,6 +202,14 @@ type Provider interface {
 	// List returns the objects currently known to the provider. Does not perform any I/O.
 	List() []ObjectMetadata
 
+	// ListObjects lists the objects present in the shared storage, and
+	// reconciles them against the shared objects known to the provider,
+	// reporting the drift between the two. Unlike List, it performs I/O.
+	//
+	// Cannot be called if shared storage is not configured for the provider,
+	// or its creator ID isn't set.
+	ListObjects() (SharedObjectListing, error)
+
 	// SetCreatorID sets the CreatorID which is needed in order to use shared
 	// objects. Shared object usage is disabled until this method is called the
 	// first time. Once set, the Creator ID is persisted and cannot change.
@@ -212,6 +223,28 @@ type Provider interface {
 	// AttachSharedObjects registers existing shared objects with this provider.
 	AttachSharedObjects(objs []SharedObjectToAttach) ([]ObjectMetadata, error)
 
+	// RefSharedObjects references the shared objects known to this provider on
+	// behalf of another provider with the given creator ID, which will know the
+	// objects under the same file numbers (e.g. the provider of a clone of the
+	// DB). The objects are then only deleted once both providers stop using
+	// them.
+	//
+	// Cannot be called if shared storage is not configured for the provider.
+	RefSharedObjects(creatorID CreatorID, objs []ObjectMetadata) error
+
+	// CollectSharedGarbage deletes the garbage of the shared storage: the
+	// shared objects that are no longer referenced by any provider, and the
+	// stale references of this provider. Removing a shared object only drops
+	// the provider's reference, so the unreferenced objects are only deleted
+	// by CollectSharedGarbage. Garbage is only deleted once it has been found
+	// by an earlier call at least gracePeriod earlier, so that the objects
+	// being created or attached concurrently by other providers are left
+	// alone. The shared objects created before references were tracked are
+	// never deleted. Returns the names of the deleted objects.
+	//
+	// Cannot be called if shared storage is not configured for the provider.
+	CollectSharedGarbage(gracePeriod time.Duration) (deleted []string, err error)
+
 	Close() error
 
 	// IsNotExistError indicates whether the error is known to report that a file or
@@ -219,6 +252,25 @@ type Provider interface {
 	IsNotExistError(err error) bool
 }
 
+// SharedObjectListing is the result of Provider.ListObjects.
+type SharedObjectListing struct {
+	// Objects are the shared objects known to the provider that are present in
+	// the shared storage.
+	Objects []ObjectMetadata
+	// Missing are the shared objects known to the provider that are absent
+	// from the shared storage.
+	Missing []ObjectMetadata
+	// Unreferenced are the shared objects known to the provider that are
+	// present in the shared storage without the provider's reference, so that
+	// other providers may delete them.
+	Unreferenced []ObjectMetadata
+	// Unknown are the names of the objects in the shared storage that belong
+	// to the provider without being known to it: the shared objects that it
+	// created or references, and that no other provider references, and its
+	// references to objects that it doesn't know about.
+	Unknown []string
+}
+
 // SharedObjectBacking encodes the metadata necessary to incorporate a shared
 // object into a different Pebble instance. The encoding is specific to a given
 // Provider implementation.
@@ -13,6 +13,7 @@ import (
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/errors/oserror"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/iouring"
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider/sharedobjcat"
 	"github.com/cockroachdb/pebble/objstorage/shared"
@@ -25,6 +26,10 @@ type provider struct {
 
 	fsDir vfs.File
 
+	// ring is used to read local objects if Settings.IOUring is set and
+	// io_uring is supported.
+	ring *iouring.Ring
+
 	shared sharedSubsystem
 
 	mu struct {
@@ -80,6 +85,20 @@ type Settings struct {
 	// out a large chunk of dirty filesystem buffers.
 	BytesPerSync int
 
+	// IOUring, if true, causes local objects to be read through an io_uring
+	// instance shared by all their readers, which can have many reads in
+	// flight without a thread blocked on each read. It's ignored (and logged)
+	// where io_uring isn't supported, and for the files of a vfs.FS that don't
+	// have a file descriptor.
+	IOUring bool
+
+	// DropCompactionReadsFromPageCache, if true, causes the data of local
+	// objects read by compactions (see ReadHandle.SetupForCompaction) to be
+	// dropped from the page cache once read, as the compaction's inputs are
+	// about to be deleted, so that they don't evict the pages of the
+	// foreground reads.
+	DropCompactionReadsFromPageCache bool
+
 	// Fields here are set only if the provider is to support shared objects
 	// (experimental).
 	Shared struct {
@@ -132,9 +151,21 @@ func open(settings Settings) (p *provider, _ error) {
 		return nil, err
 	}
 
+	if settings.IOUring {
+		p.ring, err = iouring.New(ioUringEntries)
+		if err != nil {
+			p.st.Logger.Infof("pebble: not reading through io_uring: %v", err)
+			p.ring = nil
+		}
+	}
+
 	return p, nil
 }
 
+// ioUringEntries is the number of reads that can be in flight at once through
+// the io_uring instance of a provider.
+const ioUringEntries = 256
+
 // Close is part of the objstorage.Provider interface.
 func (p *provider) Close() error {
 	var err error
@@ -142,6 +173,10 @@ func (p *provider) Close() error {
 		err = p.fsDir.Close()
 		p.fsDir = nil
 	}
+	if p.ring != nil {
+		err = firstError(err, p.ring.Close())
+		p.ring = nil
+	}
 	return err
 }
 
@@ -170,7 +205,7 @@ func (p *provider) OpenForReading(
 func (p *provider) Create(
 	ctx context.Context, fileType base.FileType, fileNum base.FileNum, opts objstorage.CreateOptions,
 ) (w objstorage.Writable, meta objstorage.ObjectMetadata, err error) {
-	if opts.PreferSharedStorage && p.st.Shared.Storage != nil {
+	if opts.PreferSharedStorage && p.st.Shared.Storage != nil && p.shared.initialized.Load() {
 		w, meta, err = p.sharedCreate(ctx, fileType, fileNum)
 	} else {
 		w, meta, err = p.vfsCreate(ctx, fileType, fileNum)
@@ -194,8 +229,9 @@ func (p *provider) Remove(fileType base.FileType, fileNum base.FileNum) error {
 
 	if !meta.IsShared() {
 		err = p.vfsRemove(fileType, fileNum)
+	} else {
+		err = p.sharedUnref(meta)
 	}
-	// TODO(radu): implement shared object removal (i.e. deref).
 
 	if err != nil && !p.IsNotExistError(err) {
 		// We want to be able to retry a Remove, so we keep the object in our list.
@@ -270,7 +306,7 @@ func (p *provider) Lookup(
 		)
 	}
 	if meta.FileType != fileType {
-		return objstorage.ObjectMetadata{}, errors.AssertionFailedf(
+		return objstorage.ObjectMetadata{}, base.InvariantErrorf(
 			"file %s type mismatch (known type %d, expected type %d)",
 			errors.Safe(fileNum), errors.Safe(meta.FileType), errors.Safe(fileType),
 		)
@@ -7,8 +7,10 @@ package objstorageprovider
 import (
 	"context"
 	"fmt"
+	"io"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cockroachdb/datadriven"
 	"github.com/cockroachdb/pebble/internal/base"
@@ -157,6 +159,91 @@ func TestProvider(t *testing.T) {
 				}
 				return log.String()
 
+			case "ref":
+				var creatorID objstorage.CreatorID
+				scanArgs("<creator-id>", &creatorID)
+				var metas []objstorage.ObjectMetadata
+				for _, l := range strings.Fields(d.Input) {
+					var fileNum base.FileNum
+					_, err := fmt.Sscan(l, &fileNum)
+					require.NoError(t, err)
+					meta, err := curProvider.Lookup(base.FileTypeTable, fileNum)
+					require.NoError(t, err)
+					metas = append(metas, meta)
+				}
+				if err := curProvider.RefSharedObjects(creatorID, metas); err != nil {
+					return err.Error()
+				}
+				return log.String()
+
+			case "remove":
+				var fileNum base.FileNum
+				scanArgs("<file-num>", &fileNum)
+				if err := curProvider.Remove(base.FileTypeTable, fileNum); err != nil {
+					return err.Error()
+				}
+				require.NoError(t, curProvider.Sync())
+				return log.String()
+
+			case "collect-garbage":
+				var arg string
+				scanArgs("<grace-period>", &arg)
+				gracePeriod, err := time.ParseDuration(arg)
+				require.NoError(t, err)
+				deleted, err := curProvider.CollectSharedGarbage(gracePeriod)
+				if err != nil {
+					return err.Error()
+				}
+				for _, name := range deleted {
+					log.Infof("deleted: %s", name)
+				}
+				return log.String()
+
+			case "list-objects":
+				listing, err := curProvider.ListObjects()
+				if err != nil {
+					return err.Error()
+				}
+				for _, l := range []struct {
+					name  string
+					metas []objstorage.ObjectMetadata
+				}{
+					{"object", listing.Objects},
+					{"missing", listing.Missing},
+					{"unreferenced", listing.Unreferenced},
+				} {
+					for _, meta := range l.metas {
+						log.Infof("%s: %s -> %s", l.name, meta.FileNum, curProvider.Path(meta))
+					}
+				}
+				for _, name := range listing.Unknown {
+					log.Infof("unknown: %s", name)
+				}
+				return log.String()
+
+			case "shared-delete":
+				// Deletes an object directly from the shared storage.
+				var name string
+				scanArgs("<name>", &name)
+				require.NoError(t, sharedStore.Delete(name))
+				return log.String()
+
+			case "shared-create":
+				// Creates an object directly in the shared storage.
+				var name string
+				scanArgs("<name>", &name)
+				w, err := sharedStore.CreateObject(name)
+				require.NoError(t, err)
+				_, err = w.Write([]byte(d.Input))
+				require.NoError(t, err)
+				require.NoError(t, w.Close())
+				return log.String()
+
+			case "shared-list":
+				_, err := sharedStore.List("" /* prefix */, "" /* delimiter */)
+				require.NoError(t, err)
+				return log.String()
+
 			default:
 				d.Fatalf(t, "unknown command %s", d.Cmd)
 				return ""
@@ -185,3 +272,111 @@ func TestNotExistError(t *testing.T) {
 	require.NoError(t, fs.Remove(base.MakeFilename(base.FileTypeTable, 1)))
 	require.True(t, provider.IsNotExistError(provider.Remove(base.FileTypeTable, 1)))
 }
+
+func TestIOUring(t *testing.T) {
+	settings := DefaultSettings(vfs.Default, t.TempDir())
+	settings.IOUring = true
+	provider, err := Open(settings)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, provider.Close()) }()
+
+	data := make([]byte, 512<<10)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	w, _, err := provider.Create(context.Background(), base.FileTypeTable, 1, objstorage.CreateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, w.Write(data))
+	require.NoError(t, w.Finish())
+
+	r, err := provider.OpenForReading(context.Background(), base.FileTypeTable, 1, objstorage.OpenOptions{})
+	require.NoError(t, err)
+	if r.(*fileReadable).ring == nil {
+		t.Log("io_uring is not supported")
+	}
+	p := make([]byte, 1000)
+	for _, off := range []int64{0, 12345, int64(len(data)) - 1000} {
+		n, err := r.ReadAt(context.Background(), p, off)
+		require.NoError(t, err)
+		require.Equal(t, len(p), n)
+		require.Equal(t, data[off:off+1000], p)
+	}
+	_, err = r.ReadAt(context.Background(), p, int64(len(data))-10)
+	require.Equal(t, io.EOF, err)
+
+	rh := r.NewReadHandle(context.Background())
+	for off := int64(0); off < int64(len(data)); off += int64(len(p)) {
+		n, err := rh.ReadAt(context.Background(), p[:10], off)
+		require.NoError(t, err)
+		require.Equal(t, data[off:off+int64(n)], p[:n])
+	}
+	require.NoError(t, rh.Close())
+
+	// Sequential reads submit their readahead to the ring, and are served from
+	// it.
+	rh = r.NewReadHandle(context.Background())
+	// A read far from the start first resets the readahead state.
+	_, err = rh.ReadAt(context.Background(), p, int64(len(data))-int64(len(p)))
+	require.NoError(t, err)
+	readahead := false
+	for off := int64(0); off+int64(len(p)) <= int64(len(data)); off += int64(len(p)) {
+		n, err := rh.ReadAt(context.Background(), p, off)
+		require.NoError(t, err)
+		require.Equal(t, data[off:off+int64(n)], p[:n])
+		require.Equal(t, len(p), n)
+		readahead = readahead || rh.(*vfsReadHandle).readahead.off > 0
+	}
+	require.Equal(t, r.(*fileReadable).ring != nil, readahead)
+	require.NoError(t, rh.Close())
+	require.NoError(t, r.Close())
+}
+
+func TestDropCompactionReadsFromPageCache(t *testing.T) {
+	settings := DefaultSettings(vfs.Default, t.TempDir())
+	settings.DropCompactionReadsFromPageCache = true
+	provider, err := Open(settings)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, provider.Close()) }()
+
+	data := make([]byte, 256<<10)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	w, _, err := provider.Create(context.Background(), base.FileTypeTable, 1, objstorage.CreateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, w.Write(data))
+	require.NoError(t, w.Finish())
+
+	r, err := provider.OpenForReading(context.Background(), base.FileTypeTable, 1, objstorage.OpenOptions{})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, r.Close()) }()
+
+	p := make([]byte, 1000)
+	readAll := func(rh objstorage.ReadHandle) {
+		for off := int64(4096); off+int64(len(p)) <= int64(len(data)); off += int64(len(p)) {
+			n, err := rh.ReadAt(context.Background(), p, off)
+			require.NoError(t, err)
+			require.Equal(t, data[off:off+int64(n)], p[:n])
+		}
+	}
+
+	// Only the range read by a compaction is dropped.
+	rh := r.NewReadHandle(context.Background())
+	readAll(rh)
+	require.False(t, rh.(*vfsReadHandle).forCompaction)
+	require.NoError(t, rh.Close())
+
+	rh = r.NewReadHandle(context.Background())
+	rh.SetupForCompaction()
+	readAll(rh)
+	vrh := rh.(*vfsReadHandle)
+	require.True(t, vrh.forCompaction)
+	require.Equal(t, int64(4096), vrh.readStart)
+	require.Equal(t, int64(4096+(len(data)-4096)/len(p)*len(p)), vrh.readEnd)
+	require.NoError(t, rh.Close())
+
+	// The data can still be read after being dropped from the page cache.
+	n, err := r.ReadAt(context.Background(), p, 4096)
+	require.NoError(t, err)
+	require.Equal(t, data[4096:4096+n], p[:n])
+}
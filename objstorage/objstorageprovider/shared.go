@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
@@ -24,6 +25,14 @@ type sharedSubsystem struct {
 	initialized atomic.Bool
 	creatorID   objstorage.CreatorID
 	initOnce    sync.Once
+
+	// gc is the state of CollectSharedGarbage.
+	gc struct {
+		sync.Mutex
+		// found maps the names of the garbage found by the last collection to
+		// the time it was first found.
+		found map[string]time.Time
+	}
 }
 
 func (ss *sharedSubsystem) init(creatorID objstorage.CreatorID) {
@@ -68,7 +77,7 @@ func (p *provider) sharedInit() error {
 // SetCreatorID is part of the objstorage.Provider interface.
 func (p *provider) SetCreatorID(creatorID objstorage.CreatorID) error {
 	if p.st.Shared.Storage == nil {
-		return errors.AssertionFailedf("attempt to set CreatorID but shared storage not enabled")
+		return base.InvariantErrorf("attempt to set CreatorID but shared storage not enabled")
 	}
 	// Note: this call is a cheap no-op if the creator ID was already set. This
 	// call also checks if we are trying to change the ID.
@@ -82,10 +91,21 @@ func (p *provider) SetCreatorID(creatorID objstorage.CreatorID) error {
 	return nil
 }
 
-func (p *provider) sharedCheckInitialized() error {
+// sharedCheckConfigured returns an error if shared storage isn't configured.
+// Reading shared objects doesn't require the creator ID to be set: a DB can
+// read the shared objects created by other instances (e.g. after DB.Clone)
+// before its own creator ID is set.
+func (p *provider) sharedCheckConfigured() error {
 	if p.st.Shared.Storage == nil {
 		return errors.Errorf("shared object support not configured")
 	}
+	return nil
+}
+
+func (p *provider) sharedCheckInitialized() error {
+	if err := p.sharedCheckConfigured(); err != nil {
+		return err
+	}
 	if !p.shared.initialized.Load() {
 		return errors.Errorf("shared object support not available: shared creator ID not yet set")
 	}
@@ -143,6 +163,14 @@ func (p *provider) sharedCreate(
 	meta.Shared.CreatorID = p.shared.creatorID
 	meta.Shared.CreatorFileNum = fileNum
 
+	// The creation and ref markers are written before the object, so that the
+	// object is never found without ref markers while it's in use.
+	if err := p.sharedCreationMarker(meta); err != nil {
+		return nil, objstorage.ObjectMetadata{}, err
+	}
+	if err := p.sharedRef(meta); err != nil {
+		return nil, objstorage.ObjectMetadata{}, err
+	}
 	objName := sharedObjectName(meta)
 	writer, err := p.st.Shared.Storage.CreateObject(objName)
 	if err != nil {
@@ -156,7 +184,7 @@ func (p *provider) sharedCreate(
 func (p *provider) sharedOpenForReading(
 	ctx context.Context, meta objstorage.ObjectMetadata,
 ) (objstorage.Readable, error) {
-	if err := p.sharedCheckInitialized(); err != nil {
+	if err := p.sharedCheckConfigured(); err != nil {
 		return nil, err
 	}
 	objName := sharedObjectName(meta)
@@ -168,7 +196,7 @@ func (p *provider) sharedOpenForReading(
 }
 
 func (p *provider) sharedSize(meta objstorage.ObjectMetadata) (int64, error) {
-	if err := p.sharedCheckInitialized(); err != nil {
+	if err := p.sharedCheckConfigured(); err != nil {
 		return 0, err
 	}
 	objName := sharedObjectName(meta)
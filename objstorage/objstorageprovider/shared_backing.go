@@ -32,7 +32,7 @@ func (p *provider) SharedObjectBacking(
 	meta *objstorage.ObjectMetadata,
 ) (objstorage.SharedObjectBacking, error) {
 	if !meta.IsShared() {
-		return nil, errors.AssertionFailedf("object %s not on shared storage", meta.FileNum)
+		return nil, base.InvariantErrorf("object %s not on shared storage", meta.FileNum)
 	}
 
 	buf := make([]byte, 0, binary.MaxVarintLen64*4)
@@ -101,6 +101,9 @@ func fromSharedObjectBacking(
 func (p *provider) AttachSharedObjects(
 	objs []objstorage.SharedObjectToAttach,
 ) ([]objstorage.ObjectMetadata, error) {
+	if err := p.sharedCheckInitialized(); err != nil {
+		return nil, err
+	}
 	metas := make([]objstorage.ObjectMetadata, len(objs))
 	for i, o := range objs {
 		meta, err := fromSharedObjectBacking(o.FileType, o.FileNum, o.Backing)
@@ -109,6 +112,14 @@ func (p *provider) AttachSharedObjects(
 		}
 		metas[i] = meta
 	}
+	// The ref markers are written before the objects are known to the
+	// provider, so that they aren't deleted by their other providers while the
+	// objects are in use.
+	for _, meta := range metas {
+		if err := p.sharedRef(meta); err != nil {
+			return nil, err
+		}
+	}
 
 	func() {
 		p.mu.Lock()
@@ -74,14 +74,14 @@ func (r *sharedReadHandle) ReadAt(_ context.Context, p []byte, offset int64) (n
 		}
 		reader, _, err := r.readable.storage.ReadObjectAt(r.readable.objName, offset)
 		if err != nil {
-			return 0, err
+			return 0, markReadError(err)
 		}
 		r.lastReader = reader
 		r.lastOffset = offset
 	}
 	n, err = io.ReadFull(r.lastReader, p)
 	r.lastOffset += int64(n)
-	return n, err
+	return n, markReadError(err)
 }
 
 func (r *sharedReadHandle) Close() error {
@@ -94,6 +94,6 @@ func (r *sharedReadHandle) Close() error {
 	return err
 }
 
-func (r *sharedReadHandle) MaxReadahead() {}
+func (r *sharedReadHandle) SetupForCompaction() {}
 
 func (r *sharedReadHandle) RecordCacheHit(_ context.Context, offset, size int64) {}
@@ -0,0 +1,369 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package objstorageprovider
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage"
+)
+
+// Shared objects are reference counted across the providers using them: each
+// provider that creates or attaches a shared object first writes an empty "ref
+// marker" object to the shared storage, named after the shared object and the
+// provider's creator ID and file number for the object:
+//
+//	<object name>.ref.<ref creator ID>.<ref file num>
+//
+// The provider creating a shared object writes an empty "creation marker"
+// before the first ref marker of the object:
+//
+//	<object name>.created
+//
+// It tells that the object is reference counted. The shared objects created
+// before ref markers were introduced have no markers, and are never deleted.
+//
+// Removing the object only removes the provider's ref marker. A reference
+// counted object without ref markers is garbage, which CollectSharedGarbage
+// deletes once it has found it without ref markers for a grace period, and then
+// its creation marker likewise. The object isn't deleted as soon as its last ref
+// marker is removed: another provider may have learned of the object while it
+// was referenced (e.g. through its SharedObjectBacking), and be about to write
+// its ref marker. The grace period must exceed the time that takes, as well as
+// the time between the creation marker and the first ref marker being written.
+
+const (
+	sharedRefSeparator         = ".ref."
+	sharedCreationMarkerSuffix = ".created"
+)
+
+// sharedObjectRefPrefix returns the prefix of the names of the ref markers of
+// the object.
+func sharedObjectRefPrefix(meta objstorage.ObjectMetadata) string {
+	return sharedObjectName(meta) + sharedRefSeparator
+}
+
+// sharedObjectRefName returns the name of the ref marker of the object for
+// the provider with the given creator ID.
+func sharedObjectRefName(meta objstorage.ObjectMetadata, creatorID objstorage.CreatorID) string {
+	return fmt.Sprintf("%s%s.%s", sharedObjectRefPrefix(meta), creatorID, meta.FileNum)
+}
+
+// sharedObjectCreationMarkerName returns the name of the creation marker of the
+// object.
+func sharedObjectCreationMarkerName(meta objstorage.ObjectMetadata) string {
+	return sharedObjectName(meta) + sharedCreationMarkerSuffix
+}
+
+// sharedCreationMarker writes the creation marker of an object created by this
+// provider.
+func (p *provider) sharedCreationMarker(meta objstorage.ObjectMetadata) error {
+	w, err := p.st.Shared.Storage.CreateObject(sharedObjectCreationMarkerName(meta))
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// sharedRef writes the ref marker of the object for this provider.
+func (p *provider) sharedRef(meta objstorage.ObjectMetadata) error {
+	return p.sharedRefFor(meta, p.shared.creatorID)
+}
+
+// sharedRefFor writes the ref marker of the object for the provider with the
+// given creator ID.
+func (p *provider) sharedRefFor(meta objstorage.ObjectMetadata, creatorID objstorage.CreatorID) error {
+	w, err := p.st.Shared.Storage.CreateObject(sharedObjectRefName(meta, creatorID))
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// RefSharedObjects is part of the objstorage.Provider interface.
+func (p *provider) RefSharedObjects(
+	creatorID objstorage.CreatorID, objs []objstorage.ObjectMetadata,
+) error {
+	if err := p.sharedCheckConfigured(); err != nil {
+		return err
+	}
+	if !creatorID.IsSet() {
+		return base.InvariantErrorf("attempt to reference shared objects without a CreatorID")
+	}
+	if p.shared.initialized.Load() && creatorID == p.shared.creatorID {
+		return errors.Errorf("pebble: shared objects can't be referenced for this provider's CreatorID %s", creatorID)
+	}
+	for _, meta := range objs {
+		if !meta.IsShared() {
+			return base.InvariantErrorf("attempt to reference local object %s", meta.FileNum)
+		}
+		if err := p.sharedRefFor(meta, creatorID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sharedUnref removes the ref marker of the object for this provider. The
+// object is left to CollectSharedGarbage even if no other provider references
+// it, as another provider may be about to. A provider whose creator ID isn't
+// set has no ref markers, but may know the shared objects of other providers
+// (e.g. after DB.Clone).
+func (p *provider) sharedUnref(meta objstorage.ObjectMetadata) error {
+	if err := p.sharedCheckConfigured(); err != nil {
+		return err
+	}
+	if !p.shared.initialized.Load() {
+		return nil
+	}
+	err := p.st.Shared.Storage.Delete(sharedObjectRefName(meta, p.shared.creatorID))
+	if err != nil && !p.IsNotExistError(err) {
+		return err
+	}
+	return nil
+}
+
+// CollectSharedGarbage is part of the objstorage.Provider interface.
+func (p *provider) CollectSharedGarbage(gracePeriod time.Duration) ([]string, error) {
+	if err := p.sharedCheckConfigured(); err != nil {
+		return nil, err
+	}
+	names, err := p.st.Shared.Storage.List("" /* prefix */, "" /* delimiter */)
+	if err != nil {
+		return nil, err
+	}
+	garbage := p.findSharedGarbage(names)
+
+	p.shared.gc.Lock()
+	defer p.shared.gc.Unlock()
+	now := time.Now()
+	// The garbage that was found by an earlier collection but is no longer
+	// garbage, e.g. because it was referenced again, is forgotten.
+	found := make(map[string]time.Time, len(garbage))
+	var deleted []string
+	for _, name := range garbage {
+		foundAt, ok := p.shared.gc.found[name]
+		if !ok || now.Sub(foundAt) < gracePeriod {
+			if !ok {
+				foundAt = now
+			}
+			found[name] = foundAt
+			continue
+		}
+		if delErr := p.st.Shared.Storage.Delete(name); delErr != nil && !p.IsNotExistError(delErr) {
+			found[name] = foundAt
+			err = firstError(err, errors.Wrapf(delErr, "deleting shared object %q", errors.Safe(name)))
+			continue
+		}
+		deleted = append(deleted, name)
+		p.st.Logger.Infof("deleted unreferenced shared object %q", name)
+	}
+	p.shared.gc.found = found
+	return deleted, err
+}
+
+// findSharedGarbage returns the garbage among the names of the objects in the
+// shared storage: the reference counted shared objects without ref markers,
+// the creation markers without objects or ref markers, and the ref markers of
+// this provider for objects that it no longer knows about. The ref markers of
+// other providers are left to them, as they may precede an object that's being
+// created. If the creator ID isn't set, the provider has no ref markers.
+//
+// A creation marker is only garbage once its object is deleted, so that an
+// object whose deletion fails isn't left without its creation marker, and thus
+// never deleted.
+func (p *provider) findSharedGarbage(names []string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	objects, refs, created := p.parseSharedNames(names)
+	var garbage []string
+	referenced := make(map[string]bool, len(refs))
+	for objName, objRefs := range refs {
+		for _, ref := range objRefs {
+			if p.isStaleRef(objName, ref) {
+				garbage = append(garbage, ref.name)
+			} else {
+				referenced[objName] = true
+			}
+		}
+	}
+	for objName := range created {
+		switch {
+		case referenced[objName]:
+			// The object is in use.
+		case objects[objName]:
+			garbage = append(garbage, objName)
+		default:
+			garbage = append(garbage, objName+sharedCreationMarkerSuffix)
+		}
+	}
+	sort.Strings(garbage)
+	return garbage
+}
+
+// ListObjects is part of the objstorage.Provider interface.
+func (p *provider) ListObjects() (objstorage.SharedObjectListing, error) {
+	if err := p.sharedCheckInitialized(); err != nil {
+		return objstorage.SharedObjectListing{}, err
+	}
+	names, err := p.st.Shared.Storage.List("" /* prefix */, "" /* delimiter */)
+	if err != nil {
+		return objstorage.SharedObjectListing{}, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	objects, refs, _ := p.parseSharedNames(names)
+	var res objstorage.SharedObjectListing
+	known := make(map[string]bool)
+	for _, meta := range p.mu.knownObjects {
+		if !meta.IsShared() {
+			continue
+		}
+		objName := sharedObjectName(meta)
+		known[objName] = true
+		switch {
+		case !objects[objName]:
+			res.Missing = append(res.Missing, meta)
+		case !p.hasRef(refs[objName], meta.FileNum):
+			res.Unreferenced = append(res.Unreferenced, meta)
+		default:
+			res.Objects = append(res.Objects, meta)
+		}
+	}
+	for objName, objRefs := range refs {
+		var otherRefs bool
+		for _, ref := range objRefs {
+			if p.isStaleRef(objName, ref) {
+				res.Unknown = append(res.Unknown, ref.name)
+			} else if ref.creatorID != p.shared.creatorID {
+				otherRefs = true
+			}
+		}
+		if objects[objName] && !known[objName] && !otherRefs {
+			res.Unknown = append(res.Unknown, objName)
+		}
+	}
+	for objName := range objects {
+		if _, ok := refs[objName]; !ok && !known[objName] &&
+			strings.HasPrefix(objName, p.shared.creatorID.String()+"-") {
+			res.Unknown = append(res.Unknown, objName)
+		}
+	}
+	for _, metas := range [][]objstorage.ObjectMetadata{res.Objects, res.Missing, res.Unreferenced} {
+		sort.Slice(metas, func(i, j int) bool {
+			return metas[i].FileNum < metas[j].FileNum
+		})
+	}
+	sort.Strings(res.Unknown)
+	return res, nil
+}
+
+// sharedRefInfo describes a ref marker.
+type sharedRefInfo struct {
+	name      string
+	creatorID objstorage.CreatorID
+	fileNum   base.FileNum
+}
+
+// parseSharedNames parses the names of the objects in the shared storage,
+// returning the set of the names of the shared objects, the ref markers by the
+// name of their object, and the set of the names of the objects with creation
+// markers (the objects may be absent from the first set). Objects with names
+// not matching the naming scheme of shared objects are ignored.
+func (p *provider) parseSharedNames(
+	names []string,
+) (objects map[string]bool, refs map[string][]sharedRefInfo, created map[string]bool) {
+	objects = make(map[string]bool)
+	refs = make(map[string][]sharedRefInfo)
+	created = make(map[string]bool)
+	for _, name := range names {
+		if strings.HasSuffix(name, sharedCreationMarkerSuffix) {
+			if objName := strings.TrimSuffix(name, sharedCreationMarkerSuffix); p.isSharedObjectName(objName) {
+				created[objName] = true
+				continue
+			}
+		}
+		objName, ref, isRef := strings.Cut(name, sharedRefSeparator)
+		if !p.isSharedObjectName(objName) {
+			continue
+		}
+		if !isRef {
+			objects[objName] = true
+			continue
+		}
+		creatorID, fileNum, ok := parseSharedObjectRef(ref)
+		if !ok {
+			continue
+		}
+		refs[objName] = append(refs[objName], sharedRefInfo{
+			name:      name,
+			creatorID: creatorID,
+			fileNum:   fileNum,
+		})
+	}
+	return objects, refs, created
+}
+
+// isStaleRef returns true if the ref marker of the named object is a marker
+// of this provider for an object that it doesn't know about. p.mu must be
+// held.
+func (p *provider) isStaleRef(objName string, ref sharedRefInfo) bool {
+	if ref.creatorID != p.shared.creatorID {
+		return false
+	}
+	meta, ok := p.mu.knownObjects[ref.fileNum]
+	return !ok || !meta.IsShared() || sharedObjectName(meta) != objName
+}
+
+// hasRef returns true if the ref markers include the marker of this provider
+// for the given file number.
+func (p *provider) hasRef(refs []sharedRefInfo, fileNum base.FileNum) bool {
+	for _, ref := range refs {
+		if ref.creatorID == p.shared.creatorID && ref.fileNum == fileNum {
+			return true
+		}
+	}
+	return false
+}
+
+// isSharedObjectName returns true if name is the name of a shared object, as
+// returned by sharedObjectName.
+func (p *provider) isSharedObjectName(name string) bool {
+	creatorID, filename, ok := strings.Cut(name, "-")
+	if !ok || len(creatorID) != len(objstorage.CreatorID(0).String()) {
+		return false
+	}
+	if _, err := strconv.ParseUint(creatorID, 10, 64); err != nil {
+		return false
+	}
+	_, _, ok = base.ParseFilename(p.st.FS, filename)
+	return ok
+}
+
+// parseSharedObjectRef parses the "<ref creator ID>.<ref file num>" suffix of
+// the name of a ref marker.
+func parseSharedObjectRef(ref string) (objstorage.CreatorID, base.FileNum, bool) {
+	creatorID, fileNum, ok := strings.Cut(ref, ".")
+	if !ok {
+		return 0, 0, false
+	}
+	c, err := strconv.ParseUint(creatorID, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	f, err := strconv.ParseUint(fileNum, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return objstorage.CreatorID(c), base.FileNum(f), true
+}
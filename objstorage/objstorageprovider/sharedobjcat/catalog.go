@@ -115,7 +115,7 @@ func Open(fs vfs.FS, dirname string) (*Catalog, CatalogContents, error) {
 // SetCreatorID sets the creator ID. If it is already set, it must match.
 func (c *Catalog) SetCreatorID(id objstorage.CreatorID) error {
 	if !id.IsSet() {
-		return errors.AssertionFailedf("attempt to unset CreatorID")
+		return base.InvariantErrorf("attempt to unset CreatorID")
 	}
 
 	c.mu.Lock()
@@ -123,7 +123,7 @@ func (c *Catalog) SetCreatorID(id objstorage.CreatorID) error {
 
 	if c.mu.creatorID.IsSet() {
 		if c.mu.creatorID != id {
-			return errors.AssertionFailedf("attempt to change CreatorID from %s to %s", c.mu.creatorID, id)
+			return base.InvariantErrorf("attempt to change CreatorID from %s to %s", c.mu.creatorID, id)
 		}
 		return nil
 	}
@@ -212,12 +212,12 @@ func (c *Catalog) ApplyBatch(b Batch) error {
 
 	for _, n := range b.ve.DeletedObjects {
 		if _, exists := c.mu.objects[n]; !exists {
-			return errors.AssertionFailedf("deleting non-existent object %s", n)
+			return base.InvariantErrorf("deleting non-existent object %s", n)
 		}
 	}
 	for _, meta := range b.ve.NewObjects {
 		if _, exists := c.mu.objects[meta.FileNum]; exists {
-			return errors.AssertionFailedf("adding existing object %s", meta.FileNum)
+			return base.InvariantErrorf("adding existing object %s", meta.FileNum)
 		}
 	}
 
@@ -311,7 +311,7 @@ func makeCatalogFilename(iter uint64) string {
 // current catalog and sets c.mu.catalogFile and c.mu.catalogRecWriter.
 func (c *Catalog) createNewCatalogFileLocked() (outErr error) {
 	if c.mu.catalogFile != nil {
-		return errors.AssertionFailedf("catalogFile already open")
+		return base.InvariantErrorf("catalogFile already open")
 	}
 	filename := makeCatalogFilename(c.mu.marker.NextIter())
 	filepath := c.fs.PathJoin(c.dirname, filename)
@@ -32,7 +32,7 @@ func (p *provider) vfsOpenForReading(
 	// that the File might support Prefetch and SequentialReadsOption. We should
 	// replace this with a cleaner way to obtain the capabilities of the FS / File.
 	if fd := file.Fd(); fd != vfs.InvalidFd {
-		return newFileReadable(file, p.st.FS, filename)
+		return newFileReadable(file, p.st.FS, filename, p.ring, p.st.DropCompactionReadsFromPageCache)
 	}
 	return newGenericFileReadable(file)
 }
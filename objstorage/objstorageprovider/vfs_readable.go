@@ -7,10 +7,14 @@ package objstorageprovider
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"sync"
 
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/invariants"
+	"github.com/cockroachdb/pebble/internal/iouring"
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/vfs"
 )
@@ -19,16 +23,24 @@ import (
 type fileReadable struct {
 	file vfs.File
 	size int64
+	// ring, if set, is used to read the file through io_uring.
+	ring *iouring.Ring
 
 	// The following fields are used to possibly open the file again using the
 	// sequential reads option (see vfsReadHandle).
 	filename string
 	fs       vfs.FS
+
+	// dropCompactionReads is set when the data read for compactions should be
+	// dropped from the page cache (see Settings.DropCompactionReadsFromPageCache).
+	dropCompactionReads bool
 }
 
 var _ objstorage.Readable = (*fileReadable)(nil)
 
-func newFileReadable(file vfs.File, fs vfs.FS, filename string) (*fileReadable, error) {
+func newFileReadable(
+	file vfs.File, fs vfs.FS, filename string, ring *iouring.Ring, dropCompactionReads bool,
+) (*fileReadable, error) {
 	info, err := file.Stat()
 	if err != nil {
 		return nil, err
@@ -36,8 +48,11 @@ func newFileReadable(file vfs.File, fs vfs.FS, filename string) (*fileReadable,
 	r := &fileReadable{
 		file:     file,
 		size:     info.Size(),
+		ring:     ring,
 		filename: filename,
 		fs:       fs,
+
+		dropCompactionReads: dropCompactionReads,
 	}
 	invariants.SetFinalizer(r, func(obj interface{}) {
 		if obj.(*fileReadable).file != nil {
@@ -50,7 +65,27 @@ func newFileReadable(file vfs.File, fs vfs.FS, filename string) (*fileReadable,
 
 // ReadAt is part of the objstorage.Readable interface.
 func (r *fileReadable) ReadAt(_ context.Context, p []byte, off int64) (n int, err error) {
-	return r.file.ReadAt(p, off)
+	return r.readAt(p, off)
+}
+
+func (r *fileReadable) readAt(p []byte, off int64) (n int, err error) {
+	if r.ring != nil {
+		n, err = r.ring.ReadAt(r.file.Fd(), p, off)
+	} else {
+		n, err = r.file.ReadAt(p, off)
+	}
+	return n, markReadError(err)
+}
+
+// markReadError marks an error returned by a read from an object as a
+// transient I/O error. Reads past the end of the object and reads of objects
+// that don't exist won't succeed if retried; their errors are returned
+// unchanged.
+func markReadError(err error) error {
+	if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF || oserror.IsNotExist(err) {
+		return err
+	}
+	return base.MarkTransientIOError(err)
 }
 
 // Close is part of the objstorage.Readable interface.
@@ -80,6 +115,25 @@ type vfsReadHandle struct {
 	// OS-level readahead. Once this is non-nil, the other variables in
 	// readaheadState don't matter much as we defer to OS-level readahead.
 	sequentialFile vfs.File
+
+	// forCompaction is set by SetupForCompaction. The byte range
+	// [readStart, readEnd) read by a compaction is dropped from the page cache
+	// when the handle is closed, if the fileReadable's dropCompactionReads is
+	// set: the compaction's inputs are about to become obsolete.
+	forCompaction      bool
+	readStart, readEnd int64
+
+	// readahead holds the readahead submitted to the fileReadable's ring, if
+	// set, instead of prefetching: the readahead is read into buf
+	// asynchronously, and the reads within it are served from buf.
+	readahead struct {
+		// op is the read of buf in flight, if any. Once it completes, buf
+		// holds n bytes of the file at off.
+		op  *iouring.Op
+		buf []byte
+		off int64
+		n   int
+	}
 }
 
 var _ objstorage.ReadHandle = (*vfsReadHandle)(nil)
@@ -101,34 +155,107 @@ var readHandlePool = sync.Pool{
 // Close is part of the objstorage.ReadHandle interface.
 func (rh *vfsReadHandle) Close() error {
 	var err error
+	if rh.forCompaction && rh.r.dropCompactionReads && rh.readEnd > rh.readStart {
+		_ = vfs.DropFromPageCache(rh.r.file, rh.readStart, rh.readEnd-rh.readStart)
+	}
 	if rh.sequentialFile != nil {
 		err = rh.sequentialFile.Close()
 	}
+	rh.waitReadahead()
+	buf := rh.readahead.buf[:0]
 	*rh = vfsReadHandle{}
+	rh.readahead.buf = buf
 	readHandlePool.Put(rh)
 	return err
 }
 
 // ReadAt is part of the objstorage.ReadHandle interface.
 func (rh *vfsReadHandle) ReadAt(_ context.Context, p []byte, offset int64) (n int, err error) {
+	if rh.forCompaction {
+		if rh.readEnd == rh.readStart || offset < rh.readStart {
+			rh.readStart = offset
+		}
+		if end := offset + int64(len(p)); end > rh.readEnd {
+			rh.readEnd = end
+		}
+	}
 	if rh.sequentialFile != nil {
 		// Use OS-level read-ahead.
-		return rh.sequentialFile.ReadAt(p, offset)
+		n, err = rh.sequentialFile.ReadAt(p, offset)
+		return n, markReadError(err)
 	}
 	if readaheadSize := rh.rs.maybeReadahead(offset, int64(len(p))); readaheadSize > 0 {
 		if readaheadSize >= maxReadaheadSize {
 			// We've reached the maximum readahead size. Beyond this point, rely on
 			// OS-level readahead.
-			rh.MaxReadahead()
-		} else {
+			rh.switchToOSReadahead()
+		} else if rh.r.ring == nil || !rh.submitReadahead(offset+int64(len(p)), offset+readaheadSize) {
 			_ = rh.r.file.Prefetch(offset, readaheadSize)
 		}
 	}
-	return rh.r.file.ReadAt(p, offset)
+	if n, ok := rh.readFromReadahead(p, offset); ok {
+		return n, nil
+	}
+	return rh.r.readAt(p, offset)
+}
+
+// submitReadahead submits the read of the byte range [start, end) of the file
+// to the ring, unless the range is empty or a readahead is already in flight.
+// The read runs concurrently with the read of the block that triggered it.
+// Returns false if the readahead wasn't submitted.
+func (rh *vfsReadHandle) submitReadahead(start, end int64) bool {
+	ra := &rh.readahead
+	if end > rh.r.size {
+		end = rh.r.size
+	}
+	if start >= end || ra.op != nil {
+		return false
+	}
+	if int64(cap(ra.buf)) < end-start {
+		ra.buf = make([]byte, maxReadaheadSize)
+	}
+	ra.buf = ra.buf[:end-start]
+	op, err := rh.r.ring.Read(rh.r.file.Fd(), ra.buf, start)
+	if err != nil {
+		ra.buf, ra.n = ra.buf[:0], 0
+		return false
+	}
+	ra.op, ra.off, ra.n = op, start, 0
+	return true
+}
+
+// readFromReadahead reads p at offset from the readahead, if it covers p.
+func (rh *vfsReadHandle) readFromReadahead(p []byte, offset int64) (int, bool) {
+	ra := &rh.readahead
+	if offset < ra.off || offset+int64(len(p)) > ra.off+int64(len(ra.buf)) {
+		return 0, false
+	}
+	rh.waitReadahead()
+	if offset+int64(len(p)) > ra.off+int64(ra.n) {
+		// The readahead failed, or was short. The read is retried, if only to
+		// return its error.
+		return 0, false
+	}
+	return copy(p, ra.buf[offset-ra.off:]), true
+}
+
+// waitReadahead waits for the readahead in flight, if any.
+func (rh *vfsReadHandle) waitReadahead() {
+	ra := &rh.readahead
+	if ra.op == nil {
+		return
+	}
+	ra.n, _ = ra.op.Wait()
+	ra.op = nil
+}
+
+// SetupForCompaction is part of the objstorage.ReadHandle interface.
+func (rh *vfsReadHandle) SetupForCompaction() {
+	rh.forCompaction = true
+	rh.switchToOSReadahead()
 }
 
-// MaxReadahead is part of the objstorage.ReadHandle interface.
-func (rh *vfsReadHandle) MaxReadahead() {
+func (rh *vfsReadHandle) switchToOSReadahead() {
 	if rh.sequentialFile != nil {
 		return
 	}
@@ -182,7 +309,8 @@ func newGenericFileReadable(file vfs.File) (*genericFileReadable, error) {
 
 // ReadAt is part of the objstorage.Readable interface.
 func (r *genericFileReadable) ReadAt(_ context.Context, p []byte, off int64) (n int, err error) {
-	return r.file.ReadAt(p, off)
+	n, err = r.file.ReadAt(p, off)
+	return n, markReadError(err)
 }
 
 // Close is part of the objstorage.Readable interface.
@@ -136,6 +136,7 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 		opts.Cache.Ref()
 	}
 
+	shards := memTableShards(opts.MemTableSize, opts.Experimental.MemTableShards)
 	d := &DB{
 		cacheID:             opts.Cache.NewID(),
 		dirname:             dirname,
@@ -146,7 +147,7 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 		merge:               opts.Merger.Merge,
 		split:               opts.Comparer.Split,
 		abbreviatedKey:      opts.Comparer.AbbreviatedKey,
-		largeBatchThreshold: (opts.MemTableSize - int(memTableEmptySize)) / 2,
+		largeBatchThreshold: (opts.MemTableSize - int(memTableEmptySize(shards))) / 2,
 		fileLock:            fileLock,
 		dataDir:             dataDir,
 		walDir:              walDir,
@@ -154,6 +155,12 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 		closed:              new(atomic.Value),
 		closedCh:            make(chan struct{}),
 	}
+	if opts.Experimental.BlockCacheLimit > 0 {
+		opts.Cache.SetLimit(d.cacheID, opts.Experimental.BlockCacheLimit)
+	}
+	if opts.Experimental.BlockCacheReservation > 0 {
+		opts.Cache.SetReservation(d.cacheID, opts.Experimental.BlockCacheReservation)
+	}
 	d.mu.versions = &versionSet{}
 	d.atomic.diskAvailBytes = math.MaxUint64
 	d.mu.versions.diskAvailBytes = d.getDiskAvailableBytesCached
@@ -168,6 +175,7 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 			// the tableCache, and if there are no other references to
 			// the tableCache, then the tableCache will also release its
 			// reference to the cache.
+			opts.Cache.ReleaseID(d.cacheID)
 			opts.Cache.Unref()
 
 			if d.tableCache != nil {
@@ -199,6 +207,9 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 	d.deletionLimiter = rate.NewLimiter(
 		rate.Limit(d.opts.Experimental.MinDeletionRate),
 		d.opts.Experimental.MinDeletionRate)
+	if r := d.opts.Experimental.FlushOutputPacingRate; r > 0 {
+		d.flushLimiter = rate.NewLimiter(rate.Limit(r), r)
+	}
 	d.mu.nextJobID = 1
 	d.mu.mem.nextSize = opts.MemTableSize
 	if d.mu.mem.nextSize > initialMemTableSize {
@@ -210,6 +221,10 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 	d.mu.compact.inProgress = make(map[*compaction]struct{})
 	d.mu.compact.noOngoingFlushStartTime = time.Now()
 	d.mu.snapshots.init()
+	d.mu.preparedTxns = make(map[string]*preparedTxn)
+	d.mu.idempotencyTokens.set = make(map[string]struct{})
+	d.mu.exportedSnapshots = make(map[string]*Snapshot)
+	d.mu.seqNumPins = make(map[*SeqNumPin]struct{})
 	// logSeqNum is the next sequence number that will be assigned. Start
 	// assigning sequence numbers from 1 to match rocksdb.
 	d.mu.versions.atomic.logSeqNum = 1
@@ -251,6 +266,9 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 				return nil, errors.Wrapf(ErrDBNotPristine, "dirname=%q", dirname)
 			}
 		}
+		// Pin the views of the exported snapshots before replaying the WAL,
+		// which may flush memtables.
+		d.pinExportedSnapshotsLocked()
 	}
 
 	// In read-only mode, we replay directly into the mutable memtable but never
@@ -282,6 +300,9 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 		FSCleaner:           opts.Cleaner,
 		NoSyncOnClose:       opts.NoSyncOnClose,
 		BytesPerSync:        opts.BytesPerSync,
+		IOUring:             opts.Experimental.IOUring,
+
+		DropCompactionReadsFromPageCache: opts.Experimental.DropCompactionReadsFromPageCache,
 	}
 	providerSettings.Shared.Storage = opts.Experimental.SharedStorage
 
@@ -365,6 +386,15 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 
 	var ve versionEdit
 	var toFlush flushableList
+	defer func() {
+		// If the open fails, release the flushables replayed from the WALs. They
+		// aren't obsolete, and will be replayed again by the next open.
+		if db == nil {
+			for _, entry := range toFlush {
+				entry.readerUnrefLocked(false)
+			}
+		}
+	}()
 	for i, lf := range logFiles {
 		lastWAL := i == len(logFiles)-1
 		flush, maxSeqNum, err := d.replayWAL(jobID, &ve, opts.FS,
@@ -403,6 +433,7 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 		for _, entry := range toFlush {
 			entry.readerUnrefLocked(true)
 		}
+		toFlush = nil
 
 		newLogName := base.MakeFilepath(opts.FS, d.walDirname, fileTypeLog, newLogNum)
 		d.mu.log.queue = append(d.mu.log.queue, fileInfo{fileNum: newLogNum, fileSize: 0})
@@ -436,8 +467,24 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 			WALFsyncLatency:    d.mu.log.metrics.fsyncLatency,
 			QueueSemChan:       d.commit.logSyncQSem,
 		}
-		d.mu.log.LogWriter = record.NewLogWriter(logFile, newLogNum, logWriterConfig)
+		logWriter := record.NewLogWriter(logFile, newLogNum, logWriterConfig)
+		if err := d.writeWALHeader(logWriter); err != nil {
+			_ = logWriter.Close()
+			return nil, err
+		}
+		d.mu.log.LogWriter = logWriter
+		d.mu.log.startLog(d.opts.Experimental.WALCipher, newLogNum)
 		d.mu.versions.metrics.WAL.Files++
+
+		// The replayed WALs are deleted once their memtables are flushed, so
+		// the new WAL must record the transactions which are still prepared,
+		// and the idempotency tokens which are retained.
+		if err := d.logCarriedOverRecordsLocked(d.mu.versions.atomic.logSeqNum); err != nil {
+			return nil, err
+		}
+		if err := d.waitCarriedOverSyncsLocked(newLogNum); err != nil {
+			return nil, err
+		}
 	}
 	d.updateReadStateLocked(d.opts.DebugCheck)
 
@@ -644,13 +691,14 @@ func GetVersion(dir string, fs vfs.FS) (string, error) {
 // The toFlush return value is a list of flushables associated with the WAL
 // being replayed which will be flushed. Once the version edit has been applied
 // to the manifest, it is up to the caller of replayWAL to unreference the
-// toFlush flushables returned by replayWAL.
+// toFlush flushables returned by replayWAL. If replayWAL fails, it releases
+// the flushables it replayed itself.
 //
 // d.mu must be held when calling this, but the mutex may be dropped and
 // re-acquired during the course of this method.
 func (d *DB) replayWAL(
 	jobID int, ve *versionEdit, fs vfs.FS, filename string, logNum FileNum, strictWALTail bool,
-) (toFlush flushableList, maxSeqNum uint64, err error) {
+) (_ flushableList, maxSeqNum uint64, err error) {
 	file, err := fs.Open(filename)
 	if err != nil {
 		return nil, 0, err
@@ -659,12 +707,33 @@ func (d *DB) replayWAL(
 	var (
 		b               Batch
 		buf             bytes.Buffer
+		toFlush         flushableList
 		mem             *memTable
 		entry           *flushableEntry
 		rr              = record.NewReader(file, logNum)
 		offset          int64 // byte offset in rr
 		lastFlushOffset int64
+		// pendingChunks holds the chunks of a batch committed by
+		// Batch.CommitChunked which are yet to be followed by the commit
+		// marker.
+		pendingChunks [][]byte
+		// dec opens the records of the WAL if it's encrypted, which is
+		// indicated by its first record.
+		dec         *walDecrypter
+		firstRecord = true
 	)
+	defer func() {
+		// The flushables replayed so far won't be flushed if the replay fails.
+		// In read-only mode, they're released with the flushable queue.
+		if err != nil && !d.opts.ReadOnly {
+			if mem != nil {
+				entry.readerUnrefLocked(false)
+			}
+			for _, entry := range toFlush {
+				entry.readerUnrefLocked(false)
+			}
+		}
+	}()
 
 	if d.opts.ReadOnly {
 		// In read-only mode, we replay directly into the mutable memtable which will
@@ -721,6 +790,59 @@ func (d *DB) replayWAL(
 		return nil
 	}
 
+	// Replays the batch b into the current memtable, or into the queue of
+	// flushables if it's large.
+	replayBatch := func(b *Batch) error {
+		seqNum := b.SeqNum()
+		if b.memTableSize >= uint64(d.largeBatchThreshold) {
+			flushMem()
+			// Make a copy of the data slice since it is currently owned by buf and will
+			// be reused in the next iteration.
+			b.data = append([]byte(nil), b.data...)
+			b.flushable = newFlushableBatch(b, d.opts.Comparer)
+			entry := d.newFlushableEntry(b.flushable, logNum, b.SeqNum())
+			// Disable memory accounting by adding a reader ref that will never be
+			// removed.
+			entry.readerRefs++
+			if d.opts.ReadOnly {
+				d.mu.mem.queue = append(d.mu.mem.queue, entry)
+				// We added the flushable batch to the flushable to the queue.
+				// But there must be at least one WAL entry waiting to be
+				// replayed. We have to ensure this newer WAL entry isn't
+				// replayed into the current value of d.mu.mem.mutable because
+				// the current mutable memtable exists before this flushable
+				// entry in the memtable queue. To ensure this, we just need to
+				// unset d.mu.mem.mutable. When a newer WAL is replayed, we will
+				// set d.mu.mem.mutable to a newer value.
+				d.mu.mem.mutable = nil
+			} else {
+				toFlush = append(toFlush, entry)
+			}
+			return nil
+		}
+		ensureMem(seqNum)
+		err := mem.prepare(b)
+		if err != nil && err != arenaskl.ErrArenaFull {
+			return err
+		}
+		// We loop since DB.newMemTable() slowly grows the size of allocated memtables, so the
+		// batch may not initially fit, but will eventually fit (since it is smaller than
+		// largeBatchThreshold).
+		for err == arenaskl.ErrArenaFull {
+			flushMem()
+			ensureMem(seqNum)
+			err = mem.prepare(b)
+			if err != nil && err != arenaskl.ErrArenaFull {
+				return err
+			}
+		}
+		if err = mem.apply(b, seqNum); err != nil {
+			return err
+		}
+		mem.writerUnref()
+		return nil
+	}
+
 	for {
 		offset = rr.Offset()
 		r, err := rr.Next()
@@ -738,12 +860,32 @@ func (d *DB) replayWAL(
 			} else if record.IsInvalidRecord(err) && !strictWALTail {
 				break
 			}
+			if record.IsInvalidRecord(err) {
+				err = base.MarkCorruptionErrorAt(err, base.FileTypeLog, logNum, offset)
+			} else {
+				err = base.MarkTransientIOError(err)
+			}
 			return nil, 0, errors.Wrap(err, "pebble: error when replaying WAL")
 		}
 
-		if buf.Len() < batchHeaderLen {
-			return nil, 0, base.CorruptionErrorf("pebble: corrupt log file %q (num %s)",
-				filename, errors.Safe(logNum))
+		repr := buf.Bytes()
+		if dec != nil {
+			if repr, err = dec.open(repr); err != nil {
+				return nil, 0, base.MarkCorruptionErrorAt(err, base.FileTypeLog, logNum, offset)
+			}
+		} else if firstRecord {
+			firstRecord = false
+			if dec, err = maybeStartDecryption(d.opts, logNum, repr); err != nil {
+				return nil, 0, err
+			} else if dec != nil {
+				buf.Reset()
+				continue
+			}
+		}
+
+		if len(repr) < batchHeaderLen {
+			return nil, 0, base.CorruptionErrorAtf(base.FileTypeLog, logNum, offset,
+				"pebble: corrupt log file %q (num %s)", filename, errors.Safe(logNum))
 		}
 
 		if d.opts.ErrorIfNotPristine {
@@ -753,9 +895,36 @@ func (d *DB) replayWAL(
 		// Specify Batch.db so that Batch.SetRepr will compute Batch.memTableSize
 		// which is used below.
 		b = Batch{db: d}
-		b.SetRepr(buf.Bytes())
+		b.SetRepr(repr)
 		seqNum := b.SeqNum()
 		maxSeqNum = seqNum + uint64(b.Count())
+		d.applyTxnMarkerLocked(&b)
+		if b.idempotencyTokens {
+			d.applyIdempotencyTokensLocked(&b)
+		}
+
+		// The chunks of a batch committed by Batch.CommitChunked are replayed
+		// once they're followed by the commit marker, and are otherwise
+		// discarded.
+		br := b.Reader()
+		switch kind, _, _, _ := br.Next(); kind {
+		case InternalKeyKindBatchChunk:
+			pendingChunks = append(pendingChunks, append([]byte(nil), b.data...))
+			buf.Reset()
+			continue
+		case InternalKeyKindCommitChunks:
+			for _, data := range pendingChunks {
+				chunk := Batch{db: d}
+				chunk.SetRepr(data)
+				if err = replayBatch(&chunk); err != nil {
+					return nil, 0, err
+				}
+			}
+			pendingChunks = nil
+			buf.Reset()
+			continue
+		}
+		pendingChunks = nil
 
 		{
 			br := b.Reader()
@@ -802,7 +971,7 @@ func (d *DB) replayWAL(
 					panic("pebble: couldn't load all files in WAL entry.")
 				}
 
-				entry, err = d.newIngestedFlushableEntry(
+				ingestEntry, err := d.newIngestedFlushableEntry(
 					meta, seqNum, logNum,
 				)
 				if err != nil {
@@ -810,7 +979,7 @@ func (d *DB) replayWAL(
 				}
 
 				if d.opts.ReadOnly {
-					d.mu.mem.queue = append(d.mu.mem.queue, entry)
+					d.mu.mem.queue = append(d.mu.mem.queue, ingestEntry)
 					// We added the IngestSST flushable to the queue. But there
 					// must be at least one WAL entry waiting to be replayed. We
 					// have to ensure this newer WAL entry isn't replayed into
@@ -821,7 +990,7 @@ func (d *DB) replayWAL(
 					// set d.mu.mem.mutable to a newer value.
 					d.mu.mem.mutable = nil
 				} else {
-					toFlush = append(toFlush, entry)
+					toFlush = append(toFlush, ingestEntry)
 					// During WAL replay, the lsm only has L0, hence, the
 					// baseLevel is 1. For the sake of simplicity, we place the
 					// ingested files in L0 here, instead of finding their
@@ -840,7 +1009,7 @@ func (d *DB) replayWAL(
 					c := newFlush(
 						d.opts, d.mu.versions.currentVersion(),
 						1, /* base level */
-						[]*flushableEntry{entry},
+						[]*flushableEntry{ingestEntry},
 					)
 					for _, file := range c.flushing[0].flushable.(*ingestedFlushable).files {
 						ve.NewFiles = append(ve.NewFiles, newFileEntry{Level: 0, Meta: file.FileMetadata})
@@ -850,50 +1019,8 @@ func (d *DB) replayWAL(
 			}
 		}
 
-		if b.memTableSize >= uint64(d.largeBatchThreshold) {
-			flushMem()
-			// Make a copy of the data slice since it is currently owned by buf and will
-			// be reused in the next iteration.
-			b.data = append([]byte(nil), b.data...)
-			b.flushable = newFlushableBatch(&b, d.opts.Comparer)
-			entry := d.newFlushableEntry(b.flushable, logNum, b.SeqNum())
-			// Disable memory accounting by adding a reader ref that will never be
-			// removed.
-			entry.readerRefs++
-			if d.opts.ReadOnly {
-				d.mu.mem.queue = append(d.mu.mem.queue, entry)
-				// We added the flushable batch to the flushable to the queue.
-				// But there must be at least one WAL entry waiting to be
-				// replayed. We have to ensure this newer WAL entry isn't
-				// replayed into the current value of d.mu.mem.mutable because
-				// the current mutable memtable exists before this flushable
-				// entry in the memtable queue. To ensure this, we just need to
-				// unset d.mu.mem.mutable. When a newer WAL is replayed, we will
-				// set d.mu.mem.mutable to a newer value.
-				d.mu.mem.mutable = nil
-			} else {
-				toFlush = append(toFlush, entry)
-			}
-		} else {
-			ensureMem(seqNum)
-			if err = mem.prepare(&b); err != nil && err != arenaskl.ErrArenaFull {
-				return nil, 0, err
-			}
-			// We loop since DB.newMemTable() slowly grows the size of allocated memtables, so the
-			// batch may not initially fit, but will eventually fit (since it is smaller than
-			// largeBatchThreshold).
-			for err == arenaskl.ErrArenaFull {
-				flushMem()
-				ensureMem(seqNum)
-				err = mem.prepare(&b)
-				if err != nil && err != arenaskl.ErrArenaFull {
-					return nil, 0, err
-				}
-			}
-			if err = mem.apply(&b, seqNum); err != nil {
-				return nil, 0, err
-			}
-			mem.writerUnref()
+		if err = replayBatch(&b); err != nil {
+			return nil, 0, err
 		}
 		buf.Reset()
 	}
@@ -161,7 +161,7 @@ func TestNewDBFilenames(t *testing.T) {
 			"LOCK",
 			"MANIFEST-000001",
 			"OPTIONS-000003",
-			"marker.format-version.000013.014",
+			"marker.format-version.000018.019",
 			"marker.manifest.000001.MANIFEST-000001",
 		},
 	}
@@ -1019,6 +1019,42 @@ func TestOpenWALReplayMemtableGrowth(t *testing.T) {
 	db.Close()
 }
 
+// TestOpenWALReplayFlushError tests that a failure to flush the memtables
+// replayed from the WAL fails the open without losing their contents.
+func TestOpenWALReplayFlushError(t *testing.T) {
+	mem := vfs.NewMem()
+	var inject atomic.Bool
+	opts := &Options{
+		FS: errorfs.Wrap(mem, errorfs.InjectorFunc(func(op errorfs.Op, path string) error {
+			if inject.Load() && op == errorfs.OpCreate && filepath.Ext(path) == ".sst" {
+				return errorfs.ErrInjected
+			}
+			return nil
+		})),
+	}
+	func() {
+		d, err := Open("", opts)
+		require.NoError(t, err)
+		defer d.Close()
+		require.NoError(t, d.Set([]byte("a"), []byte("1"), Sync))
+		require.NoError(t, d.Set([]byte("b"), []byte("2"), Sync))
+	}()
+
+	inject.Store(true)
+	_, err := Open("", opts)
+	require.True(t, errors.Is(err, errorfs.ErrInjected))
+
+	inject.Store(false)
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	for _, k := range []string{"a", "b"} {
+		_, closer, err := d.Get([]byte(k))
+		require.NoError(t, err)
+		require.NoError(t, closer.Close())
+	}
+}
+
 func TestGetVersion(t *testing.T) {
 	mem := vfs.NewMem()
 	opts := &Options{
@@ -6,6 +6,7 @@ package pebble
 
 import (
 	"bytes"
+	"crypto/cipher"
 	"fmt"
 	"io"
 	"runtime"
@@ -162,6 +163,12 @@ type IterOptions struct {
 	// would be to add a NewSnapshot variant. Creating a snapshot is heavier
 	// weight than creating an iterator, so we have opted to support this
 	// iterator option.
+	//
+	// An iterator over a Snapshot with this option observes the state as of
+	// the earlier of the snapshot and the most recent memtable flush: since
+	// memtables are flushed in seqnum order, the flushed state only lacks the
+	// writes of the snapshot that are still in the memtables if it's older
+	// than the snapshot. The option isn't supported by Batch.NewIter.
 	OnlyReadGuaranteedDurable bool
 	// UseL6Filters allows the caller to opt into reading filter blocks for L6
 	// sstables. Helpful if a lot of SeekPrefixGEs are expected in quick
@@ -171,6 +178,16 @@ type IterOptions struct {
 	// existing is not low or if we just expect a one-time Seek (where loading the
 	// data block directly is better).
 	UseL6Filters bool
+	// YieldBytes and Yield allow long scans to cooperatively yield. If both are
+	// set, a positioning method that brings the bytes of blocks loaded by the
+	// iterator (see InternalIteratorStats.BlockBytes) to YieldBytes or more
+	// beyond the previous call to Yield calls Yield before returning. Yield may
+	// block, e.g. to wait for its turn in a scheduler fair across many
+	// concurrent scans. If Yield returns an error, the positioning method
+	// fails: the iterator is left unpositioned and Error returns the error. A
+	// subsequent absolute positioning method (e.g. SeekGE) may resume the scan.
+	YieldBytes uint64
+	Yield      func() error
 
 	// Internal options.
 
@@ -346,6 +363,17 @@ type LevelOptions struct {
 	// The default value is 90
 	BlockSizeThreshold int
 
+	// BlockSizeFunc, if set, returns the target uncompressed size in bytes of
+	// the data block beginning with the given user key, overriding BlockSize.
+	// It allows the block size to depend on the key range, for example by
+	// using small blocks for the key prefixes serving point lookups and large
+	// blocks for the ones that are mostly scanned. A block's size is chosen
+	// when its first key is added, so it applies until the block is full. A
+	// non-positive size selects BlockSize.
+	//
+	// The default value is nil.
+	BlockSizeFunc func(key []byte) int
+
 	// Compression defines the per-block compression to use.
 	//
 	// The default value (DefaultCompression) uses snappy compression.
@@ -378,6 +406,27 @@ type LevelOptions struct {
 	// The default value is the value of BlockSize.
 	IndexBlockSize int
 
+	// TwoLevelIndexThreshold is the minimum uncompressed size in bytes of the
+	// index of an sstable for it to be partitioned into a two-level index,
+	// whose index blocks are only loaded as needed. A smaller index that
+	// doesn't fit in a single index block of IndexBlockSize is written as a
+	// single, larger index block.
+	//
+	// The default value of zero partitions every index that doesn't fit in a
+	// single index block.
+	TwoLevelIndexThreshold int
+
+	// PartitionedFilters partitions the table filter of an sstable into filter
+	// blocks, which are cut along with the index blocks (see IndexBlockSize),
+	// and writes a top-level filter index on them, so that a filter lookup in a
+	// large sstable only loads the filter block that may contain the key. A
+	// filter that fits in a single partition is written as a single filter
+	// block. Versions of Pebble that don't support partitioned filters still
+	// read the sstable, but ignore its filter.
+	//
+	// The default value is false.
+	PartitionedFilters bool
+
 	// The target file size for the level.
 	TargetFileSize int64
 }
@@ -491,6 +540,18 @@ type Options struct {
 		// compaction up to MaxConcurrentCompactions.
 		L0CompactionConcurrency int
 
+		// IntraL0CompactionMinStackDepth is the minimum reduction in the
+		// stack depth of L0 sublevels that an intra-L0 compaction must
+		// achieve in order to be picked. Intra-L0 compactions are only picked
+		// when an L0 -> Lbase compaction cannot be, and a shallow intra-L0
+		// compaction consumes compaction resources while doing little to
+		// reduce read amplification. Workloads that are dominated by ingested
+		// sstables, which tend to stack within a narrow key span, may benefit
+		// from a lower value.
+		//
+		// The default value is 4.
+		IntraL0CompactionMinStackDepth int
+
 		// CompactionDebtConcurrency controls the threshold of compaction debt
 		// at which additional compaction concurrency slots are added. For every
 		// multiple of this value in compaction debt bytes, an additional
@@ -499,6 +560,39 @@ type Options struct {
 		// concurrency slots as determined by the two options is chosen.
 		CompactionDebtConcurrency int
 
+		// MaxKeySize, MaxValueSize and MaxBatchSize limit the size of the
+		// writes committed to the DB. A batch is rejected if one of its keys
+		// (including the end keys of range deletions and range keys) is longer
+		// than MaxKeySize bytes, one of its values (including the encoded
+		// suffixes and values of range keys) is longer than MaxValueSize bytes,
+		// or its encoded representation is longer than MaxBatchSize bytes. The
+		// commit of a rejected batch fails with ErrKeyTooLarge,
+		// ErrValueTooLarge or ErrBatchTooLarge respectively, and none of its
+		// writes are applied. The rejections are counted in
+		// Metrics.RejectedWrites. The limits apply to batches committed by
+		// Batch.Commit, DB.Apply and the DB's write methods, as well as to
+		// Batch.CommitChunked and Batch.Prepare, but not to ingested sstables.
+		//
+		// Oversized keys and values degrade the performance of the DB, and
+		// keys and values of 4GB or more can't be represented in sstables, so
+		// these limits allow an application to reject them at the time of the
+		// write. The default value of 0 disables the respective limit.
+		MaxKeySize   int
+		MaxValueSize int
+		MaxBatchSize int
+
+		// MVCCGarbageProperties, if true, adds a built-in table property
+		// collector to the tables written by flushes and compactions, which
+		// records the number and size of the point keys that are overwritten
+		// by a newer point key with the same prefix (see Comparer.Split) in the
+		// same table, and of the point deletions, as estimates of the table's
+		// MVCC garbage. The estimates are loaded with the table stats, and
+		// their sums per level are reported by
+		// Metrics.Levels[i].Additional.MVCCGarbage, so the application can
+		// schedule its garbage collection, or manual compactions, once the
+		// garbage exceeds its thresholds.
+		MVCCGarbageProperties bool
+
 		// MinDeletionRate is the minimum number of bytes per second that would
 		// be deleted. Deletion pacing is used to slow down deletions when
 		// compactions finish up or readers close, and newly-obsolete files need
@@ -510,6 +604,18 @@ type Options struct {
 		// deletion pacing, which is also the default.
 		MinDeletionRate int
 
+		// ReadOnlyOnDiskFull, if true, transitions the DB into read-only mode
+		// when a write to the WAL, or of a flush or compaction, fails because
+		// the disk is out of space, rather than crashing the process. In
+		// read-only mode, writes fail with ErrDiskFull, flushes and compactions
+		// are paused, and reads continue to be served. The transition invokes
+		// EventListener.DiskFull; once disk space has been freed, DB.ResumeWrites
+		// returns the DB to normal operation. Writes that were committed
+		// without syncing the WAL shortly before the transition may only be
+		// durable once ResumeWrites completes. Failures to write the MANIFEST
+		// remain fatal.
+		ReadOnlyOnDiskFull bool
+
 		// ReadCompactionRate controls the frequency of read triggered
 		// compactions by adjusting `AllowedSeeks` in manifest.FileMetadata:
 		//
@@ -550,6 +656,30 @@ type Options struct {
 		// limited by runtime.GOMAXPROCS.
 		TableCacheShards int
 
+		// TableCacheMaxBytes, if positive, limits the memory of the tables open
+		// in the table cache, in addition to the limit on their count derived
+		// from MaxOpenFiles. The memory of an open table is estimated as the
+		// size of its reader and of its index and filter blocks, which are read
+		// by every lookup of the table. The count limit alone can be far off
+		// the memory usage of stores with many small or many large tables.
+		// TableCacheMaxBytes is ignored if the DB uses a shared
+		// Options.TableCache, whose limit is set by TableCache.SetMaxBytes.
+		TableCacheMaxBytes int64
+
+		// MemTableShards is the number of skiplists indexing the point keys of
+		// each memtable. With more than one shard, the point keys are sharded by
+		// a hash of their prefix (see Comparer.Split) across skiplists sharing
+		// the memtable's arena, which reduces the contention between concurrent
+		// writers and speeds up point lookups, at the expense of iteration,
+		// which must merge the shards. All the keys sharing a prefix are in the
+		// same shard, so Iterator.SeekPrefixGE and point lookups only consider
+		// a single shard. Small memtables use fewer shards, so that the empty
+		// skiplists take up at most a quarter of the memtable.
+		//
+		// The default value of 0 (like 1) indexes the point keys of a memtable
+		// in a single skiplist.
+		MemTableShards int
+
 		// KeyValidationFunc is a function to validate a user key in an SSTable.
 		//
 		// Currently, this function is used to validate the smallest and largest
@@ -627,11 +757,79 @@ type Options struct {
 		// sstables, and does not start rewriting existing sstables.
 		RequiredInPlaceValueBound UserKeyPrefixBound
 
+		// AllowNonEssentialCompactions, if set, is consulted whenever automatic
+		// compactions are picked, and returning false defers the compactions
+		// that don't help keep up with writes: elision-only, read-triggered and
+		// rewrite compactions of files marked for compaction. Score-based
+		// compactions, which maintain the shape of the LSM (including L0), and
+		// delete-only compactions are never deferred, nor are manual
+		// compactions and the rewrites required by format major version
+		// upgrades. This restricts the background I/O of non-essential
+		// compactions to operator-defined windows (see CompactionWindows) or
+		// to low-load periods. When the function starts returning true, call
+		// DB.ScheduleCompactions to schedule the deferred compactions without
+		// waiting for the next flush or compaction.
+		//
+		// The function is called with the DB mutex held, so it must be cheap
+		// and must not call into the DB. The default allows non-essential
+		// compactions at all times.
+		AllowNonEssentialCompactions func() bool
+
 		// DisableIngestAsFlushable disables lazy ingestion of sstables through
 		// a WAL write and memtable rotation. Only effectual if the the format
 		// major version is at least `FormatFlushableIngest`.
 		DisableIngestAsFlushable func() bool
 
+		// FlushTargetFileSize is the target size of the sstables produced by
+		// a flush when flush splitting is enabled (see FlushSplitBytes).
+		// Flush outputs are split once they reach this size, at boundaries
+		// of the base level's files that would otherwise cause excessive
+		// overlap, and at L0 flush split keys. Smaller outputs smooth the
+		// shape of L0 and reduce the size of subsequent L0 compactions.
+		//
+		// The default value is 0, which uses L0's TargetFileSize.
+		FlushTargetFileSize int64
+
+		// FlushOutputPacingRate, if non-zero, is the rate in bytes per second
+		// at which a flush split into multiple output sstables may write them.
+		// After finishing each output sstable other than the last, the flush
+		// waits until it's within the rate, spreading the I/O of a large flush
+		// over time rather than producing a latency spike. Pacing is bypassed
+		// whenever additional immutable memtables are queued behind the
+		// flush, so that pacing never extends a write stall.
+		//
+		// The default value is 0, which disables flush pacing.
+		FlushOutputPacingRate int
+
+		// HistoryRetentionSeqNums, if non-zero, instructs flushes and
+		// compactions to retain every version of every point key and range
+		// deletion written within the most recent HistoryRetentionSeqNums
+		// sequence numbers. Overwritten values and deletion tombstones within
+		// this window are not collapsed or elided, as if a snapshot were open
+		// at every sequence number in the window. Retained versions are
+		// exposed through DB.ScanInternal, allowing change-data-capture and
+		// as-of reads without holding long-lived Snapshots. Range keys are
+		// only retained at the granularity of the window's boundary.
+		//
+		// The default value is 0, which disables history retention.
+		HistoryRetentionSeqNums uint64
+
+		// HistoryRetentionDuration, if non-zero, instructs flushes and
+		// compactions to retain every version of every point key and range
+		// deletion written within the most recent HistoryRetentionDuration,
+		// like HistoryRetentionSeqNums does for a window of sequence numbers.
+		// The DB samples the sequence numbers it writes over time, and
+		// retains the history written since a sample taken at least
+		// HistoryRetentionDuration ago, so history may be retained for
+		// somewhat longer than the duration. The samples aren't persisted:
+		// the history written before the DB is opened is retained until
+		// HistoryRetentionDuration after it's opened. If both
+		// HistoryRetentionSeqNums and HistoryRetentionDuration are set, the
+		// longer of the two windows is retained.
+		//
+		// The default value is 0, which disables history retention.
+		HistoryRetentionDuration time.Duration
+
 		// SharedStorage is a second FS-like storage medium that can be shared
 		// between multiple Pebble instances. It is used to store sstables only, and
 		// is managed by objstorage.Provider. Each sstable might only be written to
@@ -641,6 +839,99 @@ type Options struct {
 		// be reading this file. This FS is expected to have slower read/write
 		// performance than the default FS above.
 		SharedStorage shared.Storage
+
+		// CreateOnShared, if true, causes the sstables written by flushes and
+		// compactions to be created on SharedStorage once the creator ID of the
+		// DB is set (see DB.SetCreatorID). Until then, sstables are created
+		// locally.
+		CreateOnShared bool
+
+		// BlockCacheLimit, if positive, limits the size of the blocks of the DB
+		// in the block cache (see Options.Cache). It's meant for caches shared
+		// by multiple DBs, so that one DB can't evict the blocks of the other
+		// DBs: the blocks of the DB are evicted once it exceeds its limit,
+		// regardless of the space available in the cache.
+		BlockCacheLimit int64
+
+		// BlockCacheReservation, if positive, reserves space in the block cache
+		// (see Options.Cache) for the blocks of the DB. It's meant for caches
+		// shared by multiple DBs: the blocks of the DB aren't evicted to make
+		// room for the blocks of the other DBs while they fit within the
+		// reservation. The reservations of the DBs sharing a cache should add
+		// up to less than the size of the cache. Unlike the memory reserved for
+		// memtables, the reservation doesn't shrink the cache.
+		BlockCacheReservation int64
+
+		// WALCipher, if set, is used to encrypt and authenticate the records of
+		// the WALs, which otherwise hold the plaintext of the writes: an FS
+		// encrypting the files at rest (see Options.FS) may encrypt the WALs
+		// by blocks, which the WAL's recycling and preallocation don't play
+		// well with. Each record is sealed with a random nonce, so the cipher
+		// must have nonces of at least 12 bytes, like AES-GCM. Replaying an
+		// encrypted WAL requires WALCipher to be set to a cipher with the same
+		// key. While WALCipher is set, a WAL that isn't encrypted fails to
+		// replay with a corruption error, unless AllowUnencryptedWALs is set.
+		WALCipher cipher.AEAD
+
+		// AllowUnencryptedWALs, if true, allows the WALs that aren't encrypted,
+		// like those written before WALCipher was set, to be replayed while
+		// WALCipher is set. It's meant for enabling WALCipher on an existing DB:
+		// the records of these WALs aren't authenticated, so anyone who can
+		// write to the WAL directory could substitute one for an encrypted WAL.
+		// It should be unset once the DB has been opened with WALCipher.
+		AllowUnencryptedWALs bool
+
+		// MaxIdempotencyTokens is the number of the most recently committed
+		// idempotency tokens (see Batch.AddIdempotencyToken) that are retained,
+		// and thus reported by DB.IdempotencyTokenCommitted. Older tokens are
+		// forgotten. The retained tokens are held in memory, and rewritten to
+		// every new WAL, so the retention should cover the window within which
+		// producers may retry their writes, and no more. The default is 10,000.
+		MaxIdempotencyTokens int
+
+		// MaxIdempotencyTokensSize bounds the total size in bytes of the
+		// retained idempotency tokens, and thus the size of the record holding
+		// them which is written to every new WAL. The oldest tokens are
+		// forgotten once the retained tokens exceed either this size or
+		// MaxIdempotencyTokens, and a token larger than this size can't be
+		// added to a batch. The default is 1MB.
+		MaxIdempotencyTokensSize int
+
+		// IOUring, if true, causes the sstables on the local filesystem to be
+		// read through a Linux io_uring instance shared by the readers of the
+		// DB, so that concurrent reads, like those of the iterators prefetching
+		// blocks, don't each block a thread, and have a lower syscall overhead.
+		// It's ignored (and logged) where io_uring isn't supported, including
+		// on other platforms and for an FS whose files have no file descriptor.
+		IOUring bool
+
+		// BackgroundIOPriority is the I/O priority hint of the flushes and
+		// compactions (see vfs.WithIOPriority), so that their I/O contends less
+		// with the foreground reads for the device. The default,
+		// vfs.IOPriorityDefault, leaves their I/O at the priority of the
+		// process.
+		//
+		// Note that a background priority slows down flushes and compactions
+		// under a foreground load, which may in turn stall writes.
+		BackgroundIOPriority vfs.IOPriority
+
+		// DropCompactionReadsFromPageCache, if true, causes the data of the
+		// local sstables read by compactions to be dropped from the page cache
+		// (with fadvise(POSIX_FADV_DONTNEED) on Linux) when the compaction is
+		// done reading it. The compaction's inputs are about to be deleted, so
+		// their pages would otherwise only evict those of the foreground reads.
+		DropCompactionReadsFromPageCache bool
+
+		// MemoryBudget, if positive, is the number of bytes that the memory
+		// used by the DB should fit in, covering its memtables, its blocks in
+		// the block cache, its table cache and its iterators (see
+		// Metrics.Memory). The memtables are the part of the usage that grows
+		// with the write load, so the budget is enforced by stalling writes
+		// when a memtable fills up while the budget is exceeded, until the
+		// memtables queued for flushing are flushed. The other components are
+		// bounded by their own options, like the size of Options.Cache, and
+		// should be sized to leave room for a few memtables within the budget.
+		MemoryBudget int64
 	}
 
 	// Filters is a map from filter policy name to filter policy. It is used for
@@ -901,12 +1192,24 @@ func (o *Options) EnsureDefaults() *Options {
 	if o.Comparer == nil {
 		o.Comparer = DefaultComparer
 	}
+	if o.Experimental.AllowNonEssentialCompactions == nil {
+		o.Experimental.AllowNonEssentialCompactions = func() bool { return true }
+	}
+	if o.Experimental.MaxIdempotencyTokens <= 0 {
+		o.Experimental.MaxIdempotencyTokens = 10000
+	}
+	if o.Experimental.MaxIdempotencyTokensSize <= 0 {
+		o.Experimental.MaxIdempotencyTokensSize = 1 << 20
+	}
 	if o.Experimental.DisableIngestAsFlushable == nil {
 		o.Experimental.DisableIngestAsFlushable = func() bool { return false }
 	}
 	if o.Experimental.L0CompactionConcurrency <= 0 {
 		o.Experimental.L0CompactionConcurrency = 10
 	}
+	if o.Experimental.IntraL0CompactionMinStackDepth <= 0 {
+		o.Experimental.IntraL0CompactionMinStackDepth = minIntraL0Count
+	}
 	if o.Experimental.CompactionDebtConcurrency <= 0 {
 		o.Experimental.CompactionDebtConcurrency = 1 << 30 // 1 GB
 	}
@@ -1129,8 +1432,23 @@ func (o *Options) String() string {
 	fmt.Fprintf(&buf, "  flush_delay_delete_range=%s\n", o.FlushDelayDeleteRange)
 	fmt.Fprintf(&buf, "  flush_delay_range_key=%s\n", o.FlushDelayRangeKey)
 	fmt.Fprintf(&buf, "  flush_split_bytes=%d\n", o.FlushSplitBytes)
+	if o.Experimental.FlushTargetFileSize != 0 {
+		fmt.Fprintf(&buf, "  flush_target_file_size=%d\n", o.Experimental.FlushTargetFileSize)
+	}
+	if o.Experimental.FlushOutputPacingRate != 0 {
+		fmt.Fprintf(&buf, "  flush_output_pacing_rate=%d\n", o.Experimental.FlushOutputPacingRate)
+	}
 	fmt.Fprintf(&buf, "  format_major_version=%d\n", o.FormatMajorVersion)
+	if o.Experimental.HistoryRetentionSeqNums != 0 {
+		fmt.Fprintf(&buf, "  history_retention_seqnums=%d\n", o.Experimental.HistoryRetentionSeqNums)
+	}
+	if o.Experimental.HistoryRetentionDuration != 0 {
+		fmt.Fprintf(&buf, "  history_retention_duration=%s\n", o.Experimental.HistoryRetentionDuration)
+	}
 	fmt.Fprintf(&buf, "  l0_compaction_concurrency=%d\n", o.Experimental.L0CompactionConcurrency)
+	if v := o.Experimental.IntraL0CompactionMinStackDepth; v > 0 && v != minIntraL0Count {
+		fmt.Fprintf(&buf, "  intra_l0_compaction_min_stack_depth=%d\n", o.Experimental.IntraL0CompactionMinStackDepth)
+	}
 	fmt.Fprintf(&buf, "  l0_compaction_file_threshold=%d\n", o.L0CompactionFileThreshold)
 	fmt.Fprintf(&buf, "  l0_compaction_threshold=%d\n", o.L0CompactionThreshold)
 	fmt.Fprintf(&buf, "  l0_stop_writes_threshold=%d\n", o.L0StopWritesThreshold)
@@ -1138,15 +1456,33 @@ func (o *Options) String() string {
 	if o.Experimental.LevelMultiplier != defaultLevelMultiplier {
 		fmt.Fprintf(&buf, "  level_multiplier=%d\n", o.Experimental.LevelMultiplier)
 	}
+	if o.Experimental.MaxBatchSize != 0 {
+		fmt.Fprintf(&buf, "  max_batch_size=%d\n", o.Experimental.MaxBatchSize)
+	}
 	fmt.Fprintf(&buf, "  max_concurrent_compactions=%d\n", o.MaxConcurrentCompactions())
+	if o.Experimental.MaxKeySize != 0 {
+		fmt.Fprintf(&buf, "  max_key_size=%d\n", o.Experimental.MaxKeySize)
+	}
 	fmt.Fprintf(&buf, "  max_manifest_file_size=%d\n", o.MaxManifestFileSize)
 	fmt.Fprintf(&buf, "  max_open_files=%d\n", o.MaxOpenFiles)
+	if o.Experimental.MaxValueSize != 0 {
+		fmt.Fprintf(&buf, "  max_value_size=%d\n", o.Experimental.MaxValueSize)
+	}
+	if o.Experimental.MemTableShards != 0 {
+		fmt.Fprintf(&buf, "  mem_table_shards=%d\n", o.Experimental.MemTableShards)
+	}
 	fmt.Fprintf(&buf, "  mem_table_size=%d\n", o.MemTableSize)
 	fmt.Fprintf(&buf, "  mem_table_stop_writes_threshold=%d\n", o.MemTableStopWritesThreshold)
 	fmt.Fprintf(&buf, "  min_deletion_rate=%d\n", o.Experimental.MinDeletionRate)
 	fmt.Fprintf(&buf, "  merger=%s\n", o.Merger.Name)
+	if o.Experimental.MVCCGarbageProperties {
+		fmt.Fprintf(&buf, "  mvcc_garbage_properties=%t\n", o.Experimental.MVCCGarbageProperties)
+	}
 	fmt.Fprintf(&buf, "  point_tombstone_weight=%f\n", o.Experimental.PointTombstoneWeight)
 	fmt.Fprintf(&buf, "  read_compaction_rate=%d\n", o.Experimental.ReadCompactionRate)
+	if o.Experimental.ReadOnlyOnDiskFull {
+		fmt.Fprintf(&buf, "  read_only_on_disk_full=%t\n", o.Experimental.ReadOnlyOnDiskFull)
+	}
 	fmt.Fprintf(&buf, "  read_sampling_multiplier=%d\n", o.Experimental.ReadSamplingMultiplier)
 	fmt.Fprintf(&buf, "  strict_wal_tail=%t\n", o.private.strictWALTail)
 	fmt.Fprintf(&buf, "  table_cache_shards=%d\n", o.Experimental.TableCacheShards)
@@ -1193,7 +1529,9 @@ func (o *Options) String() string {
 		fmt.Fprintf(&buf, "  filter_policy=%s\n", filterPolicyName(l.FilterPolicy))
 		fmt.Fprintf(&buf, "  filter_type=%s\n", l.FilterType)
 		fmt.Fprintf(&buf, "  index_block_size=%d\n", l.IndexBlockSize)
+		fmt.Fprintf(&buf, "  partitioned_filters=%t\n", l.PartitionedFilters)
 		fmt.Fprintf(&buf, "  target_file_size=%d\n", l.TargetFileSize)
+		fmt.Fprintf(&buf, "  two_level_index_threshold=%d\n", l.TwoLevelIndexThreshold)
 	}
 
 	return buf.String()
@@ -1343,6 +1681,10 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				o.FlushDelayRangeKey, err = time.ParseDuration(value)
 			case "flush_split_bytes":
 				o.FlushSplitBytes, err = strconv.ParseInt(value, 10, 64)
+			case "flush_target_file_size":
+				o.Experimental.FlushTargetFileSize, err = strconv.ParseInt(value, 10, 64)
+			case "flush_output_pacing_rate":
+				o.Experimental.FlushOutputPacingRate, err = strconv.Atoi(value)
 			case "format_major_version":
 				// NB: The version written here may be stale. Open does
 				// not use the format major version encoded in the
@@ -1356,6 +1698,12 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				if err == nil {
 					o.FormatMajorVersion = FormatMajorVersion(v)
 				}
+			case "history_retention_seqnums":
+				o.Experimental.HistoryRetentionSeqNums, err = strconv.ParseUint(value, 10, 64)
+			case "history_retention_duration":
+				o.Experimental.HistoryRetentionDuration, err = time.ParseDuration(value)
+			case "intra_l0_compaction_min_stack_depth":
+				o.Experimental.IntraL0CompactionMinStackDepth, err = strconv.Atoi(value)
 			case "l0_compaction_concurrency":
 				o.Experimental.L0CompactionConcurrency, err = strconv.Atoi(value)
 			case "l0_compaction_file_threshold":
@@ -1370,6 +1718,8 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				o.LBaseMaxBytes, err = strconv.ParseInt(value, 10, 64)
 			case "level_multiplier":
 				o.Experimental.LevelMultiplier, err = strconv.Atoi(value)
+			case "max_batch_size":
+				o.Experimental.MaxBatchSize, err = strconv.Atoi(value)
 			case "max_concurrent_compactions":
 				var concurrentCompactions int
 				concurrentCompactions, err = strconv.Atoi(value)
@@ -1378,10 +1728,16 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				} else {
 					o.MaxConcurrentCompactions = func() int { return concurrentCompactions }
 				}
+			case "max_key_size":
+				o.Experimental.MaxKeySize, err = strconv.Atoi(value)
 			case "max_manifest_file_size":
 				o.MaxManifestFileSize, err = strconv.ParseInt(value, 10, 64)
 			case "max_open_files":
 				o.MaxOpenFiles, err = strconv.Atoi(value)
+			case "max_value_size":
+				o.Experimental.MaxValueSize, err = strconv.Atoi(value)
+			case "mem_table_shards":
+				o.Experimental.MemTableShards, err = strconv.Atoi(value)
 			case "mem_table_size":
 				o.MemTableSize, err = strconv.Atoi(value)
 			case "mem_table_stop_writes_threshold":
@@ -1394,6 +1750,8 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 			case "min_flush_rate":
 				// Do nothing; option existed in older versions of pebble, and
 				// may be meaningful again eventually.
+			case "mvcc_garbage_properties":
+				o.Experimental.MVCCGarbageProperties, err = strconv.ParseBool(value)
 			case "point_tombstone_weight":
 				o.Experimental.PointTombstoneWeight, err = strconv.ParseFloat(value, 64)
 			case "strict_wal_tail":
@@ -1411,6 +1769,8 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				}
 			case "read_compaction_rate":
 				o.Experimental.ReadCompactionRate, err = strconv.ParseInt(value, 10, 64)
+			case "read_only_on_disk_full":
+				o.Experimental.ReadOnlyOnDiskFull, err = strconv.ParseBool(value)
 			case "read_sampling_multiplier":
 				o.Experimental.ReadSamplingMultiplier, err = strconv.ParseInt(value, 10, 64)
 			case "table_cache_shards":
@@ -1495,8 +1855,12 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				}
 			case "index_block_size":
 				l.IndexBlockSize, err = strconv.Atoi(value)
+			case "partitioned_filters":
+				l.PartitionedFilters, err = strconv.ParseBool(value)
 			case "target_file_size":
 				l.TargetFileSize, err = strconv.ParseInt(value, 10, 64)
+			case "two_level_index_threshold":
+				l.TwoLevelIndexThreshold, err = strconv.Atoi(value)
 			default:
 				if hooks != nil && hooks.SkipUnknown != nil && hooks.SkipUnknown(section+"."+key, value) {
 					return nil
@@ -1570,10 +1934,17 @@ func (o *Options) Validate() error {
 		fmt.Fprintf(&buf, "MemTableStopWritesThreshold (%d) must be >= 2\n",
 			o.MemTableStopWritesThreshold)
 	}
+	if o.Experimental.MaxKeySize < 0 || o.Experimental.MaxValueSize < 0 || o.Experimental.MaxBatchSize < 0 {
+		fmt.Fprintf(&buf, "MaxKeySize (%d), MaxValueSize (%d) and MaxBatchSize (%d) must be >= 0\n",
+			o.Experimental.MaxKeySize, o.Experimental.MaxValueSize, o.Experimental.MaxBatchSize)
+	}
 	if o.FormatMajorVersion > FormatNewest {
 		fmt.Fprintf(&buf, "FormatMajorVersion (%d) must be <= %d\n",
 			o.FormatMajorVersion, FormatNewest)
 	}
+	if c := o.Experimental.WALCipher; c != nil && c.NonceSize() < 12 {
+		fmt.Fprintf(&buf, "WALCipher nonce size (%d) must be >= 12\n", c.NonceSize())
+	}
 	if o.TableCache != nil && o.Cache != o.TableCache.cache {
 		fmt.Fprintf(&buf, "underlying cache in the TableCache and the Cache dont match\n")
 	}
@@ -1611,6 +1982,11 @@ func (o *Options) MakeWriterOptions(level int, format sstable.TableFormat) sstab
 			writerOpts.MergerName = o.Merger.Name
 		}
 		writerOpts.TablePropertyCollectors = o.TablePropertyCollectors
+		if o.Experimental.MVCCGarbageProperties {
+			n := len(o.TablePropertyCollectors)
+			writerOpts.TablePropertyCollectors = append(o.TablePropertyCollectors[:n:n],
+				newMVCCGarbageCollector(o.Comparer.Split))
+		}
 		writerOpts.BlockPropertyCollectors = o.BlockPropertyCollectors
 	}
 	if format >= sstable.TableFormatPebblev3 {
@@ -1621,9 +1997,12 @@ func (o *Options) MakeWriterOptions(level int, format sstable.TableFormat) sstab
 	writerOpts.BlockRestartInterval = levelOpts.BlockRestartInterval
 	writerOpts.BlockSize = levelOpts.BlockSize
 	writerOpts.BlockSizeThreshold = levelOpts.BlockSizeThreshold
+	writerOpts.BlockSizeFunc = levelOpts.BlockSizeFunc
 	writerOpts.Compression = levelOpts.Compression
 	writerOpts.FilterPolicy = levelOpts.FilterPolicy
 	writerOpts.FilterType = levelOpts.FilterType
 	writerOpts.IndexBlockSize = levelOpts.IndexBlockSize
+	writerOpts.TwoLevelIndexThreshold = levelOpts.TwoLevelIndexThreshold
+	writerOpts.PartitionedFilters = levelOpts.PartitionedFilters
 	return writerOpts
 }
@@ -111,7 +111,9 @@ func TestOptionsString(t *testing.T) {
   filter_policy=none
   filter_type=table
   index_block_size=4096
+  partitioned_filters=false
   target_file_size=2097152
+  two_level_index_threshold=0
 `
 
 	var opts *Options
@@ -111,6 +111,54 @@ func (p *deletionPacer) maybeThrottle(bytesToDelete uint64) error {
 	return p.limit(bytesToDelete, p.getInfo())
 }
 
+// flushPacer paces the output sstables of a flush that's split into multiple
+// files, smoothing the write bandwidth consumed by large flushes (see
+// Options.Experimental.FlushOutputPacingRate). The rate limiter is applied
+// after each output sstable is finished, rather than on each iteration step.
+type flushPacer struct {
+	limiter limiter
+	// bypass is consulted before each throttle. If it returns true, the output
+	// is accounted for in the limiter but not delayed.
+	bypass func() bool
+}
+
+// newFlushPacer instantiates a new flushPacer. The limiter passed in must be
+// a singleton shared across this pebble instance.
+func newFlushPacer(limiter limiter, bypass func() bool) *flushPacer {
+	return &flushPacer{
+		limiter: limiter,
+		bypass:  bypass,
+	}
+}
+
+// maybeThrottle slows down a flush after it has written an output sstable of
+// the provided size, if it's faster than the configured flush pacing rate.
+func (p *flushPacer) maybeThrottle(bytesWritten uint64) error {
+	burst := p.limiter.Burst()
+	if p.bypass() {
+		for bytesWritten > uint64(burst) {
+			p.limiter.AllowN(time.Now(), burst)
+			bytesWritten -= uint64(burst)
+		}
+		p.limiter.AllowN(time.Now(), int(bytesWritten))
+		return nil
+	}
+	for bytesWritten > uint64(burst) {
+		d := p.limiter.DelayN(time.Now(), burst)
+		if d == rate.InfDuration {
+			return errors.Errorf("pacing failed")
+		}
+		time.Sleep(d)
+		bytesWritten -= uint64(burst)
+	}
+	d := p.limiter.DelayN(time.Now(), int(bytesWritten))
+	if d == rate.InfDuration {
+		return errors.Errorf("pacing failed")
+	}
+	time.Sleep(d)
+	return nil
+}
+
 type noopPacer struct{}
 
 func (p *noopPacer) maybeThrottle(_ uint64) error {
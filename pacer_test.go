@@ -47,6 +47,7 @@ func TestCompactionPacerMaybeThrottle(t *testing.T) {
 				var bytesIterated uint64
 				var slowdownThreshold uint64
 				var freeBytes, liveBytes, obsoleteBytes uint64
+				var bypass bool
 				if len(d.Input) > 0 {
 					for _, data := range strings.Split(d.Input, "\n") {
 						parts := strings.Split(data, ":")
@@ -72,6 +73,8 @@ func TestCompactionPacerMaybeThrottle(t *testing.T) {
 							liveBytes = varValue
 						case "obsoleteBytes":
 							obsoleteBytes = varValue
+						case "bypass":
+							bypass = varValue != 0
 						default:
 							return fmt.Sprintf("unknown command: %s", varKey)
 						}
@@ -95,6 +98,14 @@ func TestCompactionPacerMaybeThrottle(t *testing.T) {
 						return err.Error()
 					}
 
+					return mockLimiter.buf.String()
+				case "flush":
+					flushPacer := newFlushPacer(&mockLimiter, func() bool { return bypass })
+					err := flushPacer.maybeThrottle(bytesIterated)
+					if err != nil {
+						return err.Error()
+					}
+
 					return mockLimiter.buf.String()
 				default:
 					return fmt.Sprintf("unknown command: %s", d.Cmd)
@@ -0,0 +1,90 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"sync/atomic"
+
+	"github.com/cockroachdb/errors"
+)
+
+// ErrSeqNumNotPinnable is returned by DB.PinSeqNum if the view of the DB at
+// the sequence number may no longer be intact.
+var ErrSeqNumNotPinnable = errors.New("pebble: sequence number cannot be pinned")
+
+// SeqNumPin is a handle returned by DB.PinSeqNum, preventing compactions from
+// dropping the records visible at its sequence number, or written after it,
+// until it's released by DB.ReleaseSeqNum.
+type SeqNumPin struct {
+	// pin is linked into the DB's snapshot list, where it's accounted for by
+	// compactions like an open snapshot. The records written after it are
+	// retained as history (see DB.historyRetentionSeqNum).
+	pin *Snapshot
+	// seqNum is the pinned sequence number.
+	seqNum uint64
+}
+
+// SeqNum returns the pinned sequence number.
+func (p *SeqNumPin) SeqNum() uint64 {
+	return p.seqNum
+}
+
+// PinSeqNum pins the history of the DB from the given sequence number onward:
+// until the returned handle is released by DB.ReleaseSeqNum, compactions
+// preserve the records visible at the sequence number, as if a snapshot was
+// open at the sequence number, and every version of every key written after
+// it, like Options.Experimental.HistoryRetentionSeqNums does. Overwritten
+// values and deletion tombstones written after the sequence number are thus
+// neither collapsed nor elided, and are exposed by DB.ScanInternal. Unlike a
+// snapshot, a pin can't be read from; it's meant for consumers of the WAL or of
+// the DB's changes that checkpoint their progress as a sequence number, and
+// need every change from their checkpoint onward. Pins aren't durable, and are
+// dropped when the DB is closed.
+//
+// The sequence number must be either the current sequence number of the DB
+// (see DB.LogSeqNum), or the sequence number of an open snapshot or of
+// another pin, as the view of the DB at earlier sequence numbers may already
+// have been compacted away. ErrSeqNumNotPinnable is returned otherwise. A
+// consumer can thus advance its checkpoint by pinning the new sequence number
+// before releasing the pin of the previous one.
+func (d *DB) PinSeqNum(seqNum uint64) (*SeqNumPin, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	visibleSeqNum := atomic.LoadUint64(&d.mu.versions.atomic.visibleSeqNum)
+	if seqNum != visibleSeqNum && !d.mu.snapshots.contains(seqNum) {
+		return nil, errors.WithDetailf(ErrSeqNumNotPinnable,
+			"sequence number %d, visible sequence number %d", errors.Safe(seqNum), errors.Safe(visibleSeqNum))
+	}
+	pin := &Snapshot{db: d, seqNum: seqNum}
+	d.mu.snapshots.insert(pin)
+	p := &SeqNumPin{pin: pin, seqNum: seqNum}
+	d.mu.seqNumPins[p] = struct{}{}
+	return p, nil
+}
+
+// ReleaseSeqNum releases the pin returned by DB.PinSeqNum, allowing
+// compactions to drop the records that were only retained for it. An error is
+// returned if the pin was already released, or wasn't returned by this DB.
+func (d *DB) ReleaseSeqNum(p *SeqNumPin) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.mu.seqNumPins[p]; !ok {
+		return errors.Errorf("pebble: sequence number %d isn't pinned by this handle", errors.Safe(p.seqNum))
+	}
+	delete(d.mu.seqNumPins, p)
+	d.mu.snapshots.remove(p.pin)
+	// If the pin was the earliest snapshot, we might be able to reclaim disk
+	// space by dropping obsolete records that were pinned by it.
+	if e := d.mu.snapshots.earliest(); e > p.seqNum {
+		d.maybeScheduleCompactionPicker(pickElisionOnly)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeqNumPin(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	get := func(seqNum uint64, key string) string {
+		return getAtSeqNum(t, d, seqNum, key)
+	}
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("1"), nil))
+	p1, err := d.PinSeqNum(d.LogSeqNum())
+	require.NoError(t, err)
+	require.Equal(t, d.LogSeqNum(), p1.SeqNum())
+
+	// Sequence numbers that aren't visible yet, or whose view may have been
+	// compacted away, can't be pinned.
+	_, err = d.PinSeqNum(d.LogSeqNum() + 1)
+	require.True(t, errors.Is(err, ErrSeqNumNotPinnable))
+	require.NoError(t, d.Set([]byte("a"), []byte("2"), nil))
+	_, err = d.PinSeqNum(p1.SeqNum() - 1)
+	require.True(t, errors.Is(err, ErrSeqNumNotPinnable))
+
+	// The sequence number of an existing pin can be pinned again.
+	p2, err := d.PinSeqNum(p1.SeqNum())
+	require.NoError(t, err)
+	require.NoError(t, d.Delete([]byte("b"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+	require.Equal(t, "1", get(p1.SeqNum(), "a"))
+	require.Equal(t, "1", get(p1.SeqNum(), "b"))
+	require.Equal(t, 2, d.Metrics().Snapshots.Count)
+
+	// The view stays pinned until all of its pins are released.
+	require.NoError(t, d.ReleaseSeqNum(p1))
+	require.Error(t, d.ReleaseSeqNum(p1))
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+	require.Equal(t, "1", get(p2.SeqNum(), "a"))
+	require.NoError(t, d.ReleaseSeqNum(p2))
+	require.Equal(t, 0, d.Metrics().Snapshots.Count)
+	require.NoError(t, d.Set([]byte("a"), []byte("3"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+	require.Equal(t, "<not found>", get(p2.SeqNum(), "b"))
+
+	// Pins that aren't released don't leak when the DB is closed.
+	_, err = d.PinSeqNum(d.LogSeqNum())
+	require.NoError(t, err)
+}
+
+func TestSeqNumPinHistory(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("1"), nil))
+	p, err := d.PinSeqNum(d.LogSeqNum())
+	require.NoError(t, err)
+
+	// Every version written after the pinned sequence number is retained by
+	// compactions, rather than only the latest one.
+	for _, op := range []func() error{
+		func() error { return d.Set([]byte("a"), []byte("2"), nil) },
+		func() error { return d.Delete([]byte("b"), nil) },
+		func() error { return d.Set([]byte("a"), []byte("3"), nil) },
+		func() error { return d.Set([]byte("b"), []byte("3"), nil) },
+	} {
+		require.NoError(t, op())
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+	seqNum := p.SeqNum()
+	require.Equal(t, "1 1", getAtSeqNum(t, d, seqNum, "a")+" "+getAtSeqNum(t, d, seqNum, "b"))
+	require.Equal(t, "2 1", getAtSeqNum(t, d, seqNum+1, "a")+" "+getAtSeqNum(t, d, seqNum+1, "b"))
+	require.Equal(t, "2 <not found>", getAtSeqNum(t, d, seqNum+2, "a")+" "+getAtSeqNum(t, d, seqNum+2, "b"))
+	require.Equal(t, "3 <not found>", getAtSeqNum(t, d, seqNum+3, "a")+" "+getAtSeqNum(t, d, seqNum+3, "b"))
+	require.Equal(t, "3 3", getAtSeqNum(t, d, seqNum+4, "a")+" "+getAtSeqNum(t, d, seqNum+4, "b"))
+
+	versions := func() int {
+		var n int
+		require.NoError(t, d.ScanInternal([]byte("a"), []byte("z"), func(*InternalKey, LazyValue) error {
+			n++
+			return nil
+		}, nil, nil))
+		return n
+	}
+	require.Equal(t, 6, versions())
+
+	// Once the pin is released, the history is collapsed by the next
+	// compaction rewriting the keys.
+	require.NoError(t, d.ReleaseSeqNum(p))
+	require.NoError(t, d.Set([]byte("a"), []byte("4"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+	require.Equal(t, 2, versions())
+}
+
+// getAtSeqNum reads the key at the sequence number, as a snapshot open at the
+// sequence number would.
+func getAtSeqNum(t *testing.T, d *DB, seqNum uint64, key string) string {
+	s := &Snapshot{db: d, seqNum: seqNum}
+	d.mu.Lock()
+	d.mu.snapshots.insert(s)
+	d.mu.Unlock()
+	defer s.Close()
+	v, closer, err := s.Get([]byte(key))
+	if errors.Is(err, ErrNotFound) {
+		return "<not found>"
+	}
+	require.NoError(t, err)
+	defer closer.Close()
+	return string(v)
+}
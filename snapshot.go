@@ -41,6 +41,37 @@ func (s *Snapshot) Get(key []byte) ([]byte, io.Closer, error) {
 	return s.db.getInternal(key, nil /* batch */, s)
 }
 
+// GetPinned gets the value for the given key, returning a handle to the value
+// rather than the value itself. It returns ErrNotFound if the Snapshot does
+// not contain the key. See DB.GetPinned.
+//
+// On success, the caller MUST call PinnedValue.Close() or a memory leak will
+// occur.
+func (s *Snapshot) GetPinned(key []byte) (PinnedValue, error) {
+	if s.db == nil {
+		panic(ErrClosed)
+	}
+	return s.db.getPinnedInternal(key, nil /* batch */, s)
+}
+
+// Exists returns whether the Snapshot contains the given key, without
+// retrieving the key's value. See DB.Exists.
+func (s *Snapshot) Exists(key []byte) (bool, error) {
+	if s.db == nil {
+		panic(ErrClosed)
+	}
+	return s.db.existsInternal(key, s)
+}
+
+// MultiGet gets the values for the given keys from the Snapshot, returning
+// them in the same order as the keys. See DB.MultiGet.
+func (s *Snapshot) MultiGet(keys [][]byte) ([][]byte, error) {
+	if s.db == nil {
+		panic(ErrClosed)
+	}
+	return multiGet(s.NewIter(nil), s.db.cmp, s.db.equal, s.db.opts.Comparer.Split, keys)
+}
+
 // NewIter returns an iterator that is unpositioned (Iterator.Valid() will
 // return false). The iterator can be positioned via a call to SeekGE,
 // SeekLT, First or Last.
@@ -140,6 +171,17 @@ func (l *snapshotList) earliest() uint64 {
 	return v
 }
 
+// contains returns true if the list holds a snapshot with the given sequence
+// number.
+func (l *snapshotList) contains(seqNum uint64) bool {
+	for i := l.root.next; i != &l.root; i = i.next {
+		if i.seqNum == seqNum {
+			return true
+		}
+	}
+	return false
+}
+
 func (l *snapshotList) toSlice() []uint64 {
 	if l.empty() {
 		return nil
@@ -162,6 +204,24 @@ func (l *snapshotList) pushBack(s *Snapshot) {
 	s.list = l
 }
 
+// insert inserts s into the list, after the snapshots whose sequence numbers
+// are lower than or equal to s.seqNum. Unlike pushBack, it supports snapshots
+// older than the most recent one, such as imported snapshots.
+func (l *snapshotList) insert(s *Snapshot) {
+	if s.list != nil || s.prev != nil || s.next != nil {
+		panic("pebble: snapshot list is inconsistent")
+	}
+	prev := l.root.prev
+	for prev != &l.root && prev.seqNum > s.seqNum {
+		prev = prev.prev
+	}
+	s.prev = prev
+	s.next = prev.next
+	s.prev.next = s
+	s.next.prev = s
+	s.list = l
+}
+
 func (l *snapshotList) remove(s *Snapshot) {
 	if s == &l.root {
 		panic("pebble: cannot remove snapshot list root node")
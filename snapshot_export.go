@@ -0,0 +1,168 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"sort"
+
+	"github.com/cockroachdb/errors"
+)
+
+// ErrExportedSnapshotNotFound is returned by DB.ImportSnapshot and
+// DB.DeleteExportedSnapshot if no snapshot is exported under the given name.
+var ErrExportedSnapshotNotFound = errors.New("pebble: exported snapshot not found")
+
+// ErrExportedSnapshotExists is returned by Snapshot.Export if a snapshot is
+// already exported under the same name.
+var ErrExportedSnapshotExists = errors.New("pebble: exported snapshot already exists")
+
+// Export durably records the snapshot under the given name, so that its view
+// of the DB survives reopening the DB. The exported snapshot is reopened by
+// DB.ImportSnapshot, and pins its view of the DB like an open snapshot until
+// it's deleted by DB.DeleteExportedSnapshot. Exported snapshots are listed by
+// DB.ExportedSnapshots.
+//
+// Export first makes the snapshot's view durable: the WAL is synced, or the
+// memtables are flushed if the WAL is disabled. The name and sequence number
+// of the snapshot are then recorded in the manifest. The snapshot remains
+// open, and must still be closed by the caller. Export requires a format major
+// version of at least FormatExportedSnapshots.
+func (s *Snapshot) Export(name string) error {
+	d := s.db
+	if d == nil {
+		panic(ErrClosed)
+	}
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if v := d.FormatMajorVersion(); v < FormatExportedSnapshots {
+		return errors.Newf(
+			"pebble: database has format major version %d; exported snapshots require at least %d",
+			errors.Safe(v), errors.Safe(FormatExportedSnapshots),
+		)
+	}
+	if name == "" {
+		return errors.New("pebble: exported snapshot name must not be empty")
+	}
+
+	var err error
+	if d.opts.DisableWAL {
+		err = d.Flush()
+	} else {
+		err = d.LogData(nil, Sync)
+	}
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// logLock may drop d.mu, so the name is checked once the manifest is
+	// locked.
+	d.mu.versions.logLock()
+	if _, ok := d.mu.exportedSnapshots[name]; ok {
+		d.mu.versions.logUnlock()
+		return errors.WithDetailf(ErrExportedSnapshotExists, "snapshot: %q", name)
+	}
+	pin := &Snapshot{db: d, seqNum: s.seqNum}
+	d.mu.snapshots.insert(pin)
+	jobID := d.mu.nextJobID
+	d.mu.nextJobID++
+	ve := &versionEdit{
+		ExportedSnapshots: []exportedSnapshot{{Name: name, SeqNum: s.seqNum}},
+	}
+	if err := d.mu.versions.logAndApply(jobID, ve, nil, false /* forceRotation */, func() []compactionInfo {
+		return d.getInProgressCompactionInfoLocked(nil)
+	}); err != nil {
+		d.mu.snapshots.remove(pin)
+		return err
+	}
+	d.mu.exportedSnapshots[name] = pin
+	return nil
+}
+
+// ImportSnapshot opens the snapshot exported by Snapshot.Export under the
+// given name. The returned snapshot has the view of the DB of the exported
+// snapshot, and must be closed by the caller. ErrExportedSnapshotNotFound is
+// returned if no snapshot is exported under the name.
+func (d *DB) ImportSnapshot(name string) (*Snapshot, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	pin, ok := d.mu.exportedSnapshots[name]
+	if !ok {
+		return nil, errors.WithDetailf(ErrExportedSnapshotNotFound, "snapshot: %q", name)
+	}
+	s := &Snapshot{db: d, seqNum: pin.seqNum}
+	d.mu.snapshots.insert(s)
+	return s, nil
+}
+
+// DeleteExportedSnapshot deletes the snapshot exported by Snapshot.Export under
+// the given name, releasing its view of the DB once the snapshots imported from
+// it are closed. ErrExportedSnapshotNotFound is returned if no snapshot is
+// exported under the name.
+func (d *DB) DeleteExportedSnapshot(name string) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mu.versions.logLock()
+	pin, ok := d.mu.exportedSnapshots[name]
+	if !ok {
+		d.mu.versions.logUnlock()
+		return errors.WithDetailf(ErrExportedSnapshotNotFound, "snapshot: %q", name)
+	}
+	jobID := d.mu.nextJobID
+	d.mu.nextJobID++
+	ve := &versionEdit{DeletedSnapshots: []string{name}}
+	if err := d.mu.versions.logAndApply(jobID, ve, nil, false /* forceRotation */, func() []compactionInfo {
+		return d.getInProgressCompactionInfoLocked(nil)
+	}); err != nil {
+		return err
+	}
+	delete(d.mu.exportedSnapshots, name)
+	d.mu.snapshots.remove(pin)
+	// If the pin was the earliest snapshot, we might be able to reclaim disk
+	// space by dropping obsolete records that were pinned by it.
+	if e := d.mu.snapshots.earliest(); e > pin.seqNum {
+		d.maybeScheduleCompactionPicker(pickElisionOnly)
+	}
+	return nil
+}
+
+// ExportedSnapshots returns the names of the snapshots exported by
+// Snapshot.Export which haven't been deleted, in lexicographic order.
+func (d *DB) ExportedSnapshots() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	names := make([]string, 0, len(d.mu.exportedSnapshots))
+	for name := range d.mu.exportedSnapshots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pinExportedSnapshotsLocked pins the views of the exported snapshots recorded
+// in the manifest, once the versionSet is loaded.
+//
+// d.mu must be held when calling this.
+func (d *DB) pinExportedSnapshotsLocked() {
+	for name, seqNum := range d.mu.versions.exportedSnapshots {
+		pin := &Snapshot{db: d, seqNum: seqNum}
+		d.mu.snapshots.insert(pin)
+		d.mu.exportedSnapshots[name] = pin
+	}
+}
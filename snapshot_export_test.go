@@ -0,0 +1,118 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportedSnapshots(t *testing.T) {
+	for _, disableWAL := range []bool{false, true} {
+		t.Run(fmt.Sprintf("disableWAL=%t", disableWAL), func(t *testing.T) {
+			opts := &Options{
+				FS:                  vfs.NewMem(),
+				FormatMajorVersion:  FormatExportedSnapshots,
+				DisableWAL:          disableWAL,
+				MaxManifestFileSize: 1,
+			}
+			writeOpts := Sync
+			if disableWAL {
+				writeOpts = NoSync
+			}
+			d, err := Open("", opts)
+			require.NoError(t, err)
+			reopen := func() {
+				require.NoError(t, d.Close())
+				d, err = Open("", opts)
+				require.NoError(t, err)
+			}
+			get := func(r Reader, key string) string {
+				v, closer, err := r.Get([]byte(key))
+				if errors.Is(err, ErrNotFound) {
+					return "<not found>"
+				}
+				require.NoError(t, err)
+				defer closer.Close()
+				return string(v)
+			}
+
+			require.NoError(t, d.Set([]byte("a"), []byte("1"), writeOpts))
+			require.NoError(t, d.Set([]byte("b"), []byte("1"), writeOpts))
+			s := d.NewSnapshot()
+			require.NoError(t, d.Set([]byte("c"), []byte("1"), writeOpts))
+			require.NoError(t, s.Export("s1"))
+			require.True(t, errors.Is(s.Export("s1"), ErrExportedSnapshotExists))
+			require.NoError(t, s.Close())
+			require.Equal(t, []string{"s1"}, d.ExportedSnapshots())
+
+			// Overwrite the snapshot's view, and compact the overwritten keys,
+			// rotating the manifest.
+			manifestFileNum := d.mu.versions.manifestFileNum
+			require.NoError(t, d.Set([]byte("a"), []byte("2"), writeOpts))
+			require.NoError(t, d.Delete([]byte("b"), writeOpts))
+			require.NoError(t, d.Flush())
+			require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+			require.NotEqual(t, manifestFileNum, d.mu.versions.manifestFileNum)
+			reopen()
+
+			// The exported snapshot survives reopening the DB, and keeps pinning
+			// its view through compactions.
+			require.Equal(t, []string{"s1"}, d.ExportedSnapshots())
+			require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+			s, err = d.ImportSnapshot("s1")
+			require.NoError(t, err)
+			require.Equal(t, "1", get(s, "a"))
+			require.Equal(t, "1", get(s, "b"))
+			require.Equal(t, "<not found>", get(s, "c"))
+			require.Equal(t, "2", get(d, "a"))
+			require.Equal(t, "<not found>", get(d, "b"))
+
+			// Deleting the exported snapshot doesn't affect the snapshots
+			// imported from it.
+			require.NoError(t, d.DeleteExportedSnapshot("s1"))
+			require.True(t, errors.Is(d.DeleteExportedSnapshot("s1"), ErrExportedSnapshotNotFound))
+			require.Empty(t, d.ExportedSnapshots())
+			require.Equal(t, "1", get(s, "a"))
+			require.NoError(t, s.Close())
+
+			reopen()
+			require.Empty(t, d.ExportedSnapshots())
+			_, err = d.ImportSnapshot("s1")
+			require.True(t, errors.Is(err, ErrExportedSnapshotNotFound))
+			require.NoError(t, d.Close())
+		})
+	}
+}
+
+func TestExportedSnapshotsFormatMajorVersion(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                 vfs.NewMem(),
+		FormatMajorVersion: FormatChunkedBatches,
+	})
+	require.NoError(t, err)
+	s := d.NewSnapshot()
+	require.Error(t, s.Export("s1"))
+	require.NoError(t, s.Close())
+	require.NoError(t, d.RatchetFormatMajorVersion(FormatExportedSnapshots))
+	s = d.NewSnapshot()
+	require.NoError(t, s.Export("s1"))
+	require.NoError(t, s.Close())
+	require.NoError(t, d.Close())
+}
+
+func TestSnapshotListInsert(t *testing.T) {
+	var l snapshotList
+	l.init()
+	for _, seqNum := range []uint64{5, 2, 8, 5, 1, 9} {
+		l.insert(&Snapshot{seqNum: seqNum})
+	}
+	require.Equal(t, []uint64{1, 2, 5, 5, 8, 9}, l.toSlice())
+	require.Equal(t, uint64(1), l.earliest())
+}
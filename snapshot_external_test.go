@@ -0,0 +1,35 @@
+// Copyright 2012 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/datadriven"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/internal/datatest"
+	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSnapshotDatatest exercises snapshots over range keys, ingestions and
+// flushes using the shared datadriven runner.
+func TestSnapshotDatatest(t *testing.T) {
+	d := &datatest.DB{
+		Opts: &pebble.Options{
+			Comparer:           testkeys.Comparer,
+			FormatMajorVersion: pebble.FormatNewest,
+		},
+	}
+	defer func() { require.NoError(t, d.Close()) }()
+
+	datadriven.RunTest(t, "testdata/snapshot_datatest", func(t *testing.T, td *datadriven.TestData) string {
+		if out, ok := d.RunCommand(td); ok {
+			return out
+		}
+		return fmt.Sprintf("unknown command: %s", td.Cmd)
+	})
+}
@@ -142,6 +142,18 @@ type SuffixReplaceableBlockCollector interface {
 	UpdateKeySuffixes(oldProp []byte, oldSuffix, newSuffix []byte) error
 }
 
+// PrefixReplaceableBlockCollector is an extension to the BlockPropertyCollector
+// interface that allows a block property collector to indicate that it supports
+// being *updated* during prefix replacement, i.e. when an existing SST in which
+// all keys have the same key prefix is updated to have a new prefix (see
+// RewriteKeyPrefixesAndReturnFormat).
+type PrefixReplaceableBlockCollector interface {
+	// UpdateKeyPrefixes is called when a block is updated to change the prefix
+	// of all keys in the block, and is passed the old value for that prop, if
+	// any, for that block as well as the old and new prefix.
+	UpdateKeyPrefixes(oldProp []byte, oldPrefix, newPrefix []byte) error
+}
+
 // BlockPropertyFilter is used in an Iterator to filter sstables and blocks
 // within the sstable. It should not maintain any per-sstable state, and must
 // be thread-safe.
@@ -0,0 +1,380 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"context"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/bytealloc"
+	"github.com/cockroachdb/pebble/internal/keyspan"
+	"github.com/cockroachdb/pebble/internal/rangekey"
+	"github.com/cockroachdb/pebble/objstorage"
+)
+
+// ErrEmptySpan is returned by CopySpan if the input sstable contains no keys
+// within the span being copied.
+var ErrEmptySpan = errors.New("pebble: cannot copy empty span")
+
+// CopySpan produces a new sstable, written to `out`, containing the subset of
+// the input sstable overlapping the span of user keys [start, end).
+//
+// CopySpan doesn't write the new sstable key-by-key. Instead, it finds the data
+// blocks of the input that intersect the span and copies them whole, without
+// decompressing or recompressing them. As a result, the new sstable contains
+// every point key of the input within the span, along with some keys outside
+// of the span that share a block with keys within it; callers are expected to
+// constrain reads of the new sstable to the span, as is the case for virtual
+// sstables. Range deletions and range keys are truncated to the span.
+//
+// The filter of the input is copied as-is, since a filter remains valid for a
+// subset of its keys, with a potentially higher false positive rate.
+// Partitioned filters aren't copied, and the new sstable has no filter. The
+// copied blocks are decompressed to compute the entry counts, raw sizes and
+// point key bounds of the new sstable from the keys they contain, but block and
+// user properties aren't collected, so the new sstable has none.
+//
+// The input must not contain value blocks to be copied block-by-block, as the
+// copied data blocks would reference value blocks of the input. Instead, such
+// sstables are copied by writing each key within the span to a new Writer.
+//
+// The WriterOptions.TableFormat and Checksum are ignored, and the new sstable
+// has the same TableFormat and checksum type as the input. CopySpan returns
+// the metadata of the new sstable, including its size and bounds, or
+// ErrEmptySpan if the input contains no keys within the span.
+func CopySpan(
+	ctx context.Context, r *Reader, out objstorage.Writable, o WriterOptions, start, end []byte,
+) (_ *WriterMetadata, retErr error) {
+	if r.err != nil {
+		out.Abort()
+		return nil, r.err
+	}
+	if r.Properties.ComparerName != o.Comparer.Name {
+		out.Abort()
+		return nil, errors.Errorf("mismatched Comparer %s vs %s", r.Properties.ComparerName, o.Comparer.Name)
+	}
+	o.TableFormat = r.tableFormat
+	o.Checksum = r.checksumType
+	if r.Properties.NumValueBlocks > 0 || r.Properties.NumValuesInValueBlocks > 0 {
+		return copySpanViaWriter(r, out, o, start, end)
+	}
+
+	blocks, err := intersectingDataBlocks(ctx, r, start, end)
+	if err != nil {
+		out.Abort()
+		return nil, err
+	}
+
+	w := NewWriter(out, o)
+	defer func() {
+		if w != nil {
+			// Setting the Writer's error ensures the output is aborted.
+			w.err = retErr
+			w.Close()
+		}
+	}()
+	// The index entries and properties of the new sstable are derived from
+	// those of the input, rather than from keys passed through the Writer.
+	w.propCollectors = nil
+	w.blockPropCollectors = nil
+	w.filter = nil
+	if o.FilterPolicy != nil && r.tableFilter != nil && !r.filterPartitioned && r.filterBH.Length > 0 &&
+		r.Properties.FilterPolicyName == o.FilterPolicy.Name() {
+		var err error
+		w.filter, err = copyFilter(ctx, r, o.FilterPolicy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var buf, decompressed []byte
+	for i := range blocks {
+		n := blocks[i].bh.Length + blockTrailerLen
+		if uint64(cap(buf)) < n {
+			buf = make([]byte, n)
+		}
+		buf = buf[:n]
+		if _, err := r.readable.ReadAt(ctx, buf, int64(blocks[i].bh.Offset)); err != nil {
+			return nil, err
+		}
+		if err := checkChecksum(r.checksumType, buf, blocks[i].bh.BlockHandle, r.fileNum); err != nil {
+			return nil, err
+		}
+		data := buf[:blocks[i].bh.Length]
+		if typ := blockType(buf[blocks[i].bh.Length]); typ != noCompressionBlockType {
+			decodedLen, prefixLen, err := decompressedLen(typ, data)
+			if err != nil {
+				return nil, err
+			}
+			if cap(decompressed) < decodedLen {
+				decompressed = make([]byte, decodedLen)
+			}
+			if data, err = decompressInto(typ, data[prefixLen:], decompressed[:decodedLen]); err != nil {
+				return nil, err
+			}
+		}
+		if err := addCopiedBlockKeys(r, w, data); err != nil {
+			return nil, err
+		}
+		if err := w.writable.Write(buf); err != nil {
+			return nil, err
+		}
+		bhp := BlockHandleWithProperties{
+			BlockHandle: BlockHandle{Offset: w.meta.Size, Length: blocks[i].bh.Length},
+		}
+		w.meta.Size += n
+		if err := w.addIndexEntrySep(blocks[i].sep, bhp, w.dataBlockBuf.tmp[:]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := copySpanRangeKeysToWriter(r, w, start, end); err != nil {
+		return nil, err
+	}
+	if len(blocks) == 0 && w.props.NumRangeDeletions == 0 && w.props.NumRangeKeys() == 0 {
+		return nil, ErrEmptySpan
+	}
+
+	if err := w.Close(); err != nil {
+		w = nil
+		return nil, err
+	}
+	meta, err := w.Metadata()
+	w = nil
+	return meta, err
+}
+
+// addCopiedBlockKeys accounts for the keys of a data block copied to the
+// Writer, as Writer.addPoint does for the keys added to it. The keys of the
+// copied blocks are the only point keys of the Writer, so the first and last
+// keys of the blocks are the point key bounds of the new sstable.
+func addCopiedBlockKeys(r *Reader, w *Writer, data []byte) error {
+	iter, err := newBlockIter(r.Compare, data)
+	if err != nil {
+		return err
+	}
+	iter.lazyValueHandling.hasValuePrefix = r.tableFormat >= TableFormatPebblev3
+	for key, value := iter.First(); key != nil; key, value = iter.Next() {
+		w.meta.updateSeqNum(key.SeqNum())
+		if !w.meta.HasPointKeys {
+			w.meta.SetSmallestPointKey(key.Clone())
+		}
+		w.props.NumEntries++
+		switch key.Kind() {
+		case InternalKeyKindDelete:
+			w.props.NumDeletions++
+		case InternalKeyKindMerge:
+			w.props.NumMergeOperands++
+		}
+		w.props.RawKeySize += uint64(key.Size())
+		w.props.RawValueSize += uint64(len(value.InPlaceValue()))
+	}
+	if key, _ := iter.Last(); key != nil {
+		w.meta.SetLargestPointKey(key.Clone())
+	}
+	return iter.Close()
+}
+
+// copySpanViaWriter is the slow path of CopySpan for sstables that can't be
+// copied block-by-block. It writes each key within the span to a new Writer.
+func copySpanViaWriter(
+	r *Reader, out objstorage.Writable, o WriterOptions, start, end []byte,
+) (_ *WriterMetadata, retErr error) {
+	w := NewWriter(out, o)
+	defer func() {
+		if w != nil {
+			// Setting the Writer's error ensures the output is aborted.
+			w.err = retErr
+			w.Close()
+		}
+	}()
+	iter, err := r.NewIter(start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	for k, v := iter.SeekGE(start, base.SeekGEFlagsNone); k != nil; k, v = iter.Next() {
+		val, _, err := v.Value(nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := w.Add(*k, val); err != nil {
+			return nil, err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	if err := copySpanRangeKeysToWriter(r, w, start, end); err != nil {
+		return nil, err
+	}
+	if w.props.NumEntries == 0 && w.props.NumRangeKeys() == 0 {
+		return nil, ErrEmptySpan
+	}
+	if err := w.Close(); err != nil {
+		w = nil
+		return nil, err
+	}
+	meta, err := w.Metadata()
+	w = nil
+	return meta, err
+}
+
+// copySpanRangeKeysToWriter adds the range deletions and range keys of the
+// sstable that overlap [start, end) to the Writer, truncated to the span.
+func copySpanRangeKeysToWriter(r *Reader, w *Writer, start, end []byte) error {
+	// truncate returns a copy of the span truncated to [start, end), and
+	// whether the truncated span is non-empty.
+	truncate := func(s *keyspan.Span) (keyspan.Span, bool) {
+		t := *s
+		if r.Compare(t.Start, start) < 0 {
+			t.Start = start
+		}
+		if r.Compare(t.End, end) > 0 {
+			t.End = end
+		}
+		return t, r.Compare(t.Start, t.End) < 0
+	}
+
+	rangeDelIter, err := r.NewRawRangeDelIter()
+	if err != nil {
+		return err
+	}
+	if rangeDelIter != nil {
+		defer rangeDelIter.Close()
+		for s := rangeDelIter.SeekGE(start); s != nil && r.Compare(s.Start, end) < 0; s = rangeDelIter.Next() {
+			t, ok := truncate(s)
+			if !ok {
+				continue
+			}
+			for _, k := range t.Keys {
+				if err := w.Add(base.InternalKey{UserKey: t.Start, Trailer: k.Trailer}, t.End); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	rangeKeyIter, err := r.NewRawRangeKeyIter()
+	if err != nil {
+		return err
+	}
+	if rangeKeyIter != nil {
+		defer rangeKeyIter.Close()
+		for s := rangeKeyIter.SeekGE(start); s != nil && r.Compare(s.Start, end) < 0; s = rangeKeyIter.Next() {
+			t, ok := truncate(s)
+			if !ok {
+				continue
+			}
+			// The raw fragments are already fragmented, and truncation doesn't
+			// affect fragmentation, so the fragmenter may be bypassed.
+			if err := rangekey.Encode(&t, w.AddRangeKey); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copyFilter returns a filterWriter that writes the filter block of the
+// sstable as-is.
+func copyFilter(ctx context.Context, r *Reader, policy FilterPolicy) (filterWriter, error) {
+	h, err := r.readFilter(ctx, nil /* stats */)
+	if err != nil {
+		return nil, err
+	}
+	defer h.Release()
+	return copyFilterWriter{
+		origPolicyName: policy.Name(),
+		origMetaName:   "fullfilter." + policy.Name(),
+		data:           append([]byte(nil), h.Get()...),
+	}, nil
+}
+
+// dataBlockWithSep is a data block along with its separator from the index,
+// which is greater than or equal to every key in the block.
+type dataBlockWithSep struct {
+	bh  BlockHandleWithProperties
+	sep InternalKey
+}
+
+// intersectingDataBlocks returns the data blocks of the sstable that may
+// contain keys within [start, end), in order.
+func intersectingDataBlocks(
+	ctx context.Context, r *Reader, start, end []byte,
+) ([]dataBlockWithSep, error) {
+	indexH, err := r.readIndex(ctx, nil /* stats */)
+	if err != nil {
+		return nil, err
+	}
+	defer indexH.Release()
+
+	var blocks []dataBlockWithSep
+	var alloc bytealloc.A
+	// prevSep is the user key of the separator of the preceding data block.
+	// Every key within a data block is greater than or equal to it.
+	var prevSep []byte
+	hasPrevSep := false
+	// addBlocks adds the intersecting data blocks indexed by the index block,
+	// returning false once the remaining blocks can't intersect the span.
+	addBlocks := func(index block) (bool, error) {
+		iter, err := newBlockIter(r.Compare, index)
+		if err != nil {
+			return false, err
+		}
+		for key, value := iter.First(); key != nil; key, value = iter.Next() {
+			if hasPrevSep && r.Compare(prevSep, end) >= 0 {
+				return false, nil
+			}
+			prevSep = append(prevSep[:0], key.UserKey...)
+			hasPrevSep = true
+			if r.Compare(key.UserKey, start) < 0 {
+				continue
+			}
+			bh, err := decodeBlockHandleWithProperties(value.InPlaceValue())
+			if err != nil {
+				return false, errCorruptIndexEntry
+			}
+			var sep InternalKey
+			alloc, sep = cloneKeyWithBuf(*key, alloc)
+			blocks = append(blocks, dataBlockWithSep{
+				bh:  BlockHandleWithProperties{BlockHandle: bh.BlockHandle},
+				sep: sep,
+			})
+		}
+		return true, nil
+	}
+
+	if r.Properties.IndexPartitions == 0 {
+		if _, err := addBlocks(indexH.Get()); err != nil {
+			return nil, err
+		}
+		return blocks, nil
+	}
+	topIter, err := newBlockIter(r.Compare, indexH.Get())
+	if err != nil {
+		return nil, err
+	}
+	for key, value := topIter.SeekGE(start, base.SeekGEFlagsNone); key != nil; key, value = topIter.Next() {
+		bh, err := decodeBlockHandleWithProperties(value.InPlaceValue())
+		if err != nil {
+			return nil, errCorruptIndexEntry
+		}
+		subIndexH, err := r.readBlock(ctx, bh.BlockHandle, nil /* transform */, nil /* readHandle */, nil /* stats */)
+		if err != nil {
+			return nil, err
+		}
+		more, err := addBlocks(subIndexH.Get())
+		subIndexH.Release()
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+	}
+	return blocks, nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/bloom"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopySpan(t *testing.T) {
+	const keyCount = 1000
+	key := func(i int, suffix int) []byte {
+		return []byte(fmt.Sprintf("k%04d_%03d", i, suffix))
+	}
+
+	for _, format := range []TableFormat{TableFormatPebblev2, TableFormatPebblev3} {
+		for _, versions := range []int{1, 2} {
+			t.Run(fmt.Sprintf("%s,versions=%d", format, versions), func(t *testing.T) {
+				wOpts := WriterOptions{
+					BlockSize:      128,
+					IndexBlockSize: 256,
+					FilterPolicy:   bloom.FilterPolicy(10),
+					Comparer:       test4bSuffixComparer,
+					TableFormat:    format,
+				}
+				f := &memFile{}
+				w := NewWriter(f, wOpts)
+				for i := 0; i < keyCount; i++ {
+					for v := 1; v <= versions; v++ {
+						require.NoError(t, w.Set(key(i, v), key(i, v)))
+					}
+				}
+				require.NoError(t, w.DeleteRange([]byte("k0100"), []byte("k0400")))
+				require.NoError(t, w.RangeKeySet([]byte("k0450"), []byte("k0600"), nil, []byte("v")))
+				require.NoError(t, w.Close())
+
+				readerOpts := ReaderOptions{
+					Comparer: test4bSuffixComparer,
+					Filters:  map[string]base.FilterPolicy{wOpts.FilterPolicy.Name(): wOpts.FilterPolicy},
+				}
+				r, err := NewMemReader(f.Data(), readerOpts)
+				require.NoError(t, err)
+				defer r.Close()
+				// Values are stored in value blocks for older versions of a key, in
+				// which case the span is copied key-by-key.
+				byBlocks := r.Properties.NumValueBlocks == 0
+				require.Equal(t, format == TableFormatPebblev2 || versions == 1, byBlocks)
+
+				start, end := []byte("k0300"), []byte("k0500")
+				out := &memFile{}
+				meta, err := CopySpan(context.Background(), r, out, wOpts, start, end)
+				require.NoError(t, err)
+				require.Equal(t, uint64(len(out.Data())), meta.Size)
+
+				rCopy, err := NewMemReader(out.Data(), readerOpts)
+				require.NoError(t, err)
+				defer rCopy.Close()
+				require.Equal(t, format, rCopy.tableFormat)
+
+				// The copy contains every key within the span, and if copied
+				// block-by-block, some keys surrounding it.
+				iter, err := rCopy.NewIter(nil, nil)
+				require.NoError(t, err)
+				var n int
+				var rawKeySize, rawValueSize uint64
+				var last InternalKey
+				first := -1
+				for k, v := iter.First(); k != nil; k, v = iter.Next() {
+					if n == 0 {
+						require.Equal(t, meta.SmallestPoint, k.Clone())
+					}
+					last = k.Clone()
+					var i, suffix int
+					_, err := fmt.Sscanf(string(k.UserKey), "k%04d_%03d", &i, &suffix)
+					require.NoError(t, err)
+					if first < 0 {
+						first = i
+					}
+					require.Equal(t, key(first+n/versions, n%versions+1), k.UserKey)
+					val, _, err := v.Value(nil)
+					require.NoError(t, err)
+					require.Equal(t, k.UserKey, val)
+					rawKeySize += uint64(k.Size())
+					rawValueSize += uint64(len(val))
+					n++
+				}
+				require.NoError(t, iter.Close())
+				require.Equal(t, meta.LargestPoint, last)
+				require.LessOrEqual(t, first, 300)
+				require.GreaterOrEqual(t, first+n/versions, 500)
+				if byBlocks {
+					require.Less(t, n, keyCount*versions)
+				} else {
+					require.Equal(t, 200*versions, n)
+				}
+				// The properties account for the copied keys only.
+				require.Equal(t, uint64(n), rCopy.Properties.NumEntries-rCopy.Properties.NumRangeDeletions)
+				require.Equal(t, uint64(1), rCopy.Properties.NumRangeDeletions)
+				require.Equal(t, rawKeySize, rCopy.Properties.RawKeySize-uint64(len("k0300")+base.InternalTrailerLen))
+				require.Equal(t, rawValueSize, rCopy.Properties.RawValueSize-uint64(len("k0400")))
+
+				// The filter remains valid for the copied keys.
+				iter, err = rCopy.NewIter(nil, nil)
+				require.NoError(t, err)
+				for i := 300; i < 500; i++ {
+					k := key(i, versions)
+					ik, _ := iter.SeekPrefixGE(k[:len(k)-4], k, base.SeekGEFlagsNone)
+					require.NotNil(t, ik, "key %q", k)
+					require.Equal(t, k, ik.UserKey)
+				}
+				require.NoError(t, iter.Close())
+
+				// Range deletions and range keys are truncated to the span.
+				rangeDelIter, err := rCopy.NewRawRangeDelIter()
+				require.NoError(t, err)
+				s := rangeDelIter.First()
+				require.Equal(t, "k0300-k0400:{(#0,RANGEDEL)}", s.String())
+				require.Nil(t, rangeDelIter.Next())
+				require.NoError(t, rangeDelIter.Close())
+				rangeKeyIter, err := rCopy.NewRawRangeKeyIter()
+				require.NoError(t, err)
+				s = rangeKeyIter.First()
+				require.Equal(t, "k0450-k0500:{(#0,RANGEKEYSET,,v)}", s.String())
+				require.Nil(t, rangeKeyIter.Next())
+				require.NoError(t, rangeKeyIter.Close())
+
+				// Copying a span containing no keys fails.
+				_, err = CopySpan(context.Background(), r, &memFile{}, wOpts, []byte("z"), []byte("zz"))
+				require.True(t, errors.Is(err, ErrEmptySpan))
+			})
+		}
+	}
+}
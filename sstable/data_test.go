@@ -153,6 +153,14 @@ func runBuildCmd(
 	}
 
 	readerOpts := ReaderOptions{Comparer: writerOpts.Comparer}
+	for _, arg := range td.CmdArgs {
+		switch arg.Key {
+		case "synthetic-prefix":
+			readerOpts.SyntheticPrefix = []byte(arg.Vals[0])
+		case "synthetic-suffix":
+			readerOpts.SyntheticSuffix = []byte(arg.Vals[0])
+		}
+	}
 	if writerOpts.FilterPolicy != nil {
 		readerOpts.Filters = map[string]FilterPolicy{
 			writerOpts.FilterPolicy.Name(): writerOpts.FilterPolicy,
@@ -427,7 +435,11 @@ func runRewriteCmd(
 	}
 
 	f := &memFile{}
-	meta, _, err := rewriteKeySuffixesInBlocks(r, f, opts, from, to, 2)
+	rewrite := rewriteKeySuffixesInBlocks
+	if td.Cmd == "rewrite-prefix" {
+		rewrite = rewriteKeyPrefixesInBlocks
+	}
+	meta, _, err := rewrite(r, f, opts, from, to, 2)
 	if err != nil {
 		return nil, r, errors.Wrap(err, "rewrite failed")
 	}
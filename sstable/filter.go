@@ -4,7 +4,10 @@
 
 package sstable
 
-import "sync/atomic"
+import (
+	"bytes"
+	"sync/atomic"
+)
 
 // FilterMetrics holds metrics for the filter policy.
 type FilterMetrics struct {
@@ -57,6 +60,13 @@ func newTableFilterReader(policy FilterPolicy) *tableFilterReader {
 	}
 }
 
+// recordHit records a filter lookup that avoided reading a data block
+// without consulting the filter policy, such as the lookup of a key that
+// belongs to no partition of a partitioned filter.
+func (f *tableFilterReader) recordHit() {
+	atomic.AddInt64(&f.metrics.Hits, 1)
+}
+
 func (f *tableFilterReader) mayContain(data, key []byte) bool {
 	mayContain := f.policy.MayContain(TableFilter, data, key)
 	if mayContain {
@@ -100,3 +110,85 @@ func (f *tableFilterWriter) metaName() string {
 func (f *tableFilterWriter) policyName() string {
 	return f.policy.Name()
 }
+
+// partitionedFilterWriter builds a table filter that is partitioned into
+// filter blocks, along with the index blocks of a two-level index. A partition
+// is cut at the first key change following the flush of an index block, so
+// that all the occurrences of a key (or prefix) belong to the same partition.
+// A filter consisting of a single partition is written as a full filter.
+type partitionedFilterWriter struct {
+	policy FilterPolicy
+	writer FilterWriter
+	// count is the count of the number of keys added to the current partition.
+	count int
+	// lastKey is the last key added to the current partition.
+	lastKey []byte
+	// cutPending is set when an index block is flushed, and indicates that
+	// the current partition is cut before the next key change.
+	cutPending bool
+	partitions []filterPartition
+}
+
+// filterPartition is a finished partition of a partitioned filter.
+type filterPartition struct {
+	// sep is the last key added to the partition, which is greater than or
+	// equal to all the keys in the partition.
+	sep  []byte
+	data []byte
+}
+
+func newPartitionedFilterWriter(policy FilterPolicy) *partitionedFilterWriter {
+	return &partitionedFilterWriter{
+		policy: policy,
+		writer: policy.NewWriter(TableFilter),
+	}
+}
+
+func (f *partitionedFilterWriter) addKey(key []byte) {
+	if f.cutPending && f.count > 0 && !bytes.Equal(key, f.lastKey) {
+		f.cut()
+	}
+	f.count++
+	f.writer.AddKey(key)
+	f.lastKey = append(f.lastKey[:0], key...)
+}
+
+// indexBlockFlushed is called when the Writer flushes an index block, so that
+// the current partition is cut.
+func (f *partitionedFilterWriter) indexBlockFlushed() {
+	f.cutPending = true
+}
+
+func (f *partitionedFilterWriter) cut() {
+	f.partitions = append(f.partitions, filterPartition{
+		sep:  append([]byte(nil), f.lastKey...),
+		data: f.writer.Finish(nil),
+	})
+	f.writer = f.policy.NewWriter(TableFilter)
+	f.count = 0
+	f.cutPending = false
+}
+
+// finish cuts the last partition. It returns the full filter if the filter
+// consists of a single partition. Otherwise, the partitions are written by
+// Writer.writeFilterPartitions.
+func (f *partitionedFilterWriter) finish() ([]byte, error) {
+	if f.count > 0 {
+		f.cut()
+	}
+	if len(f.partitions) != 1 {
+		return nil, nil
+	}
+	return f.partitions[0].data, nil
+}
+
+func (f *partitionedFilterWriter) metaName() string {
+	if len(f.partitions) > 1 {
+		return metaPartitionedFilterPrefix + f.policy.Name()
+	}
+	return "fullfilter." + f.policy.Name()
+}
+
+func (f *partitionedFilterWriter) policyName() string {
+	return f.policy.Name()
+}
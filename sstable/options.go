@@ -93,6 +93,22 @@ type SuffixReplaceableTableCollector interface {
 	UpdateKeySuffixes(oldProps map[string]string, oldSuffix, newSuffix []byte) error
 }
 
+// PrefixReplaceableTableCollector is an extension to the TablePropertyCollector
+// interface that allows a table property collector to indicate that it supports
+// being *updated* during prefix replacement, i.e. when an existing SST in which
+// all keys have the same key prefix is updated to have a new prefix (see
+// RewriteKeyPrefixesAndReturnFormat).
+//
+// For example, a collector that only inspects values or key suffixes can
+// simply copy its previously computed property as-is, since key-prefix
+// replacement changes neither.
+type PrefixReplaceableTableCollector interface {
+	// UpdateKeyPrefixes is called when a table is updated to change the prefix
+	// of all keys in the table, and is passed the old value for that prop, if
+	// any, for that table as well as the old and new prefix.
+	UpdateKeyPrefixes(oldProps map[string]string, oldPrefix, newPrefix []byte) error
+}
+
 // ReaderOptions holds the parameters needed for reading an sstable.
 type ReaderOptions struct {
 	// Cache is used to cache uncompressed blocks from sstables.
@@ -120,6 +136,22 @@ type ReaderOptions struct {
 
 	// Logger is an optional logger and tracer.
 	LoggerAndTracer base.LoggerAndTracer
+
+	// SyntheticPrefix, if set, is prepended to every key of the sstable, as
+	// presented by the Reader's iterators, including the bounds of its range
+	// deletions and range keys. The Comparer must order the prefixed keys in
+	// the order of the sstable's keys, and order the keys without the prefix
+	// before or after all of them, which holds for a prefix of the Split
+	// prefixes of the keys and a comparer ordering the prefixes bytewise.
+	SyntheticPrefix []byte
+
+	// SyntheticSuffix, if set, replaces the suffix of every point key of the
+	// sstable, and the suffix of every range key, as presented by the Reader's
+	// iterators. It requires Comparer.Split and Comparer.ImmediateSuccessor,
+	// and an sstable containing at most one point key per prefix, so that the
+	// presented keys are ordered. Block property filters are ignored when the
+	// suffix is replaced, as the properties describe the sstable's suffixes.
+	SyntheticSuffix []byte
 }
 
 func (o ReaderOptions) ensureDefaults() ReaderOptions {
@@ -155,6 +187,17 @@ type WriterOptions struct {
 	// The default value is 90
 	BlockSizeThreshold int
 
+	// BlockSizeFunc, if set, returns the target uncompressed size in bytes of
+	// the data block beginning with the given user key, overriding BlockSize.
+	// It allows the block size to depend on the key range, for example by
+	// using small blocks for the key prefixes serving point lookups and large
+	// blocks for the ones that are mostly scanned. A block's size is chosen
+	// when its first key is added, so it applies until the block is full. A
+	// non-positive size selects BlockSize.
+	//
+	// The default value is nil.
+	BlockSizeFunc func(key []byte) int
+
 	// Cache is used to cache uncompressed blocks from sstables.
 	//
 	// The default is a nil cache.
@@ -199,6 +242,28 @@ type WriterOptions struct {
 	// The default value is the value of BlockSize.
 	IndexBlockSize int
 
+	// TwoLevelIndexThreshold is the minimum uncompressed size in bytes of the
+	// index of an sstable for it to be partitioned into a two-level index,
+	// whose index blocks are only loaded as needed. A smaller index that
+	// doesn't fit in a single index block of IndexBlockSize is written as a
+	// single, larger index block.
+	//
+	// The default value of zero partitions every index that doesn't fit in a
+	// single index block.
+	TwoLevelIndexThreshold int
+
+	// PartitionedFilters partitions the table filter of an sstable into filter
+	// blocks, which are cut along with the index blocks (see IndexBlockSize),
+	// and writes a top-level filter index on them, so that a filter lookup in a
+	// large sstable only loads the filter block that may contain the key. A
+	// filter that fits in a single partition is written as a single filter
+	// block. Versions of Pebble that don't support partitioned filters still
+	// read the sstable, but ignore its filter. The sstables written by
+	// CopySpan from an sstable with partitioned filters have no filter.
+	//
+	// The default value is false.
+	PartitionedFilters bool
+
 	// Merger defines the associative merge operation to use for merging values
 	// written with {Batch,DB}.Merge. The MergerName is checked for consistency
 	// with the value stored in the sstable when it was written.
@@ -79,6 +79,9 @@ type Properties struct {
 	ExternalFormatVersion uint32 `prop:"rocksdb.external_sst_file.version"`
 	// Actual SST file creation time. 0 means unknown.
 	FileCreationTime uint64 `prop:"rocksdb.file.creation.time"`
+	// The number of partitions of the table filter, if it is partitioned (see
+	// WriterOptions.PartitionedFilters). 0 means the filter isn't partitioned.
+	FilterPartitions uint64 `prop:"pebble.filter.partitions"`
 	// The name of the filter policy used in this table. Empty if no filter
 	// policy is used.
 	FilterPolicyName string `prop:"rocksdb.filter.policy"`
@@ -317,6 +320,9 @@ func (p *Properties) save(w *rawBlockWriter) {
 	if p.FileCreationTime > 0 {
 		p.saveUvarint(m, unsafe.Offsetof(p.FileCreationTime), p.FileCreationTime)
 	}
+	if p.FilterPartitions > 0 {
+		p.saveUvarint(m, unsafe.Offsetof(p.FilterPartitions), p.FilterPartitions)
+	}
 	if p.FilterPolicyName != "" {
 		p.saveString(m, unsafe.Offsetof(p.FilterPolicyName), p.FilterPolicyName)
 	}
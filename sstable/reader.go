@@ -441,11 +441,12 @@ func (i *singleLevelIterator) init(
 }
 
 // setupForCompaction sets up the singleLevelIterator for use with compactionIter.
-// Currently, it skips readahead ramp-up. It should be called after init is called.
+// It skips readahead ramp-up, and lets the read handles drop the data they read
+// from the OS caches. It should be called after init is called.
 func (i *singleLevelIterator) setupForCompaction() {
-	i.dataRH.MaxReadahead()
+	i.dataRH.SetupForCompaction()
 	if i.vbRH != nil {
-		i.vbRH.MaxReadahead()
+		i.vbRH.SetupForCompaction()
 	}
 }
 
@@ -892,14 +893,12 @@ func (i *singleLevelIterator) seekPrefixGE(
 		}
 		i.lastBloomFilterMatched = false
 		// Check prefix bloom filter.
-		var dataH cache.Handle
-		dataH, i.err = i.reader.readFilter(i.ctx, i.stats)
+		var mayContain bool
+		mayContain, i.err = i.reader.filterMayContain(i.ctx, i.stats, prefix)
 		if i.err != nil {
 			i.data.invalidate()
 			return nil, base.LazyValue{}
 		}
-		mayContain := i.reader.tableFilter.mayContain(dataH.Get(), prefix)
-		dataH.Release()
 		if !mayContain {
 			// This invalidation may not be necessary for correctness, and may
 			// be a place to optimize later by reusing the already loaded
@@ -1516,7 +1515,9 @@ func (i *compactionIterator) skipForward(
 	key *InternalKey, val base.LazyValue,
 ) (*InternalKey, base.LazyValue) {
 	if key == nil {
-		for {
+		// The iterator may be exhausted due to an error loading a block,
+		// which loading the next block would clear.
+		for i.err == nil {
 			if key, _ := i.index.Next(); key == nil {
 				break
 			}
@@ -1909,14 +1910,12 @@ func (i *twoLevelIterator) SeekPrefixGE(
 			flags = flags.DisableTrySeekUsingNext()
 		}
 		i.lastBloomFilterMatched = false
-		var dataH cache.Handle
-		dataH, i.err = i.reader.readFilter(i.ctx, i.stats)
+		var mayContain bool
+		mayContain, i.err = i.reader.filterMayContain(i.ctx, i.stats, prefix)
 		if i.err != nil {
 			i.data.invalidate()
 			return nil, base.LazyValue{}
 		}
-		mayContain := i.reader.tableFilter.mayContain(dataH.Get(), prefix)
-		dataH.Release()
 		if !mayContain {
 			// This invalidation may not be necessary for correctness, and may
 			// be a place to optimize later by reusing the already loaded
@@ -2446,7 +2445,9 @@ func (i *twoLevelCompactionIterator) skipForward(
 	key *InternalKey, val base.LazyValue,
 ) (*InternalKey, base.LazyValue) {
 	if key == nil {
-		for {
+		// The iterator may be exhausted due to an error loading a block,
+		// which loading the next block would clear.
+		for i.err == nil {
 			if key, _ := i.topLevelIndex.Next(); key == nil {
 				break
 			}
@@ -2585,10 +2586,19 @@ type Reader struct {
 	metaIndexBH       BlockHandle
 	footerBH          BlockHandle
 	opts              ReaderOptions
-	Compare           Compare
-	FormatKey         base.FormatKey
-	Split             Split
-	tableFilter       *tableFilterReader
+	// synthetic is set if the keys of the sstable are presented with a
+	// synthetic prefix or suffix.
+	synthetic   *syntheticKeys
+	Compare     Compare
+	FormatKey   base.FormatKey
+	Split       Split
+	tableFilter *tableFilterReader
+	// filterPartitioned is set if the table filter is partitioned, in which
+	// case filterBH is the handle of the top-level filter index.
+	filterPartitioned bool
+	// ownsCacheID is set if the cache ID was allocated by the Reader, which
+	// releases it on Close.
+	ownsCacheID bool
 	// Keep types that are not multiples of 8 bytes at the end and with
 	// decreasing size.
 	Properties    Properties
@@ -2600,6 +2610,10 @@ type Reader struct {
 
 // Close implements DB.Close, as documented in the pebble package.
 func (r *Reader) Close() error {
+	if r.ownsCacheID {
+		r.opts.Cache.ReleaseID(r.cacheID)
+		r.ownsCacheID = false
+	}
 	r.opts.Cache.Unref()
 
 	if r.readable != nil {
@@ -2641,6 +2655,10 @@ func (r *Reader) NewIterWithBlockPropertyFiltersAndContext(
 	rp ReaderProvider,
 ) (Iterator, error) {
 
+	if r.synthetic != nil {
+		return r.newSyntheticIter(ctx, lower, upper, filterer, useFilterBlock, stats, rp)
+	}
+
 	// NB: pebble.tableCache wraps the returned iterator with one which performs
 	// reference counting on the Reader, preventing the Reader from being closed
 	// until the final iterator closes.
@@ -2675,6 +2693,12 @@ func (r *Reader) NewIter(lower, upper []byte) (Iterator, error) {
 // the number of bytes iterated. If an error occurs, NewCompactionIter cleans up
 // after itself and returns a nil iterator.
 func (r *Reader) NewCompactionIter(bytesIterated *uint64, rp ReaderProvider) (Iterator, error) {
+	if r.synthetic != nil {
+		// The bytes iterated aren't counted, as the synthetic keys aren't the
+		// keys of the blocks.
+		return r.newSyntheticIter(context.Background(), nil /* lower */, nil, /* upper */
+			nil /* filterer */, false /* useFilterBlock */, nil /* stats */, rp)
+	}
 	if r.Properties.IndexType == twoLevelIndex {
 		i := twoLevelIterPool.Get().(*twoLevelIterator)
 		err := i.init(context.Background(), r, nil /* lower */, nil, /* upper */
@@ -2719,6 +2743,9 @@ func (r *Reader) NewRawRangeDelIter() (keyspan.FragmentIterator, error) {
 	if err := i.blockIter.initHandle(r.Compare, h, r.Properties.GlobalSeqNum); err != nil {
 		return nil, err
 	}
+	if r.synthetic != nil {
+		return &syntheticSpanIter{iter: i, s: r.synthetic}, nil
+	}
 	return i, nil
 }
 
@@ -2740,6 +2767,9 @@ func (r *Reader) NewRawRangeKeyIter() (keyspan.FragmentIterator, error) {
 	if err := i.blockIter.initHandle(r.Compare, h, r.Properties.GlobalSeqNum); err != nil {
 		return nil, err
 	}
+	if r.synthetic != nil {
+		return &syntheticSpanIter{iter: i, s: r.synthetic}, nil
+	}
 	return i, nil
 }
 
@@ -2766,6 +2796,43 @@ func (r *Reader) readFilter(
 	return r.readBlock(ctx, r.filterBH, nil /* transform */, nil /* readHandle */, stats)
 }
 
+// filterMayContain returns whether the table filter may contain the prefix.
+// If the filter is partitioned, the top-level filter index is read to find the
+// only partition that may contain the prefix, which is then read in turn.
+func (r *Reader) filterMayContain(
+	ctx context.Context, stats *base.InternalIteratorStats, prefix []byte,
+) (bool, error) {
+	dataH, err := r.readFilter(ctx, stats)
+	if err != nil {
+		return false, err
+	}
+	defer dataH.Release()
+	if !r.filterPartitioned {
+		return r.tableFilter.mayContain(dataH.Get(), prefix), nil
+	}
+
+	var iter blockIter
+	if err := iter.init(r.Compare, dataH.Get(), 0 /* globalSeqNum */); err != nil {
+		return false, err
+	}
+	key, value := iter.SeekGE(prefix, base.SeekGEFlagsNone)
+	if key == nil {
+		// The prefix is greater than all the keys of the filter.
+		r.tableFilter.recordHit()
+		return false, nil
+	}
+	bh, n := decodeBlockHandle(value.InPlaceValue())
+	if n == 0 || n != len(value.InPlaceValue()) {
+		return false, base.CorruptionErrorf("pebble/table: invalid filter partition handle")
+	}
+	partH, err := r.readBlock(ctx, bh, nil /* transform */, nil /* readHandle */, stats)
+	if err != nil {
+		return false, err
+	}
+	defer partH.Release()
+	return r.tableFilter.mayContain(partH.Get(), prefix), nil
+}
+
 func (r *Reader) readRangeDel(stats *base.InternalIteratorStats) (cache.Handle, error) {
 	return r.readBlock(
 		context.Background(), r.rangeDelBH, r.rangeDelTransform, nil /* readHandle */, stats)
@@ -2791,7 +2858,7 @@ func checkChecksum(
 	}
 
 	if expectedChecksum != computedChecksum {
-		return base.CorruptionErrorf(
+		return base.CorruptionErrorAtf(base.FileTypeTable, fileNum, int64(bh.Offset),
 			"pebble/table: invalid table %s (checksum mismatch at %d/%d)",
 			errors.Safe(fileNum), errors.Safe(bh.Offset), errors.Safe(bh.Length))
 	}
@@ -2844,7 +2911,12 @@ func (r *Reader) readBlock(
 	}
 	if err != nil {
 		r.opts.Cache.Free(v)
-		return cache.Handle{}, err
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// The block handle points past the end of the file.
+			return cache.Handle{}, base.MarkCorruptionErrorAt(
+				err, base.FileTypeTable, r.fileNum, int64(bh.Offset))
+		}
+		return cache.Handle{}, base.MarkTransientIOError(err)
 	}
 
 	if err := checkChecksum(r.checksumType, b, bh, r.fileNum); err != nil {
@@ -2863,7 +2935,8 @@ func (r *Reader) readBlock(
 		b = v.Buf()
 	} else if err != nil {
 		r.opts.Cache.Free(v)
-		return cache.Handle{}, err
+		return cache.Handle{}, base.MarkCorruptionErrorAt(
+			err, base.FileTypeTable, r.fileNum, int64(bh.Offset))
 	}
 
 	if transform != nil {
@@ -3004,15 +3077,18 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 
 	for name, fp := range r.opts.Filters {
 		types := []struct {
-			ftype  FilterType
-			prefix string
+			ftype       FilterType
+			prefix      string
+			partitioned bool
 		}{
-			{TableFilter, "fullfilter."},
+			{TableFilter, "fullfilter.", false},
+			{TableFilter, metaPartitionedFilterPrefix, true},
 		}
 		var done bool
 		for _, t := range types {
 			if bh, ok := meta[t.prefix+name]; ok {
 				r.filterBH = bh
+				r.filterPartitioned = t.partitioned
 
 				switch t.ftype {
 				case TableFilter:
@@ -3104,6 +3180,21 @@ func (r *Reader) Layout() (*Layout, error) {
 			*iter = iter.resetForReuse()
 		}
 	}
+	if r.filterPartitioned {
+		filterH, err := r.readFilter(context.Background(), nil /* stats */)
+		if err != nil {
+			return nil, err
+		}
+		defer filterH.Release()
+		iter, _ := newBlockIter(r.Compare, filterH.Get())
+		for key, value := iter.First(); key != nil; key, value = iter.Next() {
+			bh, n := decodeBlockHandle(value.InPlaceValue())
+			if n == 0 || n != len(value.InPlaceValue()) {
+				return nil, base.CorruptionErrorf("pebble/table: invalid filter partition handle")
+			}
+			l.FilterPartitions = append(l.FilterPartitions, bh)
+		}
+	}
 	if r.valueBIH.h.Length != 0 {
 		vbiH, err := r.readBlock(context.Background(), r.valueBIH.h, nil, nil, nil)
 		if err != nil {
@@ -3156,6 +3247,7 @@ func (r *Reader) ValidateBlockChecksums() error {
 		blocks[i] = l.Data[i].BlockHandle
 	}
 	blocks = append(blocks, l.Index...)
+	blocks = append(blocks, l.FilterPartitions...)
 	blocks = append(blocks, l.TopIndex, l.Filter, l.RangeDel, l.RangeKey, l.Properties, l.MetaIndex)
 
 	// Sorting by offset ensures we are performing a sequential scan of the
@@ -3205,6 +3297,16 @@ func (r *Reader) EstimateDiskUsage(start, end []byte) (uint64, error) {
 	if r.err != nil {
 		return 0, r.err
 	}
+	if r.synthetic != nil {
+		// Map the range to the sstable's keys. A nil end is unbounded.
+		var empty bool
+		if start, end, empty = r.synthetic.bounds(start, end); empty {
+			return 0, nil
+		}
+		if start == nil {
+			start = []byte{}
+		}
+	}
 
 	indexH, err := r.readIndex(context.Background(), nil)
 	if err != nil {
@@ -3249,7 +3351,11 @@ func (r *Reader) EstimateDiskUsage(start, end []byte) (uint64, error) {
 			return 0, err
 		}
 
-		key, val = topIter.SeekGE(end, base.SeekGEFlagsNone)
+		if end == nil {
+			key, val = nil, base.LazyValue{}
+		} else {
+			key, val = topIter.SeekGE(end, base.SeekGEFlagsNone)
+		}
 		if key == nil {
 			if err := topIter.Error(); err != nil {
 				return 0, err
@@ -3298,7 +3404,7 @@ func (r *Reader) EstimateDiskUsage(start, end []byte) (uint64, error) {
 			uint64((float64(dataBlockSize)/float64(r.Properties.DataSize))*
 				float64(r.Properties.ValueBlocksSize))
 	}
-	if endIdxIter == nil {
+	if endIdxIter == nil || end == nil {
 		// The range spans beyond this file. Include data blocks through the last.
 		return includeInterpolatedValueBlocksSize(r.Properties.DataSize - startBH.Offset), nil
 	}
@@ -3356,18 +3462,19 @@ func NewReader(f objstorage.Readable, o ReaderOptions, extraOpts ...ReaderOption
 	}
 	if r.cacheID == 0 {
 		r.cacheID = r.opts.Cache.NewID()
+		r.ownsCacheID = true
 	}
 
 	footer, err := readFooter(f)
 	if err != nil {
-		r.err = err
+		r.err = r.markCorruptionError(err)
 		return nil, r.Close()
 	}
 	r.checksumType = footer.checksum
 	r.tableFormat = footer.format
 	// Read the metaindex.
 	if err := r.readMetaindex(footer.metaindexBH); err != nil {
-		r.err = err
+		r.err = r.markCorruptionError(err)
 		return nil, r.Close()
 	}
 	r.indexBH = footer.indexBH
@@ -3402,85 +3509,203 @@ func NewReader(f objstorage.Readable, o ReaderOptions, extraOpts ...ReaderOption
 				errors.Safe(r.fileNum), errors.Safe(r.Properties.MergerName))
 		}
 	}
+	if r.err == nil {
+		r.synthetic, r.err = makeSyntheticKeys(o, &r.Properties)
+	}
 	if r.err != nil {
 		return nil, r.Close()
 	}
 	return r, nil
 }
 
+// markCorruptionError attaches the location of the table to a corruption
+// error that doesn't carry one. Other errors are returned unchanged.
+func (r *Reader) markCorruptionError(err error) error {
+	if !errors.Is(err, base.ErrCorruption) {
+		return err
+	}
+	return base.MarkCorruptionErrorAt(err, base.FileTypeTable, r.fileNum, -1 /* offset */)
+}
+
 // Layout describes the block organization of an sstable.
 type Layout struct {
 	// NOTE: changes to fields in this struct should also be reflected in
 	// ValidateBlockChecksums, which validates a static list of BlockHandles
 	// referenced in this struct.
-
-	Data       []BlockHandleWithProperties
-	Index      []BlockHandle
-	TopIndex   BlockHandle
-	Filter     BlockHandle
-	RangeDel   BlockHandle
-	RangeKey   BlockHandle
-	ValueBlock []BlockHandle
-	ValueIndex BlockHandle
-	Properties BlockHandle
-	MetaIndex  BlockHandle
-	Footer     BlockHandle
-	Format     TableFormat
-}
-
-// Describe returns a description of the layout. If the verbose parameter is
-// true, details of the structure of each block are returned as well.
-func (l *Layout) Describe(
-	w io.Writer, verbose bool, r *Reader, fmtRecord func(key *base.InternalKey, value []byte),
-) {
-	ctx := context.TODO()
-	type block struct {
-		BlockHandle
-		name string
-	}
-	var blocks []block
-
+	//
+	// Filter is the table filter block or, if the filter is partitioned, the
+	// top-level filter index on the FilterPartitions.
+
+	Data             []BlockHandleWithProperties
+	Index            []BlockHandle
+	TopIndex         BlockHandle
+	Filter           BlockHandle
+	FilterPartitions []BlockHandle
+	RangeDel         BlockHandle
+	RangeKey         BlockHandle
+	ValueBlock       []BlockHandle
+	ValueIndex       BlockHandle
+	Properties       BlockHandle
+	MetaIndex        BlockHandle
+	Footer           BlockHandle
+	Format           TableFormat
+}
+
+// namedBlock is a block of an sstable, named by its kind.
+type namedBlock struct {
+	BlockHandle
+	name string
+}
+
+// blocks returns the blocks of the layout, sorted by offset.
+func (l *Layout) blocks() []namedBlock {
+	var blocks []namedBlock
 	for i := range l.Data {
-		blocks = append(blocks, block{l.Data[i].BlockHandle, "data"})
+		blocks = append(blocks, namedBlock{l.Data[i].BlockHandle, "data"})
 	}
 	for i := range l.Index {
-		blocks = append(blocks, block{l.Index[i], "index"})
+		blocks = append(blocks, namedBlock{l.Index[i], "index"})
 	}
 	if l.TopIndex.Length != 0 {
-		blocks = append(blocks, block{l.TopIndex, "top-index"})
+		blocks = append(blocks, namedBlock{l.TopIndex, "top-index"})
+	}
+	for i := range l.FilterPartitions {
+		blocks = append(blocks, namedBlock{l.FilterPartitions[i], "filter"})
 	}
 	if l.Filter.Length != 0 {
-		blocks = append(blocks, block{l.Filter, "filter"})
+		if len(l.FilterPartitions) > 0 {
+			blocks = append(blocks, namedBlock{l.Filter, "top-filter"})
+		} else {
+			blocks = append(blocks, namedBlock{l.Filter, "filter"})
+		}
 	}
 	if l.RangeDel.Length != 0 {
-		blocks = append(blocks, block{l.RangeDel, "range-del"})
+		blocks = append(blocks, namedBlock{l.RangeDel, "range-del"})
 	}
 	if l.RangeKey.Length != 0 {
-		blocks = append(blocks, block{l.RangeKey, "range-key"})
+		blocks = append(blocks, namedBlock{l.RangeKey, "range-key"})
 	}
 	for i := range l.ValueBlock {
-		blocks = append(blocks, block{l.ValueBlock[i], "value-block"})
+		blocks = append(blocks, namedBlock{l.ValueBlock[i], "value-block"})
 	}
 	if l.ValueIndex.Length != 0 {
-		blocks = append(blocks, block{l.ValueIndex, "value-index"})
+		blocks = append(blocks, namedBlock{l.ValueIndex, "value-index"})
 	}
 	if l.Properties.Length != 0 {
-		blocks = append(blocks, block{l.Properties, "properties"})
+		blocks = append(blocks, namedBlock{l.Properties, "properties"})
 	}
 	if l.MetaIndex.Length != 0 {
-		blocks = append(blocks, block{l.MetaIndex, "meta-index"})
+		blocks = append(blocks, namedBlock{l.MetaIndex, "meta-index"})
 	}
 	if l.Footer.Length != 0 {
 		if l.Footer.Length == levelDBFooterLen {
-			blocks = append(blocks, block{l.Footer, "leveldb-footer"})
+			blocks = append(blocks, namedBlock{l.Footer, "leveldb-footer"})
 		} else {
-			blocks = append(blocks, block{l.Footer, "footer"})
+			blocks = append(blocks, namedBlock{l.Footer, "footer"})
 		}
 	}
 
 	sort.Slice(blocks, func(i, j int) bool {
 		return blocks[i].Offset < blocks[j].Offset
 	})
+	return blocks
+}
+
+// LayoutBlock describes the physical properties of a block of an sstable.
+type LayoutBlock struct {
+	// Name is the kind of the block, as output by Layout.Describe: "data",
+	// "index", "top-index", "filter", "top-filter", "range-del", "range-key",
+	// "value-block", "value-index", "properties", "meta-index", "footer" or
+	// "leveldb-footer".
+	Name string
+	// BlockHandle holds the offset and the stored length of the block,
+	// excluding the block trailer.
+	BlockHandle
+	// Compression is the compression of the block, "none" for blocks stored
+	// uncompressed and the footer.
+	Compression string
+	// UncompressedLength is the length of the block once decompressed.
+	UncompressedLength uint64
+	// NumRestarts is the number of restart points of the block, zero for the
+	// blocks without restart points (filter, value and value index blocks, and
+	// the footer).
+	NumRestarts int
+}
+
+// CompressionRatio returns the ratio of the uncompressed length of the block
+// to its stored length.
+func (b *LayoutBlock) CompressionRatio() float64 {
+	if b.Length == 0 {
+		return 1
+	}
+	return float64(b.UncompressedLength) / float64(b.Length)
+}
+
+// String implements fmt.Stringer.
+func (b LayoutBlock) String() string {
+	return fmt.Sprintf("%10d  %s (%d) uncompressed=%d ratio=%.2f compression=%s restarts=%d",
+		b.Offset, b.Name, b.Length, b.UncompressedLength, b.CompressionRatio(),
+		b.Compression, b.NumRestarts)
+}
+
+// LayoutBlocks returns the physical properties of each of the blocks of the
+// sstable, sorted by offset. Unlike Layout, which only reads the index blocks,
+// LayoutBlocks reads every block of the sstable.
+func (r *Reader) LayoutBlocks() ([]LayoutBlock, error) {
+	l, err := r.Layout()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.TODO()
+	blocks := l.blocks()
+	res := make([]LayoutBlock, len(blocks))
+	trailer := make([]byte, blockTrailerLen)
+	for i := range blocks {
+		b := &blocks[i]
+		res[i] = LayoutBlock{
+			Name:               b.name,
+			BlockHandle:        b.BlockHandle,
+			Compression:        noCompressionBlockType.String(),
+			UncompressedLength: b.Length,
+		}
+		if b.name == "footer" || b.name == "leveldb-footer" {
+			continue
+		}
+
+		if _, err := r.readable.ReadAt(ctx, trailer, int64(b.Offset+b.Length)); err != nil {
+			return nil, err
+		}
+		bt := blockType(trailer[0])
+		if bt > zstdCompressionBlockType {
+			return nil, base.CorruptionErrorf("pebble/table: %s block at offset %d has unknown compression %d",
+				errors.Safe(b.name), errors.Safe(b.Offset), errors.Safe(bt))
+		}
+		res[i].Compression = bt.String()
+
+		h, err := r.readBlock(ctx, b.BlockHandle, nil /* transform */, nil /* readHandle */, nil /* stats */)
+		if err != nil {
+			return nil, err
+		}
+		data := h.Get()
+		res[i].UncompressedLength = uint64(len(data))
+		switch b.name {
+		case "data", "index", "top-index", "top-filter", "range-del", "range-key", "properties", "meta-index":
+			if len(data) >= 4 {
+				res[i].NumRestarts = int(binary.LittleEndian.Uint32(data[len(data)-4:]))
+			}
+		}
+		h.Release()
+	}
+	return res, nil
+}
+
+// Describe returns a description of the layout. If the verbose parameter is
+// true, details of the structure of each block are returned as well.
+func (l *Layout) Describe(
+	w io.Writer, verbose bool, r *Reader, fmtRecord func(key *base.InternalKey, value []byte),
+) {
+	ctx := context.TODO()
+	blocks := l.blocks()
 
 	for i := range blocks {
 		b := &blocks[i]
@@ -3642,6 +3867,20 @@ func (l *Layout) Describe(
 			}
 			formatRestarts(iter.data, iter.restarts, iter.numRestarts)
 			formatTrailer()
+		case "top-filter":
+			iter, _ := newBlockIter(r.Compare, h.Get())
+			for key, value := iter.First(); key != nil; key, value = iter.Next() {
+				bh, n := decodeBlockHandle(value.InPlaceValue())
+				if n == 0 || n != len(value.InPlaceValue()) {
+					fmt.Fprintf(w, "%10d    [err: invalid filter partition handle]\n", b.Offset+uint64(iter.offset))
+					continue
+				}
+				fmt.Fprintf(w, "%10d    block:%d/%d",
+					b.Offset+uint64(iter.offset), bh.Offset, bh.Length)
+				formatIsRestart(iter.data, iter.restarts, iter.numRestarts, iter.offset)
+			}
+			formatRestarts(iter.data, iter.restarts, iter.numRestarts)
+			formatTrailer()
 		case "properties":
 			iter, _ := newRawBlockIter(r.Compare, h.Get())
 			for valid := iter.First(); valid; valid = iter.Next() {
@@ -0,0 +1,482 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/keyspan"
+)
+
+// syntheticKeys holds the state required to present the keys of an sstable
+// with a synthetic prefix and/or suffix (see ReaderOptions.SyntheticPrefix and
+// ReaderOptions.SyntheticSuffix).
+//
+// A user key k of the sstable is presented as prefix+k, with the suffix of k
+// replaced by the synthetic suffix. Keys outside of the synthetic prefix sort
+// before or after all of the sstable's keys. Seek keys and bounds are mapped
+// to the sstable's keys conservatively when the suffix is replaced: the
+// sstable's iterators are positioned at the prefix of the key, and the
+// wrapping iterators skip the keys whose presented key is outside of the
+// requested range.
+type syntheticKeys struct {
+	prefix []byte
+	suffix []byte
+	cmp    Compare
+	split  Split
+	succ   base.ImmediateSuccessor
+}
+
+// makeSyntheticKeys validates the synthetic prefix and suffix of the options,
+// returning nil if neither is set.
+func makeSyntheticKeys(o ReaderOptions, props *Properties) (*syntheticKeys, error) {
+	if len(o.SyntheticPrefix) == 0 && len(o.SyntheticSuffix) == 0 {
+		return nil, nil
+	}
+	if props.ComparerName != "" && props.ComparerName != o.Comparer.Name {
+		return nil, errors.Errorf("pebble/table: synthetic keys require the sstable's comparer %s",
+			errors.Safe(props.ComparerName))
+	}
+	if len(o.SyntheticSuffix) > 0 && (o.Comparer.Split == nil || o.Comparer.ImmediateSuccessor == nil) {
+		return nil, errors.New("pebble/table: synthetic suffix requires Comparer.Split and Comparer.ImmediateSuccessor")
+	}
+	return &syntheticKeys{
+		prefix: o.SyntheticPrefix,
+		suffix: o.SyntheticSuffix,
+		cmp:    o.Comparer.Compare,
+		split:  o.Comparer.Split,
+		succ:   o.Comparer.ImmediateSuccessor,
+	}, nil
+}
+
+// transform appends the presented user key of the sstable's user key k to dst.
+func (s *syntheticKeys) transform(dst, k []byte) []byte {
+	dst = append(dst, s.prefix...)
+	if len(s.suffix) == 0 {
+		return append(dst, k...)
+	}
+	dst = append(dst, k[:s.split(k)]...)
+	return append(dst, s.suffix...)
+}
+
+// strip maps the presented key k to the sstable's key space. It returns -1 if
+// k sorts before all of the presented keys, +1 if k sorts after all of them,
+// and 0 and the key without the synthetic prefix otherwise. If the suffix is
+// replaced, the returned key is stripped of its suffix too.
+func (s *syntheticKeys) strip(k []byte) (int, []byte) {
+	if len(s.prefix) > 0 {
+		if !bytes.HasPrefix(k, s.prefix) {
+			if s.cmp(k, s.prefix) < 0 {
+				return -1, nil
+			}
+			return +1, nil
+		}
+		k = k[len(s.prefix):]
+	}
+	if len(s.suffix) > 0 {
+		k = k[:s.split(k)]
+	}
+	return 0, k
+}
+
+// bounds maps the presented iterator bounds to bounds of the sstable's iterator
+// containing all the sstable's keys presented within the bounds. It returns
+// empty if no presented key is within the bounds.
+func (s *syntheticKeys) bounds(lower, upper []byte) (l, u []byte, empty bool) {
+	if lower != nil {
+		switch pos, k := s.strip(lower); pos {
+		case +1:
+			return nil, nil, true
+		case 0:
+			l = k
+		}
+	}
+	if upper != nil {
+		switch pos, k := s.strip(upper); pos {
+		case -1:
+			return nil, nil, true
+		case 0:
+			if len(s.suffix) > 0 {
+				// Include all the keys with the prefix of the upper bound, as
+				// their presented keys may sort before the upper bound.
+				u = s.succ(nil, k)
+			} else {
+				u = k
+			}
+		}
+	}
+	return l, u, false
+}
+
+// newSyntheticIter returns an iterator presenting the keys of the sstable with
+// the synthetic prefix and/or suffix, within the presented bounds.
+//
+// Block property filters are ignored if the suffix is replaced, as the
+// properties of the blocks describe the sstable's suffixes. The filter block
+// is unaffected, as it's keyed by the prefixes of the sstable's keys, which
+// are the presented prefixes stripped of the synthetic prefix.
+func (r *Reader) newSyntheticIter(
+	ctx context.Context,
+	lower, upper []byte,
+	filterer *BlockPropertiesFilterer,
+	useFilterBlock bool,
+	stats *base.InternalIteratorStats,
+	rp ReaderProvider,
+) (Iterator, error) {
+	s := r.synthetic
+	i := &syntheticIter{s: s, lower: lower, upper: upper}
+	i.wrappedLower, i.wrappedUpper, i.empty = s.bounds(lower, upper)
+	l, u := i.wrappedLower, i.wrappedUpper
+	if len(s.suffix) > 0 {
+		filterer = nil
+	}
+	var err error
+	if r.Properties.IndexType == twoLevelIndex {
+		it := twoLevelIterPool.Get().(*twoLevelIterator)
+		err = it.init(ctx, r, l, u, filterer, useFilterBlock, stats, rp)
+		i.Iterator = it
+	} else {
+		it := singleLevelIterPool.Get().(*singleLevelIterator)
+		err = it.init(ctx, r, l, u, filterer, useFilterBlock, stats, rp)
+		i.Iterator = it
+	}
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// syntheticIter wraps the Iterator of an sstable, presenting its keys with a
+// synthetic prefix and/or suffix.
+type syntheticIter struct {
+	Iterator
+	s *syntheticKeys
+	// lower and upper are the presented bounds of the iterator.
+	lower, upper []byte
+	// wrappedLower and wrappedUpper are the bounds of the wrapped iterator.
+	wrappedLower, wrappedUpper []byte
+	// empty is set when no presented key is within the bounds.
+	empty bool
+	// exhausted is +1 (-1) when the last positioning call returned nil
+	// because the seek key sorts after (before) all the presented keys,
+	// without positioning the wrapped iterator.
+	exhausted int8
+	ikey      InternalKey
+	buf       []byte
+}
+
+var _ Iterator = (*syntheticIter)(nil)
+
+func (i *syntheticIter) key(k *InternalKey) *InternalKey {
+	i.buf = i.s.transform(i.buf[:0], k.UserKey)
+	i.ikey = InternalKey{UserKey: i.buf, Trailer: k.Trailer}
+	return &i.ikey
+}
+
+// forward steps the wrapped iterator forward from k until a key whose
+// presented key is at or after target and the lower bound, returning nil if
+// the presented key reaches the upper bound.
+func (i *syntheticIter) forward(
+	k *InternalKey, v base.LazyValue, target []byte,
+) (*InternalKey, base.LazyValue) {
+	i.exhausted = 0
+	for ; k != nil; k, v = i.Iterator.Next() {
+		pk := i.key(k)
+		if (target != nil && i.s.cmp(pk.UserKey, target) < 0) ||
+			(i.lower != nil && i.s.cmp(pk.UserKey, i.lower) < 0) {
+			continue
+		}
+		if i.upper != nil && i.s.cmp(pk.UserKey, i.upper) >= 0 {
+			return nil, base.LazyValue{}
+		}
+		return pk, v
+	}
+	return nil, base.LazyValue{}
+}
+
+// backward steps the wrapped iterator backward from k until a key whose
+// presented key is before target and the upper bound, returning nil if the
+// presented key reaches below the lower bound.
+func (i *syntheticIter) backward(
+	k *InternalKey, v base.LazyValue, target []byte,
+) (*InternalKey, base.LazyValue) {
+	i.exhausted = 0
+	for ; k != nil; k, v = i.Iterator.Prev() {
+		pk := i.key(k)
+		if (target != nil && i.s.cmp(pk.UserKey, target) >= 0) ||
+			(i.upper != nil && i.s.cmp(pk.UserKey, i.upper) >= 0) {
+			continue
+		}
+		if i.lower != nil && i.s.cmp(pk.UserKey, i.lower) < 0 {
+			return nil, base.LazyValue{}
+		}
+		return pk, v
+	}
+	return nil, base.LazyValue{}
+}
+
+// SeekGE implements internalIterator.SeekGE, as documented in the pebble
+// package.
+func (i *syntheticIter) SeekGE(key []byte, flags base.SeekGEFlags) (*InternalKey, base.LazyValue) {
+	if i.empty {
+		return nil, base.LazyValue{}
+	}
+	switch pos, k := i.s.strip(key); pos {
+	case -1:
+		return i.First()
+	case +1:
+		i.exhausted = +1
+		return nil, base.LazyValue{}
+	default:
+		ik, v := i.Iterator.SeekGE(k, flags)
+		return i.forward(ik, v, key)
+	}
+}
+
+// SeekPrefixGE implements internalIterator.SeekPrefixGE, as documented in the
+// pebble package.
+func (i *syntheticIter) SeekPrefixGE(
+	prefix, key []byte, flags base.SeekGEFlags,
+) (*InternalKey, base.LazyValue) {
+	if i.empty || !bytes.HasPrefix(prefix, i.s.prefix) {
+		i.exhausted = +1
+		return nil, base.LazyValue{}
+	}
+	pos, k := i.s.strip(key)
+	if pos != 0 {
+		i.exhausted = +1
+		return nil, base.LazyValue{}
+	}
+	// The prefix of the sstable's keys is the presented prefix stripped of the
+	// synthetic prefix, so that the filter block is checked for the sstable's
+	// keys.
+	ik, v := i.Iterator.SeekPrefixGE(prefix[len(i.s.prefix):], k, flags)
+	return i.forward(ik, v, key)
+}
+
+// SeekLT implements internalIterator.SeekLT, as documented in the pebble
+// package.
+func (i *syntheticIter) SeekLT(key []byte, flags base.SeekLTFlags) (*InternalKey, base.LazyValue) {
+	if i.empty {
+		return nil, base.LazyValue{}
+	}
+	switch pos, k := i.s.strip(key); pos {
+	case -1:
+		i.exhausted = -1
+		return nil, base.LazyValue{}
+	case +1:
+		return i.Last()
+	default:
+		if len(i.s.suffix) > 0 {
+			// Position the wrapped iterator after all the keys with the prefix
+			// of the seek key, as their presented keys may sort before the
+			// seek key.
+			k = i.s.succ(nil, k)
+		}
+		ik, v := i.Iterator.SeekLT(k, flags)
+		return i.backward(ik, v, key)
+	}
+}
+
+// First implements internalIterator.First, as documented in the pebble
+// package.
+func (i *syntheticIter) First() (*InternalKey, base.LazyValue) {
+	if i.empty {
+		return nil, base.LazyValue{}
+	}
+	if i.wrappedLower != nil {
+		k, v := i.Iterator.SeekGE(i.wrappedLower, base.SeekGEFlagsNone)
+		return i.forward(k, v, nil)
+	}
+	k, v := i.Iterator.First()
+	return i.forward(k, v, nil)
+}
+
+// Last implements internalIterator.Last, as documented in the pebble package.
+func (i *syntheticIter) Last() (*InternalKey, base.LazyValue) {
+	if i.empty {
+		return nil, base.LazyValue{}
+	}
+	if i.wrappedUpper != nil {
+		k, v := i.Iterator.SeekLT(i.wrappedUpper, base.SeekLTFlagsNone)
+		return i.backward(k, v, nil)
+	}
+	k, v := i.Iterator.Last()
+	return i.backward(k, v, nil)
+}
+
+// Next implements internalIterator.Next, as documented in the pebble package.
+func (i *syntheticIter) Next() (*InternalKey, base.LazyValue) {
+	if i.empty {
+		return nil, base.LazyValue{}
+	}
+	if i.exhausted < 0 {
+		return i.First()
+	}
+	k, v := i.Iterator.Next()
+	return i.forward(k, v, nil)
+}
+
+// NextPrefix implements (base.InternalIterator).NextPrefix.
+func (i *syntheticIter) NextPrefix(succKey []byte) (*InternalKey, base.LazyValue) {
+	if i.empty {
+		return nil, base.LazyValue{}
+	}
+	switch pos, k := i.s.strip(succKey); pos {
+	case +1:
+		i.exhausted = +1
+		return nil, base.LazyValue{}
+	case -1:
+		return i.Next()
+	default:
+		ik, v := i.Iterator.NextPrefix(k)
+		return i.forward(ik, v, succKey)
+	}
+}
+
+// Prev implements internalIterator.Prev, as documented in the pebble package.
+func (i *syntheticIter) Prev() (*InternalKey, base.LazyValue) {
+	if i.empty {
+		return nil, base.LazyValue{}
+	}
+	if i.exhausted > 0 {
+		return i.Last()
+	}
+	k, v := i.Iterator.Prev()
+	return i.backward(k, v, nil)
+}
+
+// MaybeFilteredKeys may be called when an iterator is exhausted to indicate
+// whether or not the last positioning method may have skipped any keys due to
+// block-property filters.
+func (i *syntheticIter) MaybeFilteredKeys() bool {
+	return !i.empty && i.exhausted == 0 && i.Iterator.MaybeFilteredKeys()
+}
+
+// SetBounds implements internalIterator.SetBounds, as documented in the pebble
+// package.
+func (i *syntheticIter) SetBounds(lower, upper []byte) {
+	i.lower, i.upper = lower, upper
+	i.wrappedLower, i.wrappedUpper, i.empty = i.s.bounds(lower, upper)
+	if !i.empty {
+		i.Iterator.SetBounds(i.wrappedLower, i.wrappedUpper)
+	}
+}
+
+func (i *syntheticIter) String() string {
+	return fmt.Sprintf("synthetic(%s)", i.Iterator)
+}
+
+// syntheticSpanIter wraps a range deletion or range key iterator of an
+// sstable, presenting its spans with a synthetic prefix, and the suffixes of
+// its range keys replaced by the synthetic suffix.
+type syntheticSpanIter struct {
+	iter keyspan.FragmentIterator
+	s    *syntheticKeys
+	// exhausted is as in syntheticIter.
+	exhausted int8
+	span      keyspan.Span
+	keys      []keyspan.Key
+	buf       []byte
+}
+
+var _ keyspan.FragmentIterator = (*syntheticSpanIter)(nil)
+
+func (i *syntheticSpanIter) transform(s *keyspan.Span) *keyspan.Span {
+	i.exhausted = 0
+	if s == nil {
+		return nil
+	}
+	i.buf = append(append(append(append(i.buf[:0], i.s.prefix...), s.Start...), i.s.prefix...), s.End...)
+	n := len(i.s.prefix) + len(s.Start)
+	i.span = keyspan.Span{
+		Start:     i.buf[:n:n],
+		End:       i.buf[n:],
+		Keys:      s.Keys,
+		KeysOrder: s.KeysOrder,
+	}
+	if len(i.s.suffix) > 0 {
+		i.keys = append(i.keys[:0], s.Keys...)
+		for j := range i.keys {
+			if i.keys[j].Suffix != nil {
+				i.keys[j].Suffix = i.s.suffix
+			}
+		}
+		i.span.Keys = i.keys
+	}
+	return &i.span
+}
+
+// SeekGE implements keyspan.FragmentIterator.
+func (i *syntheticSpanIter) SeekGE(key []byte) *keyspan.Span {
+	if len(i.s.prefix) == 0 {
+		return i.transform(i.iter.SeekGE(key))
+	}
+	switch {
+	case !bytes.HasPrefix(key, i.s.prefix) && i.s.cmp(key, i.s.prefix) < 0:
+		return i.First()
+	case !bytes.HasPrefix(key, i.s.prefix):
+		i.exhausted = +1
+		return nil
+	default:
+		return i.transform(i.iter.SeekGE(key[len(i.s.prefix):]))
+	}
+}
+
+// SeekLT implements keyspan.FragmentIterator.
+func (i *syntheticSpanIter) SeekLT(key []byte) *keyspan.Span {
+	if len(i.s.prefix) == 0 {
+		return i.transform(i.iter.SeekLT(key))
+	}
+	switch {
+	case !bytes.HasPrefix(key, i.s.prefix) && i.s.cmp(key, i.s.prefix) < 0:
+		i.exhausted = -1
+		return nil
+	case !bytes.HasPrefix(key, i.s.prefix):
+		return i.Last()
+	default:
+		return i.transform(i.iter.SeekLT(key[len(i.s.prefix):]))
+	}
+}
+
+// First implements keyspan.FragmentIterator.
+func (i *syntheticSpanIter) First() *keyspan.Span {
+	return i.transform(i.iter.First())
+}
+
+// Last implements keyspan.FragmentIterator.
+func (i *syntheticSpanIter) Last() *keyspan.Span {
+	return i.transform(i.iter.Last())
+}
+
+// Next implements keyspan.FragmentIterator.
+func (i *syntheticSpanIter) Next() *keyspan.Span {
+	if i.exhausted < 0 {
+		return i.First()
+	}
+	return i.transform(i.iter.Next())
+}
+
+// Prev implements keyspan.FragmentIterator.
+func (i *syntheticSpanIter) Prev() *keyspan.Span {
+	if i.exhausted > 0 {
+		return i.Last()
+	}
+	return i.transform(i.iter.Prev())
+}
+
+// Error implements keyspan.FragmentIterator.
+func (i *syntheticSpanIter) Error() error {
+	return i.iter.Error()
+}
+
+// Close implements keyspan.FragmentIterator.
+func (i *syntheticSpanIter) Close() error {
+	return i.iter.Close()
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/cockroachdb/pebble/internal/errorfs"
 	"github.com/cockroachdb/pebble/internal/humanize"
+	"github.com/cockroachdb/pebble/internal/keyspan"
 	"github.com/cockroachdb/pebble/internal/testkeys"
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
@@ -505,6 +506,97 @@ func runTestReader(
 	})
 }
 
+func TestReaderSynthetic(t *testing.T) {
+	for _, indexBlockSize := range []int{1, math.MaxInt32} {
+		t.Run(fmt.Sprintf("indexBlockSize=%d", indexBlockSize), func(t *testing.T) {
+			var r *Reader
+			defer func() {
+				if r != nil {
+					require.NoError(t, r.Close())
+				}
+			}()
+			datadriven.RunTest(t, "testdata/reader_synthetic", func(t *testing.T, d *datadriven.TestData) string {
+				switch d.Cmd {
+				case "build":
+					if r != nil {
+						require.NoError(t, r.Close())
+						r = nil
+					}
+					var err error
+					_, r, err = runBuildCmd(d, &WriterOptions{
+						BlockSize:      1,
+						IndexBlockSize: indexBlockSize,
+						Comparer:       testkeys.Comparer,
+						FilterPolicy:   bloom.FilterPolicy(10),
+						TableFormat:    TableFormatPebblev3,
+					}, 0)
+					if err != nil {
+						return err.Error()
+					}
+					return ""
+
+				case "iter":
+					var lower, upper []byte
+					for _, arg := range d.CmdArgs {
+						switch arg.Key {
+						case "lower":
+							lower = []byte(arg.Vals[0])
+						case "upper":
+							upper = []byte(arg.Vals[0])
+						}
+					}
+					iter, err := r.NewIter(lower, upper)
+					if err != nil {
+						return err.Error()
+					}
+					return runIterCmd(d, iter, true /* printValue */)
+
+				case "scan-range-del", "scan-range-key":
+					var iter keyspan.FragmentIterator
+					var err error
+					if d.Cmd == "scan-range-del" {
+						iter, err = r.NewRawRangeDelIter()
+					} else {
+						iter, err = r.NewRawRangeKeyIter()
+					}
+					if err != nil {
+						return err.Error()
+					}
+					if iter == nil {
+						return ""
+					}
+					defer iter.Close()
+
+					var buf bytes.Buffer
+					for s := iter.First(); s != nil; s = iter.Next() {
+						fmt.Fprintf(&buf, "%s\n", s)
+					}
+					for s := iter.Last(); s != nil; s = iter.Prev() {
+						fmt.Fprintf(&buf, "rev: %s\n", s)
+					}
+					return buf.String()
+
+				case "estimate":
+					var start, end string
+					d.ScanArgs(t, "start", &start)
+					d.ScanArgs(t, "end", &end)
+					size, err := r.EstimateDiskUsage([]byte(start), []byte(end))
+					if err != nil {
+						return err.Error()
+					}
+					if size > 0 {
+						return "non-zero"
+					}
+					return "zero"
+
+				default:
+					return fmt.Sprintf("unknown command: %s", d.Cmd)
+				}
+			})
+		})
+	}
+}
+
 func TestReaderCheckComparerMerger(t *testing.T) {
 	const testTable = "test"
 
@@ -845,12 +937,31 @@ func TestValidateBlockChecksums(t *testing.T) {
 		"testdata/h.zstd-compression.sst",
 	}
 
+	// Write a table with a partitioned filter.
+	partitionedFilterFile := filepath.Join(t.TempDir(), "partitioned-filter.sst")
+	{
+		f, err := vfs.Default.Create(partitionedFilterFile)
+		require.NoError(t, err)
+		w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{
+			BlockSize:          256,
+			IndexBlockSize:     256,
+			FilterPolicy:       bloom.FilterPolicy(10),
+			PartitionedFilters: true,
+			TableFormat:        TableFormatPebblev3,
+		})
+		for i := 0; i < 2000; i++ {
+			require.NoError(t, w.Set([]byte(fmt.Sprintf("k%05d", i)), []byte("v")))
+		}
+		require.NoError(t, w.Close())
+	}
+
 	type corruptionLocation int
 	const (
 		corruptionLocationData corruptionLocation = iota
 		corruptionLocationIndex
 		corruptionLocationTopIndex
 		corruptionLocationFilter
+		corruptionLocationFilterPartition
 		corruptionLocationRangeDel
 		corruptionLocationProperties
 		corruptionLocationMetaIndex
@@ -892,11 +1003,21 @@ func TestValidateBlockChecksums(t *testing.T) {
 				"testdata/h.table-bloom.no-compression.prefix_extractor.no_whole_key_filter.sst",
 				"testdata/h.table-bloom.no-compression.sst",
 				"testdata/h.table-bloom.sst",
+				partitionedFilterFile,
 			},
 			corruptionLocations: []corruptionLocation{
 				corruptionLocationFilter,
 			},
 		},
+		{
+			name: "filter partition corruption",
+			files: []string{
+				partitionedFilterFile,
+			},
+			corruptionLocations: []corruptionLocation{
+				corruptionLocationFilterPartition,
+			},
+		},
 		{
 			name: "range deletion block corruption",
 			corruptionLocations: []corruptionLocation{
@@ -963,6 +1084,7 @@ func TestValidateBlockChecksums(t *testing.T) {
 		// Perform bit flips in various corruption locations.
 		layout, err := r.Layout()
 		require.NoError(t, err)
+		corruptOffsets := make(map[int64]bool)
 		for _, location := range corruptionLocations {
 			var bh BlockHandle
 			switch location {
@@ -974,6 +1096,9 @@ func TestValidateBlockChecksums(t *testing.T) {
 				bh = layout.TopIndex
 			case corruptionLocationFilter:
 				bh = layout.Filter
+			case corruptionLocationFilterPartition:
+				require.Greater(t, len(layout.FilterPartitions), 1)
+				bh = layout.FilterPartitions[rng.Intn(len(layout.FilterPartitions))]
 			case corruptionLocationRangeDel:
 				bh = layout.RangeDel
 			case corruptionLocationProperties:
@@ -985,6 +1110,7 @@ func TestValidateBlockChecksums(t *testing.T) {
 			}
 
 			// Corrupt a random byte within the selected block.
+			corruptOffsets[int64(bh.Offset)] = true
 			pos := int64(bh.Offset) + rng.Int63n(int64(bh.Length))
 			t.Logf("altering file=%s @ offset = %d", file, pos)
 
@@ -1009,6 +1135,13 @@ func TestValidateBlockChecksums(t *testing.T) {
 		err = r.ValidateBlockChecksums()
 		require.Error(t, err)
 		require.Regexp(t, `checksum mismatch`, err.Error())
+
+		// The error carries the location of a corrupt block.
+		require.True(t, errors.Is(err, base.ErrCorruption))
+		var ce *base.CorruptionError
+		require.True(t, errors.As(err, &ce))
+		require.Equal(t, base.FileTypeTable, ce.FileType)
+		require.True(t, corruptOffsets[ce.Offset], "unexpected offset %d", ce.Offset)
 	}
 
 	for _, tc := range testCases {
@@ -0,0 +1,337 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"context"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/keyspan"
+	"github.com/cockroachdb/pebble/internal/manifest"
+)
+
+// VirtualReader wraps the Reader of a backing sstable, exposing only the keys
+// within the bounds of a virtual sstable. All reads of a virtual sstable must
+// go through a VirtualReader.
+//
+// The bounds of a virtual sstable are enforced at the granularity of user
+// keys: every key of the backing sstable with a user key within the bounds is
+// visible. The bounds must contain every range deletion and range key of the
+// virtual sstable, so spans are only truncated at an exclusive upper bound.
+type VirtualReader struct {
+	vState virtualState
+	reader *Reader
+	// Properties are the properties of the backing sstable, with the entry
+	// counts and sizes scaled down in proportion to the size of the virtual
+	// sstable relative to the backing sstable.
+	Properties Properties
+}
+
+// virtualState is the state of a virtual sstable required to read it.
+type virtualState struct {
+	lower   InternalKey
+	upper   InternalKey
+	fileNum base.FileNum
+	Compare Compare
+}
+
+// MakeVirtualReader constructs a VirtualReader reading the virtual sstable
+// described by meta from the Reader of its backing sstable.
+func MakeVirtualReader(reader *Reader, meta manifest.VirtualFileMeta) VirtualReader {
+	v := VirtualReader{
+		vState: virtualState{
+			lower:   meta.Smallest,
+			upper:   meta.Largest,
+			fileNum: meta.FileNum,
+			Compare: reader.Compare,
+		},
+		reader:     reader,
+		Properties: reader.Properties,
+	}
+	v.Properties.scale(meta.Size, meta.FileBacking.Size)
+	return v
+}
+
+// scale scales down the entry counts and sizes of the properties by the ratio
+// num/den. Non-zero values remain non-zero.
+func (p *Properties) scale(num, den uint64) {
+	if den == 0 || num >= den {
+		return
+	}
+	s := func(v *uint64) {
+		if *v == 0 {
+			return
+		}
+		*v = (*v*num + den - 1) / den
+	}
+	s(&p.DataSize)
+	s(&p.FilterSize)
+	s(&p.IndexSize)
+	s(&p.NumDataBlocks)
+	s(&p.NumDeletions)
+	s(&p.NumEntries)
+	s(&p.NumMergeOperands)
+	s(&p.NumRangeDeletions)
+	s(&p.NumRangeKeyDels)
+	s(&p.NumRangeKeySets)
+	s(&p.NumRangeKeyUnsets)
+	s(&p.NumValueBlocks)
+	s(&p.NumValuesInValueBlocks)
+	s(&p.RawKeySize)
+	s(&p.RawRangeKeyKeySize)
+	s(&p.RawRangeKeyValueSize)
+	s(&p.RawValueSize)
+	s(&p.ValueBlocksSize)
+}
+
+// NewCompactionIter is the compaction iterator function for virtual
+// sstables. Unlike Reader.NewCompactionIter, the returned iterator doesn't
+// increment bytesIterated, as the backing sstable may contain keys outside of
+// the virtual sstable.
+func (v *VirtualReader) NewCompactionIter(bytesIterated *uint64, rp ReaderProvider) (Iterator, error) {
+	return v.NewIterWithBlockPropertyFiltersAndContext(
+		context.Background(), nil /* lower */, nil, /* upper */
+		nil /* filterer */, false /* useFilterBlock */, nil /* stats */, rp)
+}
+
+// NewIterWithBlockPropertyFiltersAndContext wraps
+// Reader.NewIterWithBlockPropertyFiltersAndContext, constraining the iterator
+// to the bounds of the virtual sstable.
+func (v *VirtualReader) NewIterWithBlockPropertyFiltersAndContext(
+	ctx context.Context,
+	lower, upper []byte,
+	filterer *BlockPropertiesFilterer,
+	useFilterBlock bool,
+	stats *base.InternalIteratorStats,
+	rp ReaderProvider,
+) (Iterator, error) {
+	i := &virtualIter{vState: &v.vState}
+	i.setBounds(lower, upper)
+	iter, err := v.reader.NewIterWithBlockPropertyFiltersAndContext(
+		ctx, i.lower, i.upper, filterer, useFilterBlock, stats, rp)
+	if err != nil {
+		return nil, err
+	}
+	i.Iterator = iter
+	return i, nil
+}
+
+// NewRawRangeDelIter wraps Reader.NewRawRangeDelIter, truncating the range
+// deletions to the bounds of the virtual sstable.
+func (v *VirtualReader) NewRawRangeDelIter() (keyspan.FragmentIterator, error) {
+	iter, err := v.reader.NewRawRangeDelIter()
+	if err != nil || iter == nil {
+		return nil, err
+	}
+	return keyspan.Filter(iter, v.vState.truncateSpan), nil
+}
+
+// NewRawRangeKeyIter wraps Reader.NewRawRangeKeyIter, truncating the range
+// keys to the bounds of the virtual sstable.
+func (v *VirtualReader) NewRawRangeKeyIter() (keyspan.FragmentIterator, error) {
+	iter, err := v.reader.NewRawRangeKeyIter()
+	if err != nil || iter == nil {
+		return nil, err
+	}
+	return keyspan.Filter(iter, v.vState.truncateSpan), nil
+}
+
+// EstimateDiskUsage wraps Reader.EstimateDiskUsage, constraining [start, end]
+// to the bounds of the virtual sstable.
+func (v *VirtualReader) EstimateDiskUsage(start, end []byte) (uint64, error) {
+	if v.vState.Compare(start, v.vState.lower.UserKey) < 0 {
+		start = v.vState.lower.UserKey
+	}
+	if v.vState.Compare(end, v.vState.upper.UserKey) > 0 {
+		end = v.vState.upper.UserKey
+	}
+	if v.vState.Compare(start, end) > 0 {
+		return 0, nil
+	}
+	return v.reader.EstimateDiskUsage(start, end)
+}
+
+// ValidateBlockChecksums wraps Reader.ValidateBlockChecksums, validating the
+// blocks of the entire backing sstable.
+func (v *VirtualReader) ValidateBlockChecksums() error {
+	return v.reader.ValidateBlockChecksums()
+}
+
+// TableFormat returns the format version of the backing sstable.
+func (v *VirtualReader) TableFormat() (TableFormat, error) {
+	return v.reader.TableFormat()
+}
+
+// truncateSpan is a keyspan.FilterFunc that truncates a span to the bounds of
+// the virtual sstable, dropping spans outside of the bounds.
+func (v *virtualState) truncateSpan(in *keyspan.Span, out *keyspan.Span) bool {
+	*out = *in
+	if v.Compare(in.End, v.lower.UserKey) <= 0 {
+		return false
+	}
+	if c := v.Compare(in.Start, v.upper.UserKey); c > 0 || (c == 0 && v.upper.IsExclusiveSentinel()) {
+		return false
+	}
+	if v.Compare(out.Start, v.lower.UserKey) < 0 {
+		out.Start = v.lower.UserKey
+	}
+	if v.upper.IsExclusiveSentinel() && v.Compare(out.End, v.upper.UserKey) > 0 {
+		out.End = v.upper.UserKey
+	}
+	return true
+}
+
+// virtualIter wraps an Iterator over the backing sstable of a virtual sstable,
+// constraining it to the bounds of the virtual sstable.
+//
+// The wrapped iterator is configured with the intersection of the iterator
+// bounds and the bounds of the virtual sstable. It enforces the lower bound
+// and an exclusive upper bound. An inclusive upper bound of the virtual
+// sstable can't be expressed as an iterator bound, so it's enforced by
+// virtualIter.
+type virtualIter struct {
+	Iterator
+	vState *virtualState
+	// lower and upper are the bounds of the wrapped iterator.
+	lower []byte
+	upper []byte
+	// inclusiveUpper is set to the inclusive upper bound of the virtual
+	// sstable if it's more constraining than upper.
+	inclusiveUpper []byte
+	// empty is set if the bounds don't intersect the virtual sstable.
+	empty bool
+}
+
+var _ Iterator = (*virtualIter)(nil)
+
+// setBounds computes the bounds of the wrapped iterator from the iterator
+// bounds lower and upper.
+func (i *virtualIter) setBounds(lower, upper []byte) {
+	cmp := i.vState.Compare
+	i.lower = i.vState.lower.UserKey
+	if lower != nil && cmp(lower, i.lower) > 0 {
+		i.lower = lower
+	}
+	i.upper = upper
+	i.inclusiveUpper = nil
+	if upper == nil || cmp(i.vState.upper.UserKey, upper) < 0 {
+		if i.vState.upper.IsExclusiveSentinel() {
+			i.upper = i.vState.upper.UserKey
+		} else {
+			i.inclusiveUpper = i.vState.upper.UserKey
+		}
+	}
+	i.empty = (i.upper != nil && cmp(i.lower, i.upper) >= 0) ||
+		(i.inclusiveUpper != nil && cmp(i.lower, i.inclusiveUpper) > 0)
+}
+
+// checkUpper returns the key, or nil if the key is beyond the inclusive upper
+// bound.
+func (i *virtualIter) checkUpper(
+	key *InternalKey, val base.LazyValue,
+) (*InternalKey, base.LazyValue) {
+	if key != nil && i.inclusiveUpper != nil && i.vState.Compare(key.UserKey, i.inclusiveUpper) > 0 {
+		return nil, base.LazyValue{}
+	}
+	return key, val
+}
+
+// skipBackward steps backward over any keys beyond the inclusive upper bound.
+func (i *virtualIter) skipBackward(
+	key *InternalKey, val base.LazyValue,
+) (*InternalKey, base.LazyValue) {
+	for key != nil && i.inclusiveUpper != nil && i.vState.Compare(key.UserKey, i.inclusiveUpper) > 0 {
+		key, val = i.Iterator.Prev()
+	}
+	return key, val
+}
+
+// SeekGE implements internalIterator.SeekGE, as documented in the pebble
+// package.
+func (i *virtualIter) SeekGE(key []byte, flags base.SeekGEFlags) (*InternalKey, base.LazyValue) {
+	if i.empty {
+		return nil, base.LazyValue{}
+	}
+	if i.vState.Compare(key, i.lower) < 0 {
+		key = i.lower
+	}
+	return i.checkUpper(i.Iterator.SeekGE(key, flags))
+}
+
+// SeekPrefixGE implements internalIterator.SeekPrefixGE, as documented in the
+// pebble package.
+func (i *virtualIter) SeekPrefixGE(
+	prefix, key []byte, flags base.SeekGEFlags,
+) (*InternalKey, base.LazyValue) {
+	if i.empty {
+		return nil, base.LazyValue{}
+	}
+	if i.vState.Compare(key, i.lower) < 0 {
+		key = i.lower
+	}
+	return i.checkUpper(i.Iterator.SeekPrefixGE(prefix, key, flags))
+}
+
+// SeekLT implements internalIterator.SeekLT, as documented in the pebble
+// package.
+func (i *virtualIter) SeekLT(key []byte, flags base.SeekLTFlags) (*InternalKey, base.LazyValue) {
+	if i.empty {
+		return nil, base.LazyValue{}
+	}
+	if i.upper != nil && i.vState.Compare(key, i.upper) > 0 {
+		key = i.upper
+	}
+	return i.skipBackward(i.Iterator.SeekLT(key, flags))
+}
+
+// First implements internalIterator.First, as documented in the pebble
+// package.
+func (i *virtualIter) First() (*InternalKey, base.LazyValue) {
+	if i.empty {
+		return nil, base.LazyValue{}
+	}
+	// The wrapped iterator always has a lower bound, so it must be positioned
+	// using SeekGE.
+	return i.checkUpper(i.Iterator.SeekGE(i.lower, base.SeekGEFlagsNone))
+}
+
+// Last implements internalIterator.Last, as documented in the pebble package.
+func (i *virtualIter) Last() (*InternalKey, base.LazyValue) {
+	if i.empty {
+		return nil, base.LazyValue{}
+	}
+	if i.upper != nil {
+		return i.skipBackward(i.Iterator.SeekLT(i.upper, base.SeekLTFlagsNone))
+	}
+	return i.skipBackward(i.Iterator.Last())
+}
+
+// Next implements internalIterator.Next, as documented in the pebble package.
+func (i *virtualIter) Next() (*InternalKey, base.LazyValue) {
+	return i.checkUpper(i.Iterator.Next())
+}
+
+// NextPrefix implements (base.InternalIterator).NextPrefix.
+func (i *virtualIter) NextPrefix(succKey []byte) (*InternalKey, base.LazyValue) {
+	return i.checkUpper(i.Iterator.NextPrefix(succKey))
+}
+
+// Prev implements internalIterator.Prev, as documented in the pebble package.
+func (i *virtualIter) Prev() (*InternalKey, base.LazyValue) {
+	return i.skipBackward(i.Iterator.Prev())
+}
+
+// SetBounds implements internalIterator.SetBounds, as documented in the pebble
+// package.
+func (i *virtualIter) SetBounds(lower, upper []byte) {
+	i.setBounds(lower, upper)
+	i.Iterator.SetBounds(i.lower, i.upper)
+}
+
+// SetCloseHook implements Iterator.SetCloseHook, passing the virtualIter to
+// the hook rather than the wrapped iterator.
+func (i *virtualIter) SetCloseHook(fn func(i Iterator) error) {
+	i.Iterator.SetCloseHook(func(Iterator) error { return fn(i) })
+}
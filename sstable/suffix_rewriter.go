@@ -11,6 +11,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/bytealloc"
 	"github.com/cockroachdb/pebble/internal/invariants"
+	"github.com/cockroachdb/pebble/internal/keyspan"
 	"github.com/cockroachdb/pebble/internal/rangekey"
 	"github.com/cockroachdb/pebble/objstorage"
 )
@@ -73,15 +74,228 @@ func rewriteKeySuffixesInBlocks(
 		return nil, TableFormatUnspecified,
 			errors.New("a valid splitter is required to rewrite suffixes")
 	}
-	if concurrency < 1 {
-		return nil, TableFormatUnspecified, errors.New("concurrency must be >= 1")
-	}
 	// Even though NumValueBlocks = 0 => NumValuesInValueBlocks = 0, check both
 	// as a defensive measure.
 	if r.Properties.NumValueBlocks > 0 || r.Properties.NumValuesInValueBlocks > 0 {
 		return nil, TableFormatUnspecified,
 			errors.New("sstable with a single suffix should not have value blocks")
 	}
+	return rewriteKeysInBlocks(r, out, o, suffixRewrite{from: from, to: to, split: o.Comparer.Split}, concurrency)
+}
+
+// RewriteKeyPrefixesAndReturnFormat copies the content of the passed SSTable
+// bytes to a new sstable, written to `out`, in which the prefix `from` is
+// replaced with `to` in every key. Passing an empty `from` prepends `to` to
+// every key. Every key in the input sstable, including the bounds of range
+// deletions and range keys, must begin with `from`, and replacing the prefix
+// must not change the relative order of the keys under the Comparer in the
+// passed WriterOptions, as is the case for byte-wise comparisons.
+//
+// Unlike suffix rewriting, the input may contain keys of any kind, along with
+// range deletions. Data blocks are rewritten in parallel by `concurrency`
+// workers and then assembled into a final SST. Each key is re-encoded within
+// its block, but values are copied as-is and the block structure of the
+// input is preserved. Since the filter depends on key prefixes, it's rebuilt
+// from the rewritten keys, while block and table properties are only
+// minimally recomputed.
+//
+// Any block and table property collectors configured in the WriterOptions must
+// implement PrefixReplaceableTableCollector/PrefixReplaceableBlockCollector.
+// The input sstable must not contain value blocks; RewriteKeyPrefixesViaWriter
+// may be used to rewrite sstables that don't meet these requirements.
+//
+// The WriterOptions.TableFormat is ignored, and the output sstable has the
+// same TableFormat as the input, which is returned in case the caller wants
+// to do some error checking.
+func RewriteKeyPrefixesAndReturnFormat(
+	sst []byte,
+	rOpts ReaderOptions,
+	out objstorage.Writable,
+	o WriterOptions,
+	from, to []byte,
+	concurrency int,
+) (*WriterMetadata, TableFormat, error) {
+	r, err := NewMemReader(sst, rOpts)
+	if err != nil {
+		return nil, TableFormatUnspecified, err
+	}
+	defer r.Close()
+	return rewriteKeyPrefixesInBlocks(r, out, o, from, to, concurrency)
+}
+
+func rewriteKeyPrefixesInBlocks(
+	r *Reader, out objstorage.Writable, o WriterOptions, from, to []byte, concurrency int,
+) (*WriterMetadata, TableFormat, error) {
+	if r.Properties.NumValueBlocks > 0 || r.Properties.NumValuesInValueBlocks > 0 {
+		return nil, TableFormatUnspecified,
+			errors.New("rewriting the prefixes of an sstable with value blocks requires RewriteKeyPrefixesViaWriter")
+	}
+	return rewriteKeysInBlocks(r, out, o, prefixRewrite{from: from, to: to}, concurrency)
+}
+
+// keyRewrite describes a transformation of every user key in an sstable that
+// preserves the relative order of the keys. It's applied to the blocks of the
+// sstable by rewriteKeysInBlocks.
+type keyRewrite interface {
+	// checkCollectors returns an error if any of the Writer's property
+	// collectors can't be updated to reflect the rewrite.
+	checkCollectors(w *Writer) error
+	// rewriteKey appends the rewritten user key of the given point key to dst.
+	rewriteKey(dst []byte, key InternalKey) ([]byte, error)
+	// rewriteRangeKeySpan rewrites the given range key span in place.
+	rewriteRangeKeySpan(s *keyspan.Span) error
+	// updateTableProps updates the Writer's table property collectors given
+	// the user properties of the input sstable.
+	updateTableProps(w *Writer, oldProps map[string]string) error
+	// updateBlockProp updates the block property collector given its property
+	// for the corresponding input block.
+	updateBlockProp(c BlockPropertyCollector, oldProp []byte) error
+	// rebuildsFilter returns true if the rewrite changes the keys added to the
+	// filter, requiring it to be rebuilt rather than copied.
+	rebuildsFilter() bool
+}
+
+// rebuildsFilter returns true if the filter of the sstable written by the
+// rewrite of r must be rebuilt rather than copied: if the rewrite changes the
+// keys added to the filter, or if the filter of r is partitioned, as copying it
+// would only copy its top-level filter index.
+func rebuildsFilter(r *Reader, rw keyRewrite) bool {
+	return rw.rebuildsFilter() || r.filterPartitioned
+}
+
+// suffixRewrite replaces the suffix of every key, as determined by split,
+// with a new suffix.
+type suffixRewrite struct {
+	from, to []byte
+	split    Split
+}
+
+var _ keyRewrite = suffixRewrite{}
+
+func (rw suffixRewrite) checkCollectors(w *Writer) error {
+	for _, c := range w.propCollectors {
+		if _, ok := c.(SuffixReplaceableTableCollector); !ok {
+			return errors.Errorf("property collector %s does not support suffix replacement", c.Name())
+		}
+	}
+	for _, c := range w.blockPropCollectors {
+		if _, ok := c.(SuffixReplaceableBlockCollector); !ok {
+			return errors.Errorf("block property collector %s does not support suffix replacement", c.Name())
+		}
+	}
+	return nil
+}
+
+func (rw suffixRewrite) rewriteKey(dst []byte, key InternalKey) ([]byte, error) {
+	if key.Kind() != InternalKeyKindSet {
+		return dst, errBadKind
+	}
+	si := rw.split(key.UserKey)
+	oldSuffix := key.UserKey[si:]
+	if !bytes.Equal(oldSuffix, rw.from) {
+		return dst, errors.Errorf("key has suffix %q, expected %q", oldSuffix, rw.from)
+	}
+	newLen := si + len(rw.to)
+	if cap(dst) < newLen {
+		dst = make([]byte, 0, len(key.UserKey)*2+len(rw.to)-len(rw.from))
+	}
+	dst = dst[:newLen]
+	copy(dst, key.UserKey[:si])
+	copy(dst[si:], rw.to)
+	return dst, nil
+}
+
+func (rw suffixRewrite) rewriteRangeKeySpan(s *keyspan.Span) error {
+	for i := range s.Keys {
+		if s.Keys[i].Kind() != base.InternalKeyKindRangeKeySet {
+			return errBadKind
+		}
+		if !bytes.Equal(s.Keys[i].Suffix, rw.from) {
+			return errors.Errorf("key has suffix %q, expected %q", s.Keys[i].Suffix, rw.from)
+		}
+		s.Keys[i].Suffix = rw.to
+	}
+	return nil
+}
+
+func (rw suffixRewrite) updateTableProps(w *Writer, oldProps map[string]string) error {
+	for _, p := range w.propCollectors {
+		if err := p.(SuffixReplaceableTableCollector).UpdateKeySuffixes(oldProps, rw.from, rw.to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rw suffixRewrite) updateBlockProp(c BlockPropertyCollector, oldProp []byte) error {
+	return c.(SuffixReplaceableBlockCollector).UpdateKeySuffixes(oldProp, rw.from, rw.to)
+}
+
+func (rw suffixRewrite) rebuildsFilter() bool { return false }
+
+// prefixRewrite replaces a common prefix of every key with a new prefix.
+type prefixRewrite struct {
+	from, to []byte
+}
+
+var _ keyRewrite = prefixRewrite{}
+
+func (rw prefixRewrite) checkCollectors(w *Writer) error {
+	for _, c := range w.propCollectors {
+		if _, ok := c.(PrefixReplaceableTableCollector); !ok {
+			return errors.Errorf("property collector %s does not support prefix replacement", c.Name())
+		}
+	}
+	for _, c := range w.blockPropCollectors {
+		if _, ok := c.(PrefixReplaceableBlockCollector); !ok {
+			return errors.Errorf("block property collector %s does not support prefix replacement", c.Name())
+		}
+	}
+	return nil
+}
+
+func (rw prefixRewrite) rewriteUserKey(dst, key []byte) ([]byte, error) {
+	if !bytes.HasPrefix(key, rw.from) {
+		return dst, errors.Errorf("key %q does not have prefix %q", key, rw.from)
+	}
+	dst = append(dst[:0], rw.to...)
+	return append(dst, key[len(rw.from):]...), nil
+}
+
+func (rw prefixRewrite) rewriteKey(dst []byte, key InternalKey) ([]byte, error) {
+	return rw.rewriteUserKey(dst, key.UserKey)
+}
+
+func (rw prefixRewrite) rewriteRangeKeySpan(s *keyspan.Span) error {
+	var err error
+	if s.Start, err = rw.rewriteUserKey(nil, s.Start); err != nil {
+		return err
+	}
+	s.End, err = rw.rewriteUserKey(nil, s.End)
+	return err
+}
+
+func (rw prefixRewrite) updateTableProps(w *Writer, oldProps map[string]string) error {
+	for _, p := range w.propCollectors {
+		if err := p.(PrefixReplaceableTableCollector).UpdateKeyPrefixes(oldProps, rw.from, rw.to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rw prefixRewrite) updateBlockProp(c BlockPropertyCollector, oldProp []byte) error {
+	return c.(PrefixReplaceableBlockCollector).UpdateKeyPrefixes(oldProp, rw.from, rw.to)
+}
+
+func (rw prefixRewrite) rebuildsFilter() bool { return true }
+
+func rewriteKeysInBlocks(
+	r *Reader, out objstorage.Writable, o WriterOptions, rw keyRewrite, concurrency int,
+) (*WriterMetadata, TableFormat, error) {
+	if concurrency < 1 {
+		return nil, TableFormatUnspecified, errors.New("concurrency must be >= 1")
+	}
 
 	tableFormat := r.tableFormat
 	o.TableFormat = tableFormat
@@ -92,17 +306,8 @@ func rewriteKeySuffixesInBlocks(
 		}
 	}()
 
-	for _, c := range w.propCollectors {
-		if _, ok := c.(SuffixReplaceableTableCollector); !ok {
-			return nil, TableFormatUnspecified,
-				errors.Errorf("property collector %s does not support suffix replacement", c.Name())
-		}
-	}
-	for _, c := range w.blockPropCollectors {
-		if _, ok := c.(SuffixReplaceableBlockCollector); !ok {
-			return nil, TableFormatUnspecified,
-				errors.Errorf("block property collector %s does not support suffix replacement", c.Name())
-		}
+	if err := rw.checkCollectors(w); err != nil {
+		return nil, TableFormatUnspecified, err
 	}
 
 	l, err := r.Layout()
@@ -110,18 +315,27 @@ func rewriteKeySuffixesInBlocks(
 		return nil, TableFormatUnspecified, errors.Wrap(err, "reading layout")
 	}
 
-	if err := rewriteDataBlocksToWriter(r, w, l.Data, from, to, w.split, concurrency); err != nil {
+	if err := rewriteDataBlocksToWriter(r, w, l.Data, rw, concurrency); err != nil {
 		return nil, TableFormatUnspecified, errors.Wrap(err, "rewriting data blocks")
 	}
 
-	// Copy over the range key block and replace suffixes in it if it exists.
-	if err := rewriteRangeKeyBlockToWriter(r, w, from, to); err != nil {
+	// Copy over the range deletion block and replace prefixes in it if it
+	// exists. Suffix rewriting ignores range deletions.
+	if prw, ok := rw.(prefixRewrite); ok {
+		if err := rewriteRangeDelBlockToWriter(r, w, prw); err != nil {
+			return nil, TableFormatUnspecified, errors.Wrap(err, "rewriting range deletion blocks")
+		}
+	}
+
+	// Copy over the range key block and rewrite the keys in it if it exists.
+	if err := rewriteRangeKeyBlockToWriter(r, w, rw); err != nil {
 		return nil, TableFormatUnspecified, errors.Wrap(err, "rewriting range key blocks")
 	}
 
-	// Copy over the filter block if it exists (rewriteDataBlocksToWriter will
-	// already have ensured this is valid if it exists).
-	if w.filter != nil && l.Filter.Length > 0 {
+	// Copy over the filter block if it exists and is unaffected by the rewrite
+	// (rewriteDataBlocksToWriter will already have ensured this is valid if it
+	// exists). Otherwise, rewriteDataBlocksToWriter has rebuilt the filter.
+	if w.filter != nil && l.Filter.Length > 0 && !rebuildsFilter(r, rw) {
 		filterBlock, _, err := readBlockBuf(r, l.Filter, nil)
 		if err != nil {
 			return nil, TableFormatUnspecified, errors.Wrap(err, "reading filter")
@@ -145,6 +359,12 @@ var errBadKind = errors.New("key does not have expected kind (set)")
 type blockWithSpan struct {
 	start, end InternalKey
 	data       []byte
+	// smallestSeqNum and largestSeqNum are the bounds of the sequence numbers
+	// of the keys within the block.
+	smallestSeqNum, largestSeqNum uint64
+	// filterKeys holds the keys to add to the filter for the block, if the
+	// filter is being rebuilt.
+	filterKeys [][]byte
 }
 
 func rewriteBlocks(
@@ -155,8 +375,9 @@ func rewriteBlocks(
 	input []BlockHandleWithProperties,
 	output []blockWithSpan,
 	totalWorkers, worker int,
-	from, to []byte,
-	split Split,
+	rw keyRewrite,
+	filterSplit Split,
+	collectFilterKeys bool,
 ) error {
 	bw := blockWriter{
 		restartInterval: restartInterval,
@@ -198,25 +419,13 @@ func rewriteBlocks(
 			bw.restarts = make([]uint32, 0, iter.numRestarts)
 		}
 
+		output[i].smallestSeqNum = math.MaxUint64
 		for key, val := iter.First(); key != nil; key, val = iter.Next() {
-			if key.Kind() != InternalKeyKindSet {
-				return errBadKind
-			}
-			si := split(key.UserKey)
-			oldSuffix := key.UserKey[si:]
-			if !bytes.Equal(oldSuffix, from) {
-				err := errors.Errorf("key has suffix %q, expected %q", oldSuffix, from)
+			scratch.UserKey, err = rw.rewriteKey(scratch.UserKey, *key)
+			if err != nil {
 				return err
 			}
-			newLen := si + len(to)
-			if cap(scratch.UserKey) < newLen {
-				scratch.UserKey = make([]byte, 0, len(key.UserKey)*2+len(to)-len(from))
-			}
-
 			scratch.Trailer = key.Trailer
-			scratch.UserKey = scratch.UserKey[:newLen]
-			copy(scratch.UserKey, key.UserKey[:si])
-			copy(scratch.UserKey[si:], to)
 
 			// NB: for TableFormatPebblev3, since
 			// !iter.lazyValueHandling.hasValuePrefix, it will return the raw value
@@ -232,7 +441,9 @@ func rewriteBlocks(
 				if isValueHandle(prefix) {
 					return errors.Errorf("value prefix is incorrect")
 				}
-				if setHasSamePrefix(prefix) {
+				// Suffix rewriting requires that each key prefix appears at most
+				// once.
+				if _, ok := rw.(suffixRewrite); ok && setHasSamePrefix(prefix) {
 					return errors.Errorf("multiple keys with same key prefix")
 				}
 			}
@@ -240,6 +451,21 @@ func rewriteBlocks(
 			if output[i].start.UserKey == nil {
 				keyAlloc, output[i].start = cloneKeyWithBuf(scratch, keyAlloc)
 			}
+			if seqNum := key.SeqNum(); seqNum < output[i].smallestSeqNum {
+				output[i].smallestSeqNum = seqNum
+			}
+			if seqNum := key.SeqNum(); seqNum > output[i].largestSeqNum {
+				output[i].largestSeqNum = seqNum
+			}
+			if collectFilterKeys {
+				filterKey := scratch.UserKey
+				if filterSplit != nil {
+					filterKey = filterKey[:filterSplit(filterKey)]
+				}
+				var k []byte
+				keyAlloc, k = keyAlloc.Copy(filterKey)
+				output[i].filterKeys = append(output[i].filterKeys, k)
+			}
 		}
 		*iter = iter.resetForReuse()
 
@@ -259,17 +485,16 @@ func rewriteDataBlocksToWriter(
 	r *Reader,
 	w *Writer,
 	data []BlockHandleWithProperties,
-	from, to []byte,
-	split Split,
+	rw keyRewrite,
 	concurrency int,
 ) error {
-	if r.Properties.NumEntries == 0 {
+	if r.Properties.NumEntries == r.Properties.NumRangeDeletions {
 		// No point keys.
 		return nil
 	}
 	blocks := make([]blockWithSpan, len(data))
 
-	if w.filter != nil {
+	if w.filter != nil && !rebuildsFilter(r, rw) {
 		if r.Properties.FilterPolicyName != w.filter.policyName() {
 			return errors.New("mismatched filters")
 		}
@@ -294,8 +519,9 @@ func rewriteDataBlocksToWriter(
 				blocks,
 				concurrency,
 				worker,
-				from, to,
-				split,
+				rw,
+				w.split,
+				w.filter != nil && rebuildsFilter(r, rw),
 			)
 			if err != nil {
 				errCh <- err
@@ -308,10 +534,8 @@ func rewriteDataBlocksToWriter(
 		return err
 	}
 
-	for _, p := range w.propCollectors {
-		if err := p.(SuffixReplaceableTableCollector).UpdateKeySuffixes(r.Properties.UserProperties, from, to); err != nil {
-			return err
-		}
+	if err := rw.updateTableProps(w, r.Properties.UserProperties); err != nil {
+		return err
 	}
 
 	var decoder blockPropertiesDecoder
@@ -353,7 +577,7 @@ func rewriteDataBlocksToWriter(
 		}
 
 		for i, p := range w.blockPropCollectors {
-			if err := p.(SuffixReplaceableBlockCollector).UpdateKeySuffixes(oldProps[i], from, to); err != nil {
+			if err := rw.updateBlockProp(p, oldProps[i]); err != nil {
 				return err
 			}
 		}
@@ -369,18 +593,84 @@ func rewriteDataBlocksToWriter(
 		if err = w.addIndexEntrySync(blocks[i].end, nextKey, bhp, w.dataBlockBuf.tmp[:]); err != nil {
 			return err
 		}
+
+		for _, k := range blocks[i].filterKeys {
+			w.filter.addKey(k)
+		}
+		w.meta.updateSeqNum(blocks[i].smallestSeqNum)
+		w.meta.updateSeqNum(blocks[i].largestSeqNum)
 	}
 
-	w.meta.updateSeqNum(blocks[0].start.SeqNum())
-	w.props.NumEntries = r.Properties.NumEntries
-	w.props.RawKeySize = r.Properties.RawKeySize
-	w.props.RawValueSize = r.Properties.RawValueSize
+	// The point key statistics are copied from the input sstable, adjusting
+	// the key sizes for the rewrite. Range deletions are accounted for by the
+	// Writer if they're rewritten.
+	rangeDelKeySize, rangeDelValueSize, err := rangeDelRawSizes(r)
+	if err != nil {
+		return err
+	}
+	numPointKeys := r.Properties.NumEntries - r.Properties.NumRangeDeletions
+	w.props.NumEntries = numPointKeys
+	w.props.NumDeletions = r.Properties.NumDeletions - r.Properties.NumRangeDeletions
+	w.props.NumMergeOperands = r.Properties.NumMergeOperands
+	w.props.RawKeySize = r.Properties.RawKeySize - rangeDelKeySize
+	w.props.RawValueSize = r.Properties.RawValueSize - rangeDelValueSize
+	if prw, ok := rw.(prefixRewrite); ok {
+		delta := int64(len(prw.to)) - int64(len(prw.from))
+		w.props.RawKeySize = uint64(int64(w.props.RawKeySize) + delta*int64(numPointKeys))
+	}
 	w.meta.SetSmallestPointKey(blocks[0].start)
 	w.meta.SetLargestPointKey(blocks[len(blocks)-1].end)
 	return nil
 }
 
-func rewriteRangeKeyBlockToWriter(r *Reader, w *Writer, from, to []byte) error {
+func rewriteRangeDelBlockToWriter(r *Reader, w *Writer, rw prefixRewrite) error {
+	iter, err := r.NewRawRangeDelIter()
+	if err != nil {
+		return err
+	}
+	if iter == nil {
+		// No range deletions.
+		return nil
+	}
+	defer iter.Close()
+
+	for s := iter.First(); s != nil; s = iter.Next() {
+		start, err := rw.rewriteUserKey(nil, s.Start)
+		if err != nil {
+			return err
+		}
+		end, err := rw.rewriteUserKey(nil, s.End)
+		if err != nil {
+			return err
+		}
+		for _, k := range s.Keys {
+			if err := w.Add(base.InternalKey{UserKey: start, Trailer: k.Trailer}, end); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rangeDelRawSizes returns the contribution of the sstable's range deletions
+// to its RawKeySize and RawValueSize properties.
+func rangeDelRawSizes(r *Reader) (keySize, valueSize uint64, _ error) {
+	if r.Properties.NumRangeDeletions == 0 {
+		return 0, 0, nil
+	}
+	iter, err := r.NewRawRangeDelIter()
+	if err != nil || iter == nil {
+		return 0, 0, err
+	}
+	defer iter.Close()
+	for s := iter.First(); s != nil; s = iter.Next() {
+		keySize += uint64(len(s.Start)+base.InternalTrailerLen) * uint64(len(s.Keys))
+		valueSize += uint64(len(s.End)) * uint64(len(s.Keys))
+	}
+	return keySize, valueSize, nil
+}
+
+func rewriteRangeKeyBlockToWriter(r *Reader, w *Writer, rw keyRewrite) error {
 	iter, err := r.NewRawRangeKeyIter()
 	if err != nil {
 		return err
@@ -395,20 +685,14 @@ func rewriteRangeKeyBlockToWriter(r *Reader, w *Writer, from, to []byte) error {
 		if !s.Valid() {
 			break
 		}
-		for i := range s.Keys {
-			if s.Keys[i].Kind() != base.InternalKeyKindRangeKeySet {
-				return errBadKind
-			}
-			if !bytes.Equal(s.Keys[i].Suffix, from) {
-				return errors.Errorf("key has suffix %q, expected %q", s.Keys[i].Suffix, from)
-			}
-			s.Keys[i].Suffix = to
+		if err := rw.rewriteRangeKeySpan(s); err != nil {
+			return err
 		}
 
 		err := rangekey.Encode(s, func(k base.InternalKey, v []byte) error {
 			// Calling AddRangeKey instead of addRangeKeySpan bypasses the fragmenter.
 			// This is okay because the raw fragments off of `iter` are already
-			// fragmented, and suffix replacement should not affect fragmentation.
+			// fragmented, and key rewriting should not affect fragmentation.
 			return w.AddRangeKey(k, v)
 		})
 		if err != nil {
@@ -477,7 +761,62 @@ func RewriteKeySuffixesViaWriter(
 		}
 		k, v = i.Next()
 	}
-	if err := rewriteRangeKeyBlockToWriter(r, w, from, to); err != nil {
+	if err := rewriteRangeKeyBlockToWriter(r, w, suffixRewrite{from: from, to: to, split: r.Split}); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		w = nil
+		return nil, err
+	}
+	writerMeta, err := w.Metadata()
+	w = nil
+	return writerMeta, err
+}
+
+// RewriteKeyPrefixesViaWriter is similar to RewriteKeyPrefixesAndReturnFormat
+// but uses just a single loop over the Reader that writes each key to the
+// Writer with the new prefix. It's significantly slower than the parallelized
+// rewriter, but since it rederives filters, props, etc, property collectors
+// need not support prefix replacement, and the input may contain value blocks.
+func RewriteKeyPrefixesViaWriter(
+	r *Reader, out objstorage.Writable, o WriterOptions, from, to []byte,
+) (*WriterMetadata, error) {
+	rw := prefixRewrite{from: from, to: to}
+	w := NewWriter(out, o)
+	defer func() {
+		if w != nil {
+			w.Close()
+		}
+	}()
+	i, err := r.NewIter(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer i.Close()
+
+	var scratch InternalKey
+	for k, v := i.First(); k != nil; k, v = i.Next() {
+		scratch.UserKey, err = rw.rewriteKey(scratch.UserKey, *k)
+		if err != nil {
+			return nil, err
+		}
+		scratch.Trailer = k.Trailer
+
+		val, _, err := v.Value(nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := w.Add(scratch, val); err != nil {
+			return nil, err
+		}
+	}
+	if err := i.Error(); err != nil {
+		return nil, err
+	}
+	if err := rewriteRangeDelBlockToWriter(r, w, rw); err != nil {
+		return nil, err
+	}
+	if err := rewriteRangeKeyBlockToWriter(r, w, rw); err != nil {
 		return nil, err
 	}
 	if err := w.Close(); err != nil {
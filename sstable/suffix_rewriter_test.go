@@ -2,6 +2,7 @@ package sstable
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"math/rand"
@@ -139,6 +140,125 @@ func TestRewriteSuffixProps(t *testing.T) {
 	}
 }
 
+// TestRewriteSuffixesPartitionedFilter tests that the filter of an sstable
+// with a partitioned filter is rebuilt by a suffix rewrite, as copying it would
+// only copy its top-level filter index.
+func TestRewriteSuffixesPartitionedFilter(t *testing.T) {
+	from, to := []byte("_212"), []byte("_646")
+	wOpts := WriterOptions{
+		BlockSize:          256,
+		IndexBlockSize:     256,
+		FilterPolicy:       bloom.FilterPolicy(10),
+		PartitionedFilters: true,
+		Comparer:           test4bSuffixComparer,
+		TableFormat:        TableFormatPebblev2,
+	}
+	const keyCount = 2000
+	sst := make4bSuffixTestSST(t, wOpts, from, keyCount, 0 /* rangeKeys */)
+	readerOpts := ReaderOptions{
+		Comparer: test4bSuffixComparer,
+		Filters:  map[string]base.FilterPolicy{wOpts.FilterPolicy.Name(): wOpts.FilterPolicy},
+	}
+	r, err := NewMemReader(sst, readerOpts)
+	require.NoError(t, err)
+	defer r.Close()
+	require.True(t, r.filterPartitioned)
+
+	rewrittenSST := &memFile{}
+	_, _, err = rewriteKeySuffixesInBlocks(r, rewrittenSST, wOpts, from, to, 4)
+	require.NoError(t, err)
+	rRewritten, err := NewMemReader(rewrittenSST.Data(), readerOpts)
+	require.NoError(t, err)
+	defer rRewritten.Close()
+	require.True(t, rRewritten.filterPartitioned)
+	require.Equal(t, r.Properties.FilterPartitions, rRewritten.Properties.FilterPartitions)
+	require.NoError(t, rRewritten.ValidateBlockChecksums())
+
+	key := make([]byte, 28)
+	copy(key[24:], to)
+	for i := 0; i < keyCount; i++ {
+		binary.BigEndian.PutUint64(key[:8], 123)
+		binary.BigEndian.PutUint64(key[8:16], 456)
+		binary.BigEndian.PutUint64(key[16:], uint64(i))
+		mayContain, err := rRewritten.filterMayContain(context.Background(), nil /* stats */, key[:24])
+		require.NoError(t, err)
+		require.True(t, mayContain)
+	}
+}
+
+func TestRewriteKeyPrefixes(t *testing.T) {
+	from, to := []byte("tenant-1/"), []byte("t2/")
+
+	for _, format := range []TableFormat{TableFormatPebblev2, TableFormatPebblev3} {
+		t.Run(format.String(), func(t *testing.T) {
+			wOpts := WriterOptions{
+				BlockSize:    256,
+				FilterPolicy: bloom.FilterPolicy(10),
+				Comparer:     test4bSuffixComparer,
+				TableFormat:  format,
+			}
+			f := &memFile{}
+			w := NewWriter(f, wOpts)
+			const keyCount = 1000
+			for i := 0; i < keyCount; i++ {
+				key := []byte(fmt.Sprintf("%s%06d_123", from, i))
+				require.NoError(t, w.Set(key, key))
+			}
+			require.NoError(t, w.Close())
+
+			readerOpts := ReaderOptions{
+				Comparer: test4bSuffixComparer,
+				Filters:  map[string]base.FilterPolicy{wOpts.FilterPolicy.Name(): wOpts.FilterPolicy},
+			}
+			r, err := NewMemReader(f.Data(), readerOpts)
+			require.NoError(t, err)
+			defer r.Close()
+
+			for _, byBlocks := range []bool{false, true} {
+				rewrittenSST := &memFile{}
+				if byBlocks {
+					_, rewriteFormat, err := rewriteKeyPrefixesInBlocks(r, rewrittenSST, wOpts, from, to, 4)
+					require.NoError(t, err)
+					require.Equal(t, format, rewriteFormat)
+				} else {
+					_, err := RewriteKeyPrefixesViaWriter(r, rewrittenSST, wOpts, from, to)
+					require.NoError(t, err)
+				}
+				rRewritten, err := NewMemReader(rewrittenSST.Data(), readerOpts)
+				require.NoError(t, err)
+				require.Equal(t, r.Properties.NumEntries, rRewritten.Properties.NumEntries)
+				if byBlocks {
+					// The block structure of the input is preserved.
+					require.Equal(t, r.Properties.NumDataBlocks, rRewritten.Properties.NumDataBlocks)
+				}
+				require.Equal(t, r.Properties.RawKeySize-keyCount*uint64(len(from)-len(to)),
+					rRewritten.Properties.RawKeySize)
+
+				// Every key should be found through the rebuilt filter under its
+				// new prefix.
+				iter, err := rRewritten.NewIter(nil, nil)
+				require.NoError(t, err)
+				for j := 0; j < keyCount; j++ {
+					key := []byte(fmt.Sprintf("%s%06d_123", to, j))
+					k, v := iter.SeekPrefixGE(key[:len(key)-4], key, base.SeekGEFlagsNone)
+					require.NotNil(t, k, "key %q", key)
+					require.Equal(t, key, k.UserKey)
+					val, _, err := v.Value(nil)
+					require.NoError(t, err)
+					require.Equal(t, fmt.Sprintf("%s%06d_123", from, j), string(val))
+				}
+				require.NoError(t, iter.Close())
+				require.NoError(t, rRewritten.Close())
+			}
+			// Block property collectors must support prefix replacement.
+			rwOpts := wOpts
+			rwOpts.BlockPropertyCollectors = []func() BlockPropertyCollector{keyCountCollectorFn("count")}
+			_, _, err = rewriteKeyPrefixesInBlocks(r, &discardFile{}, rwOpts, from, to, 4)
+			require.EqualError(t, err, "block property collector count does not support prefix replacement")
+		})
+	}
+}
+
 // memFile is a file-like struct that buffers all data written to it in memory.
 // Implements the objstorage.Writable interface.
 type memFile struct {
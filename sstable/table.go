@@ -197,6 +197,10 @@ const (
 	metaRangeDelName   = "rocksdb.range_del"
 	metaRangeDelV2Name = "rocksdb.range_del2"
 
+	// metaPartitionedFilterPrefix prefixes the name of the filter policy in
+	// the metaindex entry of the top-level index of a partitioned filter.
+	metaPartitionedFilterPrefix = "pebble.partitionedfilter."
+
 	// Index Types.
 	// A space efficient index block that is optimized for binary-search-based
 	// index.
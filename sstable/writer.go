@@ -123,8 +123,11 @@ type Writer struct {
 	// The following fields are copied from Options.
 	blockSize               int
 	blockSizeThreshold      int
+	blockSizeFunc           func(key []byte) int
+	blockSizeThresholdPct   int
 	indexBlockSize          int
 	indexBlockSizeThreshold int
+	twoLevelIndexThreshold  int
 	compare                 Compare
 	split                   Split
 	formatKey               base.FormatKey
@@ -146,7 +149,7 @@ type Writer struct {
 	// cache the partitions that are required to perform the index/filter query.
 	//
 	// Two level indexes are enabled automatically when there is more than one
-	// index block.
+	// index block, unless the index is smaller than twoLevelIndexThreshold.
 	//
 	// This is useful when there are very large index blocks, which generally occurs
 	// with the usage of large keys. With large index blocks, the index blocks fight
@@ -192,6 +195,11 @@ type Writer struct {
 	// dataBlockBuf consists of the state which is currently owned by and used by
 	// the Writer client goroutine. This state can be handed off to other goroutines.
 	dataBlockBuf *dataBlockBuf
+	// dataBlockSize and dataBlockSizeThreshold are the target size and the
+	// size threshold of the data block in dataBlockBuf, which may differ from
+	// blockSize and blockSizeThreshold if blockSizeFunc is set.
+	dataBlockSize          int
+	dataBlockSizeThreshold int
 	// blockBuf consists of the state which is owned by and used by the Writer client
 	// goroutine.
 	blockBuf blockBuf
@@ -1318,6 +1326,7 @@ func (w *Writer) flush(key InternalKey) error {
 		if err != nil {
 			return err
 		}
+		w.indexBlockFlushed()
 	}
 
 	// We've called BlockPropertyCollector.FinishDataBlock, and, if necessary,
@@ -1353,7 +1362,11 @@ func (w *Writer) flush(key InternalKey) error {
 }
 
 func (w *Writer) maybeFlush(key InternalKey, valueLen int) error {
-	if !w.dataBlockBuf.shouldFlush(key, valueLen, w.blockSize, w.blockSizeThreshold) {
+	if !w.dataBlockBuf.shouldFlush(key, valueLen, w.dataBlockSize, w.dataBlockSizeThreshold) {
+		if w.dataBlockBuf.dataBlock.nEntries == 0 {
+			// The key begins the first data block.
+			w.setDataBlockSize(key.UserKey)
+		}
 		return nil
 	}
 
@@ -1364,9 +1377,27 @@ func (w *Writer) maybeFlush(key InternalKey, valueLen int) error {
 		return err
 	}
 
+	// The key begins the next data block.
+	w.setDataBlockSize(key.UserKey)
 	return nil
 }
 
+// setDataBlockSize sets the target size of the data block beginning with the
+// user key, as returned by WriterOptions.BlockSizeFunc.
+func (w *Writer) setDataBlockSize(key []byte) {
+	if w.blockSizeFunc == nil {
+		return
+	}
+	size := w.blockSizeFunc(key)
+	if size <= 0 {
+		size = w.blockSize
+	} else if size > MaximumBlockSize {
+		size = MaximumBlockSize
+	}
+	w.dataBlockSize = size
+	w.dataBlockSizeThreshold = (size*w.blockSizeThresholdPct + 99) / 100
+}
+
 // dataBlockBuf.dataBlockProps set by this method must be encoded before any future use of the
 // dataBlockBuf.blockPropsEncoder, since the properties slice will get reused by the
 // blockPropsEncoder.
@@ -1462,6 +1493,14 @@ func (w *Writer) addIndexEntry(
 	return nil
 }
 
+// indexBlockFlushed is called once the Writer decides to flush an index block,
+// so that a partitioned filter is partitioned along with the index.
+func (w *Writer) indexBlockFlushed() {
+	if f, ok := w.filter.(*partitionedFilterWriter); ok {
+		f.indexBlockFlushed()
+	}
+}
+
 func (w *Writer) addPrevDataBlockToIndexBlockProps() {
 	for i := range w.blockPropCollectors {
 		w.blockPropCollectors[i].AddPrevDataBlockToIndexBlock()
@@ -1479,7 +1518,13 @@ func (w *Writer) addPrevDataBlockToIndexBlockProps() {
 func (w *Writer) addIndexEntrySync(
 	prevKey, key InternalKey, bhp BlockHandleWithProperties, tmp []byte,
 ) error {
-	sep := w.indexEntrySep(prevKey, key, w.dataBlockBuf)
+	return w.addIndexEntrySep(w.indexEntrySep(prevKey, key, w.dataBlockBuf), bhp, tmp)
+}
+
+// addIndexEntrySep adds an index entry for the specified separator and block
+// handle. Like addIndexEntrySync, it should only be called if we're sure that
+// index entries aren't being written asynchronously.
+func (w *Writer) addIndexEntrySep(sep InternalKey, bhp BlockHandleWithProperties, tmp []byte) error {
 	shouldFlush := supportsTwoLevelIndex(
 		w.tableFormat) && w.indexBlock.shouldFlush(
 		sep, encodedBHPEstimatedSize, w.indexBlockSize, w.indexBlockSizeThreshold,
@@ -1497,6 +1542,7 @@ func (w *Writer) addIndexEntrySync(
 		if err != nil {
 			return err
 		}
+		w.indexBlockFlushed()
 	}
 
 	err = w.addIndexEntry(sep, bhp, tmp, flushableIndexBlock, w.indexBlock, 0, props)
@@ -1636,6 +1682,63 @@ func (w *Writer) writeTwoLevelIndex() (BlockHandle, error) {
 	return w.writeBlock(w.topLevelIndexBlock.finish(), w.compression, &w.blockBuf)
 }
 
+// indexPartitionsSize returns the uncompressed size of the index partitions,
+// including the unfinished index block.
+func (w *Writer) indexPartitionsSize() int {
+	size := int(w.indexBlock.estimatedSize())
+	for i := range w.indexPartitions {
+		size += len(w.indexPartitions[i].block)
+	}
+	return size
+}
+
+// mergeIndexPartitions merges the index partitions into the unfinished index
+// block, so that the index is written as a single-level index.
+func (w *Writer) mergeIndexPartitions() error {
+	blocks := make([][]byte, 0, len(w.indexPartitions)+1)
+	for i := range w.indexPartitions {
+		blocks = append(blocks, w.indexPartitions[i].block)
+	}
+	if w.indexBlock.block.nEntries > 0 {
+		blocks = append(blocks, w.indexBlock.finish())
+	}
+	indexBlock := newIndexBlockBuf(false /* useMutex */)
+	var iter blockIter
+	for _, b := range blocks {
+		if err := iter.init(w.compare, b, 0 /* globalSeqNum */); err != nil {
+			return err
+		}
+		for key, value := iter.First(); key != nil; key, value = iter.Next() {
+			indexBlock.add(*key, value.InPlaceValue(), 0 /* inflightSize */)
+		}
+	}
+	w.indexBlock.clear()
+	indexBlockBufPool.Put(w.indexBlock)
+	w.indexBlock = indexBlock
+	w.indexPartitions = w.indexPartitions[:0]
+	w.twoLevelIndex = false
+	return nil
+}
+
+// writeFilterPartitions writes the partitions of a partitioned filter, and
+// returns the top-level filter index on them, which maps the last key of each
+// partition to its block handle.
+func (w *Writer) writeFilterPartitions(f *partitionedFilterWriter) ([]byte, error) {
+	topLevel := blockWriter{restartInterval: 1}
+	for i := range f.partitions {
+		p := &f.partitions[i]
+		bh, err := w.writeBlock(p.data, NoCompression, &w.blockBuf)
+		if err != nil {
+			return nil, err
+		}
+		w.props.FilterSize += bh.Length
+		n := encodeBlockHandle(w.blockBuf.tmp[:], bh)
+		topLevel.add(InternalKey{UserKey: p.sep}, w.blockBuf.tmp[:n])
+	}
+	w.props.FilterPartitions = uint64(len(f.partitions))
+	return topLevel.finish(), nil
+}
+
 func compressAndChecksum(b []byte, compression Compression, blockBuf *blockBuf) []byte {
 	// Compress the buffer, discarding the result if the improvement isn't at
 	// least 12.5%.
@@ -1809,6 +1912,13 @@ func (w *Writer) Close() (err error) {
 		if err != nil {
 			return err
 		}
+		if f, ok := w.filter.(*partitionedFilterWriter); ok && len(f.partitions) > 1 {
+			// Write the filter partitions, followed by the top-level filter
+			// index on them.
+			if b, err = w.writeFilterPartitions(f); err != nil {
+				return err
+			}
+		}
 		bh, err := w.writeBlock(b, NoCompression, &w.blockBuf)
 		if err != nil {
 			return err
@@ -1816,7 +1926,14 @@ func (w *Writer) Close() (err error) {
 		n := encodeBlockHandle(w.blockBuf.tmp[:], bh)
 		metaindex.add(InternalKey{UserKey: []byte(w.filter.metaName())}, w.blockBuf.tmp[:n])
 		w.props.FilterPolicyName = w.filter.policyName()
-		w.props.FilterSize = bh.Length
+		w.props.FilterSize += bh.Length
+	}
+
+	if w.twoLevelIndex && w.indexPartitionsSize() < w.twoLevelIndexThreshold {
+		// The index is too small to be worth partitioning.
+		if err := w.mergeIndexPartitions(); err != nil {
+			return err
+		}
 	}
 
 	var indexBH BlockHandle
@@ -2093,8 +2210,11 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 		},
 		blockSize:               o.BlockSize,
 		blockSizeThreshold:      (o.BlockSize*o.BlockSizeThreshold + 99) / 100,
+		blockSizeFunc:           o.BlockSizeFunc,
+		blockSizeThresholdPct:   o.BlockSizeThreshold,
 		indexBlockSize:          o.IndexBlockSize,
 		indexBlockSizeThreshold: (o.IndexBlockSize*o.BlockSizeThreshold + 99) / 100,
+		twoLevelIndexThreshold:  o.TwoLevelIndexThreshold,
 		compare:                 o.Comparer.Compare,
 		split:                   o.Comparer.Split,
 		formatKey:               o.Comparer.FormatKey,
@@ -2120,6 +2240,7 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 			Format: o.Comparer.FormatKey,
 		},
 	}
+	w.dataBlockSize, w.dataBlockSizeThreshold = w.blockSize, w.blockSizeThreshold
 	if w.tableFormat == TableFormatPebblev3 {
 		w.shortAttributeExtractor = o.ShortAttributeExtractor
 		w.requiredInPlaceValueBound = o.RequiredInPlaceValueBound
@@ -2156,7 +2277,11 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 	if o.FilterPolicy != nil {
 		switch o.FilterType {
 		case TableFilter:
-			w.filter = newTableFilterWriter(o.FilterPolicy)
+			if o.PartitionedFilters && supportsTwoLevelIndex(w.tableFormat) {
+				w.filter = newPartitionedFilterWriter(o.FilterPolicy)
+			} else {
+				w.filter = newTableFilterWriter(o.FilterPolicy)
+			}
 			if w.split != nil {
 				w.props.PrefixExtractorName = o.Comparer.Name
 				w.props.PrefixFiltering = true
@@ -183,9 +183,20 @@ func runDataDriven(t *testing.T, file string, tableFormat TableFormat, paralleli
 			}
 			verbose := false
 			if len(td.CmdArgs) > 0 {
-				if td.CmdArgs[0].Key == "verbose" {
+				switch td.CmdArgs[0].Key {
+				case "verbose":
 					verbose = true
-				} else {
+				case "blocks":
+					blocks, err := r.LayoutBlocks()
+					if err != nil {
+						return err.Error()
+					}
+					var buf bytes.Buffer
+					for _, b := range blocks {
+						fmt.Fprintf(&buf, "%s\n", b)
+					}
+					return buf.String()
+				default:
 					return "unknown arg"
 				}
 			}
@@ -193,7 +204,7 @@ func runDataDriven(t *testing.T, file string, tableFormat TableFormat, paralleli
 			l.Describe(&buf, verbose, r, nil)
 			return buf.String()
 
-		case "rewrite":
+		case "rewrite", "rewrite-prefix":
 			var meta *WriterMetadata
 			var err error
 			meta, r, err = runRewriteCmd(td, r, WriterOptions{
@@ -987,3 +998,151 @@ var test4bSuffixComparer = &base.Comparer{
 	},
 	Name: "comparer-split-4b-suffix",
 }
+
+func TestWriterBlockSizeFunc(t *testing.T) {
+	mem := vfs.NewMem()
+	f, err := mem.Create("test")
+	require.NoError(t, err)
+	w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{
+		BlockSize:   4096,
+		Compression: NoCompression,
+		TableFormat: TableFormatPebblev3,
+		BlockSizeFunc: func(key []byte) int {
+			// Small blocks for the "a" prefix, and large ones for the "b" prefix.
+			if key[0] == 'a' {
+				return 256
+			}
+			return 16 << 10
+		},
+	})
+	value := bytes.Repeat([]byte("v"), 20)
+	for _, prefix := range []string{"a", "b"} {
+		for i := 0; i < 200; i++ {
+			require.NoError(t, w.Set([]byte(fmt.Sprintf("%s%03d", prefix, i)), value))
+		}
+	}
+	require.NoError(t, w.Close())
+
+	f, err = mem.Open("test")
+	require.NoError(t, err)
+	r, err := newReader(f, ReaderOptions{})
+	require.NoError(t, err)
+	defer r.Close()
+	layout, err := r.Layout()
+	require.NoError(t, err)
+
+	// The "a" keys are written to many small blocks, and the "b" keys to a
+	// single block larger than BlockSize.
+	require.Greater(t, len(layout.Data), 10)
+	for _, bh := range layout.Data[:len(layout.Data)-1] {
+		require.LessOrEqual(t, bh.Length, uint64(256+blockTrailerLen))
+	}
+	require.Greater(t, layout.Data[len(layout.Data)-1].Length, uint64(4096))
+}
+
+func TestWriterPartitionedFilters(t *testing.T) {
+	for _, parallelism := range []bool{false, true} {
+		t.Run(fmt.Sprintf("parallelism=%t", parallelism), func(t *testing.T) {
+			filter := bloom.FilterPolicy(10)
+			mem := vfs.NewMem()
+			f, err := mem.Create("test")
+			require.NoError(t, err)
+			w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{
+				BlockSize:          256,
+				IndexBlockSize:     256,
+				Compression:        NoCompression,
+				FilterPolicy:       filter,
+				PartitionedFilters: true,
+				Parallelism:        parallelism,
+				TableFormat:        TableFormatPebblev3,
+			})
+			const n = 2000
+			key := func(i int) []byte { return []byte(fmt.Sprintf("k%05d", i)) }
+			for i := 0; i < n; i++ {
+				require.NoError(t, w.Set(key(i), []byte("v")))
+			}
+			require.NoError(t, w.Close())
+
+			f, err = mem.Open("test")
+			require.NoError(t, err)
+			var metrics FilterMetrics
+			r, err := newReader(f, ReaderOptions{
+				Filters: map[string]FilterPolicy{filter.Name(): filter},
+			}, &metrics)
+			require.NoError(t, err)
+			defer r.Close()
+			require.Equal(t, uint64(twoLevelIndex), uint64(r.Properties.IndexType))
+			require.Greater(t, r.Properties.IndexPartitions, uint64(1))
+			require.Greater(t, r.Properties.FilterPartitions, uint64(1))
+			require.True(t, r.filterPartitioned)
+			require.NoError(t, r.ValidateBlockChecksums())
+
+			iter, err := r.NewIter(nil /* lower */, nil /* upper */)
+			require.NoError(t, err)
+			defer iter.Close()
+			for i := 0; i < n; i++ {
+				k, _ := iter.SeekPrefixGE(key(i), key(i), base.SeekGEFlagsNone)
+				require.NotNil(t, k)
+				require.Equal(t, key(i), k.UserKey)
+			}
+			require.Zero(t, metrics.Hits)
+
+			// Absent keys, both within and past the key span of the table, are
+			// rejected by the filter.
+			for _, k := range [][]byte{[]byte("a"), []byte("k00100x"), []byte("z")} {
+				ik, _ := iter.SeekPrefixGE(k, k, base.SeekGEFlagsNone)
+				require.Nil(t, ik)
+			}
+			require.Greater(t, metrics.Hits, int64(0))
+		})
+	}
+}
+
+func TestWriterTwoLevelIndexThreshold(t *testing.T) {
+	for _, threshold := range []int{0, 1 << 20} {
+		t.Run(fmt.Sprintf("threshold=%d", threshold), func(t *testing.T) {
+			mem := vfs.NewMem()
+			f, err := mem.Create("test")
+			require.NoError(t, err)
+			w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{
+				BlockSize:              256,
+				IndexBlockSize:         256,
+				TwoLevelIndexThreshold: threshold,
+				TableFormat:            TableFormatPebblev3,
+			})
+			const n = 2000
+			key := func(i int) []byte { return []byte(fmt.Sprintf("k%05d", i)) }
+			for i := 0; i < n; i++ {
+				require.NoError(t, w.Set(key(i), []byte("v")))
+			}
+			require.NoError(t, w.Close())
+
+			f, err = mem.Open("test")
+			require.NoError(t, err)
+			r, err := newReader(f, ReaderOptions{})
+			require.NoError(t, err)
+			defer r.Close()
+			if threshold == 0 {
+				require.Equal(t, uint64(twoLevelIndex), uint64(r.Properties.IndexType))
+				require.Greater(t, r.Properties.IndexPartitions, uint64(1))
+			} else {
+				// The index is smaller than the threshold, so it's written as a
+				// single index block.
+				require.Equal(t, uint64(binarySearchIndex), uint64(r.Properties.IndexType))
+				require.Zero(t, r.Properties.IndexPartitions)
+			}
+
+			iter, err := r.NewIter(nil /* lower */, nil /* upper */)
+			require.NoError(t, err)
+			defer iter.Close()
+			var i int
+			for k, _ := iter.First(); k != nil; k, _ = iter.Next() {
+				require.Equal(t, key(i), k.UserKey)
+				i++
+			}
+			require.Equal(t, n, i)
+			k, _ := iter.SeekGE(key(1234), base.SeekGEFlagsNone)
+			require.Equal(t, key(1234), k.UserKey)
+		})
+	}
+}
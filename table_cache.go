@@ -70,6 +70,27 @@ type tableCacheOpts struct {
 	objProvider     objstorage.Provider
 	opts            sstable.ReaderOptions
 	filterMetrics   *FilterMetrics
+	dbMetrics       *tableCacheDBMetrics
+}
+
+// tableCacheDBMetrics holds the table cache telemetry of a DB. The fields are
+// updated atomically.
+type tableCacheDBMetrics struct {
+	evictions int64
+	levels    [numLevels]TableCacheLevelMetrics
+}
+
+// recordLookup records a lookup of a table of the level, or of a table looked
+// up irrespective of its level if the level is negative.
+func (m *tableCacheDBMetrics) recordLookup(level int, hit bool) {
+	if level < 0 {
+		return
+	}
+	if hit {
+		atomic.AddInt64(&m.levels[level].Hits, 1)
+	} else {
+		atomic.AddInt64(&m.levels[level].Misses, 1)
+	}
 }
 
 // tableCacheContainer contains the table cache and
@@ -97,6 +118,9 @@ func newTableCacheContainer(
 		// NewTableCache should create a ref to tc which the container should
 		// drop whenever it is closed.
 		tc = NewTableCache(opts.Cache, opts.Experimental.TableCacheShards, size)
+		if opts.Experimental.TableCacheMaxBytes > 0 {
+			tc.SetMaxBytes(opts.Experimental.TableCacheMaxBytes)
+		}
 	}
 
 	t := &tableCacheContainer{}
@@ -106,6 +130,7 @@ func newTableCacheContainer(
 	t.dbOpts.objProvider = objProvider
 	t.dbOpts.opts = opts.MakeReaderOptions()
 	t.dbOpts.filterMetrics = &FilterMetrics{}
+	t.dbOpts.dbMetrics = &tableCacheDBMetrics{}
 	t.dbOpts.atomic.iterCount = new(int32)
 	return t
 }
@@ -136,17 +161,19 @@ func (c *tableCacheContainer) newIters(
 	opts *IterOptions,
 	internalOpts internalIterOpts,
 ) (internalIterator, keyspan.FragmentIterator, error) {
-	return c.tableCache.getShard(file.FileNum).newIters(ctx, file, opts, internalOpts, &c.dbOpts)
+	return c.tableCache.getShard(file.FileBacking.FileNum).newIters(ctx, file, opts, internalOpts, &c.dbOpts)
 }
 
 func (c *tableCacheContainer) newRangeKeyIter(
 	file *manifest.FileMetadata, opts *keyspan.SpanIterOptions,
 ) (keyspan.FragmentIterator, error) {
-	return c.tableCache.getShard(file.FileNum).newRangeKeyIter(file, opts, &c.dbOpts)
+	return c.tableCache.getShard(file.FileBacking.FileNum).newRangeKeyIter(file, opts, &c.dbOpts)
 }
 
-func (c *tableCacheContainer) getTableProperties(file physicalMeta) (*sstable.Properties, error) {
-	return c.tableCache.getShard(file.FileNum).getTableProperties(file.FileMetadata, &c.dbOpts)
+// getTableProperties returns the properties of the table. The properties of a
+// virtual sstable are those of its backing sstable.
+func (c *tableCacheContainer) getTableProperties(file *fileMetadata) (*sstable.Properties, error) {
+	return c.tableCache.getShard(file.FileBacking.FileNum).getTableProperties(file, &c.dbOpts)
 }
 
 func (c *tableCacheContainer) evict(fileNum FileNum) {
@@ -159,11 +186,11 @@ func (c *tableCacheContainer) metrics() (CacheMetrics, FilterMetrics) {
 		s := c.tableCache.shards[i]
 		s.mu.RLock()
 		m.Count += int64(len(s.mu.nodes))
+		m.Size += s.mu.bytes
 		s.mu.RUnlock()
 		m.Hits += atomic.LoadInt64(&s.atomic.hits)
 		m.Misses += atomic.LoadInt64(&s.atomic.misses)
 	}
-	m.Size = m.Count * int64(unsafe.Sizeof(sstable.Reader{}))
 	f := FilterMetrics{
 		Hits:   atomic.LoadInt64(&c.dbOpts.filterMetrics.Hits),
 		Misses: atomic.LoadInt64(&c.dbOpts.filterMetrics.Misses),
@@ -171,9 +198,24 @@ func (c *tableCacheContainer) metrics() (CacheMetrics, FilterMetrics) {
 	return m, f
 }
 
+// levelMetrics returns the number of tables of the DB evicted from the table
+// cache, and the per-level table cache metrics of the DB.
+func (c *tableCacheContainer) levelMetrics() (int64, [numLevels]TableCacheLevelMetrics) {
+	var levels [numLevels]TableCacheLevelMetrics
+	m := c.dbOpts.dbMetrics
+	for i := range levels {
+		levels[i].Hits = atomic.LoadInt64(&m.levels[i].Hits)
+		levels[i].Misses = atomic.LoadInt64(&m.levels[i].Misses)
+		levels[i].Evictions = atomic.LoadInt64(&m.levels[i].Evictions)
+	}
+	return atomic.LoadInt64(&m.evictions), levels
+}
+
+// withReader calls fn with the Reader of the table. For a virtual sstable, fn
+// is called with the Reader of its backing sstable.
 func (c *tableCacheContainer) withReader(meta *fileMetadata, fn func(*sstable.Reader) error) error {
-	s := c.tableCache.getShard(meta.FileNum)
-	v := s.findNode(meta, &c.dbOpts)
+	s := c.tableCache.getShard(meta.FileBacking.FileNum)
+	v := s.findNode(meta, -1 /* level */, &c.dbOpts)
 	defer s.unrefValue(v)
 	if v.err != nil {
 		return v.err
@@ -181,6 +223,19 @@ func (c *tableCacheContainer) withReader(meta *fileMetadata, fn func(*sstable.Re
 	return fn(v.reader)
 }
 
+// withVirtualReader calls fn with a VirtualReader for the virtual sstable.
+func (c *tableCacheContainer) withVirtualReader(
+	meta virtualMeta, fn func(sstable.VirtualReader) error,
+) error {
+	s := c.tableCache.getShard(meta.FileBacking.FileNum)
+	v := s.findNode(meta.FileMetadata, -1 /* level */, &c.dbOpts)
+	defer s.unrefValue(v)
+	if v.err != nil {
+		return v.err
+	}
+	return fn(sstable.MakeVirtualReader(v.reader, meta))
+}
+
 func (c *tableCacheContainer) iterCount() int64 {
 	return int64(atomic.LoadInt32(c.dbOpts.atomic.iterCount))
 }
@@ -236,6 +291,21 @@ func (c *TableCache) Unref() error {
 	return nil
 }
 
+// SetMaxBytes limits the memory of the tables open in the table cache to n
+// bytes, in addition to the limit on their count. The memory of an open table
+// is estimated as the size of its reader and of its index and filter blocks.
+// The limit is split evenly among the shards of the table cache. A
+// non-positive limit removes the limit.
+func (c *TableCache) SetMaxBytes(n int64) {
+	var perShard int64
+	if n > 0 {
+		perShard = (n + int64(len(c.shards)) - 1) / int64(len(c.shards))
+	}
+	for _, s := range c.shards {
+		s.setMaxBytes(perShard)
+	}
+}
+
 // NewTableCache will create a reference to the table cache. It is the callers responsibility
 // to call tableCache.Unref if they will no longer hold a reference to the table cache.
 func NewTableCache(cache *Cache, numShards int, size int) *TableCache {
@@ -298,6 +368,11 @@ type tableCacheShard struct {
 		sizeHot    int
 		sizeCold   int
 		sizeTest   int
+
+		// bytes is the estimated memory of the tables open in the shard (see
+		// tableMemoryUsage), and maxBytes the limit on it. Zero means no limit.
+		bytes    int64
+		maxBytes int64
 	}
 	releasing       sync.WaitGroup
 	releasingCh     chan *tableCacheValue
@@ -370,7 +445,11 @@ func (c *tableCacheShard) newIters(
 	// refCount. If opening the underlying table resulted in error, then we
 	// decrement this straight away. Otherwise, we pass that responsibility to
 	// the sstable iterator, which decrements when it is closed.
-	v := c.findNode(file, dbOpts)
+	level := -1
+	if opts != nil {
+		level = manifest.LevelToInt(opts.level)
+	}
+	v := c.findNode(file, level, dbOpts)
 	if v.err != nil {
 		defer c.unrefValue(v)
 		return nil, nil, v.err
@@ -388,9 +467,22 @@ func (c *tableCacheShard) newIters(
 		return nil, nil, err
 	}
 
+	// A virtual sstable is read through a VirtualReader, constraining reads
+	// of the backing sstable to the bounds of the virtual sstable.
+	var virtualReader *sstable.VirtualReader
+	if file.Virtual {
+		vr := sstable.MakeVirtualReader(v.reader, file.VirtualMeta())
+		virtualReader = &vr
+	}
+
 	// NB: range-del iterator does not maintain a reference to the table, nor
 	// does it need to read from it after creation.
-	rangeDelIter, err := v.reader.NewRawRangeDelIter()
+	var rangeDelIter keyspan.FragmentIterator
+	if virtualReader != nil {
+		rangeDelIter, err = virtualReader.NewRawRangeDelIter()
+	} else {
+		rangeDelIter, err = v.reader.NewRawRangeDelIter()
+	}
 	if err != nil {
 		c.unrefValue(v)
 		return nil, nil, err
@@ -425,7 +517,14 @@ func (c *tableCacheShard) newIters(
 	if tableFormat == sstable.TableFormatPebblev3 && v.reader.Properties.NumValueBlocks > 0 {
 		rp = &tableCacheShardReaderProvider{c: c, file: file, dbOpts: dbOpts}
 	}
-	if internalOpts.bytesIterated != nil {
+	if virtualReader != nil {
+		if internalOpts.bytesIterated != nil {
+			iter, err = virtualReader.NewCompactionIter(internalOpts.bytesIterated, rp)
+		} else {
+			iter, err = virtualReader.NewIterWithBlockPropertyFiltersAndContext(
+				ctx, opts.GetLowerBound(), opts.GetUpperBound(), filterer, useFilter, internalOpts.stats, rp)
+		}
+	} else if internalOpts.bytesIterated != nil {
 		iter, err = v.reader.NewCompactionIter(internalOpts.bytesIterated, rp)
 	} else {
 		iter, err = v.reader.NewIterWithBlockPropertyFiltersAndContext(
@@ -459,7 +558,7 @@ func (c *tableCacheShard) newRangeKeyIter(
 	// refCount. If opening the underlying table resulted in error, then we
 	// decrement this straight away. Otherwise, we pass that responsibility to
 	// the sstable iterator, which decrements when it is closed.
-	v := c.findNode(file, dbOpts)
+	v := c.findNode(file, -1 /* level */, dbOpts)
 	if v.err != nil {
 		defer c.unrefValue(v)
 		return nil, v.err
@@ -487,7 +586,12 @@ func (c *tableCacheShard) newRangeKeyIter(
 	}
 
 	var iter keyspan.FragmentIterator
-	iter, err = v.reader.NewRawRangeKeyIter()
+	if file.Virtual {
+		vr := sstable.MakeVirtualReader(v.reader, file.VirtualMeta())
+		iter, err = vr.NewRawRangeKeyIter()
+	} else {
+		iter, err = v.reader.NewRawRangeKeyIter()
+	}
 	// iter is a block iter that holds the entire value of the block in memory.
 	// No need to hold onto a ref of the cache value.
 	c.unrefValue(v)
@@ -524,7 +628,7 @@ var _ sstable.ReaderProvider = &tableCacheShardReaderProvider{}
 func (rp *tableCacheShardReaderProvider) GetReader() (*sstable.Reader, error) {
 	// Calling findNode gives us the responsibility of decrementing v's
 	// refCount.
-	v := rp.c.findNode(rp.file, rp.dbOpts)
+	v := rp.c.findNode(rp.file, -1 /* level */, rp.dbOpts)
 	if v.err != nil {
 		defer rp.c.unrefValue(v)
 		return nil, v.err
@@ -544,7 +648,7 @@ func (c *tableCacheShard) getTableProperties(
 	file *fileMetadata, dbOpts *tableCacheOpts,
 ) (*sstable.Properties, error) {
 	// Calling findNode gives us the responsibility of decrementing v's refCount here
-	v := c.findNode(file, dbOpts)
+	v := c.findNode(file, -1 /* level */, dbOpts)
 	defer c.unrefValue(v)
 
 	if v.err != nil {
@@ -566,8 +670,9 @@ func (c *tableCacheShard) releaseNode(n *tableCacheNode) {
 //
 // c.mu must be held when calling this.
 func (c *tableCacheShard) unlinkNode(n *tableCacheNode) {
-	key := tableCacheKey{n.cacheID, n.meta.FileNum}
+	key := tableCacheKey{n.cacheID, n.meta.FileBacking.FileNum}
 	delete(c.mu.nodes, key)
+	c.uncharge(n)
 
 	switch n.ptype {
 	case tableCacheNodeHot:
@@ -602,10 +707,35 @@ func (c *tableCacheShard) unlinkNode(n *tableCacheNode) {
 func (c *tableCacheShard) clearNode(n *tableCacheNode) {
 	if v := n.value; v != nil {
 		n.value = nil
+		c.uncharge(n)
 		c.unrefValue(v)
 	}
 }
 
+// charge accounts for the memory of the table of the node once it's open.
+//
+// c.mu must be held when calling this.
+func (c *tableCacheShard) charge(n *tableCacheNode, bytes int64) {
+	n.bytes = bytes
+	c.mu.bytes += bytes
+	c.evictOverMaxBytes()
+}
+
+// uncharge releases the memory of the table of the node accounted by charge.
+//
+// c.mu must be held when calling this.
+func (c *tableCacheShard) uncharge(n *tableCacheNode) {
+	c.mu.bytes -= n.bytes
+	n.bytes = 0
+}
+
+// tableMemoryUsage returns the estimated memory of an open table: the size of
+// its reader, and of its index and filter blocks, which are read by every
+// lookup of the table.
+func tableMemoryUsage(r *sstable.Reader) int64 {
+	return int64(unsafe.Sizeof(*r)) + int64(r.Properties.IndexSize+r.Properties.FilterSize)
+}
+
 // unrefValue decrements the reference count for the specified value, releasing
 // it if the reference count fell to 0. Note that the value has a reference if
 // it is present in tableCacheShard.mu.nodes, so a reference count of 0 means
@@ -617,13 +747,16 @@ func (c *tableCacheShard) unrefValue(v *tableCacheValue) {
 	}
 }
 
-// findNode returns the node for the table with the given file number, creating
-// that node if it didn't already exist. The caller is responsible for
-// decrementing the returned node's refCount.
-func (c *tableCacheShard) findNode(meta *fileMetadata, dbOpts *tableCacheOpts) *tableCacheValue {
+// findNode returns the node for the backing table of the given file, creating
+// that node if it didn't already exist. The level is the level of the file, or
+// -1 if the file is looked up irrespective of its level. The caller is
+// responsible for decrementing the returned node's refCount.
+func (c *tableCacheShard) findNode(
+	meta *fileMetadata, level int, dbOpts *tableCacheOpts,
+) *tableCacheValue {
 	// Fast-path for a hit in the cache.
 	c.mu.RLock()
-	key := tableCacheKey{dbOpts.cacheID, meta.FileNum}
+	key := tableCacheKey{dbOpts.cacheID, meta.FileBacking.FileNum}
 	if n := c.mu.nodes[key]; n != nil && n.value != nil {
 		// Fast-path hit.
 		//
@@ -633,6 +766,8 @@ func (c *tableCacheShard) findNode(meta *fileMetadata, dbOpts *tableCacheOpts) *
 		c.mu.RUnlock()
 		atomic.StoreInt32(&n.referenced, 1)
 		atomic.AddInt64(&c.atomic.hits, 1)
+		n.setLevel(level)
+		dbOpts.dbMetrics.recordLookup(level, true /* hit */)
 		<-v.loaded
 		return v
 	}
@@ -645,8 +780,10 @@ func (c *tableCacheShard) findNode(meta *fileMetadata, dbOpts *tableCacheOpts) *
 	case n == nil:
 		// Slow-path miss of a non-existent node.
 		n = &tableCacheNode{
-			meta:  meta,
-			ptype: tableCacheNodeCold,
+			meta:      meta,
+			ptype:     tableCacheNodeCold,
+			level:     -1,
+			dbMetrics: dbOpts.dbMetrics,
 		}
 		c.addNode(n, dbOpts)
 		c.mu.sizeCold++
@@ -659,6 +796,8 @@ func (c *tableCacheShard) findNode(meta *fileMetadata, dbOpts *tableCacheOpts) *
 		atomic.AddInt32(&v.refCount, 1)
 		atomic.StoreInt32(&n.referenced, 1)
 		atomic.AddInt64(&c.atomic.hits, 1)
+		n.setLevel(level)
+		dbOpts.dbMetrics.recordLookup(level, true /* hit */)
 		c.mu.Unlock()
 		<-v.loaded
 		return v
@@ -678,6 +817,8 @@ func (c *tableCacheShard) findNode(meta *fileMetadata, dbOpts *tableCacheOpts) *
 	}
 
 	atomic.AddInt64(&c.atomic.misses, 1)
+	n.setLevel(level)
+	dbOpts.dbMetrics.recordLookup(level, false /* hit */)
 
 	v := &tableCacheValue{
 		loaded:   make(chan struct{}),
@@ -711,7 +852,7 @@ func (c *tableCacheShard) findNode(meta *fileMetadata, dbOpts *tableCacheOpts) *
 func (c *tableCacheShard) addNode(n *tableCacheNode, dbOpts *tableCacheOpts) {
 	c.evictNodes()
 	n.cacheID = dbOpts.cacheID
-	key := tableCacheKey{n.cacheID, n.meta.FileNum}
+	key := tableCacheKey{n.cacheID, n.meta.FileBacking.FileNum}
 	c.mu.nodes[key] = n
 
 	n.links.next = n
@@ -736,6 +877,39 @@ func (c *tableCacheShard) evictNodes() {
 	}
 }
 
+// evictOverMaxBytes evicts tables until the memory of the tables open in the
+// shard fits within its limit. The cold hand evicts the cold tables; when there
+// are none, the hot hand demotes the hot tables that weren't referenced since
+// it last passed them. Each hand makes at most one full turn, so the memory
+// may still exceed the limit if the remaining tables were all referenced.
+//
+// c.mu must be held when calling this.
+func (c *tableCacheShard) evictOverMaxBytes() {
+	if c.mu.maxBytes <= 0 {
+		return
+	}
+	coldSteps, hotSteps := len(c.mu.nodes), len(c.mu.nodes)
+	for c.mu.bytes > c.mu.maxBytes && c.mu.handCold != nil {
+		switch {
+		case c.mu.sizeCold > 0 && coldSteps > 0:
+			c.runHandCold()
+			coldSteps--
+		case c.mu.sizeHot > 0 && hotSteps > 0:
+			c.runHandHot()
+			hotSteps--
+		default:
+			return
+		}
+	}
+}
+
+func (c *tableCacheShard) setMaxBytes(n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mu.maxBytes = n
+	c.evictOverMaxBytes()
+}
+
 func (c *tableCacheShard) runHandCold() {
 	n := c.mu.handCold
 	if n.ptype == tableCacheNodeCold {
@@ -745,6 +919,9 @@ func (c *tableCacheShard) runHandCold() {
 			c.mu.sizeCold--
 			c.mu.sizeHot++
 		} else {
+			if n.value != nil {
+				n.recordEviction()
+			}
 			c.clearNode(n)
 			n.ptype = tableCacheNodeTest
 			c.mu.sizeCold--
@@ -853,7 +1030,7 @@ func (c *tableCacheShard) removeDB(dbOpts *tableCacheOpts) {
 		}
 
 		if node.cacheID == dbOpts.cacheID {
-			fileNums = append(fileNums, node.meta.FileNum)
+			fileNums = append(fileNums, node.meta.FileBacking.FileNum)
 		}
 		node = node.next()
 	}
@@ -932,10 +1109,10 @@ func (v *tableCacheValue) load(meta *fileMetadata, c *tableCacheShard, dbOpts *t
 	// Try opening the file first.
 	var f objstorage.Readable
 	f, v.err = dbOpts.objProvider.OpenForReading(
-		context.TODO(), fileTypeTable, meta.FileNum, objstorage.OpenOptions{MustExist: true},
+		context.TODO(), fileTypeTable, meta.FileBacking.FileNum, objstorage.OpenOptions{MustExist: true},
 	)
 	if v.err == nil {
-		cacheOpts := private.SSTableCacheOpts(dbOpts.cacheID, meta.FileNum).(sstable.ReaderOption)
+		cacheOpts := private.SSTableCacheOpts(dbOpts.cacheID, meta.FileBacking.FileNum).(sstable.ReaderOption)
 		v.reader, v.err = sstable.NewReader(f, dbOpts.opts, cacheOpts, dbOpts.filterMetrics)
 	}
 	if v.err == nil {
@@ -943,18 +1120,26 @@ func (v *tableCacheValue) load(meta *fileMetadata, c *tableCacheShard, dbOpts *t
 			v.reader.Properties.GlobalSeqNum = meta.LargestSeqNum
 		}
 	}
+	// Lookup the node in the cache again as it might have already been
+	// removed.
+	key := tableCacheKey{dbOpts.cacheID, meta.FileBacking.FileNum}
 	if v.err != nil {
 		c.mu.Lock()
 		defer c.mu.Unlock()
-		// Lookup the node in the cache again as it might have already been
-		// removed.
-		key := tableCacheKey{dbOpts.cacheID, meta.FileNum}
 		n := c.mu.nodes[key]
 		if n != nil && n.value == v {
 			c.releaseNode(n)
 		}
+		close(v.loaded)
+		return
 	}
 	close(v.loaded)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n := c.mu.nodes[key]; n != nil && n.value == v {
+		c.charge(n, tableMemoryUsage(v.reader))
+	}
 }
 
 func (v *tableCacheValue) release(c *tableCacheShard) {
@@ -1000,9 +1185,32 @@ type tableCacheNode struct {
 	// since the last time one of the clock hands swept it.
 	referenced int32
 
+	// level is the level of the table at its last lookup from a level, or -1
+	// if it hasn't been looked up from a level. It's updated atomically.
+	level int32
+	// bytes is the estimated memory of the table once it's open (see
+	// tableMemoryUsage).
+	bytes int64
+
 	// Storing the cache id associated with the DB instance here
 	// avoids the need to thread the dbOpts struct through many functions.
-	cacheID uint64
+	cacheID   uint64
+	dbMetrics *tableCacheDBMetrics
+}
+
+func (n *tableCacheNode) setLevel(level int) {
+	if level >= 0 && atomic.LoadInt32(&n.level) != int32(level) {
+		atomic.StoreInt32(&n.level, int32(level))
+	}
+}
+
+// recordEviction records the eviction of the table of the node to make room
+// for other tables.
+func (n *tableCacheNode) recordEviction() {
+	atomic.AddInt64(&n.dbMetrics.evictions, 1)
+	if level := atomic.LoadInt32(&n.level); level >= 0 {
+		atomic.AddInt64(&n.dbMetrics.levels[level].Evictions, 1)
+	}
 }
 
 func (n *tableCacheNode) next() *tableCacheNode {
@@ -21,6 +21,7 @@ import (
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/manifest"
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
 	"github.com/cockroachdb/pebble/sstable"
@@ -205,6 +206,14 @@ func newTableCacheContainerTest(
 	return c, fs, nil
 }
 
+// newPhysicalMetaForTest returns the metadata of the physical sstable with the
+// given file number.
+func newPhysicalMetaForTest(fileNum FileNum) *fileMetadata {
+	m := &fileMetadata{FileNum: fileNum}
+	m.InitPhysicalBacking()
+	return m
+}
+
 // Test basic reference counting for the table cache.
 func TestTableCacheRefs(t *testing.T) {
 	tc := newTableCacheTest(8<<20, 10, 2)
@@ -452,7 +461,7 @@ func testTableCacheRandomAccess(t *testing.T, concurrent bool) {
 			rngMu.Lock()
 			fileNum, sleepTime := rng.Intn(tableCacheTestNumTables), rng.Intn(1000)
 			rngMu.Unlock()
-			iter, _, err := c.newIters(context.Background(), &fileMetadata{FileNum: FileNum(fileNum)}, nil, internalIterOpts{})
+			iter, _, err := c.newIters(context.Background(), newPhysicalMetaForTest(FileNum(fileNum)), nil, internalIterOpts{})
 			if err != nil {
 				errc <- errors.Errorf("i=%d, fileNum=%d: find: %v", i, fileNum, err)
 				return
@@ -513,10 +522,10 @@ func testTableCacheFrequentlyUsedInternal(t *testing.T, rangeIter bool) {
 			var err error
 			if rangeIter {
 				iter, err = c.newRangeKeyIter(
-					&fileMetadata{FileNum: FileNum(j)},
+					newPhysicalMetaForTest(FileNum(j)),
 					nil /* iter options */)
 			} else {
-				iter, _, err = c.newIters(context.Background(), &fileMetadata{FileNum: FileNum(j)}, nil, internalIterOpts{})
+				iter, _, err = c.newIters(context.Background(), newPhysicalMetaForTest(FileNum(j)), nil, internalIterOpts{})
 			}
 			if err != nil {
 				t.Fatalf("i=%d, j=%d: find: %v", i, j, err)
@@ -560,11 +569,11 @@ func TestSharedTableCacheFrequentlyUsed(t *testing.T) {
 
 	for i := 0; i < N; i++ {
 		for _, j := range [...]int{pinned0, i % tableCacheTestNumTables, pinned1} {
-			iter1, _, err := c1.newIters(context.Background(), &fileMetadata{FileNum: FileNum(j)}, nil, internalIterOpts{})
+			iter1, _, err := c1.newIters(context.Background(), newPhysicalMetaForTest(FileNum(j)), nil, internalIterOpts{})
 			if err != nil {
 				t.Fatalf("i=%d, j=%d: find: %v", i, j, err)
 			}
-			iter2, _, err := c2.newIters(context.Background(), &fileMetadata{FileNum: FileNum(j)}, nil, internalIterOpts{})
+			iter2, _, err := c2.newIters(context.Background(), newPhysicalMetaForTest(FileNum(j)), nil, internalIterOpts{})
 			if err != nil {
 				t.Fatalf("i=%d, j=%d: find: %v", i, j, err)
 			}
@@ -612,10 +621,10 @@ func testTableCacheEvictionsInternal(t *testing.T, rangeIter bool) {
 		var err error
 		if rangeIter {
 			iter, err = c.newRangeKeyIter(
-				&fileMetadata{FileNum: FileNum(j)},
+				newPhysicalMetaForTest(FileNum(j)),
 				nil /* iter options */)
 		} else {
-			iter, _, err = c.newIters(context.Background(), &fileMetadata{FileNum: FileNum(j)}, nil, internalIterOpts{})
+			iter, _, err = c.newIters(context.Background(), newPhysicalMetaForTest(FileNum(j)), nil, internalIterOpts{})
 		}
 		if err != nil {
 			t.Fatalf("i=%d, j=%d: find: %v", i, j, err)
@@ -674,12 +683,12 @@ func TestSharedTableCacheEvictions(t *testing.T) {
 	rng := rand.New(rand.NewSource(2))
 	for i := 0; i < N; i++ {
 		j := rng.Intn(tableCacheTestNumTables)
-		iter1, _, err := c1.newIters(context.Background(), &fileMetadata{FileNum: FileNum(j)}, nil, internalIterOpts{})
+		iter1, _, err := c1.newIters(context.Background(), newPhysicalMetaForTest(FileNum(j)), nil, internalIterOpts{})
 		if err != nil {
 			t.Fatalf("i=%d, j=%d: find: %v", i, j, err)
 		}
 
-		iter2, _, err := c2.newIters(context.Background(), &fileMetadata{FileNum: FileNum(j)}, nil, internalIterOpts{})
+		iter2, _, err := c2.newIters(context.Background(), newPhysicalMetaForTest(FileNum(j)), nil, internalIterOpts{})
 		if err != nil {
 			t.Fatalf("i=%d, j=%d: find: %v", i, j, err)
 		}
@@ -734,11 +743,106 @@ func TestSharedTableCacheEvictions(t *testing.T) {
 	}
 }
 
+func TestTableCacheMaxBytes(t *testing.T) {
+	tc := newTableCacheTest(8<<20, tableCacheTestCacheSize, 1)
+	c, fs, err := newTableCacheContainerTest(tc, "")
+	require.NoError(t, err)
+	require.NoError(t, tc.Unref())
+
+	open := func(i int, level int) {
+		opts := &IterOptions{level: manifest.Level(level)}
+		iter, _, err := c.newIters(context.Background(), newPhysicalMetaForTest(FileNum(i)), opts, internalIterOpts{})
+		require.NoError(t, err)
+		require.NoError(t, iter.Close())
+	}
+	size := func() int64 {
+		m, _ := c.metrics()
+		return m.Size
+	}
+
+	// Open a table to measure the memory of an open table.
+	open(0, 1)
+	tableBytes := size()
+	require.Greater(t, tableBytes, int64(0))
+
+	// Limit the table cache to a few tables. Opening many tables keeps the
+	// memory of the open tables within the limit, evicting tables.
+	const maxTables = 5
+	tc.SetMaxBytes(maxTables * tableBytes * 3 / 2)
+	for i := 0; i < tableCacheTestNumTables; i++ {
+		open(i, 1+i%2)
+		require.LessOrEqual(t, size(), int64(maxTables*tableBytes*3/2))
+	}
+	evictions, levels := c.levelMetrics()
+	require.Greater(t, evictions, int64(tableCacheTestNumTables-2*maxTables))
+	require.Equal(t, evictions, levels[1].Evictions+levels[2].Evictions)
+	require.Equal(t, int64(tableCacheTestNumTables/2+1), levels[1].Hits+levels[1].Misses)
+	require.Equal(t, int64(1), levels[1].Hits)
+	require.Equal(t, int64(tableCacheTestNumTables/2), levels[2].Misses)
+	require.Zero(t, levels[0].Misses)
+
+	// Removing the limit stops the evictions by size.
+	tc.SetMaxBytes(0)
+	for i := 0; i < tableCacheTestCacheSize/2; i++ {
+		open(i, 3)
+	}
+	require.Greater(t, size(), int64(maxTables*tableBytes*3/2))
+
+	fs.validate(t, c, nil)
+}
+
+// TestTableCacheMaxBytesHot tests a limit on the memory of the open tables
+// smaller than the memory of the hot tables.
+func TestTableCacheMaxBytesHot(t *testing.T) {
+	const cacheSize = 10
+	tc := newTableCacheTest(8<<20, cacheSize, 1)
+	c, fs, err := newTableCacheContainerTest(tc, "")
+	require.NoError(t, err)
+	require.NoError(t, tc.Unref())
+
+	open := func(i int) {
+		iter, _, err := c.newIters(context.Background(), newPhysicalMetaForTest(FileNum(i)), nil, internalIterOpts{})
+		require.NoError(t, err)
+		require.NoError(t, iter.Close())
+	}
+	size := func() int64 {
+		m, _ := c.metrics()
+		return m.Size
+	}
+
+	// Make the most recently opened tables hot.
+	for i := 0; i < tableCacheTestNumTables; i++ {
+		open(i)
+	}
+	for j := 0; j < 3; j++ {
+		open(tableCacheTestNumTables - 2)
+		open(tableCacheTestNumTables - 1)
+	}
+	require.Greater(t, tc.shards[0].mu.sizeHot, 0)
+
+	// The hot tables were referenced since the hot hand last passed them, so
+	// limiting the memory leaves them open. Once the hand passed them, they
+	// are evicted.
+	tc.SetMaxBytes(1)
+	require.Greater(t, size(), int64(0))
+	tc.SetMaxBytes(1)
+	require.Zero(t, size())
+
+	// Opening tables keeps evicting them, including the hot ones.
+	for i := 0; i < 2*cacheSize; i++ {
+		open(tableCacheTestNumTables - 1 - i%2)
+		require.Zero(t, size())
+	}
+	tc.SetMaxBytes(0)
+
+	fs.validate(t, c, nil)
+}
+
 func TestTableCacheIterLeak(t *testing.T) {
 	c, _, err := newTableCacheContainerTest(nil, "")
 	require.NoError(t, err)
 
-	iter, _, err := c.newIters(context.Background(), &fileMetadata{FileNum: 0}, nil, internalIterOpts{})
+	iter, _, err := c.newIters(context.Background(), newPhysicalMetaForTest(0), nil, internalIterOpts{})
 	require.NoError(t, err)
 
 	if err := c.close(); err == nil {
@@ -761,7 +865,7 @@ func TestSharedTableCacheIterLeak(t *testing.T) {
 	require.NoError(t, err)
 	tc.Unref()
 
-	iter, _, err := c1.newIters(context.Background(), &fileMetadata{FileNum: 0}, nil, internalIterOpts{})
+	iter, _, err := c1.newIters(context.Background(), newPhysicalMetaForTest(0), nil, internalIterOpts{})
 	require.NoError(t, err)
 
 	if err := c1.close(); err == nil {
@@ -795,12 +899,12 @@ func TestTableCacheRetryAfterFailure(t *testing.T) {
 	require.NoError(t, err)
 
 	fs.setOpenError(true /* enabled */)
-	if _, _, err := c.newIters(context.Background(), &fileMetadata{FileNum: 0}, nil, internalIterOpts{}); err == nil {
+	if _, _, err := c.newIters(context.Background(), newPhysicalMetaForTest(0), nil, internalIterOpts{}); err == nil {
 		t.Fatalf("expected failure, but found success")
 	}
 	fs.setOpenError(false /* enabled */)
 	var iter internalIterator
-	iter, _, err = c.newIters(context.Background(), &fileMetadata{FileNum: 0}, nil, internalIterOpts{})
+	iter, _, err = c.newIters(context.Background(), newPhysicalMetaForTest(0), nil, internalIterOpts{})
 	require.NoError(t, err)
 	require.NoError(t, iter.Close())
 	fs.validate(t, c, nil)
@@ -867,6 +971,7 @@ func TestTableCacheClockPro(t *testing.T) {
 	dbOpts.cacheID = 0
 	dbOpts.objProvider = objProvider
 	dbOpts.opts = opts.MakeReaderOptions()
+	dbOpts.dbMetrics = &tableCacheDBMetrics{}
 
 	scanner := bufio.NewScanner(f)
 	tables := make(map[int]bool)
@@ -886,7 +991,7 @@ func TestTableCacheClockPro(t *testing.T) {
 		}
 
 		oldHits := atomic.LoadInt64(&cache.atomic.hits)
-		v := cache.findNode(&fileMetadata{FileNum: FileNum(key)}, dbOpts)
+		v := cache.findNode(newPhysicalMetaForTest(FileNum(key)), -1 /* level */, dbOpts)
 		cache.unrefValue(v)
 
 		hit := atomic.LoadInt64(&cache.atomic.hits) != oldHits
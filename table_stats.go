@@ -186,10 +186,7 @@ func (d *DB) loadNewFileStats(
 			continue
 		}
 
-		stats, newHints, err := d.loadTableStats(
-			rs.current, nf.Level,
-			nf.Meta.PhysicalMeta(),
-		)
+		stats, newHints, err := d.loadTableStats(rs.current, nf.Level, nf.Meta)
 		if err != nil {
 			d.opts.EventListener.BackgroundError(err)
 			continue
@@ -236,9 +233,7 @@ func (d *DB) scanReadStateTableStats(
 				return fill, hints, moreRemain
 			}
 
-			stats, newHints, err := d.loadTableStats(
-				rs.current, l, f.PhysicalMeta(),
-			)
+			stats, newHints, err := d.loadTableStats(rs.current, l, f)
 			if err != nil {
 				// Set `moreRemain` so we'll try again.
 				moreRemain = true
@@ -255,27 +250,30 @@ func (d *DB) scanReadStateTableStats(
 	return fill, hints, moreRemain
 }
 
-// loadTableStats currently only supports stats collection for physical
-// sstables.
-//
-// TODO(bananabrick): Support stats collection for virtual sstables.
+// loadTableStats loads the stats of the table. The stats of a virtual sstable
+// are derived from the properties of its backing sstable, scaled down to the
+// size of the virtual sstable. Range deletion stats and deletion hints aren't
+// collected for virtual sstables.
 func (d *DB) loadTableStats(
-	v *version, level int, meta physicalMeta,
+	v *version, level int, meta *fileMetadata,
 ) (manifest.TableStats, []deleteCompactionHint, error) {
+	if meta.Virtual {
+		return d.loadVirtualTableStats(v, level, meta.VirtualMeta())
+	}
 	var stats manifest.TableStats
 	var compactionHints []deleteCompactionHint
 	err := d.tableCache.withReader(
-		meta.FileMetadata, func(r *sstable.Reader) (err error) {
+		meta, func(r *sstable.Reader) (err error) {
 			stats.NumEntries = r.Properties.NumEntries
 			stats.NumDeletions = r.Properties.NumDeletions
 			if r.Properties.NumPointDeletions() > 0 {
-				if err = d.loadTablePointKeyStats(r, v, level, meta, &stats); err != nil {
+				if err = d.loadTablePointKeyStats(&r.Properties, v, level, meta, &stats); err != nil {
 					return
 				}
 			}
 			if r.Properties.NumRangeDeletions > 0 || r.Properties.NumRangeKeyDels > 0 {
 				if compactionHints, err = d.loadTableRangeDelStats(
-					r, v, level, meta, &stats,
+					r, v, level, meta.PhysicalMeta(), &stats,
 				); err != nil {
 					return
 				}
@@ -285,6 +283,7 @@ func (d *DB) loadTableStats(
 			// picking.
 			stats.NumRangeKeySets = r.Properties.NumRangeKeySets
 			stats.ValueBlocksSize = r.Properties.ValueBlocksSize
+			err = loadMVCCGarbageStats(&r.Properties, meta, &stats)
 			return
 		})
 	if err != nil {
@@ -293,10 +292,39 @@ func (d *DB) loadTableStats(
 	return stats, compactionHints, nil
 }
 
+// loadVirtualTableStats loads the stats of a virtual sstable.
+func (d *DB) loadVirtualTableStats(
+	v *version, level int, meta virtualMeta,
+) (manifest.TableStats, []deleteCompactionHint, error) {
+	var stats manifest.TableStats
+	err := d.tableCache.withVirtualReader(
+		meta, func(r sstable.VirtualReader) (err error) {
+			stats.NumEntries = r.Properties.NumEntries
+			stats.NumDeletions = r.Properties.NumDeletions
+			if r.Properties.NumPointDeletions() > 0 {
+				if err = d.loadTablePointKeyStats(&r.Properties, v, level, meta.FileMetadata, &stats); err != nil {
+					return
+				}
+			}
+			stats.NumRangeKeySets = r.Properties.NumRangeKeySets
+			stats.ValueBlocksSize = r.Properties.ValueBlocksSize
+			err = loadMVCCGarbageStats(&r.Properties, meta.FileMetadata, &stats)
+			return
+		})
+	if err != nil {
+		return stats, nil, err
+	}
+	return stats, nil, nil
+}
+
 // loadTablePointKeyStats calculates the point key statistics for the given
 // table. The provided manifest.TableStats are updated.
 func (d *DB) loadTablePointKeyStats(
-	r *sstable.Reader, v *version, level int, meta physicalMeta, stats *manifest.TableStats,
+	props *sstable.Properties,
+	v *version,
+	level int,
+	meta *fileMetadata,
+	stats *manifest.TableStats,
 ) error {
 	// TODO(jackson): If the file has a wide keyspace, the average
 	// value size beneath the entire file might not be representative
@@ -309,7 +337,7 @@ func (d *DB) loadTablePointKeyStats(
 		return err
 	}
 	stats.PointDeletionsBytesEstimate =
-		pointDeletionsBytesEstimate(&r.Properties, avgKeySize, avgValSize)
+		pointDeletionsBytesEstimate(props, avgKeySize, avgValSize)
 	return nil
 }
 
@@ -421,7 +449,7 @@ func (d *DB) loadTableRangeDelStats(
 }
 
 func (d *DB) averageEntrySizeBeneath(
-	v *version, level int, meta physicalMeta,
+	v *version, level int, meta *fileMetadata,
 ) (avgKeySize, avgValueSize uint64, err error) {
 	// Find all files in lower levels that overlap with meta,
 	// summing their value sizes and entry counts.
@@ -433,9 +461,15 @@ func (d *DB) averageEntrySizeBeneath(
 		for file := iter.First(); file != nil; file = iter.Next() {
 			var err error
 			if file.Virtual {
-				// TODO(bananabrick): Once we have Properties for the virtual
-				// sstables, use those here.
-				panic("pebble: not implemented")
+				err = d.tableCache.withVirtualReader(
+					file.VirtualMeta(),
+					func(r sstable.VirtualReader) (err error) {
+						fileSum += file.Size
+						entryCount += r.Properties.NumEntries
+						keySum += r.Properties.RawKeySize
+						valSum += r.Properties.RawValueSize
+						return nil
+					})
 			} else {
 				err = d.tableCache.withReader(
 					file,
@@ -493,11 +527,6 @@ func (d *DB) estimateReclaimedSizeBeneath(
 		overlaps := v.Overlaps(l, d.cmp, start, end, true /* exclusiveEnd */)
 		iter := overlaps.Iter()
 		for file := iter.First(); file != nil; file = iter.Next() {
-			if file.Virtual {
-				// TODO(bananabrick): Remove this check once
-				// Reader.EstimatedDiskUsage works for virtual sstables.
-				panic("pebble: unimplemented")
-			}
 			startCmp := d.cmp(start, file.Smallest.UserKey)
 			endCmp := d.cmp(file.Largest.UserKey, end)
 			if startCmp <= 0 && (endCmp < 0 || endCmp == 0 && file.Largest.IsExclusiveSentinel()) {
@@ -554,11 +583,20 @@ func (d *DB) estimateReclaimedSizeBeneath(
 					continue
 				}
 				var size uint64
-				err := d.tableCache.withReader(
-					file, func(r *sstable.Reader) (err error) {
-						size, err = r.EstimateDiskUsage(start, end)
-						return err
-					})
+				var err error
+				if file.Virtual {
+					err = d.tableCache.withVirtualReader(
+						file.VirtualMeta(), func(r sstable.VirtualReader) (err error) {
+							size, err = r.EstimateDiskUsage(start, end)
+							return err
+						})
+				} else {
+					err = d.tableCache.withReader(
+						file, func(r *sstable.Reader) (err error) {
+							size, err = r.EstimateDiskUsage(start, end)
+							return err
+						})
+				}
 				if err != nil {
 					return 0, hintSeqNum, err
 				}
@@ -604,6 +642,11 @@ func maybeSetStatsFromProperties(meta physicalMeta, props *sstable.Properties) b
 		pointEstimate = pointDeletionsBytesEstimate(props, avgKeySize, avgValSize)
 	}
 
+	// An invalid MVCC garbage property is surfaced by the table stats
+	// collector.
+	if err := loadMVCCGarbageStats(props, meta.FileMetadata, &meta.Stats); err != nil {
+		return false
+	}
 	meta.Stats.NumEntries = props.NumEntries
 	meta.Stats.NumDeletions = props.NumDeletions
 	meta.Stats.NumRangeKeySets = props.NumRangeKeySets
@@ -791,6 +834,8 @@ func newCombinedDeletionKeyspanIter(
 
 	iter, err = r.NewRawRangeKeyIter()
 	if err != nil {
+		// Close the range deletion iterator added above, if any.
+		_ = mIter.Close()
 		return nil, err
 	}
 	if iter != nil {
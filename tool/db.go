@@ -51,6 +51,7 @@ type dbT struct {
 	start        key
 	end          key
 	count        int64
+	lsmFormat    string
 	verbose      bool
 }
 
@@ -106,6 +107,9 @@ process.
 		Long: `
 Print the structure of the LSM tree. Requires that the specified database not
 be in use by another process.
+
+With --format=json, the per-level files along with their bounds, sizes and
+sequence number ranges are printed using a stable JSON schema.
 `,
 		Args: cobra.ExactArgs(1),
 		Run:  d.runLSM,
@@ -177,6 +181,8 @@ use by another process.
 
 	d.Scan.Flags().Int64Var(
 		&d.count, "count", 0, "key count for scan (0 is unlimited)")
+	d.LSM.Flags().StringVar(
+		&d.lsmFormat, "format", "text", "output format (text or json)")
 	return d
 }
 
@@ -365,7 +371,14 @@ func (d *dbT) runLSM(cmd *cobra.Command, args []string) {
 	}
 	defer d.closeDB(stdout, db)
 
-	fmt.Fprintf(stdout, "%s", db.Metrics())
+	switch d.lsmFormat {
+	case "text":
+		fmt.Fprintf(stdout, "%s", db.Metrics())
+	case "json":
+		fmt.Fprintf(stdout, "%s\n", db.LSMView().JSON())
+	default:
+		fmt.Fprintf(stdout, "unknown format %q\n", d.lsmFormat)
+	}
 }
 
 func (d *dbT) runScan(cmd *cobra.Command, args []string) {
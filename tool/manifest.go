@@ -224,6 +224,14 @@ func (m *manifestT) runDump(cmd *cobra.Command, args []string) {
 					}
 					fmt.Fprintf(stdout, "\n")
 				}
+				for _, s := range ve.ExportedSnapshots {
+					empty = false
+					fmt.Fprintf(stdout, "  exported:      %q #%d\n", s.Name, s.SeqNum)
+				}
+				for _, name := range ve.DeletedSnapshots {
+					empty = false
+					fmt.Fprintf(stdout, "  unexported:    %q\n", name)
+				}
 				if empty {
 					// NB: An empty version edit can happen if we log a version edit with
 					// a zero field. RocksDB does this with a version edit that contains
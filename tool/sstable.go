@@ -47,6 +47,7 @@ type sstableT struct {
 	filter   key
 	count    int64
 	verbose  bool
+	blocks   bool
 }
 
 func newSSTable(
@@ -76,7 +77,9 @@ func newSSTable(
 		Short: "print sstable block and record layout",
 		Long: `
 Print the layout for the sstables. The -v flag controls whether record layout
-is displayed or omitted.
+is displayed or omitted. The --blocks flag prints the blocks' stored and
+uncompressed sizes, compression and restart counts instead, followed by the
+totals for each kind of block.
 `,
 		Args: cobra.MinimumNArgs(1),
 		Run:  s.runLayout,
@@ -122,6 +125,8 @@ inclusive-inclusive range specified by --start and --end.
 		&s.fmtKey, "key", "key formatter")
 	s.Layout.Flags().Var(
 		&s.fmtValue, "value", "value formatter")
+	s.Layout.Flags().BoolVar(
+		&s.blocks, "blocks", false, "print the physical properties of the blocks")
 	s.Scan.Flags().Var(
 		&s.fmtKey, "key", "key formatter")
 	s.Scan.Flags().Var(
@@ -254,6 +259,16 @@ func (s *sstableT) runLayout(cmd *cobra.Command, args []string) {
 		s.fmtKey.setForComparer(r.Properties.ComparerName, s.comparers)
 		s.fmtValue.setForComparer(r.Properties.ComparerName, s.comparers)
 
+		if s.blocks {
+			blocks, err := r.LayoutBlocks()
+			if err != nil {
+				fmt.Fprintf(stderr, "%s\n", err)
+				return
+			}
+			formatLayoutBlocks(stdout, blocks)
+			return
+		}
+
 		l, err := r.Layout()
 		if err != nil {
 			fmt.Fprintf(stderr, "%s\n", err)
@@ -269,6 +284,45 @@ func (s *sstableT) runLayout(cmd *cobra.Command, args []string) {
 	})
 }
 
+// formatLayoutBlocks prints the blocks, followed by the number of blocks, the
+// stored and uncompressed sizes and the compression ratio of each kind of
+// block.
+func formatLayoutBlocks(w io.Writer, blocks []sstable.LayoutBlock) {
+	type total struct {
+		name               string
+		count              int
+		length             uint64
+		uncompressedLength uint64
+	}
+	var totals []*total
+	byName := make(map[string]*total)
+	for i := range blocks {
+		b := &blocks[i]
+		fmt.Fprintf(w, "%s\n", b)
+		t := byName[b.Name]
+		if t == nil {
+			t = &total{name: b.Name}
+			byName[b.Name] = t
+			totals = append(totals, t)
+		}
+		t.count++
+		t.length += b.Length
+		t.uncompressedLength += b.UncompressedLength
+	}
+	sort.SliceStable(totals, func(i, j int) bool {
+		return totals[i].length > totals[j].length
+	})
+	fmt.Fprintf(w, "totals:\n")
+	for _, t := range totals {
+		ratio := 1.0
+		if t.length > 0 {
+			ratio = float64(t.uncompressedLength) / float64(t.length)
+		}
+		fmt.Fprintf(w, "  %s: %d blocks, %d bytes (%d uncompressed, ratio=%.2f)\n",
+			t.name, t.count, t.length, t.uncompressedLength, ratio)
+	}
+}
+
 func (s *sstableT) runProperties(cmd *cobra.Command, args []string) {
 	stdout, stderr := cmd.OutOrStdout(), cmd.OutOrStderr()
 	s.foreachSstable(stderr, args, func(arg string) {
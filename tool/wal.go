@@ -139,6 +139,13 @@ func (w *walT) runDump(cmd *cobra.Command, args []string) {
 						fmt.Fprintf(stdout, "<%d>", len(value))
 					case base.InternalKeyIngestSST:
 						fmt.Fprintf(stdout, "%s", w.fmtKey.fn(ukey))
+					case base.InternalKeyKindPrepareTxn:
+						fmt.Fprintf(stdout, "%q,<%d>", ukey, len(value))
+					case base.InternalKeyKindCommitTxn, base.InternalKeyKindRollbackTxn:
+						fmt.Fprintf(stdout, "%q", ukey)
+					case base.InternalKeyKindBatchChunk, base.InternalKeyKindCommitChunks:
+					case base.InternalKeyKindIdempotencyToken:
+						fmt.Fprintf(stdout, "%q", ukey)
 					case base.InternalKeyKindSingleDelete:
 						fmt.Fprintf(stdout, "%s", w.fmtKey.fn(ukey))
 					case base.InternalKeyKindSetWithDelete:
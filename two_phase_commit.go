@@ -0,0 +1,354 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+)
+
+// ErrTxnNotPrepared is returned by DB.CommitPrepared and DB.RollbackPrepared
+// if the transaction isn't prepared.
+var ErrTxnNotPrepared = errors.New("pebble: transaction not prepared")
+
+// ErrTxnAlreadyPrepared is returned by Batch.Prepare if a transaction with the
+// same ID is already prepared.
+var ErrTxnAlreadyPrepared = errors.New("pebble: transaction already prepared")
+
+// preparedTxn is a batch prepared by Batch.Prepare, which hasn't yet been
+// committed or rolled back.
+type preparedTxn struct {
+	// repr is the repr of the prepared batch, or nil if the prepare record of
+	// the transaction hasn't yet been written to the WAL.
+	repr []byte
+	// resolving is true while the commit or rollback record of the transaction
+	// is written to the WAL.
+	resolving bool
+}
+
+// Prepare durably records the batch in the WAL under the transaction ID
+// txnID, without applying it to the DB. The prepared batch is committed by
+// DB.CommitPrepared, or discarded by DB.RollbackPrepared. Prepared
+// transactions survive reopening the DB, and are listed by
+// DB.PreparedTransactions. Prepared transactions are meant for the
+// participants of distributed transactions, which must durably record their
+// vote before the outcome of the transaction is known.
+//
+// The batch must be created by DB.NewBatch or DB.NewIndexedBatch. It isn't
+// modified, and must be closed by the caller. Its writes aren't visible to
+// readers until the transaction is committed. Prepare is only supported if
+// the WAL is enabled, and requires a format major version of at least
+// FormatTwoPhaseCommit.
+//
+// If Prepare returns an error, the transaction may or may not have been
+// durably prepared.
+func (b *Batch) Prepare(txnID []byte, opts *WriteOptions) error {
+	if b.ingestedSSTBatch {
+		panic("pebble: invalid call to Prepare")
+	}
+	d := b.db
+	if d == nil {
+		// The DB to prepare the transaction in is only known for batches
+		// created by DB.NewBatch or DB.NewIndexedBatch.
+		return errors.New("pebble: batch not created by a DB can't be prepared")
+	}
+	if err := d.checkTwoPhaseCommit(); err != nil {
+		return err
+	}
+	if err := d.checkWriteSizeLimits(b); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	if _, ok := d.mu.preparedTxns[string(txnID)]; ok {
+		d.mu.Unlock()
+		return errors.WithDetailf(ErrTxnAlreadyPrepared, "txn: %q", txnID)
+	}
+	// Reserve the transaction ID, so that it can't be prepared concurrently.
+	d.mu.preparedTxns[string(txnID)] = &preparedTxn{}
+	d.mu.Unlock()
+
+	marker := newBatch(d)
+	marker.prepareTxn(txnID, b.Repr())
+	err := d.Apply(marker, opts)
+	marker.Close()
+	if err != nil {
+		d.mu.Lock()
+		if t := d.mu.preparedTxns[string(txnID)]; t != nil && t.repr == nil {
+			delete(d.mu.preparedTxns, string(txnID))
+		}
+		d.mu.Unlock()
+	}
+	return err
+}
+
+// CommitPrepared applies the batch prepared by Batch.Prepare under the
+// transaction ID txnID. The commit is atomic with the application of the
+// batch: once it's durable, the transaction is no longer prepared after
+// reopening the DB. ErrTxnNotPrepared is returned if the transaction isn't
+// prepared.
+func (d *DB) CommitPrepared(txnID []byte, opts *WriteOptions) error {
+	repr, err := d.resolvePreparedTxn(txnID)
+	if err != nil {
+		return err
+	}
+	b := newBatch(d)
+	defer b.Close()
+	b.commitTxn(txnID)
+	prepared := &Batch{}
+	if err := prepared.SetRepr(repr); err != nil {
+		d.unresolvePreparedTxn(txnID, repr)
+		return err
+	}
+	if err := b.Apply(prepared, nil); err != nil {
+		d.unresolvePreparedTxn(txnID, repr)
+		return err
+	}
+	if err := d.Apply(b, opts); err != nil {
+		d.unresolvePreparedTxn(txnID, repr)
+		return err
+	}
+	return nil
+}
+
+// RollbackPrepared discards the batch prepared by Batch.Prepare under the
+// transaction ID txnID. ErrTxnNotPrepared is returned if the transaction isn't
+// prepared.
+func (d *DB) RollbackPrepared(txnID []byte, opts *WriteOptions) error {
+	repr, err := d.resolvePreparedTxn(txnID)
+	if err != nil {
+		return err
+	}
+	b := newBatch(d)
+	defer b.Close()
+	b.rollbackTxn(txnID)
+	if err := d.Apply(b, opts); err != nil {
+		d.unresolvePreparedTxn(txnID, repr)
+		return err
+	}
+	return nil
+}
+
+// PreparedTransactions returns the IDs of the transactions prepared by
+// Batch.Prepare which haven't yet been committed or rolled back, in
+// lexicographic order. After reopening the DB, these are the transactions
+// whose prepare is durable, and which must be resolved.
+func (d *DB) PreparedTransactions() [][]byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	txnIDs := make([][]byte, 0, len(d.mu.preparedTxns))
+	for txnID, t := range d.mu.preparedTxns {
+		if t.repr != nil {
+			txnIDs = append(txnIDs, []byte(txnID))
+		}
+	}
+	sort.Slice(txnIDs, func(i, j int) bool {
+		return bytes.Compare(txnIDs[i], txnIDs[j]) < 0
+	})
+	return txnIDs
+}
+
+func (d *DB) checkTwoPhaseCommit() error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if d.opts.DisableWAL {
+		return errors.New("pebble: two-phase commit requires the WAL")
+	}
+	if v := d.FormatMajorVersion(); v < FormatTwoPhaseCommit {
+		return errors.Newf(
+			"pebble: database has format major version %d; two-phase commit requires at least %d",
+			errors.Safe(v), errors.Safe(FormatTwoPhaseCommit),
+		)
+	}
+	return nil
+}
+
+// resolvePreparedTxn marks the prepared transaction txnID as being committed
+// or rolled back, and returns the repr of its batch.
+func (d *DB) resolvePreparedTxn(txnID []byte) ([]byte, error) {
+	if err := d.checkTwoPhaseCommit(); err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t := d.mu.preparedTxns[string(txnID)]
+	if t == nil || t.repr == nil || t.resolving {
+		return nil, errors.WithDetailf(ErrTxnNotPrepared, "txn: %q", txnID)
+	}
+	t.resolving = true
+	return t.repr, nil
+}
+
+// unresolvePreparedTxn restores the prepared transaction txnID after failing
+// to commit or roll it back.
+func (d *DB) unresolvePreparedTxn(txnID []byte, repr []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if t := d.mu.preparedTxns[string(txnID)]; t != nil {
+		t.resolving = false
+		return
+	}
+	d.mu.preparedTxns[string(txnID)] = &preparedTxn{repr: repr}
+}
+
+// applyTxnMarkerLocked updates the prepared transactions according to the
+// two-phase commit marker beginning the batch b, if any. It's called once b
+// is written to the WAL, and during WAL replay.
+//
+// d.mu must be held when calling this.
+func (d *DB) applyTxnMarkerLocked(b *Batch) {
+	if len(b.data) <= batchHeaderLen {
+		return
+	}
+	r := b.Reader()
+	kind, txnID, value, ok := r.Next()
+	if !ok {
+		return
+	}
+	switch kind {
+	case InternalKeyKindPrepareTxn:
+		d.mu.preparedTxns[string(txnID)] = &preparedTxn{
+			repr: append([]byte(nil), value...),
+		}
+	case InternalKeyKindCommitTxn, InternalKeyKindRollbackTxn:
+		delete(d.mu.preparedTxns, string(txnID))
+	}
+}
+
+// preparedTxnRecordsLocked returns the WAL records preparing the transactions
+// which are currently prepared, with the sequence number seqNum.
+//
+// d.mu must be held when calling this.
+func (d *DB) preparedTxnRecordsLocked(seqNum uint64) [][]byte {
+	var records [][]byte
+	for txnID, t := range d.mu.preparedTxns {
+		if t.repr == nil {
+			// The prepare record is yet to be written.
+			continue
+		}
+		var b Batch
+		b.prepareTxn([]byte(txnID), t.repr)
+		b.setSeqNum(seqNum)
+		records = append(records, b.Repr())
+	}
+	return records
+}
+
+// carriedOverSync is the pending sync of the records written to a new WAL by
+// logCarriedOverRecordsLocked.
+type carriedOverSync struct {
+	// logNum is the number of the WAL the records were written to.
+	logNum FileNum
+	wg     sync.WaitGroup
+	err    error
+}
+
+// logCarriedOverRecordsLocked writes the prepare records of the prepared
+// transactions and the retained idempotency tokens to the new WAL, and queues
+// its sync. A prepare record or a token must survive the deletion of the WAL
+// it was written to once the WAL's memtables are flushed, so every new WAL
+// begins with the prepare records of the transactions that are still
+// prepared, and with the tokens that are retained. The records have the
+// sequence number seqNum, which must be the creation sequence number of the
+// WAL's memtable.
+//
+// The sync isn't waited for, as the WAL is rotated with DB.mu held. Instead,
+// a flush waits for the syncs of the records carried over from the WALs it
+// obsoletes (see waitCarriedOverSyncsLocked).
+//
+// Both DB.mu and commitPipeline.mu must be held by the caller, so that the
+// records are written before any later commit or rollback record. An error is
+// only returned if the DB transitioned into read-only mode after running out
+// of disk space.
+func (d *DB) logCarriedOverRecordsLocked(seqNum uint64) error {
+	records := d.preparedTxnRecordsLocked(seqNum)
+	if r := d.idempotencyTokensRecordLocked(seqNum); r != nil {
+		records = append(records, r)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	s := &carriedOverSync{logNum: d.mu.log.logNum}
+	s.wg.Add(1)
+	if _, err := d.writeRecords(&d.mu.log.walWriter, records, &s.wg, &s.err); err != nil {
+		if err := d.handleDiskFull(err); err != nil {
+			return err
+		}
+		panic(err)
+	}
+	d.mu.log.carriedOverSyncs = append(d.mu.log.carriedOverSyncs, s)
+	return nil
+}
+
+// waitCarriedOverSyncsLocked waits for the syncs of the records carried over
+// to the WALs numbered below or at logNum, which must be durable before the
+// WALs preceding logNum are obsoleted. DB.mu is released while waiting.
+//
+// d.mu must be held when calling this.
+func (d *DB) waitCarriedOverSyncsLocked(logNum FileNum) error {
+	syncs := d.mu.log.carriedOverSyncs
+	var n int
+	for n < len(syncs) && syncs[n].logNum <= logNum {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	d.mu.Unlock()
+	var err error
+	for _, s := range syncs[:n] {
+		s.wg.Wait()
+		err = firstError(err, s.err)
+	}
+	d.mu.Lock()
+	if err != nil {
+		// The WALs can't be obsoleted.
+		return err
+	}
+	// Flushes are serialized, so the syncs are still at the front.
+	d.mu.log.carriedOverSyncs = d.mu.log.carriedOverSyncs[n:]
+	return nil
+}
+
+// writeAndSyncRecords writes the records to the WAL, syncing it once the last
+// record is written, and returns the WAL's size.
+func (d *DB) writeAndSyncRecords(w *walWriter, records [][]byte) (int64, error) {
+	var syncWG sync.WaitGroup
+	var syncErr error
+	syncWG.Add(1)
+	size, err := d.writeRecords(w, records, &syncWG, &syncErr)
+	if err != nil {
+		return 0, err
+	}
+	syncWG.Wait()
+	return size, syncErr
+}
+
+// writeRecords writes the records to the WAL, and queues a sync once the last
+// record is written, calling syncWG.Done once it completes. It returns the
+// WAL's size.
+func (d *DB) writeRecords(
+	w *walWriter, records [][]byte, syncWG *sync.WaitGroup, syncErr *error,
+) (int64, error) {
+	for _, r := range records[:len(records)-1] {
+		if _, err := w.WriteRecord(r); err != nil {
+			return 0, err
+		}
+	}
+	d.commit.logSyncQSem <- struct{}{}
+	size, err := w.SyncRecord(records[len(records)-1], syncWG, syncErr)
+	if err != nil {
+		<-d.commit.logSyncQSem
+		return 0, err
+	}
+	return size, nil
+}
@@ -0,0 +1,212 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwoPhaseCommit(t *testing.T) {
+	mem := vfs.NewMem()
+	open := func() *DB {
+		d, err := Open("", &Options{
+			FS:                 mem,
+			FormatMajorVersion: FormatTwoPhaseCommit,
+		})
+		require.NoError(t, err)
+		return d
+	}
+	get := func(d *DB, key string) string {
+		v, closer, err := d.Get([]byte(key))
+		if errors.Is(err, ErrNotFound) {
+			return "<not found>"
+		}
+		require.NoError(t, err)
+		defer closer.Close()
+		return string(v)
+	}
+	prepare := func(d *DB, txnID string, kvs ...string) error {
+		b := d.NewBatch()
+		defer b.Close()
+		for i := 0; i < len(kvs); i += 2 {
+			require.NoError(t, b.Set([]byte(kvs[i]), []byte(kvs[i+1]), nil))
+		}
+		return b.Prepare([]byte(txnID), Sync)
+	}
+	txnIDs := func(d *DB) []string {
+		var ids []string
+		for _, id := range d.PreparedTransactions() {
+			ids = append(ids, string(id))
+		}
+		return ids
+	}
+
+	d := open()
+	require.NoError(t, prepare(d, "t1", "a", "1", "b", "1"))
+	require.NoError(t, prepare(d, "t2", "c", "2"))
+	require.NoError(t, prepare(d, "t3", "d", "3"))
+	require.True(t, errors.Is(prepare(d, "t1", "a", "2"), ErrTxnAlreadyPrepared))
+	require.Equal(t, []string{"t1", "t2", "t3"}, txnIDs(d))
+
+	// Prepared writes aren't visible.
+	require.Equal(t, "<not found>", get(d, "a"))
+	require.Equal(t, "<not found>", get(d, "c"))
+
+	// Prepared transactions survive reopening the DB.
+	require.NoError(t, d.Close())
+	d = open()
+	require.Equal(t, []string{"t1", "t2", "t3"}, txnIDs(d))
+
+	require.NoError(t, d.CommitPrepared([]byte("t1"), Sync))
+	require.NoError(t, d.RollbackPrepared([]byte("t2"), Sync))
+	require.True(t, errors.Is(d.CommitPrepared([]byte("t1"), Sync), ErrTxnNotPrepared))
+	require.True(t, errors.Is(d.RollbackPrepared([]byte("t4"), Sync), ErrTxnNotPrepared))
+	require.Equal(t, []string{"t3"}, txnIDs(d))
+	require.Equal(t, "1", get(d, "a"))
+	require.Equal(t, "1", get(d, "b"))
+	require.Equal(t, "<not found>", get(d, "c"))
+
+	// Prepared transactions survive the deletion of the WAL they were
+	// prepared in.
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("e"), []byte("5"), Sync))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Close())
+	d = open()
+	require.Equal(t, []string{"t3"}, txnIDs(d))
+	require.Equal(t, "1", get(d, "a"))
+	require.Equal(t, "5", get(d, "e"))
+
+	// A transaction's ID may be reused once it's resolved.
+	require.NoError(t, prepare(d, "t1", "a", "2"))
+	require.NoError(t, d.CommitPrepared([]byte("t3"), Sync))
+	require.NoError(t, d.Close())
+	d = open()
+	require.Equal(t, []string{"t1"}, txnIDs(d))
+	require.Equal(t, "1", get(d, "a"))
+	require.Equal(t, "3", get(d, "d"))
+	require.NoError(t, d.CommitPrepared([]byte("t1"), Sync))
+	require.Equal(t, "2", get(d, "a"))
+	require.NoError(t, d.Close())
+
+	d = open()
+	require.Empty(t, txnIDs(d))
+	require.Equal(t, "2", get(d, "a"))
+	require.NoError(t, d.Close())
+}
+
+func TestTwoPhaseCommitFormatMajorVersion(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                 vfs.NewMem(),
+		FormatMajorVersion: FormatVirtualSSTables,
+	})
+	require.NoError(t, err)
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("a"), []byte("1"), nil))
+	require.Error(t, b.Prepare([]byte("t1"), Sync))
+	require.NoError(t, b.Close())
+	require.Empty(t, d.PreparedTransactions())
+	require.NoError(t, d.Close())
+}
+
+func TestTwoPhaseCommitBatchWithoutDB(t *testing.T) {
+	var b Batch
+	require.NoError(t, b.Set([]byte("a"), []byte("1"), nil))
+	require.Error(t, b.Prepare([]byte("t1"), Sync))
+}
+
+// walSyncBlockingFS blocks the syncs of the WALs created while unblock is set,
+// until unblock is closed.
+type walSyncBlockingFS struct {
+	vfs.FS
+	mu      sync.Mutex
+	unblock chan struct{}
+}
+
+func (fs *walSyncBlockingFS) wrap(name string, f vfs.File) vfs.File {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.unblock == nil || !strings.HasSuffix(name, ".log") {
+		return f
+	}
+	return walSyncBlockingFile{File: f, unblock: fs.unblock}
+}
+
+func (fs *walSyncBlockingFS) Create(name string) (vfs.File, error) {
+	f, err := fs.FS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.wrap(name, f), nil
+}
+
+func (fs *walSyncBlockingFS) ReuseForWrite(oldname, newname string) (vfs.File, error) {
+	f, err := fs.FS.ReuseForWrite(oldname, newname)
+	if err != nil {
+		return nil, err
+	}
+	return fs.wrap(newname, f), nil
+}
+
+type walSyncBlockingFile struct {
+	vfs.File
+	unblock chan struct{}
+}
+
+func (f walSyncBlockingFile) Sync() error {
+	<-f.unblock
+	return f.File.Sync()
+}
+
+func (f walSyncBlockingFile) SyncData() error {
+	<-f.unblock
+	return f.File.SyncData()
+}
+
+func TestTwoPhaseCommitCarriedOverSync(t *testing.T) {
+	fs := &walSyncBlockingFS{FS: vfs.NewMem()}
+	opts := &Options{
+		FS:                 fs,
+		FormatMajorVersion: FormatTwoPhaseCommit,
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, b.Prepare([]byte("t1"), Sync))
+	require.NoError(t, b.Close())
+
+	// Rotating the WAL doesn't wait for the sync of the prepare record carried
+	// over to the new WAL.
+	unblock := make(chan struct{})
+	fs.mu.Lock()
+	fs.unblock = unblock
+	fs.mu.Unlock()
+	flushed, err := d.AsyncFlush()
+	require.NoError(t, err)
+
+	// But the flush obsoleting the previous WAL does.
+	select {
+	case <-flushed:
+		t.Fatal("flush completed before the carried over records were synced")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(unblock)
+	<-flushed
+	require.NoError(t, d.Close())
+
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("t1")}, d.PreparedTransactions())
+	require.NoError(t, d.CommitPrepared([]byte("t1"), Sync))
+	require.NoError(t, d.Close())
+}
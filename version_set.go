@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"sort"
 	"sync"
 	"sync/atomic"
 
@@ -29,8 +30,10 @@ const manifestMarkerName = `manifest`
 // Provide type aliases for the various manifest structs.
 type bulkVersionEdit = manifest.BulkVersionEdit
 type deletedFileEntry = manifest.DeletedFileEntry
+type exportedSnapshot = manifest.ExportedSnapshot
 type fileMetadata = manifest.FileMetadata
 type physicalMeta = manifest.PhysicalFileMeta
+type virtualMeta = manifest.VirtualFileMeta
 type fileBacking = manifest.FileBacking
 type newFileEntry = manifest.NewFileEntry
 type version = manifest.Version
@@ -106,6 +109,13 @@ type versionSet struct {
 	// load.
 	fileBackingMap map[FileNum]*fileBacking
 
+	// exportedSnapshots maps the names of the snapshots exported by
+	// Snapshot.Export to their sequence numbers. The exported snapshots are
+	// recorded in the manifest, and included in the snapshot version edit
+	// beginning every new manifest. exportedSnapshots is protected by the
+	// versionSet.logLock.
+	exportedSnapshots map[string]uint64
+
 	// minUnflushedLogNum is the smallest WAL log file number corresponding to
 	// mutations that have not been flushed to an sstable.
 	minUnflushedLogNum FileNum
@@ -147,6 +157,7 @@ func (vs *versionSet) init(
 	vs.obsoleteFn = vs.addObsoleteLocked
 	vs.zombieTables = make(map[FileNum]uint64)
 	vs.fileBackingMap = make(map[FileNum]*fileBacking)
+	vs.exportedSnapshots = make(map[string]uint64)
 	vs.nextFileNum = 1
 	vs.manifestMarker = marker
 	vs.setCurrent = setCurrent
@@ -230,13 +241,14 @@ func (vs *versionSet) load(
 	defer manifest.Close()
 	rr := record.NewReader(manifest, 0 /* logNum */)
 	for {
+		offset := rr.Offset()
 		r, err := rr.Next()
 		if err == io.EOF || record.IsInvalidRecord(err) {
 			break
 		}
 		if err != nil {
-			return errors.Wrapf(err, "pebble: error when loading manifest file %q",
-				errors.Safe(manifestFilename))
+			return errors.Wrapf(base.MarkTransientIOError(err),
+				"pebble: error when loading manifest file %q", errors.Safe(manifestFilename))
 		}
 		var ve versionEdit
 		err = ve.Decode(r)
@@ -246,6 +258,9 @@ func (vs *versionSet) load(
 			if err == io.EOF || record.IsInvalidRecord(err) {
 				break
 			}
+			if errors.Is(err, base.ErrCorruption) {
+				err = base.MarkCorruptionErrorAt(err, base.FileTypeManifest, vs.manifestFileNum, offset)
+			}
 			return err
 		}
 		if ve.ComparerName != "" {
@@ -256,8 +271,12 @@ func (vs *versionSet) load(
 			}
 		}
 		if err := bve.Accumulate(&ve); err != nil {
+			if errors.Is(err, base.ErrCorruption) {
+				err = base.MarkCorruptionErrorAt(err, base.FileTypeManifest, vs.manifestFileNum, offset)
+			}
 			return err
 		}
+		vs.applyExportedSnapshots(&ve)
 		if ve.MinUnflushedLogNum != 0 {
 			vs.minUnflushedLogNum = ve.MinUnflushedLogNum
 		}
@@ -286,7 +305,8 @@ func (vs *versionSet) load(
 			// minUnflushedLogNum, even if WALs with non-zero file numbers are
 			// present in the directory.
 		} else {
-			return base.CorruptionErrorf("pebble: malformed manifest file %q for DB %q",
+			return base.CorruptionErrorAtf(
+				base.FileTypeManifest, vs.manifestFileNum, -1 /* offset */, "pebble: malformed manifest file %q for DB %q",
 				errors.Safe(manifestFilename), dirname)
 		}
 	}
@@ -571,6 +591,7 @@ func (vs *versionSet) logAndApply(
 
 	// Install the new version.
 	vs.append(newVersion)
+	vs.applyExportedSnapshots(ve)
 	if ve.MinUnflushedLogNum != 0 {
 		vs.minUnflushedLogNum = ve.MinUnflushedLogNum
 	}
@@ -698,6 +719,16 @@ func (vs *versionSet) createManifest(
 		}
 	}
 
+	for name, seqNum := range vs.exportedSnapshots {
+		snapshot.ExportedSnapshots = append(snapshot.ExportedSnapshots, exportedSnapshot{
+			Name:   name,
+			SeqNum: seqNum,
+		})
+	}
+	sort.Slice(snapshot.ExportedSnapshots, func(i, j int) bool {
+		return snapshot.ExportedSnapshots[i].Name < snapshot.ExportedSnapshots[j].Name
+	})
+
 	// When creating a version snapshot for an existing DB, this snapshot VersionEdit will be
 	// immediately followed by another VersionEdit (being written in logAndApply()). That
 	// VersionEdit always contains a LastSeqNum, so we don't need to include that in the snapshot.
@@ -731,6 +762,17 @@ func (vs *versionSet) createManifest(
 	return nil
 }
 
+// applyExportedSnapshots applies the exported snapshots added and deleted by
+// the version edit ve.
+func (vs *versionSet) applyExportedSnapshots(ve *versionEdit) {
+	for _, name := range ve.DeletedSnapshots {
+		delete(vs.exportedSnapshots, name)
+	}
+	for _, s := range ve.ExportedSnapshots {
+		vs.exportedSnapshots[s.Name] = s.SeqNum
+	}
+}
+
 func (vs *versionSet) markFileNumUsed(fileNum FileNum) {
 	if vs.nextFileNum <= fileNum {
 		vs.nextFileNum = fileNum + 1
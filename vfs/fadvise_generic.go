@@ -14,3 +14,7 @@ func fadviseRandom(f uintptr) error {
 func fadviseSequential(f uintptr) error {
 	return nil
 }
+
+func fadviseDontNeed(f uintptr, offset, length int64) error {
+	return nil
+}
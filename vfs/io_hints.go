@@ -0,0 +1,69 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package vfs
+
+import "fmt"
+
+// IOPriority is a hint of the priority of the I/O issued by a goroutine,
+// relative to the I/O of the rest of the process. It's a hint: it's ignored
+// where the platform doesn't support it.
+type IOPriority int8
+
+const (
+	// IOPriorityDefault leaves the I/O at the priority of the process.
+	IOPriorityDefault IOPriority = iota
+	// IOPriorityLow is the lowest priority level of the best-effort class on
+	// Linux (the equivalent of `ionice -c2 -n7`): the I/O is served after the
+	// I/O of higher priority levels, while still making progress under load.
+	IOPriorityLow
+	// IOPriorityIdle is the idle class on Linux (the equivalent of `ionice
+	// -c3`): the I/O is only served when the device has no other I/O. It can
+	// starve under a sustained foreground load.
+	IOPriorityIdle
+)
+
+// String implements fmt.Stringer.
+func (p IOPriority) String() string {
+	switch p {
+	case IOPriorityDefault:
+		return "default"
+	case IOPriorityLow:
+		return "low"
+	case IOPriorityIdle:
+		return "idle"
+	default:
+		return fmt.Sprintf("IOPriority(%d)", int8(p))
+	}
+}
+
+// WithIOPriority calls fn with the I/O issued by the calling goroutine hinted
+// at the priority p. On Linux, the goroutine is locked to its OS thread while
+// fn runs, and the I/O priority of the thread is set with ioprio_set(2) and
+// restored before WithIOPriority returns. Only the I/O issued by the calling
+// goroutine is affected, and not that of the goroutines that fn starts.
+//
+// Note that the I/O scheduler of the device must support priorities (e.g.
+// BFQ) for the hint to have an effect on the device, and that the I/O
+// written back from the page cache isn't attributed to the thread.
+func WithIOPriority(p IOPriority, fn func()) {
+	if p == IOPriorityDefault {
+		fn()
+		return
+	}
+	withIOPriority(p, fn)
+}
+
+// DropFromPageCache hints that the byte range [offset, offset+length) of the
+// file won't be read again soon, so that its pages may be dropped from the
+// page cache, by calling fadvise() with POSIX_FADV_DONTNEED on Linux systems.
+// A length of zero extends the range to the end of the file. Dirty pages
+// aren't dropped until they're written back, so the data written to the file
+// should be synced first.
+func DropFromPageCache(f File, offset, length int64) error {
+	if fd := f.Fd(); fd != InvalidFd {
+		return fadviseDontNeed(fd, offset, length)
+	}
+	return nil
+}
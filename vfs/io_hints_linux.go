@@ -0,0 +1,53 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package vfs
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// The constants of ioprio_set(2), from include/uapi/linux/ioprio.h.
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+)
+
+func ioprio(p IOPriority) uintptr {
+	switch p {
+	case IOPriorityLow:
+		return ioprioClassBE<<ioprioClassShift | 7
+	case IOPriorityIdle:
+		return ioprioClassIdle << ioprioClassShift
+	default:
+		return 0
+	}
+}
+
+func withIOPriority(p IOPriority, fn func()) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	// A who of 0 designates the calling thread.
+	prev, _, errno := unix.Syscall(unix.SYS_IOPRIO_GET, ioprioWhoProcess, 0, 0)
+	if errno != 0 {
+		fn()
+		return
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0, ioprio(p)); errno != 0 {
+		fn()
+		return
+	}
+	defer func() {
+		_, _, _ = unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0, prev)
+	}()
+	fn()
+}
@@ -0,0 +1,55 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package vfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestWithIOPriority(t *testing.T) {
+	get := func() uintptr {
+		prio, _, errno := unix.Syscall(unix.SYS_IOPRIO_GET, ioprioWhoProcess, 0, 0)
+		if errno != 0 {
+			t.Skipf("ioprio_get: %s", errno)
+		}
+		return prio
+	}
+
+	before := get()
+	for _, p := range []IOPriority{IOPriorityLow, IOPriorityIdle} {
+		t.Run(p.String(), func(t *testing.T) {
+			var during uintptr
+			WithIOPriority(p, func() { during = get() })
+			require.Equal(t, ioprio(p), during)
+		})
+	}
+	WithIOPriority(IOPriorityDefault, func() { require.Equal(t, before, get()) })
+}
+
+func TestDropFromPageCache(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(name, make([]byte, 1<<20), 0644))
+	f, err := Default.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, f.Sync())
+	require.NoError(t, DropFromPageCache(f, 0, 0))
+	require.NoError(t, DropFromPageCache(f, 4096, 8192))
+
+	// Files without a file descriptor are ignored.
+	mem := NewMem()
+	mf, err := mem.Create("file")
+	require.NoError(t, err)
+	defer mf.Close()
+	require.NoError(t, DropFromPageCache(mf, 0, 0))
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/record"
+)
+
+// walEncryptionHeader is the first record of a WAL whose records are
+// encrypted (see Options.Experimental.WALCipher). It can't be mistaken for a
+// batch, as it isn't a valid batch: it has a count of zero, followed by an
+// invalid key kind.
+var walEncryptionHeader = []byte("pebbleEW\x00\x00\x00\x00aead")
+
+// The records of an encrypted WAL that follow the header are sealed by
+// Options.Experimental.WALCipher with a random nonce, which is prepended to
+// the sealed record. The additional data authenticated along with a record is
+// the WAL's file number and the index of the record among the sealed records
+// of the WAL, so that a record can't be replayed out of order, or into another
+// WAL, without failing its authentication.
+const walRecordADLen = 16
+
+func walRecordAD(ad *[walRecordADLen]byte, logNum FileNum, index uint64) []byte {
+	binary.LittleEndian.PutUint64(ad[:8], uint64(logNum))
+	binary.LittleEndian.PutUint64(ad[8:], index)
+	return ad[:]
+}
+
+// walNonceBatch is the number of nonces read at once from the random source.
+const walNonceBatch = 256
+
+// walWriter writes the records of the current WAL, sealing them if
+// Options.Experimental.WALCipher is set. Like the LogWriter, it's protected by
+// commitPipeline.mu.
+type walWriter struct {
+	*record.LogWriter
+
+	aead   cipher.AEAD
+	logNum FileNum
+	// index is the index of the next sealed record of the WAL.
+	index uint64
+	// nonces holds random bytes for the nonces of the next records.
+	nonces []byte
+	buf    []byte
+}
+
+// writeWALHeader writes the header of a new WAL, and waits for it to be synced,
+// if the records of the WAL are sealed. It must be called before the WAL's
+// LogWriter is installed, so that the DB never writes to an encrypted WAL
+// without its header.
+func (d *DB) writeWALHeader(w *record.LogWriter) error {
+	if d.opts.Experimental.WALCipher == nil {
+		return nil
+	}
+	_, err := d.writeAndSyncRecords(&walWriter{LogWriter: w}, [][]byte{walEncryptionHeader})
+	return err
+}
+
+// startLog must be called once the LogWriter of a new WAL, whose header was
+// written by writeWALHeader, is set.
+func (w *walWriter) startLog(aead cipher.AEAD, logNum FileNum) {
+	w.aead = aead
+	w.logNum = logNum
+	w.index = 0
+}
+
+// seal returns the sealed record p, which is valid until the next call.
+func (w *walWriter) seal(p []byte) ([]byte, error) {
+	nonceSize := w.aead.NonceSize()
+	if len(w.nonces) < nonceSize {
+		w.nonces = make([]byte, walNonceBatch*nonceSize)
+		if _, err := io.ReadFull(rand.Reader, w.nonces); err != nil {
+			return nil, errors.Wrap(err, "pebble: generating WAL nonces")
+		}
+	}
+	nonce := w.nonces[:nonceSize]
+	w.nonces = w.nonces[nonceSize:]
+
+	var ad [walRecordADLen]byte
+	w.buf = append(w.buf[:0], nonce...)
+	w.buf = w.aead.Seal(w.buf, nonce, p, walRecordAD(&ad, w.logNum, w.index))
+	w.index++
+	return w.buf, nil
+}
+
+// WriteRecord is like record.LogWriter.WriteRecord, but seals the record if
+// the WAL is encrypted.
+func (w *walWriter) WriteRecord(p []byte) (int64, error) {
+	return w.SyncRecord(p, nil, nil)
+}
+
+// SyncRecord is like record.LogWriter.SyncRecord, but seals the record if the
+// WAL is encrypted.
+func (w *walWriter) SyncRecord(p []byte, wg *sync.WaitGroup, err *error) (int64, error) {
+	if w.aead != nil {
+		var sealErr error
+		if p, sealErr = w.seal(p); sealErr != nil {
+			return -1, sealErr
+		}
+	}
+	return w.LogWriter.SyncRecord(p, wg, err)
+}
+
+// walDecrypter opens the records of an encrypted WAL being replayed.
+type walDecrypter struct {
+	aead   cipher.AEAD
+	logNum FileNum
+	index  uint64
+	buf    []byte
+}
+
+// maybeStartDecryption returns a walDecrypter if the record is the header of an
+// encrypted WAL, or nil if it's the first record of a WAL that isn't
+// encrypted. A WAL that isn't encrypted is only replayed without
+// Options.Experimental.WALCipher set, or with
+// Options.Experimental.AllowUnencryptedWALs: its records aren't authenticated,
+// so it could otherwise be substituted for an encrypted WAL.
+func maybeStartDecryption(opts *Options, logNum FileNum, r []byte) (*walDecrypter, error) {
+	if !bytes.Equal(r, walEncryptionHeader) {
+		if opts.Experimental.WALCipher != nil && !opts.Experimental.AllowUnencryptedWALs {
+			return nil, base.CorruptionErrorf("pebble: WAL %s isn't encrypted, but Options.Experimental.WALCipher is set",
+				errors.Safe(logNum))
+		}
+		return nil, nil
+	}
+	if opts.Experimental.WALCipher == nil {
+		return nil, errors.Errorf("pebble: WAL %s is encrypted, but Options.Experimental.WALCipher isn't set",
+			errors.Safe(logNum))
+	}
+	return &walDecrypter{aead: opts.Experimental.WALCipher, logNum: logNum}, nil
+}
+
+// open returns the record opened from the sealed record r, which is valid until
+// the next call.
+func (d *walDecrypter) open(r []byte) ([]byte, error) {
+	nonceSize := d.aead.NonceSize()
+	if len(r) < nonceSize {
+		return nil, base.CorruptionErrorf("pebble: WAL %s: sealed record %d is too short",
+			errors.Safe(d.logNum), errors.Safe(d.index))
+	}
+	var ad [walRecordADLen]byte
+	var err error
+	d.buf, err = d.aead.Open(d.buf[:0], r[:nonceSize], r[nonceSize:], walRecordAD(&ad, d.logNum, d.index))
+	if err != nil {
+		return nil, base.CorruptionErrorf("pebble: WAL %s: sealed record %d failed authentication: %v",
+			errors.Safe(d.logNum), errors.Safe(d.index), err)
+	}
+	d.index++
+	return d.buf, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWALCipher(t *testing.T, key byte) cipher.AEAD {
+	block, err := aes.NewCipher(bytes.Repeat([]byte{key}, 32))
+	require.NoError(t, err)
+	aead, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	return aead
+}
+
+func TestWALEncryption(t *testing.T) {
+	mem := vfs.NewMem()
+	var allowUnencrypted bool
+	open := func(aead cipher.AEAD) (*DB, error) {
+		opts := &Options{FS: mem}
+		opts.Experimental.WALCipher = aead
+		opts.Experimental.AllowUnencryptedWALs = allowUnencrypted
+		return Open("", opts)
+	}
+	get := func(d *DB, key string) string {
+		v, closer, err := d.Get([]byte(key))
+		if errors.Is(err, ErrNotFound) {
+			return "<not found>"
+		}
+		require.NoError(t, err)
+		defer closer.Close()
+		return string(v)
+	}
+	walContains := func(s string) bool {
+		ls, err := mem.List("")
+		require.NoError(t, err)
+		found := false
+		for _, name := range ls {
+			if ft, _, ok := base.ParseFilename(mem, name); !ok || ft != fileTypeLog {
+				continue
+			}
+			f, err := mem.Open(name)
+			require.NoError(t, err)
+			data, err := io.ReadAll(f)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+			found = found || bytes.Contains(data, []byte(s))
+		}
+		return found
+	}
+
+	// Write without encryption, and then enable it: the WAL written without
+	// encryption is only replayed if allowed, as its records aren't
+	// authenticated.
+	d, err := open(nil)
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("a"), []byte("plaintext-value"), nil))
+	require.NoError(t, d.Close())
+	require.True(t, walContains("plaintext-value"))
+
+	aead := newTestWALCipher(t, 1)
+	_, err = open(aead)
+	require.True(t, errors.Is(err, base.ErrCorruption))
+	require.Contains(t, err.Error(), "isn't encrypted")
+
+	allowUnencrypted = true
+	d, err = open(aead)
+	require.NoError(t, err)
+	allowUnencrypted = false
+	require.Equal(t, "plaintext-value", get(d, "a"))
+	require.NoError(t, d.Flush())
+	b := d.NewBatch()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, b.Set([]byte(fmt.Sprintf("k%03d", i)), []byte(fmt.Sprintf("secret-value-%03d", i)), nil))
+	}
+	require.NoError(t, b.Commit(Sync))
+	require.NoError(t, d.Set([]byte("b"), []byte("secret-value-b"), Sync))
+	require.NoError(t, d.Delete([]byte("k000"), Sync))
+	require.NoError(t, d.Close())
+	require.False(t, walContains("secret-value"))
+
+	// Replaying the encrypted WAL requires the cipher, with the same key.
+	_, err = open(nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "WALCipher isn't set")
+	_, err = open(newTestWALCipher(t, 2))
+	require.Error(t, err)
+	require.True(t, errors.Is(err, base.ErrCorruption))
+	var ce *CorruptionError
+	require.True(t, errors.As(err, &ce))
+	require.Equal(t, base.FileTypeLog, ce.FileType)
+
+	d, err = open(aead)
+	require.NoError(t, err)
+	require.Equal(t, "<not found>", get(d, "k000"))
+	require.Equal(t, "secret-value-042", get(d, "k042"))
+	require.Equal(t, "secret-value-b", get(d, "b"))
+	require.NoError(t, d.Close())
+}